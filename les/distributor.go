@@ -30,9 +30,11 @@ var ErrNoPeers = errors.New("no suitable peers available")
 
 // requestDistributor implements a mechanism that distributes requests to
 // suitable peers, obeying flow control rules and prioritizing them in creation
-// order (even when a resend is necessary).
+// order (even when a resend is necessary). Interactive requests are prioritized
+// over bulk ones that haven't been waiting for distMaxBulkDelay yet.
 type requestDistributor struct {
 	reqQueue         *list.List
+	interactive      int // number of queued interactive requests
 	lastReqOrder     uint64
 	peers            map[distPeer]struct{}
 	peerLock         sync.RWMutex
@@ -61,15 +63,35 @@ type distPeer interface {
 // block until it is sent because other peers might still be able to receive requests while
 // one of them is blocking. Instead, the returned function is put in the peer's send queue.
 type distReq struct {
-	getCost func(distPeer) uint64
-	canSend func(distPeer) bool
-	request func(distPeer) func()
+	getCost   func(distPeer) uint64
+	canSend   func(distPeer) bool
+	request   func(distPeer) func()
+	preferred func(distPeer) bool // optional, peer to choose if it can be sent to without waiting
+
+	interactive bool // blocking a user visible operation, see light.WithInteractive
 
 	reqOrder uint64
+	created  time.Time
 	sentChn  chan distPeer
 	element  *list.Element
 }
 
+// before tells whether request r should be sent before o. Interactive requests
+// go ahead of bulk ones, unless the bulk one has been waiting too long already,
+// otherwise creation order is kept.
+func (r *distReq) before(o *distReq, now time.Time) bool {
+	if r.interactive != o.interactive {
+		bulk := o
+		if o.interactive {
+			bulk = r
+		}
+		if now.Sub(bulk.created) < distMaxBulkDelay {
+			return r.interactive
+		}
+	}
+	return r.reqOrder < o.reqOrder
+}
+
 // newRequestDistributor creates a new request distributor
 func newRequestDistributor(peers *peerSet, stopChn chan struct{}) *requestDistributor {
 	d := &requestDistributor{
@@ -110,6 +132,18 @@ func (d *requestDistributor) registerTestPeer(p distPeer) {
 // times are recalculated based on new feedback from the servers
 const distMaxWait = time.Millisecond * 10
 
+const (
+	// distMaxBulkDelay is the waiting time after which a queued bulk request is
+	// no longer overtaken by interactive ones. Bulk requests are never delayed
+	// otherwise.
+	distMaxBulkDelay = time.Second
+
+	// distInteractiveReserve is the part of a peer's relative buffer bulk
+	// requests leave available while interactive ones are queued, so these can
+	// be sent immediately
+	distInteractiveReserve = 0.1
+)
+
 // main event loop
 func (d *requestDistributor) loop() {
 	for {
@@ -183,6 +217,7 @@ func (d *requestDistributor) nextRequest() (distPeer, *distReq, time.Duration) {
 		bestReq  *distReq
 		bestWait time.Duration
 		sel      *weightedRandomSelect
+		hinted   *selectPeerItem
 	)
 
 	d.peerLock.RLock()
@@ -196,7 +231,13 @@ func (d *requestDistributor) nextRequest() (distPeer, *distReq, time.Duration) {
 				canSend = true
 				cost := req.getCost(peer)
 				wait, bufRemain := peer.waitBefore(cost)
+				if wait == 0 && !req.interactive && d.interactive > 0 && bufRemain < distInteractiveReserve {
+					wait = distMaxWait
+				}
 				if wait == 0 {
+					if hinted == nil && req.preferred != nil && req.preferred(peer) {
+						hinted = &selectPeerItem{peer: peer, req: req}
+					}
 					if sel == nil {
 						sel = newWeightedRandomSelect()
 					}
@@ -219,6 +260,9 @@ func (d *requestDistributor) nextRequest() (distPeer, *distReq, time.Duration) {
 		elem = next
 	}
 
+	if hinted != nil {
+		return hinted.peer, hinted.req, 0
+	}
 	if sel != nil {
 		c := sel.choose().(selectPeerItem)
 		return c.peer, c.req, 0
@@ -234,20 +278,25 @@ func (d *requestDistributor) queue(r *distReq) chan distPeer {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	now := time.Now()
 	if r.reqOrder == 0 {
 		d.lastReqOrder++
-		r.reqOrder = d.lastReqOrder
+		r.reqOrder, r.created = d.lastReqOrder, now
 	}
 
 	back := d.reqQueue.Back()
-	if back == nil || r.reqOrder > back.Value.(*distReq).reqOrder {
+	if back == nil || (!r.interactive && r.reqOrder > back.Value.(*distReq).reqOrder) {
 		r.element = d.reqQueue.PushBack(r)
 	} else {
 		before := d.reqQueue.Front()
-		for before.Value.(*distReq).reqOrder < r.reqOrder {
+		for before != nil && !r.before(before.Value.(*distReq), now) {
 			before = before.Next()
 		}
-		r.element = d.reqQueue.InsertBefore(r, before)
+		if before == nil {
+			r.element = d.reqQueue.PushBack(r)
+		} else {
+			r.element = d.reqQueue.InsertBefore(r, before)
+		}
 	}
 
 	if !d.loopNextSent {
@@ -255,6 +304,9 @@ func (d *requestDistributor) queue(r *distReq) chan distPeer {
 		d.loopChn <- struct{}{}
 	}
 
+	if r.interactive {
+		d.interactive++
+	}
 	r.sentChn = make(chan distPeer, 1)
 	return r.sentChn
 }
@@ -281,5 +333,8 @@ func (d *requestDistributor) remove(r *distReq) {
 	if r.element != nil {
 		d.reqQueue.Remove(r.element)
 		r.element = nil
+		if r.interactive {
+			d.interactive--
+		}
 	}
 }
@@ -184,3 +184,110 @@ func testRequestDistributor(t *testing.T, resend bool) {
 
 	wg.Wait()
 }
+
+func TestRequestDistributorPeerHint(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	dist := newRequestDistributor(nil, stop)
+	var peers [testDistPeerCount]*testDistPeer
+	for i := range peers {
+		peers[i] = &testDistPeer{}
+		dist.registerTestPeer(peers[i])
+	}
+	send := func(canSendTo map[*testDistPeer]struct{}, hint *testDistPeer) distPeer {
+		rq := &testDistReq{canSendTo: canSendTo}
+		req := &distReq{
+			getCost: rq.getCost,
+			canSend: rq.canSend,
+			request: rq.request,
+			preferred: func(dp distPeer) bool {
+				return dp == hint
+			},
+		}
+		return <-dist.queue(req)
+	}
+	all := make(map[*testDistPeer]struct{})
+	for _, peer := range peers {
+		all[peer] = struct{}{}
+	}
+	// The hinted peer is chosen whenever it can take the request
+	for i := 0; i < 20; i++ {
+		if p := send(all, peers[3]); p != peers[3] {
+			t.Fatalf("request %d sent to %p instead of hinted peer %p", i, p, peers[3])
+		}
+	}
+	// Otherwise the request goes to any other suitable peer
+	others := map[*testDistPeer]struct{}{peers[0]: {}, peers[1]: {}}
+	if p := send(others, peers[3]); p != peers[0] && p != peers[1] {
+		t.Fatalf("request sent to %p, want a suitable peer", p)
+	}
+}
+
+func TestRequestDistributorInteractive(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	dist := newRequestDistributor(nil, stop)
+	peer := &testDistPeer{sumCost: testDistBufLimit}
+	dist.registerTestPeer(peer)
+
+	all := map[*testDistPeer]struct{}{peer: {}}
+	queue := func(order uint64, interactive bool) chan distPeer {
+		rq := &testDistReq{cost: 1, order: order, canSendTo: all}
+		return dist.queue(&distReq{getCost: rq.getCost, canSend: rq.canSend, request: rq.request, interactive: interactive})
+	}
+	sentOrder := func() []uint64 {
+		peer.lock.RLock()
+		defer peer.lock.RUnlock()
+
+		var orders []uint64
+		for _, rq := range peer.sent {
+			orders = append(orders, rq.order)
+		}
+		return orders
+	}
+	// While the peer's buffer is exhausted, a bulk request is queued before an
+	// interactive one, which still gets sent first
+	bulk, interactive := queue(1, false), queue(2, true)
+	peer.lock.Lock()
+	peer.sumCost = 0
+	peer.lock.Unlock()
+	<-interactive
+	<-bulk
+	if orders := sentOrder(); len(orders) != 2 || orders[0] != 2 || orders[1] != 1 {
+		t.Fatalf("send order mismatch: have %v, want [2 1]", orders)
+	}
+	// Without interactive requests queued, bulk ones use the whole buffer
+	peer.lock.Lock()
+	peer.sent, peer.sumCost = nil, testDistBufLimit*(1-distInteractiveReserve/2)
+	peer.lock.Unlock()
+
+	select {
+	case <-queue(3, false):
+	case <-time.After(time.Second):
+		t.Fatalf("bulk request not sent from the reserve")
+	}
+	// While an interactive request is waiting for another peer, bulk requests
+	// leave the reserve of the buffer to interactive ones
+	other := &testDistPeer{sumCost: testDistBufLimit}
+	dist.registerTestPeer(other)
+	rq := &testDistReq{cost: 1, order: 4, canSendTo: map[*testDistPeer]struct{}{other: {}}}
+	interactive = dist.queue(&distReq{getCost: rq.getCost, canSend: rq.canSend, request: rq.request, interactive: true})
+	bulk = queue(5, false)
+	select {
+	case <-bulk:
+		t.Fatalf("bulk request sent from the reserve")
+	case <-time.After(5 * distMaxWait):
+	}
+	other.lock.Lock()
+	other.sumCost = 0
+	other.lock.Unlock()
+	if p := <-interactive; p != other {
+		t.Fatalf("interactive request sent to %p, want %p", p, other)
+	}
+	<-bulk
+	if orders := sentOrder(); len(orders) != 2 || orders[0] != 3 || orders[1] != 5 {
+		t.Fatalf("send order mismatch: have %v, want [3 5]", orders)
+	}
+}
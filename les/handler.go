@@ -35,6 +35,7 @@ import (
 	"github.com/wtc/go-wtc/wtc/downloader"
 	"github.com/wtc/go-wtc/wtcdb"
 	"github.com/wtc/go-wtc/event"
+	"github.com/wtc/go-wtc/light"
 	"github.com/wtc/go-wtc/log"
 	"github.com/wtc/go-wtc/p2p"
 	"github.com/wtc/go-wtc/p2p/discover"
@@ -58,6 +59,8 @@ const (
 	MaxHeaderProofsFetch = 64  // Amount of merkle proofs to be fetched per retrieval request
 	MaxTxSend            = 64  // Amount of transactions to be send per request
 
+	defaultMaxBodyFetch = 16 // Amount of block bodies requested from servers not advertising a limit
+
 	disableClientRemovePeer = false
 )
 
@@ -317,6 +320,17 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 var reqList = []uint64{GetBlockHeadersMsg, GetBlockBodiesMsg, GetCodeMsg, GetReceiptsMsg, GetProofsMsg, SendTxMsg, GetHeaderProofsMsg}
 
+// replyKinds maps the reply messages to the request kinds whose response size
+// limit applies to them. Proof replies may carry a whole batch.
+var replyKinds = map[uint64]light.RequestKind{
+	BlockHeadersMsg: light.KindHeaderSegment,
+	BlockBodiesMsg:  light.KindBlock,
+	ReceiptsMsg:     light.KindReceipts,
+	ProofsMsg:       light.KindBatchTrie,
+	CodeMsg:         light.KindCode,
+	HeaderProofsMsg: light.KindCht,
+}
+
 // handleMsg is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
 func (pm *ProtocolManager) handleMsg(p *peer) error {
@@ -348,6 +362,16 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	if msg.Size > ProtocolMaxMsgSize {
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
+	// Reject oversized replies before decoding them
+	if kind, ok := replyKinds[msg.Code]; ok {
+		config := light.ConfigOf(pm.chainDb)
+		if pm.odr != nil {
+			config = light.BackendConfig(pm.odr)
+		}
+		if limit := config.ResponseLimit(kind); int64(msg.Size) > limit {
+			return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, limit)
+		}
+	}
 	defer msg.Discard()
 
 	var deliverMsg *Msg
@@ -643,16 +667,24 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of receipts arrived to one of our previous requests
 		var resp struct {
 			ReqID, BV uint64
-			Receipts  []types.Receipts
+			Receipts  []rlp.RawValue
 		}
 		if err := msg.Decode(&resp); err != nil {
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		// Tolerate unknown trailing receipt fields of other client versions
+		receipts := make([]types.Receipts, len(resp.Receipts))
+		for i, data := range resp.Receipts {
+			var err error
+			if receipts[i], err = light.DecodeReceipts(data); err != nil {
+				return errResp(ErrDecode, "msg %v: %v", msg, err)
+			}
+		}
 		p.fcServer.GotReply(resp.ReqID, resp.BV)
 		deliverMsg = &Msg{
 			MsgType: MsgReceipts,
 			ReqID:   resp.ReqID,
-			Obj:     resp.Receipts,
+			Obj:     receipts,
 		}
 
 	case GetProofsMsg:
@@ -691,6 +723,10 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 					}
 					if tr != nil {
 						proof := tr.Prove(req.Key)
+						// Omit the nodes the client already has if it asked so
+						if req.FromLevel > 0 && int(req.FromLevel) < len(proof) {
+							proof = proof[req.FromLevel:]
+						}
 						proofs = append(proofs, proof)
 						bytes += len(proof)
 					}
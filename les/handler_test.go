@@ -18,12 +18,15 @@ package les
 
 import (
 	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/wtc/go-wtc/common"
 	"github.com/wtc/go-wtc/core"
 	"github.com/wtc/go-wtc/core/types"
 	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/light"
 	"github.com/wtc/go-wtc/wtc/downloader"
 	"github.com/wtc/go-wtc/wtcdb"
 	"github.com/wtc/go-wtc/p2p"
@@ -342,3 +345,40 @@ func testGetProofs(t *testing.T, protocol int) {
 		t.Errorf("proofs mismatch: %v", err)
 	}
 }
+
+// unreadPayload is a message payload that records whether it was ever read.
+type unreadPayload struct{ read bool }
+
+func (p *unreadPayload) Read(b []byte) (int, error) {
+	p.read = true
+	return len(b), nil
+}
+
+// Tests that replies exceeding the response size limit of their request kind
+// are rejected on their announced size, before any of the payload is read.
+func TestOversizedReplyLes1(t *testing.T) { testOversizedReply(t, 1) }
+
+func testOversizedReply(t *testing.T, protocol int) {
+	// Assemble the test environment
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := light.BindConfig(mdb, &light.Config{MaxResponseBytes: light.ResponseLimits{light.KindCht: 1024}})
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
+	peer, errc := newTestPeer(t, "peer", protocol, pm, true)
+	defer peer.close()
+
+	// Announce a header proof reply above the limit, but well below the protocol maximum
+	payload := new(unreadPayload)
+	go peer.app.WriteMsg(p2p.Msg{Code: HeaderProofsMsg, Size: 2048, Payload: payload})
+
+	select {
+	case err := <-errc:
+		if err == nil || !strings.HasPrefix(err.Error(), errorToString[ErrMsgTooLarge]) {
+			t.Fatalf("oversized reply error mismatch: have %v, want %v", err, errorToString[ErrMsgTooLarge])
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("oversized reply not rejected")
+	}
+	if payload.read {
+		t.Errorf("oversized reply payload was read")
+	}
+}
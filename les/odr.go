@@ -18,10 +18,13 @@ package les
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/wtc/go-wtc/wtcdb"
 	"github.com/wtc/go-wtc/light"
 	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/rlp"
 )
 
 // LesOdr implements light.OdrBackend
@@ -29,6 +32,10 @@ type LesOdr struct {
 	db        wtcdb.Database
 	stop      chan struct{}
 	retriever *retrieveManager
+	timeouts  light.RequestTimeouts
+	latency   light.LatencyHistograms
+	policy    light.VerificationFailurePolicy
+	config    *light.Config
 }
 
 func NewLesOdr(db wtcdb.Database, retriever *retrieveManager) *LesOdr {
@@ -36,9 +43,34 @@ func NewLesOdr(db wtcdb.Database, retriever *retrieveManager) *LesOdr {
 		db:        db,
 		retriever: retriever,
 		stop:      make(chan struct{}),
+		timeouts:  light.DefaultRequestTimeouts,
+		latency:   light.NewLatencyHistograms("les/odr/latency"),
+		config:    light.DefaultConfig(),
 	}
 }
 
+// SetRequestTimeouts sets the per request kind timeouts applied to retrievals
+// whose context doesn't have a deadline.
+func (odr *LesOdr) SetRequestTimeouts(timeouts light.RequestTimeouts) {
+	odr.timeouts = timeouts
+}
+
+// SetVerificationFailurePolicy sets how replies failing validation are handled.
+// The peers sending them are dropped regardless.
+func (odr *LesOdr) SetVerificationFailurePolicy(policy light.VerificationFailurePolicy) {
+	odr.policy = policy
+}
+
+// SetConfig sets the configuration the replies are verified and stored with.
+func (odr *LesOdr) SetConfig(config *light.Config) {
+	odr.config = config
+}
+
+// Config returns the configuration of the backend.
+func (odr *LesOdr) Config() *light.Config {
+	return odr.config
+}
+
 func (odr *LesOdr) Stop() {
 	close(odr.stop)
 }
@@ -65,7 +97,24 @@ type Msg struct {
 // Retrieve tries to fetch an object from the LES network.
 // If the network retrieval was successful, it stores the object in local db.
 func (self *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err error) {
+	db := light.BindConfig(self.db, self.config)
+	if light.ResolveLocally(db, req) {
+		// Everything needed is cached, no need to bother the network
+		return req.StoreResult(light.StoreDatabase(db, req))
+	}
+	if batch, ok := req.(*light.BatchBlockRequest); ok {
+		if limit := self.bodyLimit(); len(batch.Hashes) > limit {
+			return retrieveChunked(ctx, batch, limit, self.Retrieve)
+		}
+	}
 	lreq := LesRequest(req)
+	if lreq == nil {
+		// Not every light request has a counterpart in the protocol yet
+		return light.ErrUnsupportedRequest
+	}
+	ctx, cancel := self.timeouts.WithTimeout(ctx, req)
+	defer cancel()
+	start := time.Now()
 
 	reqID := genReqID()
 	rq := &distReq{
@@ -83,12 +132,129 @@ func (self *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err err
 			return func() { lreq.Request(reqID, p) }
 		},
 	}
+	rq.interactive = light.Interactive(ctx)
+	if id, ok := light.PeerHint(ctx); ok {
+		rq.preferred = func(dp distPeer) bool {
+			return dp.(*peer).id == id
+		}
+	}
+
+	// Unless retrying, the first invalid reply ends the retrieval with its error
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
 
-	if err = self.retriever.retrieve(ctx, reqID, rq, func(p distPeer, msg *Msg) error { return lreq.Validate(self.db, msg) }); err == nil {
+	var (
+		lock     sync.Mutex
+		invalid  error
+		buffered int
+		retries  = make(map[error]int) // transient failures rejected for another try
+	)
+	defer func() {
+		lock.Lock()
+		if buffered > 0 {
+			light.ResponseBuffer.Release(buffered)
+		}
+		lock.Unlock()
+	}()
+	validate := func(p distPeer, msg *Msg) error {
+		err := light.VerifyWithTimeout(db, func(db wtcdb.Database) error {
+			return lreq.Validate(db, msg)
+		})
+		if err == nil {
+			// Hold up further replies of the peer while too much response data
+			// is waiting to be stored. A cancelled wait ends the retrieval anyway.
+			size := light.ResultSize(req)
+			if light.ResponseBuffer.Acquire(ctx, size) == nil {
+				lock.Lock()
+				buffered += size
+				lock.Unlock()
+			}
+			return nil
+		}
+		if self.policy == light.RejectAndRetry {
+			return err
+		}
+		if limit := light.BackendConfig(self).TransientRetries(err); limit > 0 {
+			lock.Lock()
+			retry := retries[err] < limit
+			if retry {
+				retries[err]++
+			}
+			lock.Unlock()
+			if retry {
+				return err
+			}
+		}
+		if self.policy == light.StoreAndFlag {
+			if raw, err := rlp.EncodeToBytes(msg.Obj); err == nil {
+				light.WriteUnverified(self.db, req, raw)
+			}
+		}
+		lock.Lock()
+		if invalid == nil {
+			invalid = err
+		}
+		lock.Unlock()
+
+		stop()
+		return err
+	}
+	if err = self.retriever.retrieve(ctx, reqID, rq, validate); err == nil {
 		// retrieved from network, store in db
-		req.StoreResult(self.db)
+		err = light.VerifyWithTimeout(light.StoreDatabase(db, req), req.StoreResult)
+	}
+	lock.Lock()
+	if invalid != nil {
+		err = invalid
+	}
+	lock.Unlock()
+
+	if err == nil {
+		self.latency.Observe(light.KindOf(req), time.Since(start))
 	} else {
 		log.Debug("Failed to retrieve data from network", "err", err)
 	}
 	return
 }
+
+// bodyLimit returns the largest batch of block bodies every connected server is
+// willing to serve in one request.
+func (self *LesOdr) bodyLimit() int {
+	limit := 0
+	if self.retriever != nil && self.retriever.peers != nil {
+		for _, p := range self.retriever.peers.AllPeers() {
+			if l := p.bodyLimit(); limit == 0 || l < limit {
+				limit = l
+			}
+		}
+	}
+	if limit == 0 {
+		limit = defaultMaxBodyFetch
+	}
+	return limit
+}
+
+// retrieveChunked retrieves the bodies of a batch too large for the servers in
+// chunks of at most limit blocks, reassembling the results into the original
+// request. A failing chunk ends the retrieval, leaving the bodies retrieved so
+// far in place.
+func retrieveChunked(ctx context.Context, req *light.BatchBlockRequest, limit int, retrieve func(context.Context, light.OdrRequest) error) error {
+	if len(req.Numbers) != len(req.Hashes) {
+		return light.ErrMalformedResponse
+	}
+	req.Rlps = make([][]byte, len(req.Hashes))
+	req.Errs = make([]error, len(req.Hashes))
+	for start := 0; start < len(req.Hashes); start += limit {
+		end := start + limit
+		if end > len(req.Hashes) {
+			end = len(req.Hashes)
+		}
+		chunk := &light.BatchBlockRequest{Hashes: req.Hashes[start:end], Numbers: req.Numbers[start:end]}
+		if err := retrieve(ctx, chunk); err != nil {
+			return err
+		}
+		copy(req.Rlps[start:end], chunk.Rlps)
+		copy(req.Errs[start:end], chunk.Errs)
+	}
+	return nil
+}
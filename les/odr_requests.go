@@ -19,7 +19,6 @@
 package les
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 
@@ -31,18 +30,17 @@ import (
 	"github.com/wtc/go-wtc/light"
 	"github.com/wtc/go-wtc/log"
 	"github.com/wtc/go-wtc/rlp"
-	"github.com/wtc/go-wtc/trie"
 )
 
 var (
 	errInvalidMessageType  = errors.New("invalid message type")
 	errMultipleEntries     = errors.New("multiple response entries")
+	errInvalidEntryCount   = errors.New("invalid number of response entries")
 	errHeaderUnavailable   = errors.New("header unavailable")
 	errTxHashMismatch      = errors.New("transaction hash mismatch")
 	errUncleHashMismatch   = errors.New("uncle hash mismatch")
 	errReceiptHashMismatch = errors.New("receipt hash mismatch")
 	errDataHashMismatch    = errors.New("data hash mismatch")
-	errCHTHashMismatch     = errors.New("cht hash mismatch")
 )
 
 type LesOdrRequest interface {
@@ -52,18 +50,43 @@ type LesOdrRequest interface {
 	Validate(wtcdb.Database, *Msg) error
 }
 
+// LesRequest returns the LES wrapper of an ODR request, nil for the request types
+// the protocol has no messages for: HeaderByHashRequest, BatchHeaderRequest,
+// HeaderSegmentRequest, TxLookupRequest, TxCountRequest, CodeSizeRequest and
+// BloomTrieRootRequest.
+// LesOdr fails those with light.ErrUnsupportedRequest.
 func LesRequest(req light.OdrRequest) LesOdrRequest {
 	switch r := req.(type) {
 	case *light.BlockRequest:
 		return (*BlockRequest)(r)
 	case *light.ReceiptsRequest:
 		return (*ReceiptsRequest)(r)
+	case *light.BatchBlockRequest:
+		return (*BatchBlockRequest)(r)
+	case *light.TxByIndexRequest:
+		return (*TxByIndexRequest)(r)
+	case *light.ReceiptsMetaRequest:
+		return (*ReceiptsMetaRequest)(r)
+	case *light.TxLogsRequest:
+		return (*TxLogsRequest)(r)
 	case *light.TrieRequest:
 		return (*TrieRequest)(r)
+	case *light.BatchTrieRequest:
+		return (*BatchTrieRequest)(r)
+	case *light.AccountRequest:
+		return (*AccountRequest)(r)
+	case *light.StorageRootRequest:
+		return (*StorageRootRequest)(r)
+	case *light.CodeHashRequest:
+		return (*CodeHashRequest)(r)
 	case *light.CodeRequest:
 		return (*CodeRequest)(r)
 	case *light.ChtRequest:
 		return (*ChtRequest)(r)
+	case *light.StateRootRequest:
+		return (*StateRootRequest)(r)
+	case *light.BlockBloomRequest:
+		return (*BlockBloomRequest)(r)
 	default:
 		return nil
 	}
@@ -125,6 +148,172 @@ func (r *BlockRequest) Validate(db wtcdb.Database, msg *Msg) error {
 	return nil
 }
 
+// BatchBlockRequest is the ODR request type for the bodies of several blocks
+type BatchBlockRequest light.BatchBlockRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *BatchBlockRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetBlockBodiesMsg, len(r.Hashes))
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BatchBlockRequest) CanSend(peer *peer) bool {
+	if len(r.Numbers) != len(r.Hashes) || len(r.Hashes) > peer.bodyLimit() {
+		return false
+	}
+	for i, hash := range r.Hashes {
+		if !peer.HasBlock(hash, r.Numbers[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BatchBlockRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting block bodies", "count", len(r.Hashes))
+	return peer.RequestBodies(reqID, r.GetCost(peer), r.Hashes)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest). The bodies are verified one
+// by one when storing the result.
+func (r *BatchBlockRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	log.Debug("Validating block bodies", "count", len(r.Hashes))
+
+	// Ensure we have a correct message with a body for every block
+	if msg.MsgType != MsgBlockBodies {
+		return errInvalidMessageType
+	}
+	bodies := msg.Obj.([]*types.Body)
+	if len(bodies) != len(r.Hashes) {
+		return errInvalidEntryCount
+	}
+	rlps := make([][]byte, len(bodies))
+	for i, body := range bodies {
+		data, err := rlp.EncodeToBytes(body)
+		if err != nil {
+			return err
+		}
+		rlps[i] = data
+	}
+	r.Rlps = rlps
+	return nil
+}
+
+// TxByIndexRequest is the ODR request type for a transaction at a given index,
+// served as a block body
+type TxByIndexRequest light.TxByIndexRequest
+
+// body returns the block body request the transaction is served through
+func (r *TxByIndexRequest) body() *BlockRequest {
+	return &BlockRequest{Hash: r.BlockHash, Number: r.Number}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *TxByIndexRequest) GetCost(peer *peer) uint64 {
+	return r.body().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *TxByIndexRequest) CanSend(peer *peer) bool {
+	return r.body().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *TxByIndexRequest) Request(reqID uint64, peer *peer) error {
+	return r.body().Request(reqID, peer)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *TxByIndexRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	body := r.body()
+	if err := body.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Rlp = body.Rlp
+	return nil
+}
+
+// ReceiptsMetaRequest is the ODR request type for block receipts without logs.
+// The protocol can't strip receipts, so it's served with the full ones.
+type ReceiptsMetaRequest light.ReceiptsMetaRequest
+
+// full returns the receipts request the stripped receipts are served through
+func (r *ReceiptsMetaRequest) full() *ReceiptsRequest {
+	return &ReceiptsRequest{Hash: r.Hash, Number: r.Number}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *ReceiptsMetaRequest) GetCost(peer *peer) uint64 {
+	return r.full().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *ReceiptsMetaRequest) CanSend(peer *peer) bool {
+	return r.full().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *ReceiptsMetaRequest) Request(reqID uint64, peer *peer) error {
+	return r.full().Request(reqID, peer)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *ReceiptsMetaRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	full := r.full()
+	if err := full.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Stripped, r.Receipts = false, full.Receipts
+	return nil
+}
+
+// TxLogsRequest is the ODR request type for the logs of a single transaction,
+// served with the receipts of its block.
+type TxLogsRequest light.TxLogsRequest
+
+// full returns the receipts request the transaction logs are served through
+func (r *TxLogsRequest) full() *ReceiptsRequest {
+	return &ReceiptsRequest{Hash: r.BlockHash, Number: r.Number}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *TxLogsRequest) GetCost(peer *peer) uint64 {
+	return r.full().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *TxLogsRequest) CanSend(peer *peer) bool {
+	return r.full().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *TxLogsRequest) Request(reqID uint64, peer *peer) error {
+	return r.full().Request(reqID, peer)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *TxLogsRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	full := r.full()
+	if err := full.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Receipts = full.Receipts
+	return nil
+}
+
 // ReceiptsRequest is the ODR request type for block receipts by block hash
 type ReceiptsRequest light.ReceiptsRequest
 
@@ -198,9 +387,10 @@ func (r *TrieRequest) CanSend(peer *peer) bool {
 func (r *TrieRequest) Request(reqID uint64, peer *peer) error {
 	peer.Log().Debug("Requesting trie proof", "root", r.Id.Root, "key", r.Key)
 	req := &ProofReq{
-		BHash:  r.Id.BlockHash,
-		AccKey: r.Id.AccKey,
-		Key:    r.Key,
+		BHash:     r.Id.BlockHash,
+		AccKey:    r.Id.AccKey,
+		Key:       r.Key,
+		FromLevel: r.FromLevel,
 	}
 	return peer.RequestProofs(reqID, r.GetCost(peer), []*ProofReq{req})
 }
@@ -211,6 +401,113 @@ func (r *TrieRequest) Request(reqID uint64, peer *peer) error {
 func (r *TrieRequest) Validate(db wtcdb.Database, msg *Msg) error {
 	log.Debug("Validating trie proof", "root", r.Id.Root, "key", r.Key)
 
+	// Ensure we have a correct message with a single proof
+	if msg.MsgType != MsgProofs {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([][]rlp.RawValue)
+	if len(proofs) != 1 {
+		return errMultipleEntries
+	}
+	// Complete the proof if partial, verify it and store if checks out
+	proof, err := light.CompleteTrieProof(db, (*light.TrieRequest)(r), proofs[0])
+	if err == light.ErrEmptyProof || err == light.ErrStaleStateRoot {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("merkle proof verification failed: %v", err)
+	}
+	r.Proof = proof
+	return nil
+}
+
+// ODR request type for several state/storage trie entries, see LesOdrRequest interface
+type BatchTrieRequest light.BatchTrieRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *BatchTrieRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetProofsMsg, len(r.Requests))
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BatchTrieRequest) CanSend(peer *peer) bool {
+	if len(r.Requests) > MaxProofsFetch {
+		return false
+	}
+	for _, req := range r.Requests {
+		if !(*TrieRequest)(req).CanSend(peer) {
+			return false
+		}
+	}
+	return true
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BatchTrieRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting trie proofs", "count", len(r.Requests))
+	reqs := make([]*ProofReq, len(r.Requests))
+	for i, req := range r.Requests {
+		reqs[i] = &ProofReq{
+			BHash:     req.Id.BlockHash,
+			AccKey:    req.Id.AccKey,
+			Key:       req.Key,
+			FromLevel: req.FromLevel,
+		}
+	}
+	return peer.RequestProofs(reqID, r.GetCost(peer), reqs)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest). The proofs of entries of the
+// same trie are verified together, and a proof failing verification is left out,
+// failing only its own entry when storing the result.
+func (r *BatchTrieRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	log.Debug("Validating trie proofs", "count", len(r.Requests))
+
+	// Ensure we have a correct message with a proof for every entry
+	if msg.MsgType != MsgProofs {
+		return errInvalidMessageType
+	}
+	proofs := msg.Obj.([][]rlp.RawValue)
+	if len(proofs) != len(r.Requests) {
+		return errInvalidEntryCount
+	}
+	r.Proofs, r.Errs = light.CompleteTrieProofs(db, r.Requests, proofs)
+	return nil
+}
+
+// ODR request type for accounts, served as state trie proofs, see LesOdrRequest interface
+type AccountRequest light.AccountRequest
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *AccountRequest) GetCost(peer *peer) uint64 {
+	return peer.GetRequestCost(GetProofsMsg, 1)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *AccountRequest) CanSend(peer *peer) bool {
+	return peer.HasBlock(r.Id.BlockHash, r.Id.BlockNumber)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *AccountRequest) Request(reqID uint64, peer *peer) error {
+	peer.Log().Debug("Requesting account proof", "root", r.Id.Root, "address", r.Address)
+	req := &ProofReq{
+		BHash: r.Id.BlockHash,
+		Key:   crypto.Keccak256(r.Address[:]),
+	}
+	return peer.RequestProofs(reqID, r.GetCost(peer), []*ProofReq{req})
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *AccountRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	log.Debug("Validating account proof", "root", r.Id.Root, "address", r.Address)
+
 	// Ensure we have a correct message with a single proof
 	if msg.MsgType != MsgProofs {
 		return errInvalidMessageType
@@ -220,13 +517,93 @@ func (r *TrieRequest) Validate(db wtcdb.Database, msg *Msg) error {
 		return errMultipleEntries
 	}
 	// Verify the proof and store if checks out
-	if _, err := trie.VerifyProof(r.Id.Root, r.Key, proofs[0]); err != nil {
+	config := light.ConfigOf(db)
+	if len(proofs[0]) == 0 {
+		if r.Id.Root != types.EmptyRootHash {
+			return light.ErrEmptyProof
+		}
+	} else if _, err := config.VerifyProof(r.Id.Root, crypto.Keccak256(r.Address[:]), proofs[0]); err != nil {
+		if err := config.CheckProofRoot(r.Id.Root, proofs[0]); err != nil {
+			return err
+		}
 		return fmt.Errorf("merkle proof verification failed: %v", err)
 	}
 	r.Proof = proofs[0]
 	return nil
 }
 
+// ODR request type for account storage roots, served as state trie proofs, see LesOdrRequest interface
+type StorageRootRequest light.StorageRootRequest
+
+// account returns the account request proving the storage root.
+func (r *StorageRootRequest) account() *AccountRequest {
+	return &AccountRequest{Id: r.StateId, Address: r.Address}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *StorageRootRequest) GetCost(peer *peer) uint64 {
+	return r.account().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *StorageRootRequest) CanSend(peer *peer) bool {
+	return r.account().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *StorageRootRequest) Request(reqID uint64, peer *peer) error {
+	return r.account().Request(reqID, peer)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *StorageRootRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	acc := r.account()
+	if err := acc.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Proof = acc.Proof
+	return nil
+}
+
+// ODR request type for account code hashes, served as state trie proofs, see LesOdrRequest interface
+type CodeHashRequest light.CodeHashRequest
+
+// account returns the account request proving the code hash.
+func (r *CodeHashRequest) account() *AccountRequest {
+	return &AccountRequest{Id: r.StateId, Address: r.Address}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *CodeHashRequest) GetCost(peer *peer) uint64 {
+	return r.account().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *CodeHashRequest) CanSend(peer *peer) bool {
+	return r.account().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *CodeHashRequest) Request(reqID uint64, peer *peer) error {
+	return r.account().Request(reqID, peer)
+}
+
+// Valid processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *CodeHashRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	acc := r.account()
+	if err := acc.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Proof = acc.Proof
+	return nil
+}
+
 type CodeReq struct {
 	BHash  common.Hash
 	AccKey []byte
@@ -280,6 +657,80 @@ func (r *CodeRequest) Validate(db wtcdb.Database, msg *Msg) error {
 	return nil
 }
 
+// StateRootRequest is the ODR request type for the state root of a block, served
+// as a CHT entry of the block's number
+type StateRootRequest light.StateRootRequest
+
+// cht returns the CHT request the state root is served through
+func (r *StateRootRequest) cht() *ChtRequest {
+	return &ChtRequest{ChtNum: r.ChtNum, BlockNum: r.Number, ChtRoot: r.ChtRoot}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *StateRootRequest) GetCost(peer *peer) uint64 {
+	return r.cht().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *StateRootRequest) CanSend(peer *peer) bool {
+	return r.cht().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *StateRootRequest) Request(reqID uint64, peer *peer) error {
+	return r.cht().Request(reqID, peer)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *StateRootRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	cht := r.cht()
+	if err := cht.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Header, r.Td, r.Proof = cht.Header, cht.Td, cht.Proof
+	return nil
+}
+
+// BlockBloomRequest is the ODR request type for the logs bloom of a block, served
+// as a CHT entry of the block's number
+type BlockBloomRequest light.BlockBloomRequest
+
+// cht returns the CHT request the logs bloom is served through
+func (r *BlockBloomRequest) cht() *ChtRequest {
+	return &ChtRequest{ChtNum: r.ChtNum, BlockNum: r.Number, ChtRoot: r.ChtRoot}
+}
+
+// GetCost returns the cost of the given ODR request according to the serving
+// peer's cost table (implementation of LesOdrRequest)
+func (r *BlockBloomRequest) GetCost(peer *peer) uint64 {
+	return r.cht().GetCost(peer)
+}
+
+// CanSend tells if a certain peer is suitable for serving the given request
+func (r *BlockBloomRequest) CanSend(peer *peer) bool {
+	return r.cht().CanSend(peer)
+}
+
+// Request sends an ODR request to the LES network (implementation of LesOdrRequest)
+func (r *BlockBloomRequest) Request(reqID uint64, peer *peer) error {
+	return r.cht().Request(reqID, peer)
+}
+
+// Validate processes an ODR request reply message from the LES network
+// returns true and stores results in memory if the message was a valid reply
+// to the request (implementation of LesOdrRequest)
+func (r *BlockBloomRequest) Validate(db wtcdb.Database, msg *Msg) error {
+	cht := r.cht()
+	if err := cht.Validate(db, msg); err != nil {
+		return err
+	}
+	r.Header, r.Td, r.Proof = cht.Header, cht.Td, cht.Proof
+	return nil
+}
+
 type ChtReq struct {
 	ChtNum, BlockNum, FromLevel uint64
 }
@@ -332,21 +783,11 @@ func (r *ChtRequest) Validate(db wtcdb.Database, msg *Msg) error {
 	}
 	proof := proofs[0]
 
-	// Verify the CHT
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], r.BlockNum)
-
-	value, err := trie.VerifyProof(r.ChtRoot, encNumber[:], proof.Proof)
+	// Verify the CHT, accepting the previous trusted root within its grace window
+	node, err := light.VerifyChtProof(db, r.ChtRoot, r.BlockNum, proof.Header, proof.Proof)
 	if err != nil {
 		return err
 	}
-	var node light.ChtNode
-	if err := rlp.DecodeBytes(value, &node); err != nil {
-		return err
-	}
-	if node.Hash != proof.Header.Hash() {
-		return errCHTHashMismatch
-	}
 	// Verifications passed, store and return
 	r.Header = proof.Header
 	r.Proof = proof.Proof
@@ -29,6 +29,7 @@ import (
 	"github.com/wtc/go-wtc/core/state"
 	"github.com/wtc/go-wtc/core/types"
 	"github.com/wtc/go-wtc/core/vm"
+	"github.com/wtc/go-wtc/crypto"
 	"github.com/wtc/go-wtc/wtcdb"
 	"github.com/wtc/go-wtc/light"
 	"github.com/wtc/go-wtc/params"
@@ -118,7 +119,7 @@ func odrContractCall(ctx context.Context, db wtcdb.Database, config *params.Chai
 
 			if err == nil {
 				from := statedb.GetOrNewStateObject(testBankAddress)
-				from.SetBalance(math.MaxBig256)
+				from.SetBalance(math.MaxBig256, new(big.Int), new(big.Int))
 
 				msg := callmsg{types.NewMessage(from.Address(), &testContractAddr, 0, new(big.Int), big.NewInt(100000), new(big.Int), data, false)}
 
@@ -133,7 +134,7 @@ func odrContractCall(ctx context.Context, db wtcdb.Database, config *params.Chai
 		} else {
 			header := lc.GetHeaderByHash(bhash)
 			state := light.NewState(ctx, header, lc.Odr())
-			state.SetBalance(testBankAddress, math.MaxBig256)
+			state.SetBalance(testBankAddress, math.MaxBig256, new(big.Int), new(big.Int))
 			msg := callmsg{types.NewMessage(testBankAddress, &testContractAddr, 0, new(big.Int), big.NewInt(100000), new(big.Int), data, false)}
 			context := core.NewEVMContext(msg, header, lc, nil)
 			vmenv := vm.NewEVM(context, state, config, vm.Config{})
@@ -205,3 +206,71 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
 	test(5)
 }
+
+// Tests that replies failing validation are handled according to the
+// verification failure policy of the backend.
+func TestOdrVerificationFailurePolicyLes1(t *testing.T) { testOdrVerificationFailurePolicy(t, 1) }
+
+func testOdrVerificationFailurePolicy(t *testing.T, protocol int) {
+	forged := []byte("forged code")
+
+	tests := []struct {
+		policy  light.VerificationFailurePolicy
+		err     error // error of the retrieval
+		flagged bool
+	}{
+		{light.RejectAndRetry, context.DeadlineExceeded, false},
+		{light.RejectAndDiscard, errDataHashMismatch, false},
+		{light.StoreAndFlag, errDataHashMismatch, true},
+	}
+	for _, tt := range tests {
+		// Assemble a server serving forged code for the empty code hash
+		peers := newPeerSet()
+		dist := newRequestDistributor(peers, make(chan struct{}))
+		rm := newRetrieveManager(peers, dist, nil)
+		db, _ := wtcdb.NewMemDatabase()
+		ldb, _ := wtcdb.NewMemDatabase()
+		odr := NewLesOdr(ldb, rm)
+		odr.SetVerificationFailurePolicy(tt.policy)
+		pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
+		lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
+		_, err1, lpeer, err2 := newTestPeerPair("peer", protocol, pm, lpm)
+		select {
+		case <-time.After(time.Millisecond * 100):
+		case err := <-err1:
+			t.Fatalf("peer 1 handshake error: %v", err)
+		case err := <-err2:
+			t.Fatalf("peer 1 handshake error: %v", err)
+		}
+		lpeer.lock.Lock()
+		lpeer.hasBlock = func(common.Hash, uint64) bool { return true }
+		lpeer.lock.Unlock()
+
+		db.Put(crypto.Keccak256(nil), forged)
+
+		genesis := pm.blockchain.GetHeaderByNumber(0)
+		newReq := func() *light.CodeRequest {
+			id := &light.TrieID{BlockHash: genesis.Hash(), BlockNumber: 0, Root: genesis.Root, AccKey: crypto.Keccak256(testBankAddress[:])}
+			return &light.CodeRequest{Id: id, Hash: crypto.Keccak256Hash(nil)}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		err := odr.Retrieve(ctx, newReq())
+		cancel()
+		if err != tt.err {
+			t.Errorf("%v: retrieval error mismatch: have %v, want %v", tt.policy, err, tt.err)
+		}
+		flagged := light.GetUnverified(ldb, newReq())
+		if (flagged != nil) != tt.flagged {
+			t.Errorf("%v: flagged mismatch: have %v, want %v", tt.policy, flagged != nil, tt.flagged)
+		}
+		if tt.flagged {
+			if want, _ := rlp.EncodeToBytes([][]byte{forged}); !bytes.Equal(flagged, want) {
+				t.Errorf("%v: flagged reply mismatch: have %x, want %x", tt.policy, flagged, want)
+			}
+		}
+		// Flagged or not, nothing may be served as trusted
+		if data, err := light.ReadContent(ldb, crypto.Keccak256Hash(nil), light.ContentCode); err == nil {
+			t.Errorf("%v: forged code stored: %x", tt.policy, data)
+		}
+	}
+}
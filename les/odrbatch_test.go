@@ -0,0 +1,117 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/light"
+)
+
+// Tests that a batch of block bodies exceeding the servers' advertised limit is
+// retrieved in several chunks and reassembled in the original order.
+func TestBatchBlockRequestChunking(t *testing.T) {
+	peers := newPeerSet()
+	peers.peers["a"] = &peer{id: "a", maxBodyFetch: 5}
+	peers.peers["b"] = &peer{id: "b", maxBodyFetch: 3}
+	odr := NewLesOdr(nil, &retrieveManager{peers: peers})
+
+	limit := odr.bodyLimit()
+	if limit != 3 {
+		t.Fatalf("body limit mismatch: have %d, want %d", limit, 3)
+	}
+	req := &light.BatchBlockRequest{}
+	for i := 0; i < 8; i++ {
+		req.Hashes = append(req.Hashes, common.Hash{byte(i)})
+		req.Numbers = append(req.Numbers, uint64(i))
+	}
+	if (*BatchBlockRequest)(req).CanSend(peers.peers["a"]) {
+		t.Fatalf("oversized batch sendable to peer")
+	}
+	var sizes []int
+	retrieve := func(ctx context.Context, r light.OdrRequest) error {
+		chunk := r.(*light.BatchBlockRequest)
+		if len(chunk.Hashes) > limit {
+			t.Fatalf("chunk of %d bodies exceeds limit %d", len(chunk.Hashes), limit)
+		}
+		sizes = append(sizes, len(chunk.Hashes))
+		chunk.Rlps = make([][]byte, len(chunk.Hashes))
+		chunk.Errs = make([]error, len(chunk.Hashes))
+		for i, number := range chunk.Numbers {
+			chunk.Rlps[i] = []byte{byte(number)}
+		}
+		return nil
+	}
+	if err := retrieveChunked(context.Background(), req, limit, retrieve); err != nil {
+		t.Fatalf("failed to retrieve batch: %v", err)
+	}
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 2 {
+		t.Fatalf("chunk sizes mismatch: have %v, want [3 3 2]", sizes)
+	}
+	for i, rlp := range req.Rlps {
+		if len(rlp) != 1 || rlp[0] != byte(i) {
+			t.Errorf("body %d mismatch: have %x", i, rlp)
+		}
+	}
+	if done := req.Completed(); len(done) != len(req.Hashes) {
+		t.Errorf("completed bodies mismatch: have %d, want %d", len(done), len(req.Hashes))
+	}
+}
+
+// Tests that a failing chunk ends the retrieval while keeping the bodies of the
+// chunks retrieved before it.
+func TestBatchBlockRequestChunkFailure(t *testing.T) {
+	req := &light.BatchBlockRequest{}
+	for i := 0; i < 5; i++ {
+		req.Hashes = append(req.Hashes, common.Hash{byte(i)})
+		req.Numbers = append(req.Numbers, uint64(i))
+	}
+	errFail := errors.New("chunk failed")
+	calls := 0
+	retrieve := func(ctx context.Context, r light.OdrRequest) error {
+		if calls++; calls > 1 {
+			return errFail
+		}
+		chunk := r.(*light.BatchBlockRequest)
+		chunk.Rlps = make([][]byte, len(chunk.Hashes))
+		chunk.Errs = make([]error, len(chunk.Hashes))
+		for i := range chunk.Hashes {
+			chunk.Rlps[i] = []byte{1}
+		}
+		return nil
+	}
+	if err := retrieveChunked(context.Background(), req, 2, retrieve); err != errFail {
+		t.Fatalf("error mismatch: have %v, want %v", err, errFail)
+	}
+	if done := req.Completed(); len(done) != 2 || done[0] != 0 || done[1] != 1 {
+		t.Errorf("completed bodies mismatch: have %v, want [0 1]", done)
+	}
+}
+
+// Tests that servers not advertising a body limit are treated conservatively.
+func TestDefaultBodyLimit(t *testing.T) {
+	if limit := (&peer{}).bodyLimit(); limit != defaultMaxBodyFetch {
+		t.Errorf("peer limit mismatch: have %d, want %d", limit, defaultMaxBodyFetch)
+	}
+	odr := NewLesOdr(nil, &retrieveManager{peers: newPeerSet()})
+	if limit := odr.bodyLimit(); limit != defaultMaxBodyFetch {
+		t.Errorf("odr limit mismatch: have %d, want %d", limit, defaultMaxBodyFetch)
+	}
+}
@@ -64,6 +64,8 @@ type peer struct {
 	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
 	fcServerParams *flowcontrol.ServerParams
 	fcCosts        requestCostTable
+
+	maxBodyFetch uint64 // number of block bodies the server serves per request
 }
 
 func newPeer(version int, network uint64, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -343,6 +345,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		send = send.add("serveChainSince", uint64(0))
 		send = send.add("serveStateSince", uint64(0))
 		send = send.add("txRelay", nil)
+		send = send.add("serveMaxBodies", uint64(MaxBodyFetch))
 		send = send.add("flowControl/BL", server.defParams.BufLimit)
 		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
 		list := server.fcCostStats.getCurrentList()
@@ -414,6 +417,10 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if err := recv.get("flowControl/MRC", &MRC); err != nil {
 			return err
 		}
+		if recv.get("serveMaxBodies", &p.maxBodyFetch) != nil {
+			// servers not advertising their limit get a conservative one
+			p.maxBodyFetch = defaultMaxBodyFetch
+		}
 		p.fcServerParams = params
 		p.fcServer = flowcontrol.NewServerNode(params)
 		p.fcCosts = MRC.decode()
@@ -423,6 +430,15 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 	return nil
 }
 
+// bodyLimit returns the number of block bodies the peer may be asked for in a
+// single request.
+func (p *peer) bodyLimit() int {
+	if p.maxBodyFetch == 0 {
+		return defaultMaxBodyFetch
+	}
+	return int(p.maxBodyFetch)
+}
+
 // String implements fmt.Stringer.
 func (p *peer) String() string {
 	return fmt.Sprintf("Peer %s [%s]", p.id,
@@ -145,6 +145,10 @@ func (rm *retrieveManager) sendReq(reqID uint64, req *distReq, val validatorFunc
 
 	request := req.request
 	req.request = func(p distPeer) func() {
+		// the preferred peer is only a hint for the first attempt, retries are
+		// left to the normal selection
+		req.preferred = nil
+
 		// before actually sending the request, put an entry into the sentTo map
 		r.lock.Lock()
 		r.sentTo[p] = sentReqToPeer{false, make(chan bool, 1)}
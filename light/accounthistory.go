@@ -0,0 +1,115 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// ErrAccountNotFound is returned by an account history search if the searched
+// account state isn't reached within the block range.
+var ErrAccountNotFound = errors.New("account state not found in range")
+
+// AccountCreationBlock returns the first canonical block of the range from to
+// to, inclusive, whose state contains the account with the given address. The
+// range is binary searched, so an account existing from some block on is found
+// in a logarithmic number of retrievals, each verified against the state root
+// of the block. An account deleted and recreated within the range may be found
+// at any of its incarnations. ErrAccountNotFound is returned if the account
+// doesn't exist at the end of the range.
+func AccountCreationBlock(ctx context.Context, odr OdrBackend, addr common.Address, from, to uint64) (uint64, error) {
+	return searchAccount(ctx, odr, addr, from, to, func(account *state.Account) (bool, error) {
+		return account != nil, nil
+	})
+}
+
+// AccountLastChange returns the first canonical block of the range from to to,
+// inclusive, from which on the account with the given address stays as it is at
+// the end of the range, i.e. the block of its last modification if that's after
+// from. Like AccountCreationBlock it binary searches the range, so an account
+// returning to an earlier state in between may be reported at either change.
+func AccountLastChange(ctx context.Context, odr OdrBackend, addr common.Address, from, to uint64) (uint64, error) {
+	final, err := accountAt(ctx, odr, addr, to)
+	if err != nil {
+		return 0, err
+	}
+	want, err := rlp.EncodeToBytes(final)
+	if err != nil {
+		return 0, err
+	}
+	return searchAccount(ctx, odr, addr, from, to, func(account *state.Account) (bool, error) {
+		have, err := rlp.EncodeToBytes(account)
+		return bytes.Equal(have, want), err
+	})
+}
+
+// searchAccount binary searches the range from to to, inclusive, for the first
+// block where the account with the given address matches, assuming that once
+// matching it keeps matching until the end of the range.
+func searchAccount(ctx context.Context, odr OdrBackend, addr common.Address, from, to uint64, match func(*state.Account) (bool, error)) (uint64, error) {
+	if from > to {
+		return 0, ErrInvalidRange
+	}
+	lo, hi := from, to
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		account, err := accountAt(ctx, odr, addr, mid)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := match(account)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	// The end of the range is only checked if nothing before it matched
+	if lo == to {
+		account, err := accountAt(ctx, odr, addr, to)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := match(account)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, ErrAccountNotFound
+		}
+	}
+	return lo, nil
+}
+
+// accountAt retrieves the account with the given address from the state of the
+// canonical block with the given number, nil if it doesn't exist.
+func accountAt(ctx context.Context, odr OdrBackend, addr common.Address, number uint64) (*state.Account, error) {
+	header, err := GetHeaderByNumber(ctx, odr, number)
+	if err != nil {
+		return nil, err
+	}
+	return GetAccount(ctx, odr, StateTrieID(header), addr)
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// countingOdr counts the account retrievals served by a testOdr.
+type countingOdr struct {
+	*testOdr
+	accounts int
+}
+
+func (odr *countingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if _, ok := req.(*AccountRequest); ok {
+		odr.accounts++
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+// makeHistoryChain creates a chain of 16 blocks on top of the genesis in which
+// acc1 is created by block 5 and modified by block 11.
+func makeHistoryChain(sdb wtcdb.Database) []*types.Header {
+	genesis := new(core.Genesis).MustCommit(sdb)
+	st, _ := state.New(genesis.Root(), state.NewDatabase(sdb))
+	st.SetBalance(testBankAddress, testBankFunds, new(big.Int), new(big.Int))
+
+	headers := make([]*types.Header, 17)
+	headers[0] = genesis.Header()
+	for i := 1; i < len(headers); i++ {
+		switch i {
+		case 5:
+			st.SetBalance(acc1Addr, big.NewInt(1000), new(big.Int), new(big.Int))
+		case 11:
+			st.SetNonce(acc1Addr, 1)
+		}
+		root, err := st.CommitTo(sdb, true)
+		if err != nil {
+			panic(err)
+		}
+		st, _ = state.New(root, state.NewDatabase(sdb))
+		header := makeTestBlock(headers[i-1], nil, nil, nil).Header()
+		header.Root = root
+		headers[i] = header
+	}
+	return headers
+}
+
+func TestAccountHistory(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	headers := makeHistoryChain(sdb)
+	ctx := context.Background()
+
+	newOdr := func() *countingOdr {
+		ldb, _ := wtcdb.NewMemDatabase()
+		writeCanonicalHeaders(ldb, headers)
+		return &countingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+	}
+	odr := newOdr()
+	number, err := AccountCreationBlock(ctx, odr, acc1Addr, 0, 16)
+	if err != nil {
+		t.Fatalf("failed to find creation: %v", err)
+	}
+	if number != 5 {
+		t.Errorf("creation block mismatch: have %d, want 5", number)
+	}
+	if odr.accounts > 5 {
+		t.Errorf("too many retrievals: have %d, want at most 5", odr.accounts)
+	}
+	number, err = AccountLastChange(ctx, newOdr(), acc1Addr, 0, 16)
+	if err != nil {
+		t.Fatalf("failed to find last change: %v", err)
+	}
+	if number != 11 {
+		t.Errorf("last change block mismatch: have %d, want 11", number)
+	}
+	if _, err := AccountCreationBlock(ctx, newOdr(), acc1Addr, 0, 4); err != ErrAccountNotFound {
+		t.Errorf("error mismatch before creation: have %v, want %v", err, ErrAccountNotFound)
+	}
+	if number, err := AccountCreationBlock(ctx, newOdr(), acc1Addr, 8, 8); err != nil || number != 8 {
+		t.Errorf("single block range mismatch: have %d (%v), want 8", number, err)
+	}
+	if _, err := AccountCreationBlock(ctx, newOdr(), acc2Addr, 0, 16); err != ErrAccountNotFound {
+		t.Errorf("error mismatch for missing account: have %v, want %v", err, ErrAccountNotFound)
+	}
+	if _, err := AccountCreationBlock(ctx, newOdr(), common.Address{}, 9, 2); err != ErrInvalidRange {
+		t.Errorf("error mismatch for invalid range: have %v, want %v", err, ErrInvalidRange)
+	}
+}
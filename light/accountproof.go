@@ -0,0 +1,156 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// ErrInvalidAccountProof is returned if an account proof bundle doesn't prove
+// the state it carries.
+var ErrInvalidAccountProof = errors.New("invalid account proof")
+
+// AccountProofBundle is a self-contained proof of the state of an account, that
+// can be handed to a third party and verified offline against the state root it
+// includes. It's RLP encodable. An account missing from the state is proven
+// absent, without code or storage.
+type AccountProofBundle struct {
+	StateRoot    common.Hash
+	Address      common.Address
+	AccountProof []rlp.RawValue // merkle proof of the account in the state trie
+	Code         []byte         // contract code, empty for plain accounts
+	Storage      []StorageProof
+}
+
+// StorageProof is the merkle proof of a storage slot of an AccountProofBundle.
+type StorageProof struct {
+	Slot  common.Hash
+	Proof []rlp.RawValue // merkle proof of the slot in the account's storage trie
+}
+
+// ExportAccountProof gathers the proof of the account with the given address in
+// the state trie identified by id, its code and the proofs of the given storage
+// slots into a bundle. Everything is retrieved and verified first, then the
+// bundle itself is verified with Verify before it's returned.
+func ExportAccountProof(ctx context.Context, backend OdrBackend, id *TrieID, addr common.Address, slots []common.Hash) (*AccountProofBundle, error) {
+	snap, err := ContractSnapshot(ctx, backend, id, addr, false)
+	if err != nil {
+		return nil, err
+	}
+	db := backendDatabase(backend)
+	key := addressHash(addr)
+	bundle := &AccountProofBundle{StateRoot: id.Root, Address: addr}
+	var ok bool
+	if bundle.AccountProof, ok = localProof(db, id.Root, key[:]); !ok {
+		return nil, ErrMalformedResponse
+	}
+	if snap != nil {
+		bundle.Code = snap.Code
+		storage := StorageTrieID(id, key, snap.Root)
+		for _, slot := range slots {
+			if _, err := VerifiedStorageRead(ctx, backend, id, addr, slot); err != nil {
+				return nil, err
+			}
+			proof, ok := localProof(db, storage.Root, crypto.Keccak256(slot[:]))
+			if !ok {
+				return nil, ErrMalformedResponse
+			}
+			bundle.Storage = append(bundle.Storage, StorageProof{Slot: slot, Proof: proof})
+		}
+	}
+	if _, _, err := bundle.verify(BackendConfig(backend)); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// Verify checks the bundle against its state root, returning the proven account,
+// nil if absent, and the contents of the proven storage slots, absent ones left
+// out. Without a backend at hand, the standard trie verifier is used.
+func (b *AccountProofBundle) Verify() (*state.Account, map[common.Hash][]byte, error) {
+	return b.verify(defaultConfig)
+}
+
+// verify implements Verify, checking the proofs with the verifier of config.
+func (b *AccountProofBundle) verify(config *Config) (*state.Account, map[common.Hash][]byte, error) {
+	key := addressHash(b.Address)
+	value, err := verifyBundleProof(config, b.StateRoot, key[:], b.AccountProof)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value == nil {
+		if len(b.Code) > 0 || len(b.Storage) > 0 {
+			return nil, nil, ErrMalformedResponse
+		}
+		return nil, nil, nil
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(value, account); err != nil {
+		return nil, nil, err
+	}
+	if hash := crypto.Keccak256(b.Code); !bytes.Equal(hash, account.CodeHash) {
+		return nil, nil, ErrMalformedResponse
+	}
+	storage := make(map[common.Hash][]byte)
+	for _, slot := range b.Storage {
+		value, err := verifyBundleProof(config, account.Root, crypto.Keccak256(slot.Slot[:]), slot.Proof)
+		if err != nil {
+			return nil, nil, err
+		}
+		if value == nil {
+			continue
+		}
+		_, content, _, err := rlp.Split(value)
+		if err != nil {
+			return nil, nil, ErrMalformedResponse
+		}
+		storage[slot.Slot] = content
+	}
+	return account, storage, nil
+}
+
+// VerifyAccountProofBundle checks an account proof bundle produced by another
+// client against its embedded state root, using nothing but the trie and hash
+// primitives, so it works without a backend or database. Any inconsistency
+// fails with ErrInvalidAccountProof. The bundle proves nothing to a verifier not
+// trusting the state root to be that of the intended block.
+func VerifyAccountProofBundle(b *AccountProofBundle) error {
+	if b == nil {
+		return ErrInvalidAccountProof
+	}
+	if _, _, err := b.Verify(); err != nil {
+		return ErrInvalidAccountProof
+	}
+	return nil
+}
+
+// verifyBundleProof verifies a proof of a bundle with the verifier of config.
+// Empty tries have no nodes, so their proofs are empty too.
+func verifyBundleProof(config *Config, root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	if root == types.EmptyRootHash && len(proof) == 0 {
+		return nil, nil
+	}
+	return config.VerifyProof(root, key, proof)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestExportAccountProof(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	missing := common.HexToHash("0xdead")
+	slots := []common.Hash{testStateSlot(0), testStateSlot(1), missing}
+	bundle, err := ExportAccountProof(NoOdr, odr, id, testStateContract, slots)
+	if err != nil {
+		t.Fatalf("failed to export proof: %v", err)
+	}
+	// Ship the bundle through RLP and verify it with the trie package alone
+	enc, err := rlp.EncodeToBytes(bundle)
+	if err != nil {
+		t.Fatalf("failed to encode bundle: %v", err)
+	}
+	var shipped AccountProofBundle
+	if err := rlp.DecodeBytes(enc, &shipped); err != nil {
+		t.Fatalf("failed to decode bundle: %v", err)
+	}
+	if shipped.StateRoot != id.Root || shipped.Address != testStateContract {
+		t.Fatalf("bundle identity mismatch: have %x/%x", shipped.StateRoot, shipped.Address)
+	}
+	value, err := trie.VerifyProof(shipped.StateRoot, crypto.Keccak256(shipped.Address[:]), shipped.AccountProof)
+	if err != nil || value == nil {
+		t.Fatalf("independent account verification failed: %v", err)
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		t.Fatalf("failed to decode account: %v", err)
+	}
+	if !bytes.Equal(crypto.Keccak256(shipped.Code), account.CodeHash) || !bytes.Equal(shipped.Code, testContractCode) {
+		t.Errorf("code mismatch: have %x", shipped.Code)
+	}
+	if len(shipped.Storage) != len(slots) {
+		t.Fatalf("storage proof count mismatch: have %d, want %d", len(shipped.Storage), len(slots))
+	}
+	for i, proof := range shipped.Storage {
+		value, err := trie.VerifyProof(account.Root, crypto.Keccak256(proof.Slot[:]), proof.Proof)
+		if err != nil {
+			t.Fatalf("independent slot %d verification failed: %v", i, err)
+		}
+		var content []byte
+		if value != nil {
+			_, content, _, _ = rlp.Split(value)
+		}
+		if i < 2 && !bytes.Equal(content, []byte{byte(i + 1)}) {
+			t.Errorf("slot %d mismatch: have %x, want %x", i, content, []byte{byte(i + 1)})
+		}
+		if i == 2 && value != nil {
+			t.Errorf("missing slot proven present: %x", value)
+		}
+	}
+	// The bundle's own verifier agrees
+	if _, storage, err := shipped.Verify(); err != nil || len(storage) != 2 {
+		t.Errorf("bundle verification mismatch: have %v, %v", storage, err)
+	}
+	// Tampering is detected
+	shipped.Code = append(shipped.Code, 0)
+	if _, _, err := shipped.Verify(); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for tampered code: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// Missing accounts are proven absent
+	bundle, err = ExportAccountProof(NoOdr, odr, id, acc2Addr, slots)
+	if err != nil {
+		t.Fatalf("failed to export missing account: %v", err)
+	}
+	if account, _, err := bundle.Verify(); account != nil || err != nil || len(bundle.Storage) != 0 {
+		t.Errorf("missing account mismatch: have %v, %v", account, err)
+	}
+}
+
+func TestVerifyAccountProofBundle(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	bundle, err := ExportAccountProof(NoOdr, odr, id, testStateContract, []common.Hash{testStateSlot(0), testStateSlot(1)})
+	if err != nil {
+		t.Fatalf("failed to export proof: %v", err)
+	}
+	enc, _ := rlp.EncodeToBytes(bundle)
+	decode := func() *AccountProofBundle {
+		shipped := new(AccountProofBundle)
+		if err := rlp.DecodeBytes(enc, shipped); err != nil {
+			t.Fatalf("failed to decode bundle: %v", err)
+		}
+		return shipped
+	}
+	if err := VerifyAccountProofBundle(decode()); err != nil {
+		t.Fatalf("valid bundle rejected: %v", err)
+	}
+	tampers := []func(b *AccountProofBundle){
+		func(b *AccountProofBundle) { b.StateRoot = common.Hash{1} },
+		func(b *AccountProofBundle) { b.Address = acc1Addr },
+		func(b *AccountProofBundle) { b.AccountProof = b.AccountProof[:len(b.AccountProof)-1] },
+		func(b *AccountProofBundle) { b.Code = b.Code[1:] },
+		func(b *AccountProofBundle) { b.Storage[1].Proof = b.Storage[0].Proof[:1] },
+		func(b *AccountProofBundle) { b.Storage[0].Proof[len(b.Storage[0].Proof)-1] = rlp.EmptyString },
+	}
+	for i, tamper := range tampers {
+		shipped := decode()
+		tamper(shipped)
+		if err := VerifyAccountProofBundle(shipped); err != ErrInvalidAccountProof {
+			t.Errorf("tamper %d: error mismatch: have %v, want %v", i, err, ErrInvalidAccountProof)
+		}
+	}
+	if err := VerifyAccountProofBundle(nil); err != ErrInvalidAccountProof {
+		t.Errorf("error mismatch for missing bundle: have %v, want %v", err, ErrInvalidAccountProof)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/hashicorp/golang-lru"
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+)
+
+// addrHashCache caches the secure trie keys of recently accessed accounts. It
+// is disabled by default.
+var addrHashCache *lru.Cache
+
+// SetAddressHashCache enables caching the hashes of the given number of most
+// recently accessed account addresses, or disables the cache if size is zero.
+// It is meant to be called during initialization, before any ODR retrieval.
+func SetAddressHashCache(size int) {
+	if size <= 0 {
+		addrHashCache = nil
+		return
+	}
+	addrHashCache, _ = lru.New(size)
+}
+
+// addressHash returns the secure trie key of an account address.
+func addressHash(addr common.Address) common.Hash {
+	cache := addrHashCache
+	if cache == nil {
+		return crypto.Keccak256Hash(addr[:])
+	}
+	if hash, ok := cache.Get(addr); ok {
+		return hash.(common.Hash)
+	}
+	hash := crypto.Keccak256Hash(addr[:])
+	cache.Add(addr, hash)
+	return hash
+}
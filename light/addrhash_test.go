@@ -0,0 +1,59 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+)
+
+func TestAddressHashCache(t *testing.T) {
+	defer SetAddressHashCache(0)
+
+	addrs := []common.Address{acc1Addr, acc2Addr, testBankAddress}
+	SetAddressHashCache(2)
+	for i := 0; i < 2; i++ {
+		for _, addr := range addrs {
+			if have, want := addressHash(addr), crypto.Keccak256Hash(addr[:]); have != want {
+				t.Errorf("hash mismatch for %x: have %x, want %x", addr, have, want)
+			}
+		}
+	}
+	if n := addrHashCache.Len(); n != 2 {
+		t.Errorf("cache size mismatch: have %d, want %d", n, 2)
+	}
+}
+
+func BenchmarkAddressHashUncached(b *testing.B) { benchmarkAddressHash(b, 0) }
+func BenchmarkAddressHashCached(b *testing.B)   { benchmarkAddressHash(b, 128) }
+
+func benchmarkAddressHash(b *testing.B, size int) {
+	defer SetAddressHashCache(0)
+	SetAddressHashCache(size)
+
+	addrs := make([]common.Address, 100)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addressHash(addrs[i%len(addrs)])
+	}
+}
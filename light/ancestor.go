@@ -0,0 +1,86 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// ErrNoCommonAncestor is returned if two headers don't converge within
+// MaxAncestorWalk blocks.
+var ErrNoCommonAncestor = errors.New("no common ancestor")
+
+// MaxAncestorWalk is the maximum number of parents CommonAncestor steps through,
+// bounding the retrievals spent on headers of unrelated chains.
+var MaxAncestorWalk = 1024
+
+// CommonAncestor finds the latest common ancestor of the headers with hashes a
+// and b, e.g. of the previous head a and the new head b after a reorg. Missing
+// parents are retrieved by hash and trusted by their link to the verified child,
+// so side chains no longer canonical can be walked too. The ancestor's hash is
+// returned with the reorg depth, the number of blocks of a's chain above it.
+func CommonAncestor(ctx context.Context, odr OdrBackend, a, b common.Hash) (common.Hash, uint64, error) {
+	ha, err := GetHeaderByHash(ctx, odr, a)
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	hb, err := GetHeaderByHash(ctx, odr, b)
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	head := ha.Number.Uint64()
+	for steps := 0; ha.Hash() != hb.Hash(); steps++ {
+		if steps >= MaxAncestorWalk {
+			return common.Hash{}, 0, ErrNoCommonAncestor
+		}
+		na, nb := ha.Number.Uint64(), hb.Number.Uint64()
+		if na == 0 && nb == 0 {
+			return common.Hash{}, 0, ErrNoCommonAncestor
+		}
+		if na >= nb {
+			if ha, err = parentHeader(ctx, odr, ha); err != nil {
+				return common.Hash{}, 0, err
+			}
+		}
+		if nb >= na {
+			if hb, err = parentHeader(ctx, odr, hb); err != nil {
+				return common.Hash{}, 0, err
+			}
+		}
+	}
+	return ha.Hash(), head - ha.Number.Uint64(), nil
+}
+
+// parentHeader returns the parent of a verified header, retrieving it if it's not
+// known locally.
+func parentHeader(ctx context.Context, odr OdrBackend, child *types.Header) (*types.Header, error) {
+	db := odr.Database()
+	number := child.Number.Uint64() - 1
+	if parent := getHeader(db, child.ParentHash, number); parent != nil {
+		return parent, nil
+	}
+	cht := GetTrustedCht(db)
+	r := &HeaderByHashRequest{Hash: child.ParentHash, ChtNum: cht.Number, ChtRoot: cht.Root, Child: child.Hash()}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Header, nil
+}
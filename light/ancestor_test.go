@@ -0,0 +1,85 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeForkHeaders creates a chain of n linked headers on top of parent, made
+// distinct from other chains on the same parent by extra.
+func makeForkHeaders(parent *types.Header, n int, extra string) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		header := makeTestBlock(parent, nil, nil, nil).Header()
+		header.Extra = []byte(extra)
+		headers[i], parent = header, header
+	}
+	return headers
+}
+
+func TestCommonAncestor(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	common := makeTestHeaders(genesis.Header(), 5)
+	old := makeForkHeaders(common[4], 3, "old")
+	fork := makeForkHeaders(common[4], 6, "new")
+	for _, chain := range [][]*types.Header{common, old, fork} {
+		for _, header := range chain {
+			core.WriteHeader(sdb, header)
+		}
+	}
+	// The client knows the old chain and the new head only
+	odr := NewMemoryOdrBackend(sdb)
+	writeCanonicalHeaders(odr.Database(), append(append([]*types.Header{genesis.Header()}, common...), old...))
+	core.WriteHeader(odr.Database(), fork[5])
+
+	ancestor, depth, err := CommonAncestor(NoOdr, odr, old[2].Hash(), fork[5].Hash())
+	if err != nil {
+		t.Fatalf("failed to find common ancestor: %v", err)
+	}
+	if ancestor != common[4].Hash() || depth != 3 {
+		t.Errorf("ancestor mismatch: have %x (depth %d), want %x (depth 3)", ancestor, depth, common[4].Hash())
+	}
+	// The new chain's headers were retrieved while walking back
+	for i, header := range fork[:5] {
+		if getHeader(odr.Database(), header.Hash(), header.Number.Uint64()) == nil {
+			t.Errorf("fork header %d not stored", i)
+		}
+	}
+	// Headers on the same chain have the older one as ancestor
+	if ancestor, depth, err := CommonAncestor(NoOdr, odr, common[1].Hash(), old[1].Hash()); err != nil || ancestor != common[1].Hash() || depth != 0 {
+		t.Errorf("same chain mismatch: have %x (depth %d, %v), want %x (depth 0)", ancestor, depth, err, common[1].Hash())
+	}
+	// Unrelated chains don't converge
+	root := types.CopyHeader(genesis.Header())
+	root.Extra = []byte("other")
+	other := makeForkHeaders(root, 4, "other")
+	for _, header := range other {
+		core.WriteHeader(sdb, header)
+	}
+	core.WriteHeader(odr.Database(), other[3])
+	defer func(max int) { MaxAncestorWalk = max }(MaxAncestorWalk)
+	MaxAncestorWalk = 3
+	if _, _, err := CommonAncestor(NoOdr, odr, old[2].Hash(), other[3].Hash()); err != ErrNoCommonAncestor {
+		t.Errorf("error mismatch for unrelated chains: have %v, want %v", err, ErrNoCommonAncestor)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrArchiveMode is returned when evicting data from the cache in archive mode,
+// see the ArchiveMode option of Config.
+var ErrArchiveMode = errors.New("eviction disabled in archive mode")
+
+var archivePrefix = []byte("light-archive-") // archivePrefix + num (uint64 big endian) + hash -> nothing
+
+// archiveBlock records a block with data retained by the archive, if the
+// configuration bound to db is in archive mode.
+func archiveBlock(db wtcdb.Database, hash common.Hash, number uint64) {
+	if !ConfigOf(db).ArchiveMode {
+		return
+	}
+	key := make([]byte, len(archivePrefix)+8+common.HashLength)
+	copy(key, archivePrefix)
+	binary.BigEndian.PutUint64(key[len(archivePrefix):], number)
+	copy(key[len(archivePrefix)+8:], hash[:])
+	if err := db.Put(key, []byte{}); err != nil {
+		log.Error("Failed to index archived block", "number", number, "hash", hash, "err", err)
+	}
+}
+
+// ArchivedBlocks calls fn with the number and hash of every block with a body or
+// receipts retained in archive mode.
+func ArchivedBlocks(db wtcdb.Database, fn func(number uint64, hash common.Hash)) error {
+	return forEachPrefix(db, archivePrefix, func(key, value []byte) {
+		if len(key) != len(archivePrefix)+8+common.HashLength {
+			return
+		}
+		key = key[len(archivePrefix):]
+		fn(binary.BigEndian.Uint64(key[:8]), common.BytesToHash(key[8:]))
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestArchiveMode(t *testing.T) {
+	mdb, _ := wtcdb.NewMemDatabase()
+	config := DefaultConfig()
+	config.ArchiveMode = true
+	db := BindConfig(mdb, config)
+	genesis := new(core.Genesis).MustCommit(db)
+	txs := makeTestTxs(2)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	core.WriteHeader(db, block.Header())
+
+	// A filter keeping everything in memory is bypassed
+	fdb := BindConfig(NewFilterDatabase(db, func(OdrRequest, []byte, []byte) bool { return false }), config)
+	data, _ := rlp.EncodeToBytes(block.Body())
+	breq := &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: data}
+	if err := breq.StoreResult(StoreDatabase(fdb, breq)); err != nil {
+		t.Fatalf("failed to store body: %v", err)
+	}
+	rreq := &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: receipts}
+	if err := rreq.StoreResult(StoreDatabase(fdb, rreq)); err != nil {
+		t.Fatalf("failed to store receipts: %v", err)
+	}
+	if len(core.GetBodyRLP(db, block.Hash(), block.NumberU64())) == 0 {
+		t.Errorf("body kept in memory only")
+	}
+	if core.GetBlockReceipts(db, block.Hash(), block.NumberU64()) == nil {
+		t.Errorf("receipts kept in memory only")
+	}
+	// Nothing is evicted
+	if err := DeleteCachedBody(db, block.Hash(), block.NumberU64()); err != ErrArchiveMode {
+		t.Errorf("error mismatch for eviction: have %v, want %v", err, ErrArchiveMode)
+	}
+	if len(core.GetBodyRLP(db, block.Hash(), block.NumberU64())) == 0 {
+		t.Errorf("body evicted")
+	}
+	// The block is indexed once
+	var archived []common.Hash
+	if err := ArchivedBlocks(mdb, func(number uint64, hash common.Hash) {
+		if number != block.NumberU64() {
+			t.Errorf("archived block number mismatch: have %d, want %d", number, block.NumberU64())
+		}
+		archived = append(archived, hash)
+	}); err != nil {
+		t.Fatalf("failed to list archive: %v", err)
+	}
+	if len(archived) != 1 || archived[0] != block.Hash() {
+		t.Errorf("archived blocks mismatch: have %x, want [%x]", archived, block.Hash())
+	}
+	// Trie nodes are not evicted from a database bound to the configuration
+	ndb := NewNodeLRUDatabase(db, 1)
+	for i := 0; i < 3; i++ {
+		blob, _ := rlp.EncodeToBytes([]uint{uint(i), uint(i)})
+		ndb.Put(crypto.Keccak256(blob), blob)
+	}
+	for i := 0; i < 3; i++ {
+		blob, _ := rlp.EncodeToBytes([]uint{uint(i), uint(i)})
+		if ok, _ := mdb.Has(crypto.Keccak256(blob)); !ok {
+			t.Errorf("trie node %d evicted", i)
+		}
+	}
+}
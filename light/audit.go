@@ -0,0 +1,94 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single retrieval done through an audited backend.
+type AuditEntry struct {
+	Time    time.Time     // start of the retrieval
+	Kind    RequestKind   // kind of the retrieved request
+	Elapsed time.Duration // duration of the retrieval
+	Err     error         // failure of the retrieval, nil if succeeded
+}
+
+// AuditOdr wraps an OdrBackend, keeping a log of the most recent retrievals.
+type AuditOdr struct {
+	OdrBackend
+	limit int
+
+	lock    sync.Mutex
+	entries []AuditEntry
+}
+
+// NewAuditOdr creates an auditing wrapper around backend, remembering the last
+// limit retrievals.
+func NewAuditOdr(backend OdrBackend, limit int) *AuditOdr {
+	return &AuditOdr{
+		OdrBackend: backend,
+		limit:      limit,
+	}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *AuditOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve forwards the request to the wrapped backend, logging its outcome.
+func (odr *AuditOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	start := clock.Now()
+	err := odr.OdrBackend.Retrieve(ctx, req)
+	entry := AuditEntry{Time: start, Kind: KindOf(req), Elapsed: since(start), Err: err}
+
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	odr.entries = append(odr.entries, entry)
+	if len(odr.entries) > odr.limit {
+		odr.entries = append(odr.entries[:0], odr.entries[len(odr.entries)-odr.limit:]...)
+	}
+	return err
+}
+
+// Entries returns the logged retrievals, oldest first.
+func (odr *AuditOdr) Entries() []AuditEntry {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return append([]AuditEntry(nil), odr.entries...)
+}
+
+// ExportAudit writes the audit log to w in the format of enc, or JSON if enc is
+// nil.
+func (odr *AuditOdr) ExportAudit(w io.Writer, enc Encoder) error {
+	entries := odr.Entries()
+	rows := make([][]interface{}, len(entries))
+	for i, e := range entries {
+		var failure string
+		if e.Err != nil {
+			failure = e.Err.Error()
+		}
+		rows[i] = []interface{}{e.Time.UTC().Format(time.RFC3339Nano), e.Kind.String(), int64(e.Elapsed), failure}
+	}
+	return export(w, enc, []string{"time", "kind", "elapsed_ns", "error"}, rows)
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// BatchBalances retrieves the balances of the accounts with the given addresses
+// from the state trie identified by id, each verified by its account proof. The
+// balances and errors are aligned by index with addrs; accounts that don't exist
+// have a zero balance. The proofs share the upper nodes of the trie, so once the
+// first ones are stored the rest are mostly resolved locally.
+func BatchBalances(ctx context.Context, odr OdrBackend, id *TrieID, addrs []common.Address) ([]*big.Int, []error) {
+	var (
+		balances = make([]*big.Int, len(addrs))
+		errs     = make([]error, len(addrs))
+		pending  = make(chan int)
+		wg       sync.WaitGroup
+	)
+	workers := BackendConfig(odr).BatchBalanceConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range pending {
+				balances[index], _, errs[index] = BalanceAndNonce(ctx, odr, id, addrs[index])
+			}
+		}()
+	}
+	for index := range addrs {
+		if ctx.Err() == nil {
+			select {
+			case pending <- index:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		errs[index] = ctx.Err()
+	}
+	close(pending)
+	wg.Wait()
+
+	return balances, errs
+}
+
+// BalanceChanged retrieves the balance of the account with the given address at
+// the state tries identified by idA and idB, each verified by its account proof,
+// and reports whether they differ along with both balances. Accounts that don't
+// exist at either end have a zero balance there.
+func BalanceChanged(ctx context.Context, odr OdrBackend, addr common.Address, idA, idB *TrieID) (bool, *big.Int, *big.Int, error) {
+	balanceA, _, err := BalanceAndNonce(ctx, odr, idA, addr)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	balanceB, _, err := BalanceAndNonce(ctx, odr, idB, addr)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	return balanceA.Cmp(balanceB) != 0, balanceA, balanceB, nil
+}
+
+// StorageRootDelta retrieves the account with the given address at the state
+// tries identified by idA and idB, each verified by its account proof, and
+// reports whether its storage root differs, i.e. whether any storage slot of the
+// account changed, without reading a single slot. An account that doesn't exist
+// at an end has the empty storage root there, so its creation or deletion only
+// counts as a change if it had storage.
+func StorageRootDelta(ctx context.Context, odr OdrBackend, addr common.Address, idA, idB *TrieID) (changed bool, rootA, rootB common.Hash, err error) {
+	if rootA, err = verifiedStorageRoot(ctx, odr, idA, addr); err != nil {
+		return false, common.Hash{}, common.Hash{}, err
+	}
+	if rootB, err = verifiedStorageRoot(ctx, odr, idB, addr); err != nil {
+		return false, common.Hash{}, common.Hash{}, err
+	}
+	return rootA != rootB, rootA, rootB, nil
+}
+
+// verifiedStorageRoot returns the storage root of the account with the given
+// address proven by its account proof, the empty root if it doesn't exist.
+func verifiedStorageRoot(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (common.Hash, error) {
+	account, err := GetAccount(ctx, odr, id, addr)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if account == nil {
+		return types.EmptyRootHash, nil
+	}
+	return account.Root, nil
+}
+
+// BatchAccountExists reports which of the accounts with the given addresses
+// exist in the state trie identified by id, aligned by index with addrs. The
+// accounts not resolvable locally are proven in batched trie retrievals of at
+// most MaxCoalescedRequests keys, as many as servers answer at once, either by
+// their inclusion or by an exclusion proof. Any failing proof fails the call.
+func BatchAccountExists(ctx context.Context, odr OdrBackend, id *TrieID, addrs []common.Address) ([]bool, error) {
+	accounts, err := batchAccounts(ctx, odr, id, addrs)
+	if err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(addrs))
+	for i, account := range accounts {
+		exists[i] = account != nil
+	}
+	return exists, nil
+}
+
+// SumBalances returns the sum of the balances of the accounts with the given
+// addresses in the state trie identified by id, each verified by its account
+// proof, with accounts that don't exist counting as zero. The accounts are
+// proven in batches like by BatchAccountExists, and any failing proof fails the
+// call rather than yielding a partial sum.
+func SumBalances(ctx context.Context, odr OdrBackend, id *TrieID, addrs []common.Address) (*big.Int, error) {
+	accounts, err := batchAccounts(ctx, odr, id, addrs)
+	if err != nil {
+		return nil, err
+	}
+	sum := new(big.Int)
+	for _, account := range accounts {
+		if account != nil {
+			sum.Add(sum, account.Balance)
+		}
+	}
+	return sum, nil
+}
+
+// batchAccounts retrieves the accounts with the given addresses from the state
+// trie identified by id for BatchAccountExists and SumBalances, aligned by index
+// with addrs and nil where they don't exist.
+func batchAccounts(ctx context.Context, odr OdrBackend, id *TrieID, addrs []common.Address) ([]*state.Account, error) {
+	var (
+		db       = backendDatabase(odr)
+		accounts = make([]*state.Account, len(addrs))
+		missing  []int
+	)
+	lookup := func(index int) bool {
+		key := addressHash(addrs[index])
+		value, ok := localValue(db, id.Root, key[:])
+		if !ok || value == nil {
+			return ok
+		}
+		account := new(state.Account)
+		if err := rlp.DecodeBytes(value, account); err != nil {
+			return false
+		}
+		accounts[index] = account
+		return true
+	}
+	cached := !BackendConfig(odr).NoCache[KindAccount]
+	for i := range addrs {
+		if !cached || !lookup(i) {
+			missing = append(missing, i)
+		}
+	}
+	for len(missing) > 0 {
+		chunk := missing
+		if len(chunk) > MaxCoalescedRequests {
+			chunk = chunk[:MaxCoalescedRequests]
+		}
+		missing = missing[len(chunk):]
+
+		batch := &BatchTrieRequest{Requests: make([]*TrieRequest, len(chunk))}
+		for i, index := range chunk {
+			key := addressHash(addrs[index])
+			batch.Requests[i] = newTrieRequest(db, id, key[:])
+		}
+		if err := odr.Retrieve(ctx, batch); err != nil {
+			return nil, err
+		}
+		if len(batch.Errs) != len(chunk) {
+			return nil, ErrMalformedResponse
+		}
+		for i, index := range chunk {
+			if batch.Errs[i] != nil {
+				return nil, batch.Errs[i]
+			}
+			// The stored proof must lead from the root to the account or its absence
+			if !lookup(index) {
+				return nil, ErrMalformedResponse
+			}
+		}
+	}
+	return accounts, nil
+}
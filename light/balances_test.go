@@ -0,0 +1,252 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// accountFailOdr is a test backend failing the account retrievals of a single
+// address.
+type accountFailOdr struct {
+	*testOdr
+	fail common.Address
+}
+
+var errAccountFail = errors.New("account retrieval failed")
+
+func (odr *accountFailOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if r, ok := req.(*AccountRequest); ok && r.Address == odr.fail {
+		return errAccountFail
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestBatchBalances(t *testing.T) {
+	// Retrieve one account after the other, so the failing first one can't be
+	// resolved from the proofs of the others
+	config := &Config{BatchBalanceConcurrency: 1}
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	ldb, _ := wtcdb.NewMemDatabase()
+	failing := common.HexToAddress("fa11")
+	odr := &accountFailOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb, config: config}, fail: failing}
+
+	addrs := []common.Address{failing, testBankAddress, acc2Addr, acc1Addr, testStateContract, acc1Addr}
+	want := []*big.Int{nil, testBankFunds, new(big.Int), big.NewInt(1000), new(big.Int), big.NewInt(1000)}
+
+	balances, errs := BatchBalances(context.Background(), odr, id, addrs)
+	if len(balances) != len(addrs) || len(errs) != len(addrs) {
+		t.Fatalf("result length mismatch: have %d/%d, want %d", len(balances), len(errs), len(addrs))
+	}
+	for i := range addrs {
+		if addrs[i] == failing {
+			if errs[i] != errAccountFail || balances[i] != nil {
+				t.Errorf("account %d: result mismatch: have %v, %v, want nil, %v", i, balances[i], errs[i], errAccountFail)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("account %d: failed to retrieve balance: %v", i, errs[i])
+			continue
+		}
+		if balances[i].Cmp(want[i]) != 0 {
+			t.Errorf("account %d: balance mismatch: have %v, want %v", i, balances[i], want[i])
+		}
+	}
+	// A cancelled batch fails every account not retrieved yet
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fresh, _ := wtcdb.NewMemDatabase()
+	_, errs = BatchBalances(ctx, &testOdr{sdb: sdb, ldb: fresh, disable: true}, id, addrs)
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("account %d: retrieved after cancellation", i)
+		}
+	}
+}
+
+func TestBalanceChanged(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	st, _ := state.New(header.Root, state.NewDatabase(sdb))
+	st.AddBalance(acc1Addr, big.NewInt(500), new(big.Int), new(big.Int))
+	st.SetNonce(testBankAddress, 4)
+	root, _ := st.CommitTo(sdb, true)
+	idA, idB := StateTrieID(header), StateTrieID(&types.Header{Number: big.NewInt(1), Root: root})
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	tests := []struct {
+		addr     common.Address
+		changed  bool
+		from, to *big.Int
+	}{
+		{acc1Addr, true, big.NewInt(1000), big.NewInt(1500)},
+		{testBankAddress, false, testBankFunds, testBankFunds}, // only the nonce changed
+		{acc2Addr, false, new(big.Int), new(big.Int)},          // doesn't exist at either end
+	}
+	for i, tt := range tests {
+		changed, from, to, err := BalanceChanged(context.Background(), odr, tt.addr, idA, idB)
+		if err != nil {
+			t.Errorf("test %d: failed to compare balances: %v", i, err)
+			continue
+		}
+		if changed != tt.changed || from.Cmp(tt.from) != 0 || to.Cmp(tt.to) != 0 {
+			t.Errorf("test %d: result mismatch: have %v, %v, %v, want %v, %v, %v", i, changed, from, to, tt.changed, tt.from, tt.to)
+		}
+	}
+	// A failing retrieval at either end fails the comparison
+	fresh, _ := wtcdb.NewMemDatabase()
+	failing := &accountFailOdr{testOdr: &testOdr{sdb: sdb, ldb: fresh}, fail: acc1Addr}
+	if changed, _, _, err := BalanceChanged(context.Background(), failing, acc1Addr, idA, idB); err != errAccountFail || changed {
+		t.Errorf("result mismatch for failing retrieval: have %v, %v, want false, %v", changed, err, errAccountFail)
+	}
+}
+
+func TestStorageRootDelta(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	other := common.HexToAddress("0x0fee")
+	st, _ := state.New(header.Root, state.NewDatabase(sdb))
+	st.SetState(testStateContract, testStateSlot(0), common.BigToHash(big.NewInt(42)))
+	st.AddBalance(acc1Addr, big.NewInt(500), new(big.Int), new(big.Int))
+	st.SetNonce(other, 1)
+	st.SetState(other, testStateSlot(0), common.BigToHash(big.NewInt(1)))
+	root, _ := st.CommitTo(sdb, true)
+	idA, idB := StateTrieID(header), StateTrieID(&types.Header{Number: big.NewInt(1), Root: root})
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	storageRoot := func(id *TrieID, addr common.Address) common.Hash {
+		st, _ := state.New(id.Root, state.NewDatabase(sdb))
+		if !st.Exist(addr) {
+			return types.EmptyRootHash
+		}
+		return st.StorageTrie(addr).Hash()
+	}
+	tests := []struct {
+		addr    common.Address
+		changed bool
+	}{
+		{testStateContract, true}, // a slot changed
+		{acc1Addr, false},         // only the balance changed
+		{acc2Addr, false},         // doesn't exist at either end
+		{other, true},             // created with storage
+	}
+	for i, tt := range tests {
+		changed, rootA, rootB, err := StorageRootDelta(context.Background(), odr, tt.addr, idA, idB)
+		if err != nil {
+			t.Errorf("test %d: failed to compare storage roots: %v", i, err)
+			continue
+		}
+		wantA, wantB := storageRoot(idA, tt.addr), storageRoot(idB, tt.addr)
+		if changed != tt.changed || rootA != wantA || rootB != wantB {
+			t.Errorf("test %d: result mismatch: have %v, %x, %x, want %v, %x, %x", i, changed, rootA, rootB, tt.changed, wantA, wantB)
+		}
+	}
+	// A failing retrieval at either end fails the comparison
+	fresh, _ := wtcdb.NewMemDatabase()
+	failing := &accountFailOdr{testOdr: &testOdr{sdb: sdb, ldb: fresh}, fail: testStateContract}
+	if changed, _, _, err := StorageRootDelta(context.Background(), failing, testStateContract, idA, idB); err != errAccountFail || changed {
+		t.Errorf("result mismatch for failing retrieval: have %v, %v, want false, %v", changed, err, errAccountFail)
+	}
+}
+
+// batchCountingOdr is a test backend recording the sizes of the batched trie
+// retrievals.
+type batchCountingOdr struct {
+	OdrBackend
+	sizes []int
+}
+
+func (odr *batchCountingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if r, ok := req.(*BatchTrieRequest); ok {
+		odr.sizes = append(odr.sizes, len(r.Requests))
+	}
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+func TestBatchAccountExists(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+
+	addrs := make([]common.Address, MaxCoalescedRequests+36)
+	want := make([]bool, len(addrs))
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	for i, addr := range []common.Address{testBankAddress, acc1Addr, testStateContract} {
+		index := i * 40
+		addrs[index], want[index] = addr, true
+	}
+	odr := &batchCountingOdr{OdrBackend: NewMemoryOdrBackend(sdb)}
+	exists, err := BatchAccountExists(context.Background(), odr, id, addrs)
+	if err != nil {
+		t.Fatalf("failed to check accounts: %v", err)
+	}
+	for i := range addrs {
+		if exists[i] != want[i] {
+			t.Errorf("account %d: existence mismatch: have %v, want %v", i, exists[i], want[i])
+		}
+	}
+	if len(odr.sizes) != 2 || odr.sizes[0] != MaxCoalescedRequests || odr.sizes[1] != 36 {
+		t.Errorf("batch sizes mismatch: have %v, want [%d 36]", odr.sizes, MaxCoalescedRequests)
+	}
+	// Everything is proven locally the second time
+	odr.sizes = nil
+	if again, err := BatchAccountExists(context.Background(), odr, id, addrs); err != nil || len(again) != len(addrs) || len(odr.sizes) != 0 {
+		t.Errorf("local check mismatch: have %d results, %v, %d retrievals", len(again), err, len(odr.sizes))
+	}
+	// A failing retrieval fails the whole check
+	ldb, _ := wtcdb.NewMemDatabase()
+	if _, err := BatchAccountExists(context.Background(), &testOdr{sdb: sdb, ldb: ldb, disable: true}, id, addrs); err != ErrOdrDisabled {
+		t.Errorf("error mismatch for failing retrieval: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
+
+func TestSumBalances(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+
+	addrs := []common.Address{testBankAddress, acc1Addr, acc2Addr, testStateContract}
+	odr := &batchCountingOdr{OdrBackend: NewMemoryOdrBackend(sdb)}
+	sum, err := SumBalances(context.Background(), odr, id, addrs)
+	if want := new(big.Int).Add(testBankFunds, big.NewInt(1000)); err != nil || sum.Cmp(want) != 0 {
+		t.Errorf("sum mismatch: have %v, %v, want %v", sum, err, want)
+	}
+	if len(odr.sizes) != 1 || odr.sizes[0] != len(addrs) {
+		t.Errorf("batch sizes mismatch: have %v, want [%d]", odr.sizes, len(addrs))
+	}
+	if sum, err := SumBalances(context.Background(), odr, id, nil); err != nil || sum.Sign() != 0 {
+		t.Errorf("empty sum mismatch: have %v, %v, want 0", sum, err)
+	}
+	// A failing retrieval must not yield a partial sum
+	ldb, _ := wtcdb.NewMemDatabase()
+	if sum, err := SumBalances(context.Background(), &testOdr{sdb: sdb, ldb: ldb, disable: true}, id, addrs); err != ErrOdrDisabled || sum != nil {
+		t.Errorf("failing retrieval mismatch: have %v, %v, want nil, %v", sum, err, ErrOdrDisabled)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrBlacklistedRoot is returned if a proof is against a root known to belong
+// to a bad fork.
+var ErrBlacklistedRoot = errors.New("root is blacklisted")
+
+var blacklistPrefix = []byte("light-blacklist-") // blacklistPrefix + root -> empty, the root is blacklisted
+
+// BlacklistRoot marks a state, storage or CHT root as belonging to a bad fork,
+// e.g. after a checkpoint conflict is detected. Proofs against it are rejected
+// from then on, so data of the bad fork can't be stored again. The mark is kept
+// in the database and survives restarts.
+func BlacklistRoot(db wtcdb.Database, root common.Hash) error {
+	return db.Put(append(append([]byte{}, blacklistPrefix...), root[:]...), []byte{})
+}
+
+// IsBlacklistedRoot returns whether the given root was blacklisted.
+func IsBlacklistedRoot(db wtcdb.Database, root common.Hash) bool {
+	ok, _ := db.Has(append(append([]byte{}, blacklistPrefix...), root[:]...))
+	return ok
+}
+
+// checkBlacklist returns ErrBlacklistedRoot if root was blacklisted.
+func checkBlacklist(db wtcdb.Database, root common.Hash) error {
+	if IsBlacklistedRoot(db, root) {
+		return ErrBlacklistedRoot
+	}
+	return nil
+}
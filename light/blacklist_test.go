@@ -0,0 +1,67 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestBlacklistRoot(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	if err := BlacklistRoot(ldb, header.Root); err != nil {
+		t.Fatalf("failed to blacklist state root: %v", err)
+	}
+	// The mark lives in the database, a backend opened on it later must honor it
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	if _, err := GetAccount(NoOdr, odr, id, testStateContract); err != ErrBlacklistedRoot {
+		t.Errorf("error mismatch for blacklisted state root: have %v, want %v", err, ErrBlacklistedRoot)
+	}
+	if value, _ := ldb.Get(header.Root[:]); value != nil {
+		t.Errorf("proof against blacklisted root stored")
+	}
+	// Only the blacklisted root itself is marked
+	if !IsBlacklistedRoot(ldb, id.Root) || IsBlacklistedRoot(ldb, header.ParentHash) {
+		t.Errorf("blacklist membership mismatch")
+	}
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 4)
+	root := makeTestCht(sdb, headers)
+	cht, _ := trie.New(root, sdb)
+
+	req := &ChtRequest{ChtRoot: root, BlockNum: 2, Header: headers[1], Td: headers[1].Number, Proof: cht.Prove(chtKey(2))}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store cht result: %v", err)
+	}
+	// Once the CHT root is blacklisted, no header is accepted through it anymore
+	BlacklistRoot(ldb, root)
+	req = &ChtRequest{ChtRoot: root, BlockNum: 3, Header: headers[2], Td: headers[2].Number, Proof: cht.Prove(chtKey(3))}
+	if err := req.StoreResult(ldb); err != ErrBlacklistedRoot {
+		t.Errorf("error mismatch for blacklisted cht root: have %v, want %v", err, ErrBlacklistedRoot)
+	}
+	if hash := core.GetCanonicalHash(ldb, 3); hash != (common.Hash{}) {
+		t.Errorf("header proven by blacklisted cht stored")
+	}
+}
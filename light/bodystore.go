@@ -0,0 +1,119 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var (
+	bodyBlobPrefix = []byte("light-body-")    // bodyBlobPrefix + hash(body rlp) -> body rlp
+	bodyRefPrefix  = []byte("light-bodyref-") // stored in place of a deduplicated body, followed by its hash
+
+	bodyPrefix = []byte("b") // prefix of the block bodies in the chain database
+)
+
+func bodyBlobKey(hash common.Hash) []byte {
+	return append(append([]byte{}, bodyBlobPrefix...), hash.Bytes()...)
+}
+
+// writeBody stores a block body in RLP encoding, deduplicated if the DedupBodies
+// option of the configuration bound to db is set. A body is always an RLP list,
+// so a pointer can't be mistaken for one.
+func writeBody(db wtcdb.Database, hash common.Hash, number uint64, data rlp.RawValue) error {
+	archiveBlock(db, hash, number)
+	if !ConfigOf(db).DedupBodies {
+		return core.WriteBodyRLP(db, hash, number, data)
+	}
+	blob := crypto.Keccak256Hash(data)
+	key := bodyBlobKey(blob)
+	if ok, _ := db.Has(key); !ok {
+		if err := db.Put(key, data); err != nil {
+			return err
+		}
+	}
+	if err := tagContent(db, blob, ContentBody); err != nil {
+		return err
+	}
+	return core.WriteBodyRLP(db, hash, number, append(append([]byte{}, bodyRefPrefix...), blob.Bytes()...))
+}
+
+// getBodyRLP retrieves a block body in RLP encoding, dereferencing it if it was
+// stored deduplicated.
+func getBodyRLP(db core.DatabaseReader, hash common.Hash, number uint64) rlp.RawValue {
+	data := core.GetBodyRLP(db, hash, number)
+	if !bytes.HasPrefix(data, bodyRefPrefix) {
+		return data
+	}
+	ref := common.BytesToHash(data[len(bodyRefPrefix):])
+	if ConfigOf(db).TagContent && !hasContentTag(db, ref, ContentBody) {
+		return nil
+	}
+	blob, _ := db.Get(bodyBlobKey(ref))
+	return blob
+}
+
+// getBody retrieves and decodes a block body, nil if none found.
+func getBody(db core.DatabaseReader, hash common.Hash, number uint64) *types.Body {
+	data := getBodyRLP(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(data, body); err != nil {
+		log.Error("Invalid block body RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return body
+}
+
+// CachedBodies calls fn with the number, hash and RLP size of every block body
+// in the local database. Deduplicated bodies report the size of their shared
+// blob. Databases supporting range iteration only visit the body entries.
+func CachedBodies(db wtcdb.Database, fn func(number uint64, hash common.Hash, size int)) error {
+	return forEachPrefix(db, bodyPrefix, func(key, value []byte) {
+		if len(key) != blockKeyLength {
+			return
+		}
+		size := len(value)
+		if bytes.HasPrefix(value, bodyRefPrefix) {
+			blob, _ := db.Get(bodyBlobKey(common.BytesToHash(value[len(bodyRefPrefix):])))
+			size = len(blob)
+		}
+		fn(binary.BigEndian.Uint64(key[1:9]), common.BytesToHash(key[9:]), size)
+	})
+}
+
+// DeleteCachedBody removes a block body from the local database. The blob of a
+// deduplicated body may be shared with other blocks and is kept. Bodies can't be
+// deleted if the configuration bound to db is in archive mode.
+func DeleteCachedBody(db wtcdb.Database, hash common.Hash, number uint64) error {
+	if ConfigOf(db).ArchiveMode {
+		return ErrArchiveMode
+	}
+	core.DeleteBody(db, hash, number)
+	return nil
+}
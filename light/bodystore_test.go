@@ -0,0 +1,129 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// countBodies returns the number of body blobs and deduplicated body pointers
+// in the database.
+func countBodies(db *wtcdb.MemDatabase) (blobs, refs int) {
+	for _, key := range db.Keys() {
+		switch {
+		case bytes.HasPrefix(key, bodyBlobPrefix):
+			blobs++
+		case len(key) == 41 && key[0] == 'b':
+			if value, _ := db.Get(key); bytes.HasPrefix(value, bodyRefPrefix) {
+				refs++
+			}
+		}
+	}
+	return blobs, refs
+}
+
+func TestDedupBodies(t *testing.T) {
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := BindConfig(mdb, &Config{DedupBodies: true})
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 16)
+	for _, header := range headers {
+		core.WriteHeader(db, header)
+	}
+	data, _ := rlp.EncodeToBytes(new(types.Body))
+	for _, header := range headers {
+		req := &BlockRequest{Hash: header.Hash(), Number: header.Number.Uint64(), Rlp: data}
+		if err := req.StoreResult(db); err != nil {
+			t.Fatalf("block %d: store failed: %v", header.Number, err)
+		}
+	}
+	if blobs, refs := countBodies(mdb); blobs != 1 || refs != len(headers) {
+		t.Fatalf("stored %d blobs and %d pointers, want 1 and %d", blobs, refs, len(headers))
+	}
+	odr := &testOdr{ldb: db, disable: true}
+	for _, header := range headers {
+		body, err := GetBody(context.Background(), odr, header.Hash(), header.Number.Uint64())
+		if err != nil {
+			t.Fatalf("block %d: read failed: %v", header.Number, err)
+		}
+		if len(body.Transactions) != 0 || len(body.Uncles) != 0 {
+			t.Errorf("block %d: body not empty", header.Number)
+		}
+	}
+
+	// Without the option bodies are stored in place.
+	req := &BlockRequest{Hash: genesis.Hash(), Number: 0, Rlp: data}
+	if err := req.StoreResult(mdb); err != nil {
+		t.Fatalf("store failed: %v", err)
+	}
+	if have := core.GetBodyRLP(db, genesis.Hash(), 0); !bytes.Equal(have, data) {
+		t.Errorf("body stored as %x, want %x", have, data)
+	}
+}
+
+func TestCachedBodies(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	uncles := makeTestHeaders(genesis.Header(), 3)
+
+	sizes := make(map[common.Hash]int)
+	parent := genesis.Header()
+	for i := 0; i <= len(uncles); i++ {
+		block := makeTestBlock(parent, nil, uncles[:i], nil)
+		core.WriteHeader(db, block.Header())
+		data, _ := rlp.EncodeToBytes(block.Body())
+		req := &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: data}
+		if err := req.StoreResult(db); err != nil {
+			t.Fatalf("block %d: store failed: %v", block.NumberU64(), err)
+		}
+		sizes[block.Hash()] = len(data)
+		parent = block.Header()
+	}
+	// The genesis body is cached too
+	sizes[genesis.Hash()] = len(core.GetBodyRLP(db, genesis.Hash(), 0))
+
+	seen := make(map[common.Hash]int)
+	err := CachedBodies(db, func(number uint64, hash common.Hash, size int) {
+		if header := core.GetHeader(db, hash, number); header == nil {
+			t.Errorf("body %x: unknown block %d", hash, number)
+		}
+		seen[hash] = size
+	})
+	if err != nil {
+		t.Fatalf("failed to enumerate bodies: %v", err)
+	}
+	if !reflect.DeepEqual(seen, sizes) {
+		t.Errorf("bodies mismatch: have %v, want %v", seen, sizes)
+	}
+	// Deleted bodies are no longer listed
+	DeleteCachedBody(db, parent.Hash(), parent.Number.Uint64())
+	delete(sizes, parent.Hash())
+	seen = make(map[common.Hash]int)
+	CachedBodies(db, func(number uint64, hash common.Hash, size int) { seen[hash] = size })
+	if !reflect.DeepEqual(seen, sizes) {
+		t.Errorf("bodies mismatch after delete: have %v, want %v", seen, sizes)
+	}
+}
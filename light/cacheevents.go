@@ -0,0 +1,175 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// cacheEventBuffer is the number of events buffered for each subscriber before
+// further events are dropped.
+const cacheEventBuffer = 256
+
+// CacheEventType is the type of an access to the local ODR cache.
+type CacheEventType int
+
+const (
+	CacheStore CacheEventType = iota // an entry was written
+	CacheEvict                       // an entry was deleted
+	CacheHit                         // an entry was read
+	CacheMiss                        // a read found no entry
+)
+
+// String implements fmt.Stringer
+func (t CacheEventType) String() string {
+	switch t {
+	case CacheStore:
+		return "store"
+	case CacheEvict:
+		return "evict"
+	case CacheHit:
+		return "hit"
+	case CacheMiss:
+		return "miss"
+	default:
+		return "unknown"
+	}
+}
+
+// CacheEvent is a single access to the local ODR cache.
+type CacheEvent struct {
+	Type CacheEventType
+	Key  []byte
+	Size int // size of the stored or read value
+	Time time.Time
+}
+
+// CacheEventDatabase wraps the database of an ODR backend, reporting writes,
+// deletions and reads to subscribers. Events are delivered without blocking:
+// if a subscriber doesn't keep up, the events it can't take are dropped.
+type CacheEventDatabase struct {
+	eventView
+
+	lock    sync.RWMutex
+	subs    map[chan CacheEvent]struct{}
+	dropped uint64 // number of events dropped for slow subscribers (atomic)
+}
+
+// NewCacheEventDatabase creates an event reporting wrapper around db.
+func NewCacheEventDatabase(db wtcdb.Database) *CacheEventDatabase {
+	edb := &CacheEventDatabase{subs: make(map[chan CacheEvent]struct{})}
+	edb.eventView = eventView{Database: db, feed: edb}
+	return edb
+}
+
+// SubscribeCacheEvents creates a new subscription to the cache events, returning
+// the channel they are delivered on and a function cancelling the subscription.
+func (db *CacheEventDatabase) SubscribeCacheEvents() (<-chan CacheEvent, func()) {
+	ch := make(chan CacheEvent, cacheEventBuffer)
+
+	db.lock.Lock()
+	db.subs[ch] = struct{}{}
+	db.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			db.lock.Lock()
+			delete(db.subs, ch)
+			close(ch)
+			db.lock.Unlock()
+		})
+	}
+}
+
+// Dropped returns the number of events dropped because of slow subscribers.
+func (db *CacheEventDatabase) Dropped() uint64 {
+	return atomic.LoadUint64(&db.dropped)
+}
+
+// ForRequest implements RequestDatabase, reporting the events of the request
+// specific view of the wrapped database.
+func (db *CacheEventDatabase) ForRequest(req OdrRequest) wtcdb.Database {
+	view := StoreDatabase(db.Database, req)
+	if view == db.Database {
+		return db
+	}
+	return &eventView{Database: view, feed: db}
+}
+
+// send delivers an event to all subscribers that have room for it.
+func (db *CacheEventDatabase) send(typ CacheEventType, key []byte, size int) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if len(db.subs) == 0 {
+		return
+	}
+	ev := CacheEvent{Type: typ, Key: common.CopyBytes(key), Size: size, Time: clock.Now()}
+	for ch := range db.subs {
+		select {
+		case ch <- ev:
+		default:
+			atomic.AddUint64(&db.dropped, 1)
+		}
+	}
+}
+
+// eventView reports the accesses to a database as cache events.
+type eventView struct {
+	wtcdb.Database
+	feed *CacheEventDatabase
+}
+
+// Put writes a value, reporting a store event.
+func (v *eventView) Put(key []byte, value []byte) error {
+	if err := v.Database.Put(key, value); err != nil {
+		return err
+	}
+	v.feed.send(CacheStore, key, len(value))
+	return nil
+}
+
+// Get reads a value, reporting a hit or a miss.
+func (v *eventView) Get(key []byte) ([]byte, error) {
+	value, err := v.Database.Get(key)
+	if err != nil {
+		v.feed.send(CacheMiss, key, 0)
+	} else {
+		v.feed.send(CacheHit, key, len(value))
+	}
+	return value, err
+}
+
+// Delete removes a value, reporting an evict event.
+func (v *eventView) Delete(key []byte) error {
+	if err := v.Database.Delete(key); err != nil {
+		return err
+	}
+	v.feed.send(CacheEvict, key, 0)
+	return nil
+}
+
+// NewBatch creates a batch reporting a store event for each entry on Write.
+func (v *eventView) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: v}
+}
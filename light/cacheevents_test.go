@@ -0,0 +1,86 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestCacheEvents(t *testing.T) {
+	mem, _ := wtcdb.NewMemDatabase()
+	db := NewCacheEventDatabase(mem)
+	events, unsub := db.SubscribeCacheEvents()
+	defer unsub()
+
+	db.Put([]byte("key"), []byte("value"))
+	db.Get([]byte("key"))
+	db.Get([]byte("missing"))
+	db.Delete([]byte("key"))
+
+	want := []struct {
+		typ  CacheEventType
+		key  string
+		size int
+	}{
+		{CacheStore, "key", 5},
+		{CacheHit, "key", 5},
+		{CacheMiss, "missing", 0},
+		{CacheEvict, "key", 0},
+	}
+	for i, w := range want {
+		select {
+		case ev := <-events:
+			if ev.Type != w.typ || string(ev.Key) != w.key || ev.Size != w.size || ev.Time.IsZero() {
+				t.Errorf("event %d mismatch: have %v %q %d, want %v %q %d", i, ev.Type, ev.Key, ev.Size, w.typ, w.key, w.size)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+	unsub()
+	if _, ok := <-events; ok {
+		t.Errorf("event delivered after unsubscribing")
+	}
+}
+
+func TestCacheEventsSlowConsumer(t *testing.T) {
+	mem, _ := wtcdb.NewMemDatabase()
+	db := NewCacheEventDatabase(mem)
+	_, unsub := db.SubscribeCacheEvents()
+	defer unsub()
+
+	// Nobody reads the events, the stores must complete regardless
+	const stores = 4 * cacheEventBuffer
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < stores; i++ {
+			db.Put([]byte{byte(i >> 8), byte(i)}, []byte{0x01})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stores blocked by slow consumer")
+	}
+	if dropped := db.Dropped(); dropped != stores-cacheEventBuffer {
+		t.Errorf("dropped count mismatch: have %d, want %d", dropped, stores-cacheEventBuffer)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/core/vm"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/params"
+)
+
+// StorageSlot identifies a single storage slot of a contract.
+type StorageSlot struct {
+	Address common.Address
+	Key     common.Hash
+}
+
+// CallResult is the outcome of a read-only contract call executed against
+// state retrieved on demand through ODR.
+type CallResult struct {
+	Return  []byte        // data returned by the call
+	GasUsed uint64        // gas consumed by the execution
+	Err     error         // EVM execution error (revert, out of gas, write protection)
+	Slots   []StorageSlot // storage slots read during execution, in access order
+}
+
+// Call executes a read-only call of the contract at to with the given input
+// against the state of header. Accounts, code and storage slots are fetched
+// lazily from the ODR backend as the execution touches them, each one verified
+// against the state root. The state is discarded afterwards. The chain is only
+// consulted by the BLOCKHASH opcode.
+//
+// An error is returned if any part of the state could not be retrieved; EVM
+// failures are reported in CallResult.Err instead.
+func Call(ctx context.Context, odr OdrBackend, chain core.ChainContext, config *params.ChainConfig, header *types.Header, from, to common.Address, input []byte, gas uint64) (*CallResult, error) {
+	db := &slotRecorder{
+		Database: NewStateDatabase(ctx, header, odr),
+		addrs:    make(map[common.Hash]common.Address),
+		seen:     make(map[StorageSlot]bool),
+	}
+	st, err := state.New(header.Root, db)
+	if err != nil {
+		return nil, err
+	}
+	msg := types.NewMessage(from, &to, 0, new(big.Int), new(big.Int).SetUint64(gas), new(big.Int), input, false)
+	context := core.NewEVMContext(msg, header, chain, &header.Coinbase)
+	evm := vm.NewEVM(context, st, config, vm.Config{})
+
+	ret, left, vmerr := evm.StaticCall(vm.AccountRef(from), to, input, gas)
+	if err := st.Error(); err != nil {
+		return nil, err
+	}
+	return &CallResult{Return: ret, GasUsed: gas - left, Err: vmerr, Slots: db.slots}, nil
+}
+
+// Prewarm retrieves the accounts, code and storage slots touched by an earlier
+// call, as reported in CallResult.Slots, so that repeating the call against the
+// same state is answered from the local database.
+func Prewarm(ctx context.Context, odr OdrBackend, header *types.Header, slots []StorageSlot) error {
+	var (
+		st   = NewState(ctx, header, odr)
+		done = make(map[common.Address]bool)
+	)
+	for _, slot := range slots {
+		if !done[slot.Address] {
+			done[slot.Address] = true
+			st.GetCode(slot.Address)
+		}
+		st.GetState(slot.Address, slot.Key)
+		if err := st.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slotRecorder is a state database recording every storage slot read through
+// it. Account trie reads are tracked too, so storage tries, which are opened
+// by address hash, can be attributed to their account.
+type slotRecorder struct {
+	state.Database
+	addrs map[common.Hash]common.Address
+	slots []StorageSlot
+	seen  map[StorageSlot]bool
+}
+
+func (db *slotRecorder) OpenTrie(root common.Hash) (state.Trie, error) {
+	t, err := db.Database.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingTrie{Trie: t, db: db, account: true}, nil
+}
+
+func (db *slotRecorder) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	t, err := db.Database.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingTrie{Trie: t, db: db, addrHash: addrHash}, nil
+}
+
+func (db *slotRecorder) CopyTrie(t state.Trie) state.Trie {
+	if rt, ok := t.(*recordingTrie); ok {
+		return &recordingTrie{Trie: db.Database.CopyTrie(rt.Trie), db: db, account: rt.account, addrHash: rt.addrHash}
+	}
+	return db.Database.CopyTrie(t)
+}
+
+type recordingTrie struct {
+	state.Trie
+	db       *slotRecorder
+	account  bool
+	addrHash common.Hash
+}
+
+func (t *recordingTrie) TryGet(key []byte) ([]byte, error) {
+	if t.account {
+		t.db.addrs[crypto.Keccak256Hash(key)] = common.BytesToAddress(key)
+	} else {
+		slot := StorageSlot{Address: t.db.addrs[t.addrHash], Key: common.BytesToHash(key)}
+		if !t.db.seen[slot] {
+			t.db.seen[slot] = true
+			t.db.slots = append(t.db.slots, slot)
+		}
+	}
+	return t.Trie.TryGet(key)
+}
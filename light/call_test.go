@@ -0,0 +1,97 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/params"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeCallState commits a state holding the runtime part of testContractCode,
+// whose get(uint256) view function returns storage slot i.
+func makeCallState(db wtcdb.Database) *types.Header {
+	st, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	st.SetCode(testStateContract, testContractCode[16:])
+	for i := 0; i < testStateSlots; i++ {
+		st.SetState(testStateContract, testStateSlot(i), common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	root, err := st.CommitTo(db, true)
+	if err != nil {
+		panic(err)
+	}
+	return &types.Header{Number: big.NewInt(1), Root: root, Time: new(big.Int), Difficulty: new(big.Int), GasLimit: big.NewInt(4712388)}
+}
+
+func TestCall(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeCallState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	input := common.Hex2Bytes("60cd2685" + "0000000000000000000000000000000000000000000000000000000000000003")
+	res, err := Call(context.Background(), odr, nil, params.TestChainConfig, header, acc1Addr, testStateContract, input, 100000)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if res.Err != nil {
+		t.Fatalf("execution failed: %v", res.Err)
+	}
+	if want := common.BigToHash(big.NewInt(4)).Bytes(); !reflect.DeepEqual(res.Return, want) {
+		t.Errorf("return mismatch: have %x, want %x", res.Return, want)
+	}
+	if res.GasUsed == 0 {
+		t.Errorf("no gas used")
+	}
+	want := []StorageSlot{{Address: testStateContract, Key: testStateSlot(3)}}
+	if !reflect.DeepEqual(res.Slots, want) {
+		t.Errorf("slots mismatch: have %v, want %v", res.Slots, want)
+	}
+
+	// Prewarming a fresh database must allow the call to run without ODR.
+	ldb, _ = wtcdb.NewMemDatabase()
+	odr = &testOdr{sdb: sdb, ldb: ldb}
+	if err := Prewarm(context.Background(), odr, header, res.Slots); err != nil {
+		t.Fatalf("prewarm failed: %v", err)
+	}
+	odr.disable = true
+	again, err := Call(context.Background(), odr, nil, params.TestChainConfig, header, acc1Addr, testStateContract, input, 100000)
+	if err != nil {
+		t.Fatalf("prewarmed call failed: %v", err)
+	}
+	if !reflect.DeepEqual(again.Return, res.Return) {
+		t.Errorf("prewarmed return mismatch: have %x, want %x", again.Return, res.Return)
+	}
+}
+
+func TestCallMissingState(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeCallState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb, disable: true}
+
+	if _, err := Call(context.Background(), odr, nil, params.TestChainConfig, header, acc1Addr, testStateContract, nil, 100000); err == nil {
+		t.Fatal("call succeeded without retrievable state")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrSuperseded is returned by a retrieval that was cancelled because a newer
+// request was issued on the same channel.
+var ErrSuperseded = errors.New("request superseded")
+
+type channelKey struct{}
+
+// WithChannel tags all retrievals made with the returned context with a logical
+// channel. When used through a ChannelOdr, a new retrieval on a channel cancels
+// the one still in flight on the same channel.
+func WithChannel(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, channelKey{}, key)
+}
+
+// channelHead is the retrieval currently in flight on a channel.
+type channelHead struct {
+	cancel     context.CancelFunc
+	superseded bool
+}
+
+// ChannelOdr wraps an OdrBackend, implementing cancel-and-replace semantics for
+// retrievals tagged with WithChannel. Untagged retrievals are passed through.
+type ChannelOdr struct {
+	OdrBackend
+	lock     sync.Mutex
+	channels map[string]*channelHead
+}
+
+// NewChannelOdr creates a channel aware wrapper around backend.
+func NewChannelOdr(backend OdrBackend) *ChannelOdr {
+	return &ChannelOdr{
+		OdrBackend: backend,
+		channels:   make(map[string]*channelHead),
+	}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *ChannelOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve cancels any older retrieval on the channel of ctx and then retrieves
+// req through the wrapped backend.
+func (odr *ChannelOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	key, ok := ctx.Value(channelKey{}).(string)
+	if !ok {
+		return odr.OdrBackend.Retrieve(ctx, req)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	head := &channelHead{cancel: cancel}
+	odr.lock.Lock()
+	if prev := odr.channels[key]; prev != nil {
+		prev.superseded = true
+		prev.cancel()
+	}
+	odr.channels[key] = head
+	odr.lock.Unlock()
+
+	err := odr.OdrBackend.Retrieve(ctx, req)
+
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+	if odr.channels[key] == head {
+		delete(odr.channels, key)
+	}
+	if err != nil && head.superseded {
+		return ErrSuperseded
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// hangingOdr is a backend whose retrievals only return when their context is
+// cancelled.
+type hangingOdr struct {
+	OdrBackend
+	started chan OdrRequest
+}
+
+func newHangingOdr() *hangingOdr {
+	return &hangingOdr{started: make(chan OdrRequest, 16)}
+}
+
+func (odr *hangingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	odr.started <- req
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestChannelSupersede(t *testing.T) {
+	backend := newHangingOdr()
+	odr := NewChannelOdr(backend)
+	ctx := WithChannel(context.Background(), "view")
+
+	first := make(chan error, 1)
+	go func() { first <- odr.Retrieve(ctx, &BlockRequest{Number: 1}) }()
+	<-backend.started
+
+	ctx2, cancel := context.WithCancel(ctx)
+	second := make(chan error, 1)
+	go func() { second <- odr.Retrieve(ctx2, &BlockRequest{Number: 6}) }()
+	<-backend.started
+
+	select {
+	case err := <-first:
+		if err != ErrSuperseded {
+			t.Fatalf("superseded request error mismatch: have %v, want %v", err, ErrSuperseded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("superseded request not cancelled")
+	}
+	select {
+	case err := <-second:
+		t.Fatalf("newer request returned early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	if err := <-second; err != context.Canceled {
+		t.Fatalf("cancelled request error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestChannelIndependent(t *testing.T) {
+	backend := newHangingOdr()
+	odr := NewChannelOdr(backend)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 2)
+	go func() { errc <- odr.Retrieve(WithChannel(ctx, "a"), &BlockRequest{Number: 1}) }()
+	go func() { errc <- odr.Retrieve(WithChannel(ctx, "b"), &BlockRequest{Number: 2}) }()
+	<-backend.started
+	<-backend.started
+
+	select {
+	case err := <-errc:
+		t.Fatalf("request on other channel cancelled: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrCheckpointUnverifiable is returned if neither the section head nor the CHT
+// of a checkpoint is available locally to check cached headers against.
+var ErrCheckpointUnverifiable = errors.New("checkpoint can't be verified locally")
+
+var (
+	checkpointPrefix    = []byte("light-checkpoint-") // checkpointPrefix + section (uint64 big endian) -> checkpoint
+	bloomTrieRootPrefix = []byte("light-bloomroot-")  // bloomTrieRootPrefix + section (uint64 big endian) -> root hash
+)
+
+// Checkpoint is a trusted snapshot of the trie roots belonging to a section of
+// the chain, obtained out of band (e.g. hard coded or set by the user).
+type Checkpoint struct {
+	Section     uint64
+	SectionHead common.Hash // hash of the last block of the section
+	ChtRoot     common.Hash
+	BloomRoot   common.Hash
+}
+
+// sectionKey appends the big endian encoding of a section index to prefix.
+func sectionKey(prefix []byte, section uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], section)
+	return key
+}
+
+// GetCheckpoint retrieves the trusted checkpoint of a section, or nil if none
+// is known.
+func GetCheckpoint(db wtcdb.Database, section uint64) *Checkpoint {
+	data, _ := db.Get(sectionKey(checkpointPrefix, section))
+	if len(data) == 0 {
+		return nil
+	}
+	cp := new(Checkpoint)
+	if err := rlp.DecodeBytes(data, cp); err != nil {
+		return nil
+	}
+	return cp
+}
+
+// WriteCheckpoint stores a trusted checkpoint.
+func WriteCheckpoint(db wtcdb.Database, cp *Checkpoint) error {
+	data, err := rlp.EncodeToBytes(cp)
+	if err != nil {
+		return err
+	}
+	return db.Put(sectionKey(checkpointPrefix, cp.Section), data)
+}
+
+// chtSectionRoot returns the root of a CHT covering the given section, taken
+// from the trusted CHT or the checkpoint of the section, or an empty hash if
+// none is known.
+func chtSectionRoot(db wtcdb.Database, section uint64) common.Hash {
+	if cht := GetTrustedCht(db); section < cht.Number {
+		return cht.Root
+	}
+	if cp := GetCheckpoint(db, section); cp != nil {
+		return cp.ChtRoot
+	}
+	return common.Hash{}
+}
+
+// HasChtSection tells whether the blocks of a section can be looked up by number
+// through a CHT: a CHT root covering the section must be known and the header of
+// the section head stored locally.
+func HasChtSection(db wtcdb.Database, section uint64) bool {
+	if chtSectionRoot(db, section) == (common.Hash{}) {
+		return false
+	}
+	head := (section+1)*ChtFrequency - 1
+	return getHeader(db, core.GetCanonicalHash(db, head), head) != nil
+}
+
+// AvailableChtSections returns the sections for which HasChtSection holds, in
+// ascending order. The sections covered by the trusted CHT are checked, followed
+// by the ones with consecutive checkpoints after it.
+func AvailableChtSections(db wtcdb.Database) ([]uint64, error) {
+	last := GetTrustedCht(db).Number
+	for GetCheckpoint(db, last) != nil {
+		last++
+	}
+	if last == 0 {
+		return nil, ErrNoTrustedCht
+	}
+	var sections []uint64
+	for section := uint64(0); section < last; section++ {
+		if HasChtSection(db, section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
+
+// GetTrustedBloomTrieRoot retrieves the verified BloomTrie root of a section, or
+// an empty hash if it is not known yet.
+func GetTrustedBloomTrieRoot(db wtcdb.Database, section uint64) common.Hash {
+	data, _ := db.Get(sectionKey(bloomTrieRootPrefix, section))
+	return common.BytesToHash(data)
+}
+
+// ValidateAgainstCheckpoint checks the cached canonical headers of the section of
+// a newly trusted checkpoint, returning the numbers of the blocks contradicting
+// it in ascending order. The expected hashes are derived by following parent
+// hashes back from the section head as long as the headers are cached, falling
+// back to the locally available nodes of the checkpoint's CHT otherwise.
+//
+// Conflicts mean the client was fed a bad chain, see PurgeConflicts.
+func ValidateAgainstCheckpoint(db wtcdb.Database, cp Checkpoint) ([]uint64, error) {
+	var cht *trie.Trie
+	if cp.ChtRoot != (common.Hash{}) {
+		cht, _ = trie.New(cp.ChtRoot, db)
+	}
+	if cp.SectionHead == (common.Hash{}) && cht == nil {
+		return nil, ErrCheckpointUnverifiable
+	}
+	var (
+		start, end = cp.Section * ChtFrequency, (cp.Section+1)*ChtFrequency - 1
+		expected   = cp.SectionHead
+		conflicts  []uint64
+	)
+	for n := end; ; n-- {
+		if expected == (common.Hash{}) && cht != nil {
+			expected = localChtHash(cht, n)
+		}
+		if hash := core.GetCanonicalHash(db, n); hash != (common.Hash{}) && expected != (common.Hash{}) && hash != expected {
+			conflicts = append(conflicts, n)
+		}
+		// Move on to the parent of the expected header if known
+		var parent common.Hash
+		if expected != (common.Hash{}) {
+			if header := getHeader(db, expected, n); header != nil {
+				parent = header.ParentHash
+			}
+		}
+		expected = parent
+
+		if n == start {
+			break
+		}
+	}
+	for i, j := 0, len(conflicts)-1; i < j; i, j = i+1, j-1 {
+		conflicts[i], conflicts[j] = conflicts[j], conflicts[i]
+	}
+	return conflicts, nil
+}
+
+// localChtHash looks up the canonical hash of a block in the locally available
+// part of a CHT, returning an empty hash if it's not available.
+func localChtHash(cht *trie.Trie, number uint64) common.Hash {
+	value, err := cht.TryGet(chtKey(number))
+	if err != nil || value == nil {
+		return common.Hash{}
+	}
+	var node ChtNode
+	if err := rlp.DecodeBytes(value, &node); err != nil {
+		return common.Hash{}
+	}
+	return node.Hash
+}
+
+// PurgeConflicts removes the canonical hashes and headers of the given blocks,
+// as reported by ValidateAgainstCheckpoint, so they get retrieved again.
+func PurgeConflicts(db wtcdb.Database, numbers []uint64) {
+	for _, n := range numbers {
+		hash := core.GetCanonicalHash(db, n)
+		core.DeleteCanonicalHash(db, n)
+		deleteHeader(db, hash, n)
+		core.DeleteTd(db, hash, n)
+	}
+}
+
+// VerifyCachedCht checks the CHT data cached by a previous session against the
+// given trusted checkpoints before it's relied on, returning the sections that
+// disagree with them in ascending order. A section disagrees if a cached CHT
+// root of it differs from the checkpoint's, or if its cached canonical headers
+// contradict the checkpoint as reported by ValidateAgainstCheckpoint.
+//
+// Disagreeing sections are purged: their cached roots are replaced by the
+// trusted ones and their canonical headers dropped, so they get synced again.
+func VerifyCachedCht(db wtcdb.Database, checkpoints []Checkpoint) ([]uint64, error) {
+	cps := make([]Checkpoint, len(checkpoints))
+	copy(cps, checkpoints)
+	sort.Slice(cps, func(i, j int) bool { return cps[i].Section < cps[j].Section })
+
+	var sections []uint64
+	for _, cp := range cps {
+		if cp.ChtRoot != (common.Hash{}) && !cachedChtRootsMatch(db, cp) {
+			if err := replaceCachedChtRoots(db, cp); err != nil {
+				return nil, err
+			}
+			// The cached headers were verified against a bad root, drop them all
+			// except for the genesis, which is never retrieved
+			var numbers []uint64
+			for n := cp.Section * ChtFrequency; n < (cp.Section+1)*ChtFrequency; n++ {
+				if n > 0 && core.GetCanonicalHash(db, n) != (common.Hash{}) {
+					numbers = append(numbers, n)
+				}
+			}
+			PurgeConflicts(db, numbers)
+			sections = append(sections, cp.Section)
+			continue
+		}
+		conflicts, err := ValidateAgainstCheckpoint(db, cp)
+		if err == ErrCheckpointUnverifiable {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			PurgeConflicts(db, conflicts)
+			sections = append(sections, cp.Section)
+		}
+	}
+	return sections, nil
+}
+
+// cachedChtRootsMatch tells whether the locally cached CHT roots of the section
+// of a trusted checkpoint all agree with it. Missing roots don't disagree.
+func cachedChtRootsMatch(db wtcdb.Database, cp Checkpoint) bool {
+	if cached := GetCheckpoint(db, cp.Section); cached != nil && cached.ChtRoot != cp.ChtRoot {
+		return false
+	}
+	if cht := GetTrustedCht(db); cht.Number == cp.Section+1 && cht.Root != cp.ChtRoot {
+		return false
+	}
+	if prev := getPreviousCht(db); prev != nil && prev.Cht.Number == cp.Section+1 && prev.Cht.Root != cp.ChtRoot {
+		return false
+	}
+	return true
+}
+
+// replaceCachedChtRoots overwrites the cached CHT roots of the section of a
+// trusted checkpoint with its root.
+func replaceCachedChtRoots(db wtcdb.Database, cp Checkpoint) error {
+	if cached := GetCheckpoint(db, cp.Section); cached != nil {
+		cached.ChtRoot = cp.ChtRoot
+		if err := WriteCheckpoint(db, cached); err != nil {
+			return err
+		}
+	}
+	if cht := GetTrustedCht(db); cht.Number == cp.Section+1 {
+		WriteTrustedCht(db, TrustedCht{Number: cht.Number, Root: cp.ChtRoot})
+	}
+	if prev := getPreviousCht(db); prev != nil && prev.Cht.Number == cp.Section+1 {
+		db.Delete(previousChtKey)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeTestBloomTrie creates a synthetic BloomTrie of a section, mapping each
+// bloom bit index to a fake compressed bit vector.
+func makeTestBloomTrie(db wtcdb.Database, section uint64) common.Hash {
+	t, _ := trie.New(common.Hash{}, db)
+	for bit := uint16(0); bit < 2048; bit += 64 {
+		var key [10]byte
+		binary.BigEndian.PutUint16(key[:2], bit)
+		binary.BigEndian.PutUint64(key[2:], section)
+		t.Update(key[:], crypto.Keccak256(key[:]))
+	}
+	root, _ := t.CommitTo(db)
+	return root
+}
+
+func TestBloomTrieRootRequest(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	root := makeTestBloomTrie(db, 3)
+
+	// Without a checkpoint there's nothing to trust the root by
+	req := &BloomTrieRootRequest{Section: 3, Root: root}
+	if err := req.StoreResult(db); err != ErrNoCheckpoint {
+		t.Errorf("error mismatch without checkpoint: have %v, want %v", err, ErrNoCheckpoint)
+	}
+	if err := WriteCheckpoint(db, &Checkpoint{Section: 3, BloomRoot: root}); err != nil {
+		t.Fatalf("failed to write checkpoint: %v", err)
+	}
+	forged := &BloomTrieRootRequest{Section: 3, Root: makeTestBloomTrie(db, 4)}
+	if err := forged.StoreResult(db); err != ErrCheckpointMismatch {
+		t.Errorf("error mismatch for forged root: have %v, want %v", err, ErrCheckpointMismatch)
+	}
+	if have := GetTrustedBloomTrieRoot(db, 3); have != (common.Hash{}) {
+		t.Errorf("forged root trusted: %x", have)
+	}
+	if err := req.StoreResult(db); err != nil {
+		t.Fatalf("failed to store matching root: %v", err)
+	}
+	if have := GetTrustedBloomTrieRoot(db, 3); have != root {
+		t.Errorf("trusted root mismatch: have %x, want %x", have, root)
+	}
+	// The trusted root anchors the bit vectors of the section
+	var key [10]byte
+	binary.BigEndian.PutUint16(key[:2], 64)
+	binary.BigEndian.PutUint64(key[2:], 3)
+	tr, _ := trie.New(root, db)
+	if vector, err := trie.VerifyProof(GetTrustedBloomTrieRoot(db, 3), key[:], tr.Prove(key[:])); err != nil || !bytes.Equal(vector, crypto.Keccak256(key[:])) {
+		t.Errorf("bit vector mismatch: have %x, %v", vector, err)
+	}
+	other := &BloomTrieRootRequest{Section: 4, Root: root}
+	if err := other.StoreResult(db); err != ErrNoCheckpoint {
+		t.Errorf("error mismatch for uncovered section: have %v, want %v", err, ErrNoCheckpoint)
+	}
+}
+
+// writeCanonicalHeaders caches the given headers as the canonical chain.
+func writeCanonicalHeaders(db wtcdb.Database, headers []*types.Header) {
+	for _, header := range headers {
+		core.WriteHeader(db, header)
+		core.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+	}
+}
+
+func TestValidateAgainstCheckpoint(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 8)
+	fork := newTestUncle(headers[3], "fork")
+	forked := append([]*types.Header{fork}, makeTestHeaders(fork, 2)...)
+	cp := Checkpoint{Section: 1, SectionHead: headers[6].Hash()}
+
+	// The cache holds the canonical chain with a single forged canonical entry,
+	// detectable by following the parent hashes from the section head
+	db, _ := wtcdb.NewMemDatabase()
+	writeCanonicalHeaders(db, headers[:8])
+	writeCanonicalHeaders(db, []*types.Header{newTestUncle(headers[3], "forged")})
+	conflicts, err := ValidateAgainstCheckpoint(db, cp)
+	if err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0] != 5 {
+		t.Errorf("conflicts mismatch: have %v, want [5]", conflicts)
+	}
+	PurgeConflicts(db, conflicts)
+	if hash := core.GetCanonicalHash(db, 5); hash != (common.Hash{}) {
+		t.Errorf("conflicting canonical hash not purged: %x", hash)
+	}
+	if conflicts, _ := ValidateAgainstCheckpoint(db, cp); len(conflicts) != 0 {
+		t.Errorf("conflicts left after purge: %v", conflicts)
+	}
+
+	// The cache holds a fork of the section, detectable through the CHT
+	db, _ = wtcdb.NewMemDatabase()
+	writeCanonicalHeaders(db, headers[:4])
+	writeCanonicalHeaders(db, forked)
+	cp.ChtRoot = makeTestCht(db, headers)
+	if conflicts, err := ValidateAgainstCheckpoint(db, cp); err != nil || len(conflicts) != 3 || conflicts[0] != 5 || conflicts[2] != 7 {
+		t.Errorf("conflicts mismatch: have %v, %v, want [5 6 7]", conflicts, err)
+	}
+	if _, err := ValidateAgainstCheckpoint(db, Checkpoint{Section: 1}); err != ErrCheckpointUnverifiable {
+		t.Errorf("error mismatch without anchors: have %v, want %v", err, ErrCheckpointUnverifiable)
+	}
+}
+
+func TestVerifyCachedCht(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 8)
+	writeCanonicalHeaders(db, headers)
+	checkpoints := []Checkpoint{
+		{Section: 1, SectionHead: headers[6].Hash(), ChtRoot: makeTestCht(db, headers[:7])},
+		{Section: 0, SectionHead: headers[2].Hash(), ChtRoot: makeTestCht(db, headers[:3])},
+	}
+	// The session left a matching trusted CHT for section 0, but a corrupted
+	// cached root for section 1
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: checkpoints[1].ChtRoot})
+	WriteCheckpoint(db, &Checkpoint{Section: 1, SectionHead: headers[6].Hash(), ChtRoot: common.HexToHash("bad")})
+
+	sections, err := VerifyCachedCht(db, checkpoints)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if !reflect.DeepEqual(sections, []uint64{1}) {
+		t.Errorf("disagreeing sections mismatch: have %v, want [1]", sections)
+	}
+	if root := GetCheckpoint(db, 1).ChtRoot; root != checkpoints[0].ChtRoot {
+		t.Errorf("cached root not replaced: have %x, want %x", root, checkpoints[0].ChtRoot)
+	}
+	for n := uint64(4); n < 8; n++ {
+		if hash := core.GetCanonicalHash(db, n); hash != (common.Hash{}) {
+			t.Errorf("canonical hash %d of purged section kept: %x", n, hash)
+		}
+	}
+	for _, n := range []uint64{3, 8} {
+		if hash := core.GetCanonicalHash(db, n); hash != headers[n-1].Hash() {
+			t.Errorf("canonical hash %d outside the purged section dropped: %x", n, hash)
+		}
+	}
+	if sections, err := VerifyCachedCht(db, checkpoints); err != nil || len(sections) != 0 {
+		t.Errorf("sections disagreeing after purge: %v, %v", sections, err)
+	}
+	// A corrupted trusted CHT is replaced as well
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: common.HexToHash("bad")})
+	if sections, err := VerifyCachedCht(db, checkpoints); err != nil || !reflect.DeepEqual(sections, []uint64{0}) {
+		t.Errorf("disagreeing sections mismatch: have %v, %v, want [0]", sections, err)
+	}
+	if cht := GetTrustedCht(db); cht.Root != checkpoints[1].ChtRoot {
+		t.Errorf("trusted root not replaced: have %x, want %x", cht.Root, checkpoints[1].ChtRoot)
+	}
+	if hash := core.GetCanonicalHash(db, 0); hash != genesis.Hash() {
+		t.Errorf("genesis purged: %x", hash)
+	}
+}
+
+func TestAvailableChtSections(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	db, _ := wtcdb.NewMemDatabase()
+	if _, err := AvailableChtSections(db); err != ErrNoTrustedCht {
+		t.Errorf("error mismatch without CHTs: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 10)
+	writeCanonicalHeaders(db, headers[:8])
+
+	// Section 0 is covered by the trusted CHT, sections 1 and 2 by checkpoints,
+	// but the head of section 2 isn't known
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: common.HexToHash("01")})
+	WriteCheckpoint(db, &Checkpoint{Section: 1, SectionHead: headers[6].Hash(), ChtRoot: common.HexToHash("02")})
+	WriteCheckpoint(db, &Checkpoint{Section: 2, ChtRoot: common.HexToHash("03")})
+
+	sections, err := AvailableChtSections(db)
+	if err != nil {
+		t.Fatalf("failed to list sections: %v", err)
+	}
+	if !reflect.DeepEqual(sections, []uint64{0, 1}) {
+		t.Errorf("available sections mismatch: have %v, want [0 1]", sections)
+	}
+	for section, want := range []bool{true, true, false, false} {
+		if have := HasChtSection(db, uint64(section)); have != want {
+			t.Errorf("section %d: availability mismatch: have %v, want %v", section, have, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var previousChtKey = []byte("PreviousTrustedCHT")
+
+// previousCht is the trusted CHT superseded by the current one, along with the
+// unix time it was superseded at.
+type previousCht struct {
+	Cht        TrustedCht
+	Superseded uint64
+}
+
+func getPreviousCht(db wtcdb.Database) *previousCht {
+	data, _ := db.Get(previousChtKey)
+	if len(data) == 0 {
+		return nil
+	}
+	prev := new(previousCht)
+	if err := rlp.DecodeBytes(data, prev); err != nil {
+		return nil
+	}
+	return prev
+}
+
+func writePreviousCht(db wtcdb.Database, cht TrustedCht, superseded time.Time) {
+	data, _ := rlp.EncodeToBytes(&previousCht{Cht: cht, Superseded: uint64(superseded.Unix())})
+	db.Put(previousChtKey, data)
+}
+
+// graceChtRoot returns the previous trusted CHT root if it covers the given
+// block and was superseded no longer than the configured ChtGraceWindow ago.
+func graceChtRoot(db wtcdb.Database, number uint64) (common.Hash, bool) {
+	window := ConfigOf(db).ChtGraceWindow
+	if window <= 0 {
+		return common.Hash{}, false
+	}
+	prev := getPreviousCht(db)
+	if prev == nil || number >= prev.Cht.Number*ChtFrequency {
+		return common.Hash{}, false
+	}
+	if since(time.Unix(int64(prev.Superseded), 0)) > window {
+		return common.Hash{}, false
+	}
+	return prev.Cht.Root, true
+}
+
+// VerifyChtProof verifies the CHT proof of the header of the given block against
+// root, the CHT root the request was anchored to, and returns the proven entry.
+// If root is the current trusted one, a proof against the previous trusted root
+// is accepted within the grace window as well, unless it was blacklisted. Both
+// ODR backends validating CHT replies and ChtRequest.StoreResult use it, so they
+// accept the same proofs.
+func VerifyChtProof(db wtcdb.Database, root common.Hash, number uint64, header *types.Header, proof []rlp.RawValue) (*ChtNode, error) {
+	// Make sure the header and the proof are both for the requested block
+	if header == nil || header.Number == nil || header.Number.Uint64() != number {
+		return nil, ErrMalformedResponse
+	}
+	if err := checkBlacklist(db, root); err != nil {
+		return nil, err
+	}
+	value, err := verifyProofCached(db, root, chtKey(number), proof)
+	if (err != nil || value == nil) && root == GetTrustedCht(db).Root {
+		// Right after a section boundary servers may still prove the previous root
+		if prev, ok := graceChtRoot(db, number); ok {
+			if err := checkBlacklist(db, prev); err != nil {
+				return nil, err
+			}
+			value, err = verifyProofCached(db, prev, chtKey(number), proof)
+		}
+	}
+	if err != nil || value == nil {
+		return nil, ErrMalformedResponse
+	}
+	node := new(ChtNode)
+	if err := rlp.DecodeBytes(value, node); err != nil || node.Hash != header.Hash() {
+		return nil, ErrMalformedResponse
+	}
+	return node, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestChtRequestGraceWindow(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 7)
+	prevRoot := makeTestCht(sdb, headers[:3])
+	curRoot := makeTestCht(sdb, headers)
+	prev, _ := trie.New(prevRoot, sdb)
+
+	// A server still on the previous section proves the block against its root
+	staleRequest := func() *ChtRequest {
+		return &ChtRequest{ChtNum: 2, BlockNum: 2, ChtRoot: curRoot, Header: headers[1], Td: big.NewInt(2), Proof: prev.Prove(chtKey(2))}
+	}
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := BindConfig(mdb, &Config{ChtGraceWindow: time.Minute})
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: prevRoot})
+	if err := staleRequest().StoreResult(db); err != ErrMalformedResponse {
+		t.Fatalf("stale proof accepted before the rollover: %v", err)
+	}
+	WriteTrustedCht(db, TrustedCht{Number: 2, Root: curRoot})
+	if err := staleRequest().StoreResult(db); err != nil {
+		t.Fatalf("stale proof rejected within the grace window: %v", err)
+	}
+	if hash := core.GetCanonicalHash(db, 2); hash != headers[1].Hash() {
+		t.Errorf("canonical hash mismatch: have %x, want %x", hash, headers[1].Hash())
+	}
+	// Requests not anchored to the current trusted root get no grace
+	req := staleRequest()
+	req.ChtRoot = headers[0].Hash()
+	if err := req.StoreResult(db); err != ErrMalformedResponse {
+		t.Errorf("stale proof accepted for an untrusted root: %v", err)
+	}
+	// Once the window elapsed, only the current root is accepted
+	writePreviousCht(db, TrustedCht{Number: 1, Root: prevRoot}, time.Now().Add(-2*time.Minute))
+	if err := staleRequest().StoreResult(db); err != ErrMalformedResponse {
+		t.Errorf("stale proof accepted after the grace window: %v", err)
+	}
+	cur, _ := trie.New(curRoot, sdb)
+	req = staleRequest()
+	req.Proof = cur.Prove(chtKey(2))
+	if err := req.StoreResult(db); err != nil {
+		t.Errorf("current proof rejected: %v", err)
+	}
+	// A disabled window rejects stale proofs right after the rollover
+	mdb, _ = wtcdb.NewMemDatabase()
+	db = BindConfig(mdb, new(Config))
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: prevRoot})
+	WriteTrustedCht(db, TrustedCht{Number: 2, Root: curRoot})
+	if err := staleRequest().StoreResult(db); err != ErrMalformedResponse {
+		t.Errorf("stale proof accepted with the grace window disabled: %v", err)
+	}
+}
+
+func TestVerifyChtProof(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 7)
+	prevRoot := makeTestCht(sdb, headers[:3])
+	curRoot := makeTestCht(sdb, headers)
+	prev, _ := trie.New(prevRoot, sdb)
+	proof := prev.Prove(chtKey(2))
+
+	db, _ := wtcdb.NewMemDatabase()
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: prevRoot})
+	WriteTrustedCht(db, TrustedCht{Number: 2, Root: curRoot})
+	node, err := VerifyChtProof(db, curRoot, 2, headers[1], proof)
+	if err != nil {
+		t.Fatalf("grace root proof rejected: %v", err)
+	}
+	if node.Hash != headers[1].Hash() {
+		t.Errorf("entry hash mismatch: have %x, want %x", node.Hash, headers[1].Hash())
+	}
+	// The header must be the one of the proven block
+	if _, err := VerifyChtProof(db, curRoot, 3, headers[1], proof); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for another block number: have %v, want %v", err, ErrMalformedResponse)
+	}
+	if _, err := VerifyChtProof(db, curRoot, 2, headers[2], proof); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for another header: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// A blacklisted previous root isn't accepted within the grace window either
+	if err := BlacklistRoot(db, prevRoot); err != nil {
+		t.Fatalf("failed to blacklist root: %v", err)
+	}
+	if _, err := VerifyChtProof(db, curRoot, 2, headers[1], proof); err != ErrBlacklistedRoot {
+		t.Errorf("error mismatch for blacklisted grace root: have %v, want %v", err, ErrBlacklistedRoot)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/metrics"
+)
+
+// MaxConcurrentChtSyncs is the number of sections SyncChtSections retrieves in
+// parallel, the rest waiting for a slot. It's kept low so that a client far
+// behind doesn't flood its peers with CHT proofs. Values below one are treated
+// as one.
+var MaxConcurrentChtSyncs = 2
+
+var (
+	chtSyncActive int64 // number of section syncs running
+	chtSyncQueued int64 // number of section syncs waiting for a slot
+
+	chtSyncActiveGauge = metrics.NewGauge("light/cht/sync/active")
+	chtSyncQueuedGauge = metrics.NewGauge("light/cht/sync/queued")
+)
+
+// SyncChtSections makes the given sections available for lookups by number, see
+// HasChtSection, by retrieving the header of each section head through the CHT
+// covering it. Sections already available are skipped, ones without a known CHT
+// root fail with ErrNoTrustedCht. At most MaxConcurrentChtSyncs sections are
+// retrieved at once. The first failure is returned after all syncs finished.
+func SyncChtSections(ctx context.Context, odr OdrBackend, sections []uint64) error {
+	limit := MaxConcurrentChtSyncs
+	if limit < 1 {
+		limit = 1
+	}
+	var (
+		db    = odr.Database()
+		slots = make(chan struct{}, limit)
+		wg    sync.WaitGroup
+
+		lock  sync.Mutex
+		first error
+	)
+	fail := func(err error) {
+		lock.Lock()
+		if first == nil {
+			first = err
+		}
+		lock.Unlock()
+	}
+	for _, section := range sections {
+		if HasChtSection(db, section) {
+			continue
+		}
+		root := chtSectionRoot(db, section)
+		if root == (common.Hash{}) {
+			fail(ErrNoTrustedCht)
+			continue
+		}
+		wg.Add(1)
+		chtSyncQueuedGauge.Update(atomic.AddInt64(&chtSyncQueued, 1))
+		go func(section uint64, root common.Hash) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				chtSyncQueuedGauge.Update(atomic.AddInt64(&chtSyncQueued, -1))
+				fail(ctx.Err())
+				return
+			}
+			chtSyncQueuedGauge.Update(atomic.AddInt64(&chtSyncQueued, -1))
+			chtSyncActiveGauge.Update(atomic.AddInt64(&chtSyncActive, 1))
+			defer func() {
+				chtSyncActiveGauge.Update(atomic.AddInt64(&chtSyncActive, -1))
+				<-slots
+			}()
+			r := &ChtRequest{ChtRoot: root, ChtNum: section + 1, BlockNum: (section+1)*ChtFrequency - 1}
+			if err := odr.Retrieve(ctx, r); err != nil {
+				fail(err)
+			}
+		}(section, root)
+	}
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// chtServingOdr serves CHT requests from a CHT in sdb over the given headers,
+// recording the highest number of requests served concurrently.
+type chtServingOdr struct {
+	*testOdr
+	headers []*types.Header
+
+	lock   sync.Mutex
+	active int
+	peak   int
+}
+
+func (odr *chtServingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	r, ok := req.(*ChtRequest)
+	if !ok {
+		return odr.testOdr.Retrieve(ctx, req)
+	}
+	odr.lock.Lock()
+	if odr.active++; odr.active > odr.peak {
+		odr.peak = odr.active
+	}
+	odr.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	t, _ := trie.New(r.ChtRoot, odr.sdb)
+	r.Header = odr.headers[r.BlockNum]
+	r.Td = new(big.Int).Set(r.Header.Number)
+	r.Proof = t.Prove(chtKey(r.BlockNum))
+
+	odr.lock.Lock()
+	odr.active--
+	odr.lock.Unlock()
+	return r.StoreResult(odr.ldb)
+}
+
+func TestSyncChtSectionsConcurrency(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	defer func(max int) { MaxConcurrentChtSyncs = max }(MaxConcurrentChtSyncs)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := append([]*types.Header{genesis.Header()}, makeTestHeaders(genesis.Header(), 31)...)
+	root := makeTestCht(sdb, headers)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	WriteTrustedCht(ldb, TrustedCht{Number: 8, Root: root})
+	odr := &chtServingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}, headers: headers}
+
+	MaxConcurrentChtSyncs = 3
+	sections := []uint64{0, 1, 2, 3, 4, 5, 6, 7}
+	if err := SyncChtSections(context.Background(), odr, sections); err != nil {
+		t.Fatalf("failed to sync sections: %v", err)
+	}
+	if odr.peak != 3 {
+		t.Errorf("concurrency peak mismatch: have %d, want 3", odr.peak)
+	}
+	for _, section := range sections {
+		if !HasChtSection(ldb, section) {
+			t.Errorf("section %d not available after sync", section)
+		}
+	}
+	if active, queued := chtSyncActive, chtSyncQueued; active != 0 || queued != 0 {
+		t.Errorf("sync counters not reset: %d active, %d queued", active, queued)
+	}
+	// Available sections aren't retrieved again, uncovered ones fail
+	odr.peak = 0
+	if err := SyncChtSections(context.Background(), odr, []uint64{2, 9}); err != ErrNoTrustedCht {
+		t.Errorf("error mismatch for uncovered section: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	if odr.peak != 0 {
+		t.Errorf("available section retrieved again")
+	}
+}
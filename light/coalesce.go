@@ -0,0 +1,141 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxCoalescedRequests is the maximum number of trie requests coalesced into a
+// single batch, matching the number of proofs LES servers serve per request.
+const MaxCoalescedRequests = 64
+
+// CoalesceOdr wraps an OdrBackend, holding trie requests for a short window so
+// that the ones arriving close together are retrieved in a single round trip
+// as a BatchTrieRequest. It trades a little latency for fewer round trips under
+// bursty read patterns. Interactive requests (see WithInteractive) and other
+// request types are passed on right away, as is everything with a zero window.
+type CoalesceOdr struct {
+	OdrBackend
+	window time.Duration
+
+	lock    sync.Mutex
+	pending *trieBatch // batch collecting requests, nil if none
+}
+
+// trieBatch is a set of trie requests coalesced into a single retrieval.
+type trieBatch struct {
+	reqs    []*TrieRequest
+	waiting int // requests whose callers are still waiting for the result
+
+	ctx    context.Context // cancelled once no caller is waiting any more
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error   // error of the batch retrieval
+	errs   []error // errors of the individual requests
+}
+
+// NewCoalesceOdr creates a wrapper around backend coalescing the trie requests
+// arriving within window of the first one into a batch.
+func NewCoalesceOdr(backend OdrBackend, window time.Duration) *CoalesceOdr {
+	return &CoalesceOdr{OdrBackend: backend, window: window}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *CoalesceOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve adds trie requests to the batch being collected, waiting for it to be
+// retrieved, and forwards other requests to the wrapped backend.
+func (odr *CoalesceOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	r, ok := req.(*TrieRequest)
+	if !ok || odr.window <= 0 || Interactive(ctx) {
+		return odr.OdrBackend.Retrieve(ctx, req)
+	}
+	odr.lock.Lock()
+	batch := odr.pending
+	if batch == nil {
+		batch = &trieBatch{done: make(chan struct{})}
+		batch.ctx, batch.cancel = context.WithCancel(context.Background())
+		odr.pending = batch
+		go odr.dispatch(batch)
+	}
+	index := len(batch.reqs)
+	batch.reqs = append(batch.reqs, r)
+	batch.waiting++
+	if len(batch.reqs) == MaxCoalescedRequests {
+		odr.pending = nil // full, later requests go into the next batch
+	}
+	odr.lock.Unlock()
+
+	select {
+	case <-batch.done:
+		if batch.err != nil {
+			return batch.err
+		}
+		return batch.errs[index]
+	case <-ctx.Done():
+		odr.abandon(batch)
+		return ctx.Err()
+	}
+}
+
+// abandon records that a caller stopped waiting for a batch. The retrieval of a
+// batch nobody waits for is cancelled, and new requests go into a fresh one.
+func (odr *CoalesceOdr) abandon(batch *trieBatch) {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	if batch.waiting--; batch.waiting == 0 {
+		if odr.pending == batch {
+			odr.pending = nil
+		}
+		batch.cancel()
+	}
+}
+
+// dispatch retrieves a batch once its window passed.
+func (odr *CoalesceOdr) dispatch(batch *trieBatch) {
+	defer close(batch.done)
+	defer batch.cancel()
+
+	<-clock.After(odr.window)
+	odr.lock.Lock()
+	if odr.pending == batch {
+		odr.pending = nil
+	}
+	reqs := batch.reqs
+	odr.lock.Unlock()
+
+	if err := batch.ctx.Err(); err != nil {
+		batch.err = err
+		return
+	}
+	// A lone request doesn't need the batch
+	if len(reqs) == 1 {
+		batch.errs = []error{odr.OdrBackend.Retrieve(batch.ctx, reqs[0])}
+		return
+	}
+	req := &BatchTrieRequest{Requests: reqs}
+	if batch.err = odr.OdrBackend.Retrieve(batch.ctx, req); batch.err == nil && len(req.Errs) != len(reqs) {
+		batch.err = ErrMalformedResponse
+	}
+	batch.errs = req.Errs
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// kindOdr records the kinds of the requests passed to the wrapped backend.
+type kindOdr struct {
+	OdrBackend
+	lock  sync.Mutex
+	kinds []RequestKind
+}
+
+func (odr *kindOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	odr.lock.Lock()
+	odr.kinds = append(odr.kinds, KindOf(req))
+	odr.lock.Unlock()
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+// waitPending blocks until the batch being collected holds n requests.
+func (odr *CoalesceOdr) waitPending(n int) {
+	for {
+		odr.lock.Lock()
+		pending := 0
+		if odr.pending != nil {
+			pending = len(odr.pending.reqs)
+		}
+		odr.lock.Unlock()
+		if pending >= n {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestCoalesceOdr(t *testing.T) {
+	c, restore := useManualClock()
+	defer restore()
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	backend := &kindOdr{OdrBackend: NewMemoryOdrBackend(sdb)}
+	odr := NewCoalesceOdr(backend, 5*time.Millisecond)
+
+	addrs := []common.Address{acc1Addr, testBankAddress, testStateContract}
+	errc := make(chan error, len(addrs))
+	for _, addr := range addrs {
+		key := addressHash(addr)
+		go func() { errc <- odr.Retrieve(NoOdr, &TrieRequest{Id: id, Key: key[:]}) }()
+	}
+	odr.waitPending(len(addrs))
+
+	// Interactive requests don't wait for the window
+	key := addressHash(acc2Addr)
+	if err := odr.Retrieve(WithInteractive(NoOdr), &TrieRequest{Id: id, Key: key[:]}); err != nil {
+		t.Fatalf("interactive retrieval failed: %v", err)
+	}
+	c.Advance(5 * time.Millisecond)
+	for range addrs {
+		if err := <-errc; err != nil {
+			t.Fatalf("coalesced retrieval failed: %v", err)
+		}
+	}
+	if want := []RequestKind{KindTrie, KindBatchTrie}; len(backend.kinds) != len(want) || backend.kinds[0] != want[0] || backend.kinds[1] != want[1] {
+		t.Errorf("retrievals mismatch: have %v, want %v", backend.kinds, want)
+	}
+	st, _ := trie.New(id.Root, backend.Database())
+	for _, addr := range addrs {
+		key := addressHash(addr)
+		if value, err := st.TryGet(key[:]); err != nil || value == nil {
+			t.Errorf("account %x not stored: %v", addr, err)
+		}
+	}
+	// A batch abandoned by all callers isn't retrieved
+	ctx, cancel := context.WithCancel(context.Background())
+	key = addressHash(acc1Addr)
+	go func() { errc <- odr.Retrieve(ctx, &TrieRequest{Id: id, Key: key[:]}) }()
+	odr.waitPending(1)
+	c.waitTimers(1)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("error mismatch for abandoned request: have %v, want %v", err, context.Canceled)
+	}
+	c.Advance(5 * time.Millisecond)
+	// Without a window nothing is held
+	backend.kinds = nil
+	if err := NewCoalesceOdr(backend, 0).Retrieve(NoOdr, &TrieRequest{Id: id, Key: key[:]}); err != nil {
+		t.Fatalf("retrieval without window failed: %v", err)
+	}
+	if len(backend.kinds) != 1 || backend.kinds[0] != KindTrie {
+		t.Errorf("retrievals mismatch without window: have %v", backend.kinds)
+	}
+}
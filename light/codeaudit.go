@@ -0,0 +1,183 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrNotIterable is returned if an audit needs to enumerate a database which
+// doesn't support it.
+var ErrNotIterable = errors.New("database can't be iterated")
+
+// AuditCodeReferences returns the hashes of the code blobs in the local database
+// which aren't referenced by the CodeHash of any account found in the cached
+// trie nodes, sorted. Such code is either left over from an account that has
+// since been pruned or was never legitimately retrieved.
+//
+// Code and trie nodes are both stored under the hash of their content; entries
+// which decode as a trie node are taken as such, so a code blob that happens to
+// be a valid trie node isn't audited.
+func AuditCodeReferences(db wtcdb.Database) ([]common.Hash, error) {
+	var (
+		code       = make(map[common.Hash]bool)
+		referenced = make(map[common.Hash]bool)
+	)
+	err := forEachEntry(db, func(key, value []byte) {
+		if len(key) != common.HashLength || !bytes.Equal(crypto.Keccak256(value), key) {
+			return
+		}
+		values, err := nodeValues(value)
+		if err != nil {
+			code[common.BytesToHash(key)] = true
+			return
+		}
+		for _, value := range values {
+			var account state.Account
+			if rlp.DecodeBytes(value, &account) == nil {
+				referenced[common.BytesToHash(account.CodeHash)] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var orphans []common.Hash
+	for hash := range code {
+		if !referenced[hash] {
+			orphans = append(orphans, hash)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return bytes.Compare(orphans[i][:], orphans[j][:]) < 0 })
+	return orphans, nil
+}
+
+// forEachEntry calls fn with every key/value pair of the database, if its type
+// allows enumerating them.
+func forEachEntry(db wtcdb.Database, fn func(key, value []byte)) error {
+	switch enum := db.(type) {
+	case interface{ NewIterator() iterator.Iterator }:
+		it := enum.NewIterator()
+		defer it.Release()
+		for it.Next() {
+			fn(it.Key(), it.Value())
+		}
+		return it.Error()
+	case interface{ Keys() [][]byte }:
+		for _, key := range enum.Keys() {
+			if value, err := db.Get(key); err == nil {
+				fn(key, value)
+			}
+		}
+		return nil
+	default:
+		return ErrNotIterable
+	}
+}
+
+// forEachPrefix calls fn with every key/value pair of the database whose key
+// starts with prefix. Databases supporting range iteration only visit those
+// entries, others are enumerated in full.
+func forEachPrefix(db wtcdb.Database, prefix []byte, fn func(key, value []byte)) error {
+	if ldb, ok := db.(interface{ LDB() *leveldb.DB }); ok {
+		it := ldb.LDB().NewIterator(util.BytesPrefix(prefix), nil)
+		defer it.Release()
+		for it.Next() {
+			fn(it.Key(), it.Value())
+		}
+		return it.Error()
+	}
+	return forEachEntry(db, func(key, value []byte) {
+		if bytes.HasPrefix(key, prefix) {
+			fn(key, value)
+		}
+	})
+}
+
+// nodeValues returns the values stored in an RLP encoded trie node, including
+// the ones in its embedded child nodes.
+func nodeValues(blob []byte) ([][]byte, error) {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return nil, err
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, err
+	}
+	switch count {
+	case 2:
+		key, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) > 0 && key[0]&0x20 != 0 {
+			value, _, err := rlp.SplitString(rest)
+			if err != nil {
+				return nil, err
+			}
+			return [][]byte{value}, nil
+		}
+		return embeddedValues(rest, 1)
+	case 17:
+		return embeddedValues(elems, 17)
+	default:
+		return nil, errInvalidTrieNode
+	}
+}
+
+// embeddedValues collects the values in the first n elements of an RLP encoded
+// buffer of child references, the last one being a value if n is 17.
+func embeddedValues(buf []byte, n int) ([][]byte, error) {
+	var values [][]byte
+	for i := 0; i < n; i++ {
+		kind, val, rest, err := rlp.Split(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 16:
+			if kind != rlp.String {
+				return nil, errInvalidTrieNode
+			}
+			if len(val) > 0 {
+				values = append(values, val)
+			}
+		case kind == rlp.List:
+			embedded, err := nodeValues(buf[:len(buf)-len(rest)])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, embedded...)
+		case len(val) != 0 && len(val) != common.HashLength:
+			return nil, errInvalidTrieNode
+		}
+		buf = rest
+	}
+	return values, nil
+}
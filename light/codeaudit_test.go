@@ -0,0 +1,57 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestAuditCodeReferences(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	makeTestState(db)
+
+	orphans, err := AuditCodeReferences(db)
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if len(orphans) != 0 {
+		t.Fatalf("referenced code reported as orphaned: %x", orphans)
+	}
+
+	orphan := common.Hex2Bytes("6060604052600a8060106000396000f360606040526008565b00")
+	hash := crypto.Keccak256Hash(orphan)
+	db.Put(hash[:], orphan)
+	orphans, err = AuditCodeReferences(db)
+	if err != nil {
+		t.Fatalf("audit failed: %v", err)
+	}
+	if want := []common.Hash{hash}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("orphans mismatch: have %x, want %x", orphans, want)
+	}
+}
+
+func TestAuditCodeReferencesNotIterable(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	if _, err := AuditCodeReferences(NewReadOnlyDatabase(db)); err != ErrNotIterable {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotIterable)
+	}
+}
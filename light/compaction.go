@@ -0,0 +1,171 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/metrics"
+)
+
+// ErrNotCompactable is returned if the database of a backend can't be compacted.
+var ErrNotCompactable = errors.New("database not compactable")
+
+var lastCompactionGauge = metrics.NewGauge("light/odr/lastcompaction")
+
+// odrKeyPrefix is the common prefix of the keys of the data stored by the light
+// client on its own, e.g. indexes and checkpoints.
+var odrKeyPrefix = []byte("light-")
+
+// CompactionConfig contains the settings of the background compaction.
+type CompactionConfig struct {
+	Interval time.Duration // Minimum time between two compactions
+	IdleTime time.Duration // Time without retrievals after which the backend is idle
+}
+
+// DefaultCompactionConfig compacts at most hourly, after a minute without
+// retrievals.
+var DefaultCompactionConfig = CompactionConfig{
+	Interval: time.Hour,
+	IdleTime: time.Minute,
+}
+
+// CompactingOdr wraps an OdrBackend, periodically compacting the light client
+// namespace of its database while no retrievals are running. After lots of
+// pruning and eviction this keeps reads fast on long running clients. The
+// compaction runs in the background, retrievals started meanwhile are not held
+// up by it.
+type CompactingOdr struct {
+	OdrBackend
+	config CompactionConfig
+
+	lock        sync.Mutex
+	active      int       // number of running retrievals
+	lastActive  time.Time // end of the last retrieval
+	lastCompact time.Time
+	compactions uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCompactingOdr creates a compacting wrapper around backend and starts its
+// background loop.
+func NewCompactingOdr(backend OdrBackend, config CompactionConfig) *CompactingOdr {
+	odr := &CompactingOdr{
+		OdrBackend:  backend,
+		config:      config,
+		lastActive:  clock.Now(),
+		lastCompact: clock.Now(),
+		quit:        make(chan struct{}),
+	}
+	odr.wg.Add(1)
+	go odr.loop()
+	return odr
+}
+
+// Stop terminates the background loop, waiting for a running compaction.
+func (odr *CompactingOdr) Stop() {
+	close(odr.quit)
+	odr.wg.Wait()
+}
+
+// Compactions returns the number of compactions done so far.
+func (odr *CompactingOdr) Compactions() uint64 {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return odr.compactions
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *CompactingOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve forwards the request to the wrapped backend, recording the activity.
+func (odr *CompactingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	odr.lock.Lock()
+	odr.active++
+	odr.lock.Unlock()
+
+	defer func() {
+		odr.lock.Lock()
+		odr.active--
+		odr.lastActive = clock.Now()
+		odr.lock.Unlock()
+	}()
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+func (odr *CompactingOdr) loop() {
+	defer odr.wg.Done()
+
+	for {
+		select {
+		case <-clock.After(odr.config.IdleTime):
+			if !odr.due(clock.Now()) {
+				continue
+			}
+			if err := odr.Compact(); err != nil {
+				log.Debug("Failed to compact ODR database", "err", err)
+			}
+		case <-odr.quit:
+			return
+		}
+	}
+}
+
+// due reports whether the backend has been idle long enough and the last
+// compaction is long enough ago for the next one.
+func (odr *CompactingOdr) due(now time.Time) bool {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return odr.active == 0 && now.Sub(odr.lastActive) >= odr.config.IdleTime && now.Sub(odr.lastCompact) >= odr.config.Interval
+}
+
+// Compact compacts the light client namespace of the database right away.
+func (odr *CompactingOdr) Compact() error {
+	db, ok := odr.Database().(interface {
+		Compact(start []byte, limit []byte) error
+	})
+	if !ok {
+		return ErrNotCompactable
+	}
+	limit := append([]byte{}, odrKeyPrefix...)
+	limit[len(limit)-1]++
+
+	start := clock.Now()
+	err := db.Compact(odrKeyPrefix, limit)
+
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+	odr.lastCompact = clock.Now()
+	if err != nil {
+		return err
+	}
+	odr.compactions++
+	lastCompactionGauge.Update(odr.lastCompact.Unix())
+	log.Debug("Compacted ODR database", "elapsed", common.PrettyDuration(since(start)))
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// compactableDB is an in-memory database recording the compacted ranges.
+type compactableDB struct {
+	*wtcdb.MemDatabase
+
+	lock   sync.Mutex
+	ranges [][2][]byte
+}
+
+func (db *compactableDB) Compact(start []byte, limit []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.ranges = append(db.ranges, [2][]byte{start, limit})
+	return nil
+}
+
+func (db *compactableDB) compacted() int {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return len(db.ranges)
+}
+
+func TestCompactingOdrIdle(t *testing.T) {
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := &compactableDB{MemDatabase: mdb}
+	backend := &blockingOdr{OdrBackend: offlineOdr{db}, release: make(chan struct{})}
+	odr := NewCompactingOdr(backend, CompactionConfig{Interval: 10 * time.Millisecond, IdleTime: 20 * time.Millisecond})
+	defer odr.Stop()
+
+	// No compaction happens while a retrieval is running
+	done := make(chan error)
+	go func() { done <- odr.Retrieve(context.Background(), &CodeRequest{}) }()
+	time.Sleep(100 * time.Millisecond)
+	if n := db.compacted(); n != 0 {
+		t.Fatalf("compacted %d times during a retrieval", n)
+	}
+	close(backend.release)
+	if err := <-done; err != nil {
+		t.Fatalf("retrieval failed: %v", err)
+	}
+	// Once idle, the light client namespace is compacted
+	deadline := time.Now().Add(time.Second)
+	for db.compacted() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if odr.Compactions() == 0 {
+		t.Fatalf("no compaction while idle")
+	}
+	db.lock.Lock()
+	start, limit := db.ranges[0][0], db.ranges[0][1]
+	db.lock.Unlock()
+	if !bytes.Equal(start, []byte("light-")) || !bytes.Equal(limit, []byte("light.")) {
+		t.Errorf("compacted range mismatch: have %q-%q, want %q-%q", start, limit, "light-", "light.")
+	}
+}
+
+func TestCompactingOdrLevelDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "light-compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := wtcdb.NewLDBDatabase(dir, 16, 16)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	odr := NewCompactingOdr(offlineOdr{db}, DefaultCompactionConfig)
+	defer odr.Stop()
+	if err := odr.Compact(); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	mdb, _ := wtcdb.NewMemDatabase()
+	plain := NewCompactingOdr(offlineOdr{mdb}, DefaultCompactionConfig)
+	defer plain.Stop()
+	if err := plain.Compact(); err != ErrNotCompactable {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotCompactable)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// Diff describes a request on which two ODR backends diverged.
+type Diff struct {
+	Index      int         // position of the request in the compared list
+	Kind       RequestKind // kind of the request
+	A, B       []byte      // resolved values returned by the two backends
+	ErrA, ErrB error       // retrieval or verification failures of the two backends
+}
+
+// CompareBackends runs each request against both backends and reports those on
+// which the resolved values differ. Values are compared after verification, so
+// proofs which only differ in node ordering are considered equal. A backend
+// failing a request another one serves is reported as a divergence too.
+//
+// The passed requests are used as templates only, each backend retrieves its
+// own copy and stores the results in its own database.
+func CompareBackends(ctx context.Context, a, b OdrBackend, reqs []OdrRequest) ([]Diff, error) {
+	var diffs []Diff
+	for i, req := range reqs {
+		ra, rb := copyRequest(req), copyRequest(req)
+		if ra == nil {
+			return nil, ErrUnsupportedRequest
+		}
+		valA, errA := resolveRequest(ctx, a, ra)
+		valB, errB := resolveRequest(ctx, b, rb)
+		if err := ctx.Err(); err != nil {
+			return diffs, err
+		}
+		if (errA == nil) != (errB == nil) || !bytes.Equal(valA, valB) {
+			diffs = append(diffs, Diff{Index: i, Kind: KindOf(req), A: valA, B: valB, ErrA: errA, ErrB: errB})
+		}
+	}
+	return diffs, nil
+}
+
+// copyRequest creates a fresh request with the same inputs as req, or nil if
+// the request type can't be compared.
+func copyRequest(req OdrRequest) OdrRequest {
+	switch r := req.(type) {
+	case *TrieRequest:
+		return &TrieRequest{Id: r.Id, Key: r.Key, Candidates: r.Candidates, MaxDepth: r.MaxDepth}
+	case *BatchTrieRequest:
+		batch := &BatchTrieRequest{Requests: make([]*TrieRequest, len(r.Requests))}
+		for i, tr := range r.Requests {
+			batch.Requests[i] = copyRequest(tr).(*TrieRequest)
+		}
+		return batch
+	case *AccountRequest:
+		return &AccountRequest{Id: r.Id, Address: r.Address}
+	case *StorageRootRequest:
+		return &StorageRootRequest{StateId: r.StateId, Address: r.Address}
+	case *CodeHashRequest:
+		return &CodeHashRequest{StateId: r.StateId, Address: r.Address}
+	case *CodeRequest:
+		return &CodeRequest{Id: r.Id, Hash: r.Hash}
+	case *CodeSizeRequest:
+		return &CodeSizeRequest{Id: r.Id, Hash: r.Hash}
+	case *BlockRequest:
+		return &BlockRequest{Hash: r.Hash, Number: r.Number, StrictSignatureCheck: r.StrictSignatureCheck, Config: r.Config}
+	case *ReceiptsRequest:
+		return &ReceiptsRequest{Hash: r.Hash, Number: r.Number}
+	case *ReceiptsMetaRequest:
+		return &ReceiptsMetaRequest{Hash: r.Hash, Number: r.Number}
+	case *BatchBlockRequest:
+		return &BatchBlockRequest{Hashes: r.Hashes, Numbers: r.Numbers}
+	case *TxByIndexRequest:
+		return &TxByIndexRequest{BlockHash: r.BlockHash, Number: r.Number, Index: r.Index}
+	case *TxCountRequest:
+		return &TxCountRequest{BlockHash: r.BlockHash, Number: r.Number}
+	case *TxLogsRequest:
+		return &TxLogsRequest{TxHash: r.TxHash, BlockHash: r.BlockHash, Number: r.Number, Index: r.Index}
+	case *TxLookupRequest:
+		return &TxLookupRequest{TxHash: r.TxHash}
+	case *ChtRequest:
+		return &ChtRequest{ChtNum: r.ChtNum, BlockNum: r.BlockNum, ChtRoot: r.ChtRoot}
+	case *StateRootRequest:
+		return &StateRootRequest{Number: r.Number, Hash: r.Hash, ChtNum: r.ChtNum, ChtRoot: r.ChtRoot}
+	case *BlockBloomRequest:
+		return &BlockBloomRequest{Number: r.Number, Hash: r.Hash, ChtNum: r.ChtNum, ChtRoot: r.ChtRoot}
+	case *HeaderByHashRequest:
+		return &HeaderByHashRequest{Hash: r.Hash, ChtNum: r.ChtNum, ChtRoot: r.ChtRoot, Child: r.Child}
+	case *BatchHeaderRequest:
+		return &BatchHeaderRequest{Hashes: r.Hashes, ChtNum: r.ChtNum, ChtRoot: r.ChtRoot}
+	case *HeaderSegmentRequest:
+		return &HeaderSegmentRequest{Anchor: r.Anchor, Number: r.Number, Amount: r.Amount, Verify: r.Verify}
+	case *BloomTrieRootRequest:
+		return &BloomTrieRootRequest{Section: r.Section}
+	default:
+		return nil
+	}
+}
+
+// resolveRequest retrieves req from the backend and returns the verified value
+// it resolved to.
+func resolveRequest(ctx context.Context, odr OdrBackend, req OdrRequest) ([]byte, error) {
+	if err := odr.Retrieve(ctx, req); err != nil {
+		return nil, err
+	}
+	config := BackendConfig(odr)
+	switch r := req.(type) {
+	case *TrieRequest:
+		root := r.Id.Root
+		if r.MatchedRoot != (common.Hash{}) {
+			root = r.MatchedRoot
+		}
+		return config.VerifyProof(root, r.Key, r.Proof)
+	case *BatchTrieRequest:
+		values := make([][]byte, len(r.Requests))
+		for i, tr := range r.Requests {
+			root := tr.Id.Root
+			if tr.MatchedRoot != (common.Hash{}) {
+				root = tr.MatchedRoot
+			}
+			value, err := config.VerifyProof(root, tr.Key, tr.Proof)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return rlp.EncodeToBytes(values)
+	case *AccountRequest:
+		key := addressHash(r.Address)
+		return config.VerifyProof(r.Id.Root, key[:], r.Proof)
+	case *StorageRootRequest:
+		return r.Root[:], nil
+	case *CodeHashRequest:
+		return r.CodeHash[:], nil
+	case *CodeRequest:
+		if crypto.Keccak256Hash(r.Data) != r.Hash {
+			return nil, ErrMalformedResponse
+		}
+		return r.Data, nil
+	case *CodeSizeRequest:
+		var enc [8]byte
+		binary.BigEndian.PutUint64(enc[:], r.Size)
+		return enc[:], nil
+	case *BlockRequest:
+		return r.Rlp, nil
+	case *ReceiptsRequest:
+		return rlp.EncodeToBytes(r.Receipts)
+	case *BatchBlockRequest:
+		return rlp.EncodeToBytes(r.Rlps)
+	case *TxByIndexRequest:
+		return rlp.EncodeToBytes(r.Tx)
+	case *TxCountRequest:
+		return rlp.EncodeToBytes(r.Count)
+	case *TxLogsRequest:
+		return rlp.EncodeToBytes(r.Logs)
+	case *TxLookupRequest:
+		return rlp.EncodeToBytes([]interface{}{r.BlockHash, r.Number, r.Index})
+	case *ReceiptsMetaRequest:
+		return rlp.EncodeToBytes(r.Meta)
+	case *ChtRequest:
+		if r.Header == nil {
+			return nil, ErrMalformedResponse
+		}
+		return rlp.EncodeToBytes(ChtNode{Hash: r.Header.Hash(), Td: r.Td})
+	case *StateRootRequest:
+		return r.Root[:], nil
+	case *BlockBloomRequest:
+		return r.Bloom[:], nil
+	case *HeaderByHashRequest:
+		if r.Header == nil {
+			return nil, ErrMalformedResponse
+		}
+		return rlp.EncodeToBytes(r.Header)
+	case *BatchHeaderRequest:
+		return rlp.EncodeToBytes(r.Headers)
+	case *HeaderSegmentRequest:
+		return rlp.EncodeToBytes(r.Headers)
+	case *BloomTrieRootRequest:
+		return r.Root[:], nil
+	}
+	return nil, ErrUnsupportedRequest
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// forkOdr is a test backend serving every request from its own chain state,
+// regardless of the state root being asked for.
+type forkOdr struct {
+	*testOdr
+	root     common.Hash
+	codeSize uint64
+}
+
+func (odr *forkOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	switch req := req.(type) {
+	case *TrieRequest:
+		t, _ := trie.New(odr.root, odr.sdb)
+		req.Proof = t.Prove(req.Key)
+		return req.StoreResult(odr.ldb)
+	case *CodeSizeRequest:
+		req.Size = odr.codeSize
+		return nil
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestCompareBackends(t *testing.T) {
+	sdbA, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdbA)
+
+	// Create a forked state where acc1 has a different balance
+	sdbB, _ := wtcdb.NewMemDatabase()
+	st, _ := state.New(common.Hash{}, state.NewDatabase(sdbB))
+	st.SetBalance(acc1Addr, big.NewInt(2000), new(big.Int), new(big.Int))
+	st.SetCode(testStateContract, testContractCode)
+	forkRoot, _ := st.CommitTo(sdbB, true)
+
+	ldbA, _ := wtcdb.NewMemDatabase()
+	ldbB, _ := wtcdb.NewMemDatabase()
+	a := &testOdr{sdb: sdbA, ldb: ldbA}
+	b := &forkOdr{testOdr: &testOdr{sdb: sdbB, ldb: ldbB}, root: forkRoot, codeSize: 1}
+
+	id := StateTrieID(header)
+	codeHash := crypto.Keccak256Hash(testContractCode)
+	reqs := []OdrRequest{
+		&TrieRequest{Id: id, Key: crypto.Keccak256(acc1Addr[:])},
+		&CodeRequest{Id: id, Hash: codeHash},
+		&CodeSizeRequest{Id: id, Hash: codeHash},
+	}
+	diffs, err := CompareBackends(context.Background(), a, b, reqs)
+	if err != nil {
+		t.Fatalf("failed to compare backends: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("diff count mismatch: have %d, want %d", len(diffs), 2)
+	}
+	if d := diffs[0]; d.Index != 0 || d.Kind != KindTrie || d.ErrA != nil || d.ErrB == nil {
+		t.Errorf("trie diff mismatch: %+v", d)
+	}
+	if d := diffs[1]; d.Index != 2 || d.Kind != KindCodeSize || d.ErrA != nil || d.ErrB != nil {
+		t.Errorf("code size diff mismatch: %+v", d)
+	}
+	if _, err := CompareBackends(context.Background(), a, b, []OdrRequest{nil}); err != ErrUnsupportedRequest {
+		t.Errorf("error mismatch for unsupported request: have %v, want %v", err, ErrUnsupportedRequest)
+	}
+}
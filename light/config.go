@@ -0,0 +1,230 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"time"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// Config holds the settings of an ODR backend controlling how the results of
+// its requests are verified and stored. Backends are created with DefaultConfig
+// and take another one with their SetConfig method, which is meant to be called
+// during initialization, before any retrieval. A Config must not be modified
+// after it was set.
+type Config struct {
+	// ProofVerifier verifies retrieved merkle proofs, e.g. for chains using a
+	// variant trie. The standard TrieProofVerifier is used if nil.
+	ProofVerifier ProofVerifier
+
+	// ReorderProofs makes the verification of proofs for the standard trie
+	// accept proof nodes in any order. Verification assumes the nodes to be
+	// ordered from the root down, which some servers don't ensure: a proof
+	// failing verification is then rearranged along the path to its key and
+	// verified again.
+	ReorderProofs bool
+
+	// BestEffortVerification keeps the client usable on tries the proof verifier
+	// reports ErrUnsupportedLayout for. Such proofs are only checked to be a
+	// chain of content-addressed nodes hanging off the root, each node
+	// referenced by the hash of an earlier one, and the value located by the
+	// verifier is accepted as is. This doesn't prove the value belongs to the
+	// key, so a warning is logged.
+	BestEffortVerification bool
+
+	// CacheVerifiedProofs enables persistent markers of the merkle proofs that
+	// passed verification, so that proofs served again, e.g. those rebuilt from
+	// the local database when resolving requests locally, aren't verified again
+	// even across restarts. A marker is keyed by the root, the key and the proof
+	// itself, so a proof differing in any node is always verified. Markers are
+	// trusted by every backend with the option enabled sharing the database.
+	CacheVerifiedProofs bool
+
+	// ParanoidProofStore enables comparing the retrieved proof nodes with the
+	// ones already stored under the same hash, instead of assuming they are
+	// equal. A difference means the database is corrupt or a node got stored
+	// unverified, and fails the request with ErrHashCollision. It costs a
+	// comparison per node and is disabled by default.
+	ParanoidProofStore bool
+
+	// RetryOnEmpty is the number of times the backend retries a retrieval
+	// answered with an empty proof for a non-empty trie, which some servers send
+	// transiently under load instead of an error. The retries are attempted
+	// regardless of the verification failure policy, with another peer where the
+	// backend has a choice, and ErrEmptyProof is returned only once they are used
+	// up. Zero disables them.
+	RetryOnEmpty int
+
+	// RetryOnStaleRoot is the number of times the backend retries a retrieval
+	// answered with a proof of another state root than the requested one, which
+	// servers lagging behind the chain send. Like the ones of RetryOnEmpty, the
+	// retries are attempted regardless of the verification failure policy and
+	// ErrStaleStateRoot is returned only once they are used up. Zero disables
+	// them.
+	RetryOnStaleRoot int
+
+	// TagContent enables type tags on content-addressed entries. Trie nodes and
+	// contract code share the Keccak256 hash namespace, so identical content is
+	// stored once, and a one byte tag recording the types it was stored as is
+	// kept next to it. Typed reads of code and of the nodes of locally built
+	// proofs then only accept content stored as that type, so e.g. a code blob
+	// is never walked as a trie node. Entries stored before enabling it carry no
+	// tags and are treated as missing, so they are retrieved again.
+	TagContent bool
+
+	// ChtGraceWindow is how long after the trusted CHT advanced to a new section
+	// proofs against the previous trusted root are still accepted, as servers
+	// may briefly keep referencing it right after the section boundary. The
+	// default covers the import delay of a few blocks; a server lagging behind
+	// for longer is better retried with another peer. Zero disables it.
+	ChtGraceWindow time.Duration
+
+	// BatchBalanceConcurrency is the number of accounts BatchBalances retrieves
+	// concurrently, at least one.
+	BatchBalanceConcurrency int
+
+	// NoCache lists the request kinds that are never answered from the local
+	// database, forcing the backend to retrieve them afresh, e.g. for privacy or
+	// freshness. Neither ResolveLocally nor the helpers looking up a request in
+	// the database before retrieving it answer them, only trie nodes already
+	// walked by the state readers are still read locally. The results are still
+	// stored, unless a store filter keeps them in memory.
+	NoCache map[RequestKind]bool
+
+	// IndexTrieValues enables a secondary index mapping (root, key) pairs to
+	// the trie values proven by retrieved merkle proofs. Repeated reads of the
+	// same keys are then answered without walking the trie, at the cost of
+	// storing every value twice. Since the root is part of the index key, the
+	// entries of a trie are naturally invalidated when its root changes.
+	IndexTrieValues bool
+
+	// MaxTrieDepth is the maximum number of nodes the local trie walking
+	// helpers descend through, DefaultMaxTrieDepth if zero.
+	MaxTrieDepth int
+
+	// DedupBodies enables content-addressed storage of retrieved block bodies:
+	// each distinct body is stored once under its hash and blocks only keep a
+	// pointer to it, so e.g. all empty blocks share a single body blob. Pointers
+	// are resolved transparently by the light client's own reads, whatever the
+	// configuration, but not by core's accessors, so it's disabled by default to
+	// preserve the database layout. Shared blobs are never removed.
+	DedupBodies bool
+
+	// IndexReceiptLogs enables a columnar index of the logs of stored receipts,
+	// keyed by block, address and first topic. Filters for an address and topic
+	// then read the matching logs of a block directly instead of decoding all
+	// of its receipts. The receipts stay authoritative: the index is only
+	// written along with them, and blocks missing from it are scanned through
+	// their receipts.
+	IndexReceiptLogs bool
+
+	// NoIndexFallback makes FilterLogs fail with ErrNoReceipts on blocks missing
+	// from the log index, instead of retrieving and indexing their receipts so
+	// that later filters hit the index.
+	NoIndexFallback bool
+
+	// VerificationTimeout limits the time spent verifying and storing a single
+	// retrieved response, separately from the network timeout of the retrieval.
+	// It protects against oversized proofs keeping a CPU busy indefinitely. Zero
+	// disables the limit.
+	VerificationTimeout time.Duration
+
+	// ArchiveMode makes the backend keep everything it ever retrieved, e.g. to
+	// build a local dataset for offline analysis. Eviction is refused, results
+	// are persisted even through a FilterDatabase that would keep them in
+	// memory only, and every block whose body or receipts were stored is
+	// indexed so the coverage of the archive can be listed by ArchivedBlocks.
+	// A FilterDatabase or NodeLRUDatabase follows the configuration bound to
+	// the database it wraps.
+	ArchiveMode bool
+
+	// MaxResponseBytes overrides the size limits of the responses to retrievals
+	// of the listed kinds, enforced by the network layer of the backend before
+	// any decoding. The other kinds keep their default limits.
+	MaxResponseBytes ResponseLimits
+}
+
+// DefaultConfig returns the configuration backends are created with.
+func DefaultConfig() *Config {
+	return &Config{
+		ProofVerifier:           TrieProofVerifier{},
+		ChtGraceWindow:          30 * time.Second,
+		BatchBalanceConcurrency: 8,
+		MaxTrieDepth:            DefaultMaxTrieDepth,
+		VerificationTimeout:     10 * time.Second,
+	}
+}
+
+// defaultConfig applies where no backend configuration is available. It's never
+// modified.
+var defaultConfig = DefaultConfig()
+
+// Configured is implemented by ODR backends having a configuration, including
+// the wrappers forwarding to the one of the backend they wrap.
+type Configured interface {
+	Config() *Config
+}
+
+// BackendConfig returns the configuration of an ODR backend. Backends without
+// one use the configuration bound to their database, if any.
+func BackendConfig(odr OdrBackend) *Config {
+	if c, ok := odr.(Configured); ok {
+		if config := c.Config(); config != nil {
+			return config
+		}
+	}
+	return ConfigOf(odr.Database())
+}
+
+// backendDatabase returns the database of an ODR backend with its configuration
+// bound, for the local reads of helpers.
+func backendDatabase(odr OdrBackend) wtcdb.Database {
+	return BindConfig(odr.Database(), BackendConfig(odr))
+}
+
+// configDatabase binds the configuration of an ODR backend to the database the
+// results of its requests are verified and stored with.
+type configDatabase struct {
+	wtcdb.Database
+	config *Config
+}
+
+// BindConfig returns a view of db carrying the given backend configuration, to
+// be passed to StoreResult and other verification code only seeing a database.
+func BindConfig(db wtcdb.Database, config *Config) wtcdb.Database {
+	if config == nil {
+		return db
+	}
+	return &configDatabase{Database: db, config: config}
+}
+
+// ConfigOf returns the backend configuration bound to db with BindConfig, the
+// default one if there is none.
+func ConfigOf(db core.DatabaseReader) *Config {
+	for {
+		switch d := db.(type) {
+		case *configDatabase:
+			return d.config
+		case *stagingDatabase:
+			db = d.Database
+		default:
+			return defaultConfig
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrContentType is returned by ReadContent if the content stored under a hash
+// was never stored as the requested type.
+var ErrContentType = errors.New("content type mismatch")
+
+// ContentType is the kind of content stored under its Keccak256 hash. Types are
+// bit flags, so content stored as several types carries all of their tags.
+type ContentType byte
+
+const (
+	ContentNode ContentType = 1 << iota // trie node
+	ContentCode                         // contract code
+	ContentBody                         // deduplicated block body blob
+)
+
+var contentTagPrefix = []byte("light-tag-") // contentTagPrefix + hash -> one byte mask of the content types stored
+
+func contentTagKey(hash common.Hash) []byte {
+	return append(append([]byte{}, contentTagPrefix...), hash.Bytes()...)
+}
+
+// tagContent records that the content under hash was stored as typ, if the
+// configuration bound to db has TagContent set.
+func tagContent(db wtcdb.Database, hash common.Hash, typ ContentType) error {
+	if !ConfigOf(db).TagContent {
+		return nil
+	}
+	var mask byte
+	if tag, _ := db.Get(contentTagKey(hash)); len(tag) == 1 {
+		mask = tag[0]
+	}
+	if mask&byte(typ) != 0 {
+		return nil
+	}
+	return db.Put(contentTagKey(hash), []byte{mask | byte(typ)})
+}
+
+// ReadContent reads the content stored under hash as the given type. With
+// TagContent set in the configuration bound to db, content not tagged with typ
+// fails with ErrContentType, even if present, otherwise it's returned regardless
+// of its type.
+func ReadContent(db wtcdb.Database, hash common.Hash, typ ContentType) ([]byte, error) {
+	data, err := db.Get(hash[:])
+	if err != nil || !ConfigOf(db).TagContent {
+		return data, err
+	}
+	if !hasContentTag(db, hash, typ) {
+		return nil, ErrContentType
+	}
+	return data, nil
+}
+
+// hasContentTag returns whether the content under hash was tagged with typ.
+func hasContentTag(db core.DatabaseReader, hash common.Hash, typ ContentType) bool {
+	tag, _ := db.Get(contentTagKey(hash))
+	return len(tag) == 1 && tag[0]&byte(typ) != 0
+}
+
+// nodeReader is a database wrapper reading hash keys as trie nodes, so that
+// content not stored as a node isn't resolved by tries built on it.
+type nodeReader struct {
+	wtcdb.Database
+}
+
+func (r nodeReader) Get(key []byte) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return r.Database.Get(key)
+	}
+	return ReadContent(r.Database, common.BytesToHash(key), ContentNode)
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestTagContent(t *testing.T) {
+	config := &Config{TagContent: true}
+
+	// Take a trie node and store the very same bytes as contract code as well
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	st, _ := trie.New(header.Root, sdb)
+	proof := st.Prove(crypto.Keccak256(acc1Addr[:]))
+	node := proof[len(proof)-1]
+	hash := crypto.Keccak256Hash(node)
+
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := BindConfig(mdb, config)
+	if err := storeProof(db, []rlp.RawValue{node}); err != nil {
+		t.Fatalf("failed to store node: %v", err)
+	}
+	if _, err := ReadContent(db, hash, ContentCode); err != ErrContentType {
+		t.Errorf("error mismatch for node read as code: have %v, want %v", err, ErrContentType)
+	}
+	if _, err := ReadContent(mdb, hash, ContentCode); err != nil {
+		t.Errorf("type checked without tagging configured: %v", err)
+	}
+	if ResolveLocally(db, &CodeRequest{Hash: hash}) {
+		t.Errorf("node resolved locally as code")
+	}
+	code := &CodeRequest{Hash: hash, Data: common.CopyBytes(node)}
+	if err := code.StoreResult(db); err != nil {
+		t.Fatalf("failed to store code: %v", err)
+	}
+	// Both types read back the single deduplicated copy
+	for _, typ := range []ContentType{ContentNode, ContentCode} {
+		if data, err := ReadContent(db, hash, typ); err != nil || !bytes.Equal(data, node) {
+			t.Errorf("type %d read mismatch: have %x, %v, want %x", typ, data, err, node)
+		}
+	}
+	if n := len(mdb.Keys()); n != 2 {
+		t.Errorf("entry count mismatch: have %d, want %d (content and tag)", n, 2)
+	}
+	// Code is never walked as a trie node, even if it forms a whole path
+	mcdb, _ := wtcdb.NewMemDatabase()
+	cdb := BindConfig(mcdb, config)
+	for _, node := range proof {
+		(&CodeRequest{Hash: crypto.Keccak256Hash(node), Data: common.CopyBytes(node)}).StoreResult(cdb)
+	}
+	if _, ok := localProof(cdb, header.Root, crypto.Keccak256(acc1Addr[:])); ok {
+		t.Errorf("code resolved as trie nodes")
+	}
+	storeProof(cdb, proof)
+	if _, ok := localProof(cdb, header.Root, crypto.Keccak256(acc1Addr[:])); !ok {
+		t.Errorf("tagged nodes not resolved")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// ContractState is the verified snapshot of a contract taken by ContractSnapshot.
+type ContractState struct {
+	Address  common.Address
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash // storage trie root
+	CodeHash common.Hash
+	Code     []byte
+
+	// Storage maps the hashes of the storage slots to their contents. It's only
+	// filled in if the storage was requested.
+	Storage map[common.Hash][]byte
+}
+
+// ContractSnapshot retrieves the account with the given address from the state
+// trie identified by state along with its code and, if includeStorage is set,
+// all of its storage through a StorageIterator. Everything is verified against
+// the state root: the account by its proof, the code by its hash and the storage
+// by the root of the account. The first failure aborts the snapshot. The result
+// is nil if the account doesn't exist.
+func ContractSnapshot(ctx context.Context, odr OdrBackend, state *TrieID, addr common.Address, includeStorage bool) (*ContractState, error) {
+	account, err := GetAccount(ctx, odr, state, addr)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	addrHash, codeHash := addressHash(addr), common.BytesToHash(account.CodeHash)
+	code, err := (&odrDatabase{ctx: ctx, id: state, backend: odr}).ContractCode(addrHash, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	// Code requests aren't checked against their hash by every backend
+	if codeHash != sha3_nil && crypto.Keccak256Hash(code) != codeHash {
+		return nil, ErrMalformedResponse
+	}
+	snap := &ContractState{
+		Address:  addr,
+		Nonce:    account.Nonce,
+		Balance:  account.Balance,
+		Root:     account.Root,
+		CodeHash: codeHash,
+		Code:     code,
+	}
+	if !includeStorage {
+		return snap, nil
+	}
+	snap.Storage = make(map[common.Hash][]byte)
+	it := NewStorageIterator(ctx, odr, StorageTrieID(state, addrHash, account.Root))
+	for it.Next() {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, ErrMalformedResponse
+		}
+		snap.Storage[common.BytesToHash(it.Key)] = content
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
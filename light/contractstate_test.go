@@ -0,0 +1,81 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// forgedCodeOdr serves contract code with a byte appended.
+type forgedCodeOdr struct {
+	*testOdr
+}
+
+func (odr *forgedCodeOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if req, ok := req.(*CodeRequest); ok {
+		data, _ := odr.sdb.Get(req.Hash[:])
+		req.Data = append(data, 0)
+		return req.StoreResult(StoreDatabase(odr.ldb, req))
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestContractSnapshot(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	snap, err := ContractSnapshot(NoOdr, odr, id, testStateContract, true)
+	if err != nil {
+		t.Fatalf("failed to snapshot contract: %v", err)
+	}
+	if !bytes.Equal(snap.Code, testContractCode) || snap.CodeHash != crypto.Keccak256Hash(testContractCode) {
+		t.Errorf("code mismatch: have %x (hash %x)", snap.Code, snap.CodeHash)
+	}
+	if snap.Balance.Sign() != 0 || snap.Nonce != 0 {
+		t.Errorf("account mismatch: balance %v, nonce %d", snap.Balance, snap.Nonce)
+	}
+	if len(snap.Storage) != testStateSlots {
+		t.Fatalf("storage size mismatch: have %d, want %d", len(snap.Storage), testStateSlots)
+	}
+	for i := 0; i < testStateSlots; i++ {
+		slot := testStateSlot(i)
+		if value := snap.Storage[crypto.Keccak256Hash(slot[:])]; !bytes.Equal(value, []byte{byte(i + 1)}) {
+			t.Errorf("slot %d mismatch: have %x, want %x", i, value, []byte{byte(i + 1)})
+		}
+	}
+	// Without storage only the account and code are retrieved
+	snap, err = ContractSnapshot(NoOdr, &testOdr{sdb: sdb, ldb: ldb, disable: true}, id, testStateContract, false)
+	if err != nil || snap.Storage != nil || !bytes.Equal(snap.Code, testContractCode) {
+		t.Errorf("storageless snapshot mismatch: have %v, %v", snap, err)
+	}
+	if snap, err := ContractSnapshot(NoOdr, odr, id, acc2Addr, true); snap != nil || err != nil {
+		t.Errorf("missing account mismatch: have %v, %v, want nil", snap, err)
+	}
+	// Forged code fails the snapshot
+	fdb, _ := wtcdb.NewMemDatabase()
+	forged := &forgedCodeOdr{&testOdr{sdb: sdb, ldb: fdb}}
+	if snap, err := ContractSnapshot(NoOdr, forged, id, testStateContract, true); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for forged code: have %v, %v, want %v", snap, err, ErrMalformedResponse)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var errInvalidTrieNode = errors.New("invalid trie node")
+
+// stateCoverageLimit is the maximum number of trie nodes StateCoverage visits.
+var stateCoverageLimit = 100000
+
+// Coverage describes how much of a trie is available in the local database.
+type Coverage struct {
+	RootPresent bool  // whether the root node itself is cached
+	Present     int   // number of reachable nodes found locally
+	Missing     int   // number of referenced nodes not found locally
+	Complete    bool  // whether the traversal finished within its bound
+	Err         error // ErrTrieTooDeep if the trie exceeds the configured MaxTrieDepth
+}
+
+// Ratio returns the share of the known nodes that are present locally.
+func (c Coverage) Ratio() float64 {
+	if c.Present+c.Missing == 0 {
+		return 0
+	}
+	return float64(c.Present) / float64(c.Present+c.Missing)
+}
+
+// StateCoverage walks the trie nodes reachable from root in the local database,
+// counting the cached and the missing ones. Subtrees below a missing node can't
+// be seen, so the number of missing nodes is a lower bound. Storage tries are
+// not followed, at most stateCoverageLimit nodes are visited and nothing below
+// the MaxTrieDepth of the configuration bound to db is looked at.
+func StateCoverage(db wtcdb.Database, root common.Hash) Coverage {
+	var (
+		limit  = ConfigOf(db).maxTrieDepth()
+		cov    Coverage
+		queue  = []common.Hash{root}
+		depths = []int{1}
+		seen   = map[common.Hash]bool{root: true}
+	)
+	for len(queue) > 0 && cov.Present+cov.Missing < stateCoverageLimit {
+		hash, depth := queue[0], depths[0]
+		queue, depths = queue[1:], depths[1:]
+
+		blob, err := db.Get(hash[:])
+		if err != nil || len(blob) == 0 {
+			cov.Missing++
+			continue
+		}
+		if hash == root {
+			cov.RootPresent = true
+		}
+		cov.Present++
+
+		children, err := nodeChildren(blob)
+		if err != nil {
+			continue // corrupt node, don't guess what's below it
+		}
+		if len(children) > 0 && depth >= limit {
+			cov.Err = ErrTrieTooDeep
+			continue
+		}
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				queue, depths = append(queue, child), append(depths, depth+1)
+			}
+		}
+	}
+	cov.Complete = len(queue) == 0 && cov.Err == nil
+	return cov
+}
+
+// nodeChildren returns the hashes of the nodes referenced by an RLP encoded trie
+// node, including the ones referenced by its embedded child nodes.
+func nodeChildren(blob []byte) ([]common.Hash, error) {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return nil, err
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, err
+	}
+	switch count {
+	case 2:
+		// Short node, only extensions have a child
+		key, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) > 0 && key[0]&0x20 != 0 {
+			return nil, nil // leaf, terminator flag set in the compact key
+		}
+		return childRefs(rest, 1)
+	case 17:
+		// Full node, the 17th element is the value
+		return childRefs(elems, 16)
+	default:
+		return nil, errInvalidTrieNode
+	}
+}
+
+// childRefs collects the nodes referenced by the first n child references in
+// the RLP encoded buffer.
+func childRefs(buf []byte, n int) ([]common.Hash, error) {
+	var refs []common.Hash
+	for i := 0; i < n; i++ {
+		kind, val, rest, err := rlp.Split(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case kind == rlp.List:
+			// Embedded node, look into it directly
+			embedded, err := nodeChildren(buf[:len(buf)-len(rest)])
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, embedded...)
+		case len(val) == common.HashLength:
+			refs = append(refs, common.BytesToHash(val))
+		}
+		buf = rest
+	}
+	return refs, nil
+}
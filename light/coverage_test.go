@@ -0,0 +1,73 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestStateCoverage(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	root := makeTestStorage(sdb, 300).Root
+
+	// Fully available trie
+	full := StateCoverage(sdb, root)
+	if !full.RootPresent || !full.Complete || full.Missing != 0 || full.Ratio() != 1 {
+		t.Errorf("full coverage mismatch: %+v", full)
+	}
+	nodes := 0
+	st, _ := trie.New(root, sdb)
+	for it := st.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+	if full.Present != nodes {
+		t.Errorf("full coverage node count mismatch: have %d, want %d", full.Present, nodes)
+	}
+	// Nothing available
+	ldb, _ := wtcdb.NewMemDatabase()
+	if empty := StateCoverage(ldb, root); empty.RootPresent || empty.Present != 0 || empty.Missing != 1 || empty.Ratio() != 0 {
+		t.Errorf("empty coverage mismatch: %+v", empty)
+	}
+	// Only the paths of a few proven keys available
+	for i := 0; i < 3; i++ {
+		slot := testStateSlot(i)
+		storeProof(ldb, st.Prove(crypto.Keccak256(slot[:])))
+	}
+	partial := StateCoverage(ldb, root)
+	if !partial.RootPresent || !partial.Complete {
+		t.Errorf("partial coverage mismatch: %+v", partial)
+	}
+	if ratio := partial.Ratio(); ratio <= 0 || ratio >= 1 {
+		t.Errorf("partial coverage ratio out of range: %v (%+v)", ratio, partial)
+	}
+	if partial.Present >= full.Present {
+		t.Errorf("partial coverage has too many nodes: have %d, full %d", partial.Present, full.Present)
+	}
+	// Bounded traversal
+	defer func(limit int) { stateCoverageLimit = limit }(stateCoverageLimit)
+	stateCoverageLimit = 10
+	if bounded := StateCoverage(sdb, root); bounded.Complete || bounded.Present != 10 {
+		t.Errorf("bounded coverage mismatch: %+v", bounded)
+	}
+}
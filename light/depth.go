@@ -0,0 +1,64 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var (
+	// ErrTrieTooDeep is returned if walking a locally cached trie goes deeper
+	// than MaxTrieDepth, which only happens with corrupt or cyclic data.
+	ErrTrieTooDeep = errors.New("trie too deep")
+
+	// ErrProofTooDeep is returned if a retrieved proof has more nodes than the
+	// MaxDepth of its request.
+	ErrProofTooDeep = errors.New("proof too deep")
+)
+
+// DefaultMaxTrieDepth is the default maximum number of nodes the local trie
+// walking helpers descend through. The path to a 32 byte key crosses at most 64
+// full nodes with a short node above each of them and a leaf below, the rest is
+// margin.
+const DefaultMaxTrieDepth = 2*64 + 1 + 31
+
+// maxTrieDepth returns the maximum trie depth of the configuration.
+func (c *Config) maxTrieDepth() int {
+	if c.MaxTrieDepth <= 0 {
+		return DefaultMaxTrieDepth
+	}
+	return c.MaxTrieDepth
+}
+
+// depthGuard is a database wrapper for walking a single path of a trie, failing
+// all reads once limit nodes have been resolved.
+type depthGuard struct {
+	wtcdb.Database
+	limit    int
+	reads    int
+	exceeded bool
+}
+
+func (g *depthGuard) Get(key []byte) ([]byte, error) {
+	if g.reads++; g.reads > g.limit {
+		g.exceeded = true
+		return nil, ErrTrieTooDeep
+	}
+	return g.Database.Get(key)
+}
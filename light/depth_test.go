@@ -0,0 +1,100 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeDeepTrie stores a chain of n full nodes, each referencing the next one as
+// its first child, returning the hash of the topmost one.
+func makeDeepTrie(db wtcdb.Database, n int) common.Hash {
+	var child []byte
+	for i := 0; i < n; i++ {
+		elems := make([][]byte, 17)
+		elems[0] = child
+		if i == 0 {
+			elems[16] = []byte("bottom")
+		}
+		blob, _ := rlp.EncodeToBytes(elems)
+		child = crypto.Keccak256(blob)
+		db.Put(child, blob)
+	}
+	return common.BytesToHash(child)
+}
+
+func TestTrieDepthGuard(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	deep := &TrieID{Root: makeDeepTrie(db, DefaultMaxTrieDepth+40)}
+	key := make([]byte, DefaultMaxTrieDepth) // twice as many nibbles as nodes
+
+	if ResolveLocally(db, &TrieRequest{Id: deep, Key: key}) {
+		t.Errorf("too deep trie resolved locally")
+	}
+	if prefix := localProofPrefix(db, deep.Root, key); prefix != nil {
+		t.Errorf("proof prefix of too deep trie returned: %d nodes", len(prefix))
+	}
+	if cov := StateCoverage(db, deep.Root); cov.Err != ErrTrieTooDeep || cov.Complete || cov.Present != DefaultMaxTrieDepth {
+		t.Errorf("coverage of too deep trie mismatch: %+v", cov)
+	}
+	it := NewStorageIterator(NoOdr, offlineOdr{db}, deep)
+	for it.Next() {
+	}
+	if it.Err() != ErrTrieTooDeep {
+		t.Errorf("iteration error mismatch: have %v, want %v", it.Err(), ErrTrieTooDeep)
+	}
+	// Raising the limit should make the same trie acceptable
+	raised := BindConfig(db, &Config{MaxTrieDepth: DefaultMaxTrieDepth + 50})
+	if !ResolveLocally(raised, &TrieRequest{Id: deep, Key: key}) {
+		t.Errorf("trie within the raised limit not resolved locally")
+	}
+	if cov := StateCoverage(raised, deep.Root); cov.Err != nil || !cov.Complete {
+		t.Errorf("coverage of trie within the raised limit mismatch: %+v", cov)
+	}
+}
+
+func TestTrieDepthGuardCycle(t *testing.T) {
+	// A corrupt extension node with an empty key referencing itself would be
+	// followed forever without consuming any of the key
+	db, _ := wtcdb.NewMemDatabase()
+	self := crypto.Keccak256([]byte("cycle"))
+	blob, _ := rlp.EncodeToBytes([][]byte{{0x00}, self})
+	db.Put(self, blob)
+
+	if ResolveLocally(db, &TrieRequest{Id: &TrieID{Root: common.BytesToHash(self)}, Key: []byte{1}}) {
+		t.Errorf("cyclic trie resolved locally")
+	}
+	// Helpers reading the local trie first must give up on it and retrieve
+	id := &TrieID{Root: common.BytesToHash(self)}
+	if _, err := GetAccount(NoOdr, offlineOdr{db}, id, common.Address{}); err != errOffline {
+		t.Errorf("account error mismatch: have %v, want %v", err, errOffline)
+	}
+	if _, err := GetStorageRoot(NoOdr, offlineOdr{db}, id, common.Address{}); err != errOffline {
+		t.Errorf("storage root error mismatch: have %v, want %v", err, errOffline)
+	}
+	if _, err := GetCodeHash(NoOdr, offlineOdr{db}, id, common.Address{}); err != errOffline {
+		t.Errorf("code hash error mismatch: have %v, want %v", err, errOffline)
+	}
+	if _, err := SumBalances(NoOdr, offlineOdr{db}, id, []common.Address{{}}); err != errOffline {
+		t.Errorf("balance sum error mismatch: have %v, want %v", err, errOffline)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// CacheDiskUsage estimates the space taken by the data retrieved into the local
+// database, by the kind of request storing it: trie nodes, code, headers, block
+// bodies, receipts and stripped receipts. The sizes of the keys and values of
+// all entries are summed, other entries aren't counted.
+//
+// Entries are recognized by the key layout of the chain database; trie nodes
+// and code share a content addressed layout and are told apart by whether the
+// value decodes as a trie node, like AuditCodeReferences does. Values are read
+// through the database iterator without being copied where it's supported.
+func CacheDiskUsage(db wtcdb.Database) (map[RequestKind]uint64, error) {
+	usage := make(map[RequestKind]uint64)
+	err := forEachEntry(db, func(key, value []byte) {
+		if kind := usageKind(key, value); kind != KindUnknown {
+			usage[kind] += uint64(len(key) + len(value))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// blockKeyLength is the length of the keys of block keyed chain data: a single
+// byte prefix, the block number and the block hash.
+const blockKeyLength = 1 + 8 + common.HashLength
+
+// usageKind returns the kind of request a database entry belongs to.
+func usageKind(key, value []byte) RequestKind {
+	switch {
+	case len(key) == common.HashLength:
+		if _, err := nodeValues(value); err == nil {
+			return KindTrie
+		}
+		return KindCode
+	case bytes.HasPrefix(key, bodyBlobPrefix):
+		return KindBlock
+	case bytes.HasPrefix(key, receiptsMetaPrefix):
+		return KindReceiptsMeta
+	case len(key) == blockKeyLength:
+		switch key[0] {
+		case 'h':
+			return KindHeader
+		case 'b':
+			return KindBlock
+		case 'r':
+			return KindReceipts
+		}
+	}
+	return KindUnknown
+}
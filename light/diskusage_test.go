@@ -0,0 +1,84 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestCacheDiskUsage(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	makeTestState(db)
+
+	// The hash keyed entries are the trie nodes and the code, the rest are
+	// preimages of the secure trie keys
+	var total uint64
+	for _, key := range db.Keys() {
+		if len(key) == 32 {
+			value, _ := db.Get(key)
+			total += uint64(len(key) + len(value))
+		}
+	}
+	codeSize := uint64(32 + len(testContractCode))
+
+	// Add a block with its header, body and receipts
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(&types.Header{Number: new(big.Int), Time: new(big.Int)}, txs, nil, receipts)
+	hash, num := block.Hash(), block.NumberU64()
+	core.WriteHeader(db, block.Header())
+	header, _ := rlp.EncodeToBytes(block.Header())
+	body, _ := rlp.EncodeToBytes(block.Body())
+	core.WriteBodyRLP(db, hash, num, body)
+	core.WriteBlockReceipts(db, hash, num, receipts)
+	stored, _ := rlp.EncodeToBytes(storedReceipts(receipts))
+
+	usage, err := CacheDiskUsage(db)
+	if err != nil {
+		t.Fatalf("failed to compute usage: %v", err)
+	}
+	want := map[RequestKind]uint64{
+		KindTrie:     total - codeSize,
+		KindCode:     codeSize,
+		KindHeader:   uint64(blockKeyLength + len(header)),
+		KindBlock:    uint64(blockKeyLength + len(body)),
+		KindReceipts: uint64(blockKeyLength + len(stored)),
+	}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("usage mismatch:\nhave %v\nwant %v", usage, want)
+	}
+
+	if _, err := CacheDiskUsage(NewReadOnlyDatabase(db)); err != ErrNotIterable {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotIterable)
+	}
+}
+
+// storedReceipts converts receipts into their database encoding.
+func storedReceipts(receipts types.Receipts) []*types.ReceiptForStorage {
+	stored := make([]*types.ReceiptForStorage, len(receipts))
+	for i, receipt := range receipts {
+		stored[i] = (*types.ReceiptForStorage)(receipt)
+	}
+	return stored
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+)
+
+// ErrDispatchIdentity is returned if a dispatch hook changed what a request asks
+// for instead of just how it's retrieved.
+var ErrDispatchIdentity = errors.New("dispatch hook changed request identity")
+
+// BeforeDispatch is called with every request right before it's retrieved and
+// returns the request to retrieve in its place, which may be req itself after
+// adjusting it, or nil to leave it as it is. A request of another value must be
+// of the same type; its results are copied into req once retrieved.
+//
+// The hook may only tune parameters outside of the request identity that keep
+// or tighten its verification, like the MaxDepth of a TrieRequest. The identity
+// of the request, i.e. everything MarshalRequest encodes (hashes, numbers,
+// roots, keys and candidate roots), must be left unchanged: otherwise nothing is
+// retrieved and ErrDispatchIdentity is returned. Verification parameters that
+// aren't part of the identity, like StrictSignatureCheck, can't be checked and
+// must not be loosened.
+type BeforeDispatch func(req OdrRequest) OdrRequest
+
+// DispatchHookOdr wraps an OdrBackend, passing every request through a hook
+// before retrieving it.
+type DispatchHookOdr struct {
+	OdrBackend
+	hook BeforeDispatch
+}
+
+// NewDispatchHookOdr creates a wrapper around backend calling hook before each
+// retrieval.
+func NewDispatchHookOdr(backend OdrBackend, hook BeforeDispatch) *DispatchHookOdr {
+	return &DispatchHookOdr{OdrBackend: backend, hook: hook}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *DispatchHookOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve passes req through the hook and retrieves the request it returned.
+func (odr *DispatchHookOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	before, merr := MarshalRequest(req)
+	r := odr.hook(req)
+	if r == nil {
+		r = req
+	}
+	if reflect.TypeOf(r) != reflect.TypeOf(req) {
+		return ErrDispatchIdentity
+	}
+	if merr == nil {
+		if after, err := MarshalRequest(r); err != nil || !bytes.Equal(after, before) {
+			return ErrDispatchIdentity
+		}
+	} else if r != req {
+		// Without an encoding the identity of another value can't be checked
+		return ErrDispatchIdentity
+	}
+	err := odr.OdrBackend.Retrieve(ctx, r)
+	if r != req {
+		reflect.ValueOf(req).Elem().Set(reflect.ValueOf(r).Elem())
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestDispatchHookDepthLimit(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	key := addressHash(acc1Addr)
+
+	limit := func(depth uint) BeforeDispatch {
+		return func(req OdrRequest) OdrRequest {
+			if r, ok := req.(*TrieRequest); ok {
+				r.MaxDepth = depth
+			}
+			return req
+		}
+	}
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewDispatchHookOdr(&testOdr{sdb: sdb, ldb: ldb}, limit(1))
+	if err := odr.Retrieve(NoOdr, &TrieRequest{Id: id, Key: key[:]}); err != ErrProofTooDeep {
+		t.Fatalf("error mismatch with depth limit: have %v, want %v", err, ErrProofTooDeep)
+	}
+	odr = NewDispatchHookOdr(&testOdr{sdb: sdb, ldb: ldb}, limit(uint(DefaultMaxTrieDepth)))
+	if err := odr.Retrieve(NoOdr, &TrieRequest{Id: id, Key: key[:]}); err != nil {
+		t.Fatalf("failed to retrieve within depth limit: %v", err)
+	}
+}
+
+func TestDispatchHookReplace(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	key := addressHash(acc1Addr)
+	ldb, _ := wtcdb.NewMemDatabase()
+
+	// A replacement of the same identity is retrieved and its results copied back
+	odr := NewDispatchHookOdr(&testOdr{sdb: sdb, ldb: ldb}, func(req OdrRequest) OdrRequest {
+		r := *req.(*TrieRequest)
+		r.MaxDepth = uint(DefaultMaxTrieDepth)
+		return &r
+	})
+	req := &TrieRequest{Id: id, Key: key[:]}
+	if err := odr.Retrieve(NoOdr, req); err != nil {
+		t.Fatalf("failed to retrieve replaced request: %v", err)
+	}
+	if len(req.Proof) == 0 {
+		t.Errorf("results of replaced request not copied")
+	}
+	// Changing what's asked for is rejected
+	tests := []BeforeDispatch{
+		func(req OdrRequest) OdrRequest {
+			r := *req.(*TrieRequest)
+			r.Key = common.Hash{1}.Bytes()
+			return &r
+		},
+		func(req OdrRequest) OdrRequest {
+			req.(*TrieRequest).Candidates = []common.Hash{{2}}
+			return nil
+		},
+		func(req OdrRequest) OdrRequest {
+			return &AccountRequest{Id: id, Address: acc1Addr}
+		},
+	}
+	for i, hook := range tests {
+		odr := NewDispatchHookOdr(&testOdr{sdb: sdb, ldb: ldb}, hook)
+		req := &TrieRequest{Id: id, Key: key[:]}
+		if err := odr.Retrieve(NoOdr, req); err != ErrDispatchIdentity {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, ErrDispatchIdentity)
+		}
+		if req.Proof != nil {
+			t.Errorf("test %d: request retrieved", i)
+		}
+	}
+}
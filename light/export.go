@@ -0,0 +1,75 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Encoder serializes a table of exported records, such as retrieval statistics
+// or audit log entries.
+type Encoder interface {
+	Encode(w io.Writer, columns []string, rows [][]interface{}) error
+}
+
+// JSONEncoder encodes records as a JSON array of objects keyed by column name.
+type JSONEncoder struct{}
+
+// Encode implements Encoder.
+func (JSONEncoder) Encode(w io.Writer, columns []string, rows [][]interface{}) error {
+	records := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		records[i] = make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			records[i][column] = row[j]
+		}
+	}
+	return json.NewEncoder(w).Encode(records)
+}
+
+// CSVEncoder encodes records as CSV, preceded by a header line of the columns.
+type CSVEncoder struct{}
+
+// Encode implements Encoder.
+func (CSVEncoder) Encode(w io.Writer, columns []string, rows [][]interface{}) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		fields := make([]string, len(row))
+		for i, field := range row {
+			fields[i] = fmt.Sprint(field)
+		}
+		if err := out.Write(fields); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// export encodes a table with enc, defaulting to JSON.
+func export(w io.Writer, enc Encoder, columns []string, rows [][]interface{}) error {
+	if enc == nil {
+		enc = JSONEncoder{}
+	}
+	return enc.Encode(w, columns, rows)
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// newTestExportOdr creates an audited, statistics gathering backend and runs a
+// successful code retrieval and a failing block retrieval through it.
+func newTestExportOdr() (*StatsOdr, *AuditOdr) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	sdb.Put(crypto.Keccak256(testContractCode), testContractCode)
+
+	base := &testOdr{sdb: sdb, ldb: ldb}
+	stats := NewStatsOdr(base)
+	audit := NewAuditOdr(stats, 2)
+
+	audit.Retrieve(NoOdr, &CodeRequest{Hash: crypto.Keccak256Hash(testContractCode)})
+	audit.Retrieve(NoOdr, &CodeRequest{Hash: crypto.Keccak256Hash(testContractCode)})
+	base.disable = true
+	audit.Retrieve(NoOdr, &BlockRequest{})
+	return stats, audit
+}
+
+func TestStatsExport(t *testing.T) {
+	stats, _ := newTestExportOdr()
+	if s := stats.Stats(); len(s) != 2 || s[0].Kind != KindCode || s[0].Requests != 2 || s[1].Kind != KindBlock || s[1].Failures != 1 {
+		t.Fatalf("stats mismatch: %+v", s)
+	}
+	// JSON is the default encoding
+	var buf bytes.Buffer
+	if err := stats.ExportStats(&buf, nil); err != nil {
+		t.Fatalf("failed to export JSON stats: %v", err)
+	}
+	var records []struct {
+		Kind     string `json:"kind"`
+		Requests uint64 `json:"requests"`
+		Failures uint64 `json:"failures"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("failed to decode JSON stats: %v", err)
+	}
+	if len(records) != 2 || records[0].Kind != "code" || records[0].Requests != 2 || records[1].Kind != "block" || records[1].Failures != 1 {
+		t.Errorf("JSON stats mismatch: %+v", records)
+	}
+	buf.Reset()
+	if err := stats.ExportStats(&buf, CSVEncoder{}); err != nil {
+		t.Fatalf("failed to export CSV stats: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to decode CSV stats: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "kind" || rows[1][0] != "code" || rows[1][1] != "2" || rows[2][2] != "1" {
+		t.Errorf("CSV stats mismatch: %v", rows)
+	}
+}
+
+func TestAuditExport(t *testing.T) {
+	_, audit := newTestExportOdr()
+	entries := audit.Entries()
+	if len(entries) != 2 || entries[0].Kind != KindCode || entries[0].Err != nil || entries[1].Err != ErrOdrDisabled {
+		t.Fatalf("audit log mismatch: %+v", entries)
+	}
+	var buf bytes.Buffer
+	if err := audit.ExportAudit(&buf, JSONEncoder{}); err != nil {
+		t.Fatalf("failed to export JSON audit log: %v", err)
+	}
+	var records []struct {
+		Kind  string `json:"kind"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("failed to decode JSON audit log: %v", err)
+	}
+	if len(records) != 2 || records[0].Kind != "code" || records[0].Error != "" || records[1].Error != ErrOdrDisabled.Error() {
+		t.Errorf("JSON audit log mismatch: %+v", records)
+	}
+	buf.Reset()
+	if err := audit.ExportAudit(&buf, CSVEncoder{}); err != nil {
+		t.Fatalf("failed to export CSV audit log: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to decode CSV audit log: %v", err)
+	}
+	if len(rows) != 3 || rows[0][3] != "error" || rows[1][1] != "code" || rows[2][3] != ErrOdrDisabled.Error() {
+		t.Errorf("CSV audit log mismatch: %v", rows)
+	}
+}
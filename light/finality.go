@@ -0,0 +1,101 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// FinalityStatus tells how deeply a block is buried in the verified chain.
+type FinalityStatus int
+
+const (
+	// Pending blocks aren't part of the verified canonical chain (yet), either
+	// because they're on a fork or newer than the verified head.
+	Pending FinalityStatus = iota
+
+	// Confirmed blocks are canonical but less than FinalityDepth blocks deep.
+	Confirmed
+
+	// Final blocks are buried at least FinalityDepth blocks deep, or covered by
+	// the trusted CHT.
+	Final
+)
+
+// String implements fmt.Stringer
+func (s FinalityStatus) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Confirmed:
+		return "confirmed"
+	case Final:
+		return "final"
+	default:
+		return "unknown"
+	}
+}
+
+// FinalityDepth is the number of blocks a canonical block has to be followed by
+// on the verified chain to be considered final.
+var FinalityDepth = uint64(64)
+
+// Finality returns the finality status of the block with the given header. It's
+// derived from the verified local head, never from one asserted by a peer, and
+// the canonical hash of the block number, which is proven by the trusted CHT or
+// resolved from the head like by VerifiedHashForNumber.
+func Finality(ctx context.Context, odr OdrBackend, header *types.Header) (FinalityStatus, error) {
+	head := verifiedHead(odr.Database())
+	if head == nil {
+		return Pending, ErrNoHead
+	}
+	number := header.Number.Uint64()
+	if number > head.Number.Uint64() {
+		return Pending, nil
+	}
+	canon, err := VerifiedHashForNumber(ctx, odr, number)
+	if err != nil {
+		return Pending, err
+	}
+	if canon != header.Hash() {
+		return Pending, nil
+	}
+	if cht := GetTrustedCht(odr.Database()); number < cht.Number*ChtFrequency {
+		return Final, nil
+	}
+	if head.Number.Uint64()-number >= FinalityDepth {
+		return Final, nil
+	}
+	return Confirmed, nil
+}
+
+// GetHeaderByHashWithFinality retrieves the header with the given hash like
+// GetHeaderByHash, together with its finality status.
+func GetHeaderByHashWithFinality(ctx context.Context, odr OdrBackend, hash common.Hash) (*types.Header, FinalityStatus, error) {
+	header, err := GetHeaderByHash(ctx, odr, hash)
+	if err != nil {
+		return nil, Pending, err
+	}
+	status, err := Finality(ctx, odr, header)
+	if err != nil {
+		return nil, Pending, err
+	}
+	return header, status, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+func TestFinality(t *testing.T) {
+	defer func(depth, freq uint64) { FinalityDepth, ChtFrequency = depth, freq }(FinalityDepth, ChtFrequency)
+	FinalityDepth, ChtFrequency = 3, 4
+
+	odr := NewMemoryOdrBackend(nil)
+	db := odr.Database()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 10)
+	writeCanonicalHeaders(db, headers[:9])
+	core.WriteHeader(db, headers[9]) // newer than the head
+	core.WriteHeadHeaderHash(db, headers[8].Hash())
+	fork := newTestUncle(headers[6], "fork")
+	core.WriteHeader(db, fork)
+
+	tests := []struct {
+		header *types.Header
+		want   FinalityStatus
+	}{
+		{headers[9], Pending}, // ahead of the head
+		{headers[8], Confirmed},
+		{headers[6], Confirmed},
+		{fork, Pending},
+		{headers[5], Final}, // FinalityDepth blocks deep
+		{headers[0], Final},
+	}
+	for i, tt := range tests {
+		header, status, err := GetHeaderByHashWithFinality(NoOdr, odr, tt.header.Hash())
+		if err != nil || header.Hash() != tt.header.Hash() || status != tt.want {
+			t.Errorf("test %d: finality mismatch: have %v, %v, want %v", i, status, err, tt.want)
+		}
+	}
+	// Blocks covered by the trusted CHT are final regardless of their depth
+	FinalityDepth = 100
+	if status, _ := Finality(NoOdr, odr, headers[5]); status != Confirmed {
+		t.Errorf("deep block finality mismatch without CHT: have %v, want %v", status, Confirmed)
+	}
+	WriteTrustedCht(db, TrustedCht{Number: 2})
+	for i, want := range map[int]FinalityStatus{6: Final, 7: Confirmed} {
+		if status, err := Finality(NoOdr, odr, headers[i]); err != nil || status != want {
+			t.Errorf("block %d: finality mismatch with CHT: have %v, %v, want %v", i+1, status, err, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+)
+
+// ErrStaleRead is returned by the fresh read helpers if the block a read is
+// anchored to is older than MaxStaleness relative to the verified head.
+var ErrStaleRead = errors.New("read anchored to stale block")
+
+// MaxStaleness bounds the age of the block the fresh read helpers read the state
+// of, measured as the difference between its header timestamp and the one of the
+// verified local head. It keeps a malicious server from answering with the state
+// of an old block it picked. Zero disables the bound.
+var MaxStaleness time.Duration = 0
+
+// AnchorTime returns the timestamp of the verified header of the block the trie
+// identified by id belongs to, and enforces MaxStaleness on it. A state trie ID
+// must carry the state root of that header, otherwise ErrMalformedResponse is
+// returned, as the header doesn't vouch for the trie.
+func AnchorTime(ctx context.Context, odr OdrBackend, id *TrieID) (uint64, error) {
+	header, err := GetHeaderByHash(ctx, odr, id.BlockHash)
+	if err != nil {
+		return 0, err
+	}
+	if header.Number.Uint64() != id.BlockNumber || (id.AccKey == nil && header.Root != id.Root) {
+		return 0, ErrMalformedResponse
+	}
+	if MaxStaleness > 0 {
+		head := verifiedHead(odr.Database())
+		if head == nil {
+			return 0, ErrNoHead
+		}
+		age := new(big.Int).Sub(head.Time, header.Time)
+		if age.Cmp(big.NewInt(int64(MaxStaleness/time.Second))) > 0 {
+			return 0, ErrStaleRead
+		}
+	}
+	return header.Time.Uint64(), nil
+}
+
+// FreshAccount retrieves the account with the given address like GetAccount,
+// together with the timestamp of the header its state root was taken from. The
+// read is rejected with ErrStaleRead before anything is retrieved if that header
+// is older than MaxStaleness.
+func FreshAccount(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (*state.Account, uint64, error) {
+	stamp, err := AnchorTime(ctx, odr, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	account, err := GetAccount(ctx, odr, id, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return account, stamp, nil
+}
+
+// FreshStorageRead retrieves a storage slot like VerifiedStorageRead, together
+// with the timestamp of the header the state root was taken from. The read is
+// rejected with ErrStaleRead before anything is retrieved if that header is
+// older than MaxStaleness.
+func FreshStorageRead(ctx context.Context, odr OdrBackend, state *TrieID, addr common.Address, slot common.Hash) ([]byte, uint64, error) {
+	stamp, err := AnchorTime(ctx, odr, state)
+	if err != nil {
+		return nil, 0, err
+	}
+	content, err := VerifiedStorageRead(ctx, odr, state, addr, slot)
+	if err != nil {
+		return nil, 0, err
+	}
+	return content, stamp, nil
+}
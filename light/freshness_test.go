@@ -0,0 +1,72 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestFreshAccount(t *testing.T) {
+	defer func(max time.Duration) { MaxStaleness = max }(MaxStaleness)
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	header.Time = big.NewInt(1000)
+	headers := makeTestHeaders(header, 6) // 10 seconds apart
+	writeCanonicalHeaders(ldb, append(headers, header))
+	core.WriteHeadHeaderHash(ldb, headers[5].Hash())
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	// Without a bound the read succeeds and returns the anchor timestamp
+	account, stamp, err := FreshAccount(NoOdr, odr, id, acc1Addr)
+	if err != nil || account == nil || account.Balance.Int64() != 1000 || stamp != 1000 {
+		t.Fatalf("fresh account mismatch: have %v, %d, %v", account, stamp, err)
+	}
+	// The anchor is 60 seconds behind the head
+	MaxStaleness = time.Minute
+	if _, stamp, err := FreshStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(1)); err != nil || stamp != 1000 {
+		t.Errorf("read within bound failed: have %d, %v", stamp, err)
+	}
+	MaxStaleness = 30 * time.Second
+	if _, _, err := FreshAccount(NoOdr, odr, id, acc1Addr); err != ErrStaleRead {
+		t.Errorf("error mismatch for stale anchor: have %v, want %v", err, ErrStaleRead)
+	}
+	if _, _, err := FreshStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(1)); err != ErrStaleRead {
+		t.Errorf("error mismatch for stale storage anchor: have %v, want %v", err, ErrStaleRead)
+	}
+	// A header not carrying the requested state root doesn't vouch for it
+	forged := &TrieID{BlockHash: headers[3].Hash(), BlockNumber: 4, Root: header.Root}
+	if _, err := AnchorTime(NoOdr, odr, forged); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for foreign root: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// A recent anchor passes
+	if stamp, err := AnchorTime(NoOdr, odr, StateTrieID(headers[3])); err != nil || stamp != 1040 {
+		t.Errorf("recent anchor mismatch: have %d, %v, want 1040", stamp, err)
+	}
+	// Without a verified head the bound can't be enforced
+	core.WriteHeadHeaderHash(ldb, newTestUncle(headers[4], "fork").Hash())
+	if _, _, err := FreshAccount(NoOdr, odr, id, acc1Addr); err != ErrNoHead {
+		t.Errorf("error mismatch without head: have %v, want %v", err, ErrNoHead)
+	}
+}
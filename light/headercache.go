@@ -0,0 +1,81 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/hashicorp/golang-lru"
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// headerCache caches recently read or written headers by hash, saving the RLP
+// decoding of headers touched repeatedly, e.g. by range scans. It is disabled by
+// default.
+var headerCache *lru.Cache
+
+// SetHeaderCache enables caching the given number of most recently accessed
+// decoded headers, or disables the cache if size is zero. It is meant to be
+// called during initialization, before any ODR retrieval, and assumes a single
+// database is used by the process.
+func SetHeaderCache(size int) {
+	if size <= 0 {
+		headerCache = nil
+		return
+	}
+	headerCache, _ = lru.New(size)
+}
+
+// getHeader retrieves a header from the cache, falling back to decoding it from
+// the database. The returned header is shared and mustn't be modified.
+func getHeader(db wtcdb.Database, hash common.Hash, number uint64) *types.Header {
+	cache := headerCache
+	if cache == nil {
+		return core.GetHeader(db, hash, number)
+	}
+	if header, ok := cache.Get(hash); ok {
+		if header := header.(*types.Header); header.Number.Uint64() == number {
+			return header
+		}
+		return nil
+	}
+	header := core.GetHeader(db, hash, number)
+	if header != nil {
+		cache.Add(hash, header)
+	}
+	return header
+}
+
+// writeHeader stores a header in the database and the cache.
+func writeHeader(db wtcdb.Database, header *types.Header) error {
+	if err := core.WriteHeader(db, header); err != nil {
+		return err
+	}
+	if cache := headerCache; cache != nil {
+		cache.Add(header.Hash(), header)
+	}
+	return nil
+}
+
+// deleteHeader removes a header from the database and the cache.
+func deleteHeader(db wtcdb.Database, hash common.Hash, number uint64) {
+	core.DeleteHeader(db, hash, number)
+	if cache := headerCache; cache != nil {
+		cache.Remove(hash)
+	}
+}
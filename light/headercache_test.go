@@ -0,0 +1,74 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestHeaderCache(t *testing.T) {
+	defer SetHeaderCache(0)
+
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 3)
+
+	SetHeaderCache(2)
+	for _, header := range headers {
+		if err := writeHeader(db, header); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+	}
+	if n := headerCache.Len(); n != 2 {
+		t.Errorf("cache size mismatch: have %d, want %d", n, 2)
+	}
+	for _, header := range headers {
+		if have := getHeader(db, header.Hash(), header.Number.Uint64()); have == nil || have.Hash() != header.Hash() {
+			t.Errorf("header %d mismatch: have %v, want %x", header.Number, have, header.Hash())
+		}
+	}
+	if have := getHeader(db, headers[2].Hash(), 1); have != nil {
+		t.Errorf("header returned for wrong number: %x", have.Hash())
+	}
+	deleteHeader(db, headers[2].Hash(), 3)
+	if have := getHeader(db, headers[2].Hash(), 3); have != nil {
+		t.Errorf("deleted header still returned")
+	}
+}
+
+func BenchmarkHeaderUncached(b *testing.B) { benchmarkHeader(b, 0) }
+func BenchmarkHeaderCached(b *testing.B)   { benchmarkHeader(b, 128) }
+
+func benchmarkHeader(b *testing.B, size int) {
+	defer SetHeaderCache(0)
+	SetHeaderCache(size)
+
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 100)
+	for _, header := range headers {
+		writeHeader(db, header)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		header := headers[i%len(headers)]
+		getHeader(db, header.Hash(), header.Number.Uint64())
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/consensus"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// HeaderChainError is returned by VerifyHeaderChain for the first header that
+// doesn't extend the one before it.
+type HeaderChainError struct {
+	Index  int    // position of the offending header
+	Reason string // what's wrong with it
+}
+
+func (e *HeaderChainError) Error() string {
+	return fmt.Sprintf("header %d: %s", e.Index, e.Reason)
+}
+
+// VerifyHeaderChain checks that the headers form a chain: each of them must be
+// the child of the previous one, with the next number and a later timestamp.
+// The headers aren't checked against a CHT or the consensus rules, only that
+// they fit together.
+func VerifyHeaderChain(headers []*types.Header) error {
+	for i, header := range headers {
+		if header == nil || header.Number == nil || header.Time == nil {
+			return &HeaderChainError{i, "incomplete header"}
+		}
+		if i == 0 {
+			continue
+		}
+		parent := headers[i-1]
+		if header.Number.Cmp(new(big.Int).Add(parent.Number, common.Big1)) != 0 {
+			return &HeaderChainError{i, fmt.Sprintf("number %v doesn't follow %v", header.Number, parent.Number)}
+		}
+		if header.ParentHash != parent.Hash() {
+			return &HeaderChainError{i, fmt.Sprintf("parent hash %x doesn't match %x", header.ParentHash, parent.Hash())}
+		}
+		if header.Time.Cmp(parent.Time) <= 0 {
+			return &HeaderChainError{i, fmt.Sprintf("timestamp %v not after %v", header.Time, parent.Time)}
+		}
+	}
+	return nil
+}
+
+// EngineVerifier returns a HeaderVerifier checking headers, including their
+// seals, against the rules of a consensus engine. The chain must give access to
+// the locally stored headers, e.g. a core.HeaderChain on the light database.
+func EngineVerifier(engine consensus.Engine, chain consensus.ChainReader) HeaderVerifier {
+	return func(headers []*types.Header) error {
+		seals := make([]bool, len(headers))
+		for i := range seals {
+			seals[i] = true
+		}
+		abort, results := engine.VerifyHeaders(chain, headers, seals)
+		defer close(abort)
+
+		for i := range headers {
+			if err := <-results; err != nil {
+				return &HeaderChainError{i, err.Error()}
+			}
+		}
+		return nil
+	}
+}
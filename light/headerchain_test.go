@@ -0,0 +1,69 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestVerifyHeaderChain(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 5)
+
+	if err := VerifyHeaderChain(headers); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	if err := VerifyHeaderChain(nil); err != nil {
+		t.Fatalf("empty chain rejected: %v", err)
+	}
+	// A sibling of the third header breaks the link to the fourth one
+	broken := append([]*types.Header{}, headers...)
+	broken[2] = newTestUncle(headers[1], "sibling")
+
+	gap := append([]*types.Header{}, headers[:2]...)
+	gap = append(gap, headers[3:]...)
+
+	stale := append([]*types.Header{}, headers...)
+	stale[4] = types.CopyHeader(headers[4])
+	stale[4].Time = new(big.Int).Set(headers[3].Time)
+
+	tests := []struct {
+		headers []*types.Header
+		index   int
+	}{
+		{broken, 3},
+		{gap, 2},
+		{stale, 4},
+		{[]*types.Header{headers[0], {}}, 1},
+	}
+	for i, tt := range tests {
+		err, ok := VerifyHeaderChain(tt.headers).(*HeaderChainError)
+		if !ok {
+			t.Errorf("test %d: inconsistency not detected", i)
+			continue
+		}
+		if err.Index != tt.index {
+			t.Errorf("test %d: index mismatch: have %d, want %d (%v)", i, err.Index, tt.index, err)
+		}
+	}
+}
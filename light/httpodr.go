@@ -0,0 +1,531 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/common/hexutil"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrReceiptHashMismatch is returned if retrieved receipts don't hash to the
+// ReceiptHash of their header.
+var ErrReceiptHashMismatch = errors.New("receipt hash mismatch")
+
+// httpVerifyAttempts is the number of times a retrieval is attempted if the
+// replies of the provider fail verification under the RejectAndRetry policy.
+// Providers behind a load balancer may well be served by another machine.
+const httpVerifyAttempts = 3
+
+// errProviderUnsupported is returned if the provider doesn't serve a request.
+var errProviderUnsupported = errors.New("request not supported by provider")
+
+// HTTPOdrBackend is an ODR backend retrieving data from an HTTP proof provider
+// instead of LES peers. Every request is posted to the endpoint as a JSON object
+// and the reply is verified the same way network responses are.
+type HTTPOdrBackend struct {
+	lock     sync.RWMutex // held for reading by retrievals, for writing by SwapDatabase
+	db       wtcdb.Database
+	endpoint string
+	header   http.Header // extra headers (e.g. authorization) sent with each call
+	client   *http.Client
+	policy   VerificationFailurePolicy
+	config   *Config
+}
+
+// NewHTTPOdrBackend creates an ODR backend posting requests to endpoint, storing
+// the verified results in db.
+func NewHTTPOdrBackend(db wtcdb.Database, endpoint string, header http.Header) *HTTPOdrBackend {
+	return &HTTPOdrBackend{
+		db:       db,
+		endpoint: endpoint,
+		header:   header,
+		client:   new(http.Client),
+		config:   DefaultConfig(),
+	}
+}
+
+// httpOdrRequest is the JSON encoding of an ODR request sent to the provider.
+type httpOdrRequest struct {
+	Kind        string         `json:"kind"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	AccKey      hexutil.Bytes  `json:"accKey,omitempty"`
+	Key         hexutil.Bytes  `json:"key,omitempty"`
+	FromLevel   hexutil.Uint64 `json:"fromLevel"`
+	Hash        common.Hash    `json:"hash"`
+	ChtNum      hexutil.Uint64 `json:"chtNum"`
+	Amount      hexutil.Uint64 `json:"amount,omitempty"`
+}
+
+// httpOdrResponse is the JSON encoding of a reply of the provider. Chain data
+// (headers, bodies, receipts) is passed in RLP encoding.
+type httpOdrResponse struct {
+	Proof []hexutil.Bytes `json:"proof"`
+	Data  hexutil.Bytes   `json:"data"`
+	Td    *hexutil.Big    `json:"td"`
+}
+
+// httpTxLookup is the RLP encoded data of a transaction lookup reply: the lookup
+// entry followed by the body of the block it points to.
+type httpTxLookup struct {
+	BlockHash     common.Hash
+	Number, Index uint64
+	Body          rlp.RawValue
+}
+
+// SetVerificationFailurePolicy sets how replies failing verification are handled.
+func (b *HTTPOdrBackend) SetVerificationFailurePolicy(policy VerificationFailurePolicy) {
+	b.policy = policy
+}
+
+// SetConfig sets the configuration the replies of the provider are verified and
+// stored with.
+func (b *HTTPOdrBackend) SetConfig(config *Config) {
+	b.config = config
+}
+
+// Config returns the configuration of the backend.
+func (b *HTTPOdrBackend) Config() *Config {
+	return b.config
+}
+
+// Database returns the database the retrieved data is stored in.
+func (b *HTTPOdrBackend) Database() wtcdb.Database {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.db
+}
+
+// flusher is implemented by databases buffering writes, like BufferedDatabase.
+type flusher interface {
+	Flush() error
+}
+
+// SwapDatabase redirects the backend to store retrieved data in db, e.g. in a
+// compacted copy of the current database. It waits for the running retrievals
+// to finish against the current database, which is flushed first if it buffers
+// writes; if that fails, the current database is kept. Retrievals starting
+// afterwards use db. The current database isn't closed.
+func (b *HTTPOdrBackend) SwapDatabase(db wtcdb.Database) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if f, ok := b.db.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	b.db = db
+	return nil
+}
+
+// Retrieve fetches the requested data from the proof provider, verifies it and
+// stores it in the local database.
+func (b *HTTPOdrBackend) Retrieve(ctx context.Context, req OdrRequest) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.retrieve(ctx, req)
+}
+
+// retrieve implements Retrieve, assuming the database lock is held.
+func (b *HTTPOdrBackend) retrieve(ctx context.Context, req OdrRequest) error {
+	db := BindConfig(b.db, b.config)
+	if ResolveLocally(db, req) {
+		return req.StoreResult(StoreDatabase(db, req))
+	}
+	if r, ok := req.(*BatchBlockRequest); ok {
+		return b.retrieveBodies(ctx, r)
+	}
+	if r, ok := req.(*BatchHeaderRequest); ok {
+		return b.retrieveHeaders(ctx, r)
+	}
+	if r, ok := req.(*BatchTrieRequest); ok {
+		return b.retrieveTries(ctx, r)
+	}
+	hreq := &httpOdrRequest{Kind: KindOf(req).String()}
+	switch r := req.(type) {
+	case *TrieRequest:
+		hreq.BlockHash, hreq.BlockNumber = r.Id.BlockHash, hexutil.Uint64(r.Id.BlockNumber)
+		hreq.AccKey, hreq.Key, hreq.FromLevel = r.Id.AccKey, r.Key, hexutil.Uint64(r.FromLevel)
+	case *AccountRequest:
+		key := addressHash(r.Address)
+		hreq.BlockHash, hreq.BlockNumber = r.Id.BlockHash, hexutil.Uint64(r.Id.BlockNumber)
+		hreq.Key = key[:]
+	case *StorageRootRequest:
+		key := addressHash(r.Address)
+		hreq.Kind = KindAccount.String() // served as an account proof
+		hreq.BlockHash, hreq.BlockNumber = r.StateId.BlockHash, hexutil.Uint64(r.StateId.BlockNumber)
+		hreq.Key = key[:]
+	case *CodeHashRequest:
+		key := addressHash(r.Address)
+		hreq.Kind = KindAccount.String() // served as an account proof
+		hreq.BlockHash, hreq.BlockNumber = r.StateId.BlockHash, hexutil.Uint64(r.StateId.BlockNumber)
+		hreq.Key = key[:]
+	case *CodeRequest:
+		hreq.BlockHash, hreq.BlockNumber = r.Id.BlockHash, hexutil.Uint64(r.Id.BlockNumber)
+		hreq.AccKey, hreq.Hash = r.Id.AccKey, r.Hash
+	case *BlockRequest:
+		hreq.Hash, hreq.BlockNumber = r.Hash, hexutil.Uint64(r.Number)
+	case *ReceiptsRequest:
+		hreq.Hash, hreq.BlockNumber = r.Hash, hexutil.Uint64(r.Number)
+	case *TxLogsRequest:
+		hreq.Kind = KindReceipts.String() // served as the block receipts
+		hreq.Hash, hreq.BlockNumber = r.BlockHash, hexutil.Uint64(r.Number)
+	case *TxLookupRequest:
+		hreq.Hash = r.TxHash
+	case *ReceiptsMetaRequest:
+		r.Stripped = true
+		hreq.Hash, hreq.BlockNumber = r.Hash, hexutil.Uint64(r.Number)
+	case *TxByIndexRequest:
+		hreq.Kind = KindBlock.String() // served as a block body
+		hreq.Hash, hreq.BlockNumber = r.BlockHash, hexutil.Uint64(r.Number)
+	case *ChtRequest:
+		hreq.ChtNum, hreq.BlockNumber = hexutil.Uint64(r.ChtNum), hexutil.Uint64(r.BlockNum)
+	case *StateRootRequest:
+		hreq.Kind = KindCht.String() // served as a CHT entry
+		hreq.ChtNum, hreq.BlockNumber = hexutil.Uint64(r.ChtNum), hexutil.Uint64(r.Number)
+	case *BlockBloomRequest:
+		hreq.Kind = KindCht.String() // served as a CHT entry
+		hreq.ChtNum, hreq.BlockNumber = hexutil.Uint64(r.ChtNum), hexutil.Uint64(r.Number)
+	case *HeaderByHashRequest:
+		hreq.ChtNum, hreq.Hash = hexutil.Uint64(r.ChtNum), r.Hash
+	case *HeaderSegmentRequest:
+		hreq.BlockHash, hreq.BlockNumber, hreq.Amount = r.Anchor, hexutil.Uint64(r.Number), hexutil.Uint64(r.Amount)
+	default:
+		return ErrUnsupportedRequest
+	}
+	retries := make(map[error]int) // transient failures retried regardless of the policy
+	for attempt := 1; ; attempt++ {
+		resp, err := b.call(ctx, KindOf(req), hreq)
+		if r, ok := req.(*ReceiptsMetaRequest); ok && err == errProviderUnsupported && r.Stripped {
+			// The provider can't strip receipts, fall back to the full ones
+			r.Stripped, hreq.Kind = false, KindReceipts.String()
+			resp, err = b.call(ctx, KindOf(req), hreq)
+		}
+		if err != nil {
+			return err
+		}
+		if err = b.fill(req, resp); err == nil {
+			err = storeBuffered(ctx, db, req)
+		}
+		if err == nil {
+			return nil
+		}
+		if retries[err] < ConfigOf(db).TransientRetries(err) {
+			retries[err]++
+			attempt--
+			continue
+		}
+		switch {
+		case b.policy == StoreAndFlag:
+			if raw, jerr := json.Marshal(resp); jerr == nil {
+				WriteUnverified(b.db, req, raw)
+			}
+			return err
+		case b.policy == RejectAndDiscard || attempt == httpVerifyAttempts:
+			return err
+		}
+	}
+}
+
+// call posts a request to the provider and decodes its reply, which is read no
+// further than the response size limit of the given request kind.
+func (b *HTTPOdrBackend) call(ctx context.Context, kind RequestKind, hreq *httpOdrRequest) (*httpOdrResponse, error) {
+	body, err := json.Marshal(hreq)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", b.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range b.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errProviderUnsupported
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proof provider returned %s", res.Status)
+	}
+	resp := new(httpOdrResponse)
+	reply := &limitedReader{r: res.Body, left: BackendConfig(b).ResponseLimit(kind)}
+	if err := json.NewDecoder(reply).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fill validates a reply of the provider and copies its content into req. The
+// checks done by StoreResult itself are not repeated.
+func (b *HTTPOdrBackend) fill(req OdrRequest, resp *httpOdrResponse) error {
+	proof := make([]rlp.RawValue, len(resp.Proof))
+	for i, node := range resp.Proof {
+		proof[i] = rlp.RawValue(node)
+	}
+	switch r := req.(type) {
+	case *TrieRequest:
+		proof, err := CompleteTrieProof(BindConfig(b.db, b.config), r, proof)
+		if err != nil {
+			return err
+		}
+		r.Proof = proof
+
+	case *AccountRequest:
+		r.Proof = proof
+
+	case *StorageRootRequest:
+		r.Proof = proof
+
+	case *CodeHashRequest:
+		r.Proof = proof
+
+	case *CodeRequest:
+		if crypto.Keccak256Hash(resp.Data) != r.Hash {
+			return ErrMalformedResponse
+		}
+		r.Data = resp.Data
+
+	case *BlockRequest:
+		header := core.GetHeader(b.db, r.Hash, r.Number)
+		if header == nil {
+			return ErrNoHeader
+		}
+		body := new(types.Body)
+		if err := rlp.DecodeBytes(resp.Data, body); err != nil {
+			return ErrMalformedResponse
+		}
+		if header.TxHash != types.DeriveSha(types.Transactions(body.Transactions)) {
+			return ErrTxHashMismatch
+		}
+		r.Rlp = resp.Data
+
+	case *TxByIndexRequest:
+		r.Rlp = resp.Data
+
+	case *ReceiptsRequest:
+		receipts, err := b.fullReceipts(r.Hash, r.Number, resp.Data)
+		if err != nil {
+			return err
+		}
+		r.Receipts = receipts
+
+	case *TxLogsRequest:
+		receipts, err := b.fullReceipts(r.BlockHash, r.Number, resp.Data)
+		if err != nil {
+			return err
+		}
+		r.Receipts = receipts
+
+	case *TxLookupRequest:
+		var entry httpTxLookup
+		if err := rlp.DecodeBytes(resp.Data, &entry); err != nil {
+			return ErrMalformedResponse
+		}
+		r.BlockHash, r.Number, r.Index, r.Rlp = entry.BlockHash, entry.Number, entry.Index, entry.Body
+
+	case *ReceiptsMetaRequest:
+		if !r.Stripped {
+			receipts, err := b.fullReceipts(r.Hash, r.Number, resp.Data)
+			if err != nil {
+				return err
+			}
+			r.Receipts = receipts
+			break
+		}
+		meta, err := decodeReceiptsMeta(resp.Data)
+		if err != nil {
+			return ErrMalformedResponse
+		}
+		r.Meta = meta
+
+	case *ChtRequest:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(resp.Data, header); err != nil || resp.Td == nil {
+			return ErrMalformedResponse
+		}
+		r.Header, r.Td, r.Proof = header, (*big.Int)(resp.Td), proof
+
+	case *StateRootRequest:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(resp.Data, header); err != nil || resp.Td == nil {
+			return ErrMalformedResponse
+		}
+		r.Header, r.Td, r.Proof = header, (*big.Int)(resp.Td), proof
+
+	case *BlockBloomRequest:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(resp.Data, header); err != nil || resp.Td == nil {
+			return ErrMalformedResponse
+		}
+		r.Header, r.Td, r.Proof = header, (*big.Int)(resp.Td), proof
+
+	case *HeaderByHashRequest:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(resp.Data, header); err != nil {
+			return ErrMalformedResponse
+		}
+		r.Header, r.Proof = header, proof
+
+	case *HeaderSegmentRequest:
+		var headers []*types.Header
+		if err := rlp.DecodeBytes(resp.Data, &headers); err != nil {
+			return ErrMalformedResponse
+		}
+		r.Headers = headers
+	}
+	return nil
+}
+
+// retrieveBodies fetches the bodies of a batch request one by one, as the
+// provider has no batch call. Failures are reported per block. Every body is
+// stored as soon as it's verified, so if the retrieval is cancelled the bodies
+// retrieved until then are kept and the rest fail with the error of ctx.
+func (b *HTTPOdrBackend) retrieveBodies(ctx context.Context, req *BatchBlockRequest) error {
+	if len(req.Numbers) != len(req.Hashes) {
+		return ErrMalformedResponse
+	}
+	req.Rlps, req.Errs = make([][]byte, len(req.Hashes)), make([]error, len(req.Hashes))
+	for i, hash := range req.Hashes {
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(req.Hashes); j++ {
+				req.Errs[j] = err
+			}
+			return err
+		}
+		r := &BlockRequest{Hash: hash, Number: req.Numbers[i]}
+		if req.Errs[i] = b.retrieve(ctx, r); req.Errs[i] == nil {
+			req.Rlps[i] = r.Rlp
+		}
+	}
+	return nil
+}
+
+// retrieveTries fetches the proofs of a batch request one by one, as the
+// provider has no batch call, and verifies and stores them together so that the
+// proofs of entries of the same trie are verified at once. Entries failing
+// verification are retrieved again like single requests, applying the retries
+// and the verification failure policy of those. Failures are reported per entry.
+func (b *HTTPOdrBackend) retrieveTries(ctx context.Context, req *BatchTrieRequest) error {
+	fetched := make([]error, len(req.Requests))
+	proofs := make([][]rlp.RawValue, len(req.Requests))
+	for i, r := range req.Requests {
+		if err := ctx.Err(); err != nil {
+			req.Errs = make([]error, len(req.Requests))
+			for j := i; j < len(req.Requests); j++ {
+				req.Errs[j] = err
+			}
+			return err
+		}
+		hreq := &httpOdrRequest{Kind: KindTrie.String()}
+		hreq.BlockHash, hreq.BlockNumber = r.Id.BlockHash, hexutil.Uint64(r.Id.BlockNumber)
+		hreq.AccKey, hreq.Key, hreq.FromLevel = r.Id.AccKey, r.Key, hexutil.Uint64(r.FromLevel)
+		resp, err := b.call(ctx, KindTrie, hreq)
+		if err == nil {
+			proofs[i] = make([]rlp.RawValue, len(resp.Proof))
+			for j, node := range resp.Proof {
+				proofs[i][j] = rlp.RawValue(node)
+			}
+		}
+		fetched[i] = err
+	}
+	db := BindConfig(b.db, b.config)
+	req.Proofs, req.Errs = CompleteTrieProofs(db, req.Requests, proofs)
+	if err := storeBuffered(ctx, db, req); err != nil {
+		return err
+	}
+	for i, r := range req.Requests {
+		switch err := req.Errs[i]; {
+		case fetched[i] != nil:
+			req.Errs[i] = fetched[i]
+		case err != nil && (b.policy != RejectAndDiscard || ConfigOf(db).TransientRetries(err) > 0):
+			if req.Errs[i] = b.retrieve(ctx, r); req.Errs[i] == nil {
+				req.Proofs[i] = r.Proof
+			}
+		}
+	}
+	return nil
+}
+
+// retrieveHeaders fetches the headers of a batch request one by one, as the
+// provider has no batch call, and verifies and stores them together so that
+// parents in the batch are known. Failures are reported per header.
+func (b *HTTPOdrBackend) retrieveHeaders(ctx context.Context, req *BatchHeaderRequest) error {
+	fetched := make([]error, len(req.Hashes))
+	req.Headers, req.Proofs = make([]*types.Header, len(req.Hashes)), make([][]rlp.RawValue, len(req.Hashes))
+	for i, hash := range req.Hashes {
+		hreq := &httpOdrRequest{Kind: KindHeader.String(), ChtNum: hexutil.Uint64(req.ChtNum), Hash: hash}
+		resp, err := b.call(ctx, KindHeader, hreq)
+		if err == nil {
+			r := &HeaderByHashRequest{Hash: hash, ChtNum: req.ChtNum, ChtRoot: req.ChtRoot}
+			if err = b.fill(r, resp); err == nil {
+				req.Headers[i], req.Proofs[i] = r.Header, r.Proof
+			}
+		}
+		fetched[i] = err
+	}
+	if err := storeBuffered(ctx, BindConfig(b.db, b.config), req); err != nil {
+		return err
+	}
+	for i, err := range fetched {
+		if err != nil {
+			req.Errs[i] = err
+		}
+	}
+	return nil
+}
+
+// fullReceipts decodes the receipts of a block from a reply of the provider and
+// verifies them against the ReceiptHash of the locally known header.
+func (b *HTTPOdrBackend) fullReceipts(hash common.Hash, number uint64, data []byte) (types.Receipts, error) {
+	header := core.GetHeader(b.db, hash, number)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	receipts, err := DecodeReceipts(data)
+	if err != nil {
+		return nil, ErrMalformedResponse
+	}
+	if header.ReceiptHash != types.DeriveSha(receipts) {
+		return nil, ErrReceiptHashMismatch
+	}
+	return receipts, nil
+}
@@ -0,0 +1,519 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/common/hexutil"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// newTestProofProvider creates an HTTP proof provider serving proofs of the state
+// with the given root and code from sdb to clients presenting the given
+// authorization header.
+func newTestProofProvider(sdb wtcdb.Database, root common.Hash, auth string, tamper bool, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != auth {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(delay)
+
+		var req httpOdrRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp httpOdrResponse
+		switch req.Kind {
+		case "trie", "account":
+			trieRoot := root
+			if len(req.AccKey) > 0 {
+				trieRoot = accountRoot(sdb, root, req.AccKey)
+			}
+			t, _ := trie.New(trieRoot, sdb)
+			for _, node := range t.Prove(req.Key) {
+				resp.Proof = append(resp.Proof, hexutil.Bytes(node))
+			}
+		case "code":
+			resp.Data, _ = sdb.Get(req.Hash[:])
+			if tamper {
+				resp.Data = append(resp.Data, 0x00)
+			}
+		default:
+			http.Error(w, "unsupported", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+}
+
+// accountRoot returns the storage root of the account with the given hash.
+func accountRoot(db wtcdb.Database, root common.Hash, addrHash []byte) common.Hash {
+	t, _ := trie.New(root, db)
+	enc, _ := t.TryGet(addrHash)
+	var account state.Account
+	rlp.DecodeBytes(enc, &account)
+	return account.Root
+}
+
+func TestHTTPOdrBackend(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	srv := newTestProofProvider(sdb, header.Root, "Bearer secret", false, 0)
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(ldb, srv.URL, http.Header{"Authorization": {"Bearer secret"}})
+
+	account, err := GetAccount(NoOdr, odr, id, testStateContract)
+	if err != nil || account == nil {
+		t.Fatalf("failed to retrieve account: %v, %v", account, err)
+	}
+	storage := StorageTrieID(id, crypto.Keccak256Hash(testStateContract[:]), account.Root)
+	st, _ := NewStateDatabase(NoOdr, header, odr).OpenStorageTrie(crypto.Keccak256Hash(testStateContract[:]), storage.Root)
+	slot := testStateSlot(3)
+	value, err := st.TryGet(slot[:])
+	if err != nil {
+		t.Fatalf("failed to retrieve storage slot: %v", err)
+	}
+	var content []byte
+	rlp.DecodeBytes(value, &content)
+	if have := new(big.Int).SetBytes(content); have.Int64() != 4 {
+		t.Errorf("storage slot mismatch: have %v, want %d", have, 4)
+	}
+	code := &CodeRequest{Id: storage, Hash: crypto.Keccak256Hash(testContractCode)}
+	if err := odr.Retrieve(NoOdr, code); err != nil {
+		t.Errorf("failed to retrieve code: %v", err)
+	}
+	if err := odr.Retrieve(NoOdr, &BloomTrieRootRequest{}); err != ErrUnsupportedRequest {
+		t.Errorf("error mismatch for unsupported request: have %v, want %v", err, ErrUnsupportedRequest)
+	}
+	// Requests without the credentials should be rejected by the provider
+	adb, _ := wtcdb.NewMemDatabase()
+	anon := NewHTTPOdrBackend(adb, srv.URL, nil)
+	if err := anon.Retrieve(NoOdr, &CodeRequest{Id: storage, Hash: code.Hash}); err == nil {
+		t.Errorf("unauthorized retrieval succeeded")
+	}
+}
+
+func TestHTTPOdrBackendTampered(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+
+	srv := newTestProofProvider(sdb, header.Root, "", true, 0)
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+	code := &CodeRequest{Id: StateTrieID(header), Hash: crypto.Keccak256Hash(testContractCode)}
+	if err := odr.Retrieve(NoOdr, code); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for tampered code: have %v, want %v", err, ErrMalformedResponse)
+	}
+	if ok, _ := ldb.Has(code.Hash[:]); ok {
+		t.Errorf("tampered code stored")
+	}
+}
+
+func TestHTTPOdrBackendTimeout(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+
+	srv := newTestProofProvider(sdb, header.Root, "", false, 500*time.Millisecond)
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := GetAccount(ctx, odr, StateTrieID(header), acc1Addr); err == nil {
+		t.Errorf("retrieval succeeded despite timeout")
+	}
+}
+
+func TestHTTPOdrBackendFailurePolicy(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	// Serve account proofs with the leaf node dropped
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req httpOdrRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var resp httpOdrResponse
+		tr, _ := trie.New(header.Root, sdb)
+		proof := tr.Prove(req.Key)
+		for _, node := range proof[:len(proof)-1] {
+			resp.Proof = append(resp.Proof, hexutil.Bytes(node))
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		policy  VerificationFailurePolicy
+		calls   int
+		flagged bool
+	}{
+		{RejectAndRetry, httpVerifyAttempts, false},
+		{RejectAndDiscard, 1, false},
+		{StoreAndFlag, 1, true},
+	}
+	for _, tt := range tests {
+		calls = 0
+		ldb, _ := wtcdb.NewMemDatabase()
+		odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+		odr.SetVerificationFailurePolicy(tt.policy)
+
+		req := &AccountRequest{Id: id, Address: testBankAddress}
+		if err := odr.Retrieve(NoOdr, req); err == nil {
+			t.Errorf("%v: tampered proof accepted", tt.policy)
+		}
+		if calls != tt.calls {
+			t.Errorf("%v: provider call count mismatch: have %d, want %d", tt.policy, calls, tt.calls)
+		}
+		if flagged := GetUnverified(ldb, &AccountRequest{Id: id, Address: testBankAddress}) != nil; flagged != tt.flagged {
+			t.Errorf("%v: flagged mismatch: have %v, want %v", tt.policy, flagged, tt.flagged)
+		}
+		// Flagged or not, nothing may be served as trusted
+		offline := NewHTTPOdrBackend(ldb, "http://127.0.0.1:0", nil)
+		if account, err := GetAccount(NoOdr, offline, id, testBankAddress); err == nil {
+			t.Errorf("%v: tampered account served: %v", tt.policy, account)
+		}
+	}
+}
+
+func TestHTTPOdrBackendRetryOnEmpty(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	// Answer the first call of every retrieval with an empty proof
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req httpOdrRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var resp httpOdrResponse
+		if calls > 1 {
+			tr, _ := trie.New(header.Root, sdb)
+			for _, node := range tr.Prove(req.Key) {
+				resp.Proof = append(resp.Proof, hexutil.Bytes(node))
+			}
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	for _, retries := range []int{0, 1} {
+		calls = 0
+
+		ldb, _ := wtcdb.NewMemDatabase()
+		odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+		odr.SetVerificationFailurePolicy(RejectAndDiscard)
+		config := DefaultConfig()
+		config.RetryOnEmpty = retries
+		odr.SetConfig(config)
+
+		req := &AccountRequest{Id: id, Address: testBankAddress}
+		err := odr.Retrieve(NoOdr, req)
+		if retries == 0 && err != ErrEmptyProof {
+			t.Errorf("error mismatch without retries: have %v, want %v", err, ErrEmptyProof)
+		}
+		if retries > 0 && (err != nil || req.Account == nil) {
+			t.Errorf("retry failed: %v, %v", req.Account, err)
+		}
+		if calls != retries+1 {
+			t.Errorf("provider call count mismatch with %d retries: have %d, want %d", retries, calls, retries+1)
+		}
+	}
+}
+
+func TestHTTPOdrBackendBatchCancel(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	parent := new(core.Genesis).MustCommit(sdb).Header()
+	blocks := make([]*types.Block, 3)
+	for i := range blocks {
+		blocks[i] = makeTestBlock(parent, makeTestTxs(i+1), nil, nil)
+		core.WriteBlock(sdb, blocks[i])
+		parent = blocks[i].Header()
+	}
+	// The provider serves the first body, then the retrieval is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpOdrRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if served++; served > 1 {
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(&httpOdrResponse{Data: hexutil.Bytes(core.GetBodyRLP(sdb, req.Hash, uint64(req.BlockNumber)))})
+	}))
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	req := &BatchBlockRequest{}
+	for _, block := range blocks {
+		core.WriteHeader(ldb, block.Header())
+		req.Hashes, req.Numbers = append(req.Hashes, block.Hash()), append(req.Numbers, block.NumberU64())
+	}
+	odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+	if err := odr.Retrieve(ctx, req); err != context.Canceled {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if done := req.Completed(); !reflect.DeepEqual(done, []int{0}) {
+		t.Errorf("completed blocks mismatch: have %v, want [0]", done)
+	}
+	if core.GetBodyRLP(ldb, blocks[0].Hash(), 1) == nil {
+		t.Errorf("retrieved body not stored")
+	}
+	for i, block := range blocks[1:] {
+		if core.GetBodyRLP(ldb, block.Hash(), block.NumberU64()) != nil {
+			t.Errorf("block %d: cancelled body stored", i+2)
+		}
+		if req.Errs[i+1] == nil {
+			t.Errorf("block %d: missing error for cancelled body", i+2)
+		}
+	}
+}
+
+func TestHTTPOdrBackendBatchTries(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	keys, proofs := makeGroupedProofs(sdb, id.Root)
+
+	// The provider leaves out the root node of the first proof, which is only
+	// complete along with the second one
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpOdrRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var resp httpOdrResponse
+		for i, key := range keys {
+			if bytes.Equal(req.Key, key) {
+				for _, node := range proofs[i] {
+					resp.Proof = append(resp.Proof, hexutil.Bytes(node))
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+	odr.SetVerificationFailurePolicy(RejectAndDiscard)
+
+	req := &BatchTrieRequest{Requests: []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}}
+	if err := odr.Retrieve(NoOdr, req); err != nil {
+		t.Fatalf("failed to retrieve batch: %v", err)
+	}
+	for i, err := range req.Errs {
+		if err != nil {
+			t.Errorf("entry %d: proof not verified with the batch: %v", i, err)
+		}
+	}
+	if _, ok := localValue(ldb, id.Root, keys[0]); !ok {
+		t.Errorf("grouped entry not available locally")
+	}
+}
+
+func TestHTTPOdrBackendSwapDatabase(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	srv := newTestProofProvider(sdb, header.Root, "", false, 50*time.Millisecond)
+	defer srv.Close()
+
+	// Buffer all results, so the swap has pending writes to flush
+	odb, _ := wtcdb.NewMemDatabase()
+	ndb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(NewBufferedDatabase(odb, WriteSync{}), srv.URL, nil)
+
+	req := &AccountRequest{Id: id, Address: testStateContract}
+	done := make(chan error, 1)
+	go func() { done <- odr.Retrieve(NoOdr, req) }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := odr.SwapDatabase(ndb); err != nil {
+		t.Fatalf("failed to swap database: %v", err)
+	}
+	// The swap waits for the running retrieval, which stores into the old handle
+	select {
+	case err := <-done:
+		if err != nil || req.Account == nil {
+			t.Fatalf("in-flight retrieval failed: %v, %v", req.Account, err)
+		}
+	default:
+		t.Fatalf("swap returned before in-flight retrieval")
+	}
+	for _, node := range req.Proof {
+		if ok, _ := odb.Has(crypto.Keccak256(node)); !ok {
+			t.Errorf("proof node %x not flushed to old database", crypto.Keccak256(node))
+		}
+		if ok, _ := ndb.Has(crypto.Keccak256(node)); ok {
+			t.Errorf("proof node %x stored in new database", crypto.Keccak256(node))
+		}
+	}
+	if odr.Database() != ndb {
+		t.Fatalf("database handle not swapped")
+	}
+	// Later retrievals go to the new handle only
+	code := &CodeRequest{Id: id, Hash: crypto.Keccak256Hash(testContractCode)}
+	if err := odr.Retrieve(NoOdr, code); err != nil {
+		t.Fatalf("failed to retrieve code after swap: %v", err)
+	}
+	if ok, _ := ndb.Has(code.Hash[:]); !ok {
+		t.Errorf("code not stored in new database")
+	}
+	if ok, _ := odb.Has(code.Hash[:]); ok {
+		t.Errorf("code stored in old database")
+	}
+}
+
+func TestHTTPOdrBackendNoCache(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	var calls int
+	provider := newTestProofProvider(sdb, header.Root, "", false, 0)
+	defer provider.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		provider.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+	hash := crypto.Keccak256Hash(testContractCode)
+
+	// Cacheable kinds should be served from the database once retrieved
+	for i := 0; i < 2; i++ {
+		if err := odr.Retrieve(NoOdr, &CodeRequest{Id: id, Hash: hash}); err != nil {
+			t.Fatalf("failed to retrieve code: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("provider call count mismatch: have %d, want %d", calls, 1)
+	}
+	// Non-cacheable kinds should ignore the cached entry and go to the provider
+	odr.SetConfig(&Config{NoCache: map[RequestKind]bool{KindCode: true}})
+	code := &CodeRequest{Id: id, Hash: hash}
+	if err := odr.Retrieve(NoOdr, code); err != nil {
+		t.Fatalf("failed to retrieve non-cacheable code: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("provider call count mismatch: have %d, want %d", calls, 2)
+	}
+	if !bytes.Equal(code.Data, testContractCode) {
+		t.Errorf("code mismatch: have %x, want %x", code.Data, testContractCode)
+	}
+	if data, _ := ldb.Get(hash[:]); !bytes.Equal(data, testContractCode) {
+		t.Errorf("retrieved code not stored: %x", data)
+	}
+}
+
+func TestHTTPOdrBackendStaleRoot(t *testing.T) {
+	// Advance the state, but let the provider lag behind on the first call
+	sdb, _ := wtcdb.NewMemDatabase()
+	stale := makeTestState(sdb)
+	st, _ := state.New(stale.Root, state.NewDatabase(sdb))
+	st.AddBalance(acc1Addr, big.NewInt(500), new(big.Int), new(big.Int))
+	root, _ := st.CommitTo(sdb, true)
+	id := StateTrieID(&types.Header{Number: big.NewInt(1), Root: root})
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var req httpOdrRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		served := root
+		if calls == 1 {
+			served = stale.Root
+		}
+		var resp httpOdrResponse
+		tr, _ := trie.New(served, sdb)
+		for _, node := range tr.Prove(req.Key) {
+			resp.Proof = append(resp.Proof, hexutil.Bytes(node))
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	key := crypto.Keccak256(acc1Addr[:])
+	reqs := []func() OdrRequest{
+		func() OdrRequest { return &AccountRequest{Id: id, Address: acc1Addr} },
+		func() OdrRequest { return &TrieRequest{Id: id, Key: key} },
+	}
+	for i, newReq := range reqs {
+		for _, retries := range []int{0, 1} {
+			calls = 0
+
+			ldb, _ := wtcdb.NewMemDatabase()
+			odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+			odr.SetVerificationFailurePolicy(RejectAndDiscard)
+			config := DefaultConfig()
+			config.RetryOnStaleRoot = retries
+			odr.SetConfig(config)
+
+			err := odr.Retrieve(NoOdr, newReq())
+			if retries == 0 && err != ErrStaleStateRoot {
+				t.Errorf("request %d: error mismatch without retries: have %v, want %v", i, err, ErrStaleStateRoot)
+			}
+			if retries > 0 && err != nil {
+				t.Errorf("request %d: retry failed: %v", i, err)
+			}
+			if calls != retries+1 {
+				t.Errorf("request %d: provider call count mismatch with %d retries: have %d, want %d", i, retries, calls, retries+1)
+			}
+			// Nothing of the stale state may be stored
+			if ok, _ := ldb.Has(stale.Root[:]); ok {
+				t.Errorf("request %d: stale root node stored", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import "context"
+
+type interactiveKey struct{}
+
+// WithInteractive marks all retrievals made with the returned context as
+// blocking a user visible operation, e.g. a UI element waiting for its data.
+// Backends queueing their requests dispatch interactive ones ahead of bulk
+// background work and keep part of their request budget available for them.
+// Bulk requests that already waited long are not overtaken, so marking reads
+// interactive can't starve the rest.
+func WithInteractive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, interactiveKey{}, true)
+}
+
+// Interactive tells whether ctx was marked by WithInteractive.
+func Interactive(ctx context.Context) bool {
+	interactive, _ := ctx.Value(interactiveKey{}).(bool)
+	return interactive
+}
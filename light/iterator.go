@@ -0,0 +1,72 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/wtc/go-wtc/trie"
+)
+
+// StorageIterator enumerates all entries of an account's storage trie. Trie
+// nodes missing from the local database are retrieved through the ODR backend
+// as the iteration reaches them, every node being verified against the hash
+// referencing it. Only a single retrieval is in flight at any time, so a large
+// storage is paged in node by node instead of being requested at once.
+type StorageIterator struct {
+	Key   []byte // Hash of the current storage slot
+	Value []byte // RLP encoded value of the current storage slot
+
+	ctx context.Context
+	it  *trie.Iterator
+	err error
+}
+
+// NewStorageIterator creates an iterator over the storage trie identified by id,
+// usually obtained through StorageTrieID.
+func NewStorageIterator(ctx context.Context, backend OdrBackend, id *TrieID) *StorageIterator {
+	t := &odrTrie{db: &odrDatabase{ctx: ctx, id: id, backend: backend}, id: id}
+	return &StorageIterator{
+		ctx: ctx,
+		it:  trie.NewIterator(newNodeIterator(t, nil)),
+	}
+}
+
+// Next moves the iterator to the next storage entry, returning whether there is
+// one. If false is returned, Err tells whether the iteration stopped because of
+// a failure or the context being cancelled.
+func (it *StorageIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	if !it.it.Next() {
+		it.err = it.it.Err
+		it.Key, it.Value = nil, nil
+		return false
+	}
+	it.Key, it.Value = it.it.Key, it.it.Value
+	return true
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *StorageIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeTestStorage commits a contract with the given number of storage slots
+// into db and returns the TrieID of its storage trie.
+func makeTestStorage(db wtcdb.Database, slots int) *TrieID {
+	st, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	st.SetCode(testStateContract, testContractCode)
+	for i := 0; i < slots; i++ {
+		st.SetState(testStateContract, testStateSlot(i), common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	root, _ := st.CommitTo(db, true)
+	st, _ = state.New(root, state.NewDatabase(db))
+
+	addrHash := crypto.Keccak256Hash(testStateContract[:])
+	return StorageTrieID(&TrieID{Root: root}, addrHash, st.StorageTrie(testStateContract).Hash())
+}
+
+func TestStorageIterator(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	id := makeTestStorage(sdb, 300)
+
+	full, _ := trie.New(id.Root, sdb)
+	want := trie.NewIterator(full.NodeIterator(nil))
+
+	it := NewStorageIterator(context.Background(), &testOdr{sdb: sdb, ldb: ldb}, id)
+	count := 0
+	for it.Next() {
+		if !want.Next() {
+			t.Fatalf("light iterator has more entries")
+		}
+		if !bytes.Equal(it.Key, want.Key) || !bytes.Equal(it.Value, want.Value) {
+			t.Fatalf("entry %d mismatch: have %x=%x, want %x=%x", count, it.Key, it.Value, want.Key, want.Value)
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iteration failed: %v", err)
+	}
+	if want.Next() {
+		t.Fatalf("light iterator has fewer entries")
+	}
+	if count != 300 {
+		t.Fatalf("entry count mismatch: have %d, want %d", count, 300)
+	}
+}
+
+func TestStorageIteratorCancel(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	id := makeTestStorage(sdb, 300)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	it := NewStorageIterator(ctx, &testOdr{sdb: sdb, ldb: ldb}, id)
+	for i := 0; i < 10; i++ {
+		if !it.Next() {
+			t.Fatalf("iteration stopped early: %v", it.Err())
+		}
+	}
+	cancel()
+	if it.Next() {
+		t.Fatalf("iteration continued after cancel")
+	}
+	if it.Err() != context.Canceled {
+		t.Fatalf("error mismatch: have %v, want %v", it.Err(), context.Canceled)
+	}
+}
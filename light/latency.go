@@ -0,0 +1,49 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"time"
+
+	"github.com/wtc/go-wtc/metrics"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// LatencyHistograms tracks the time it takes to retrieve and store the results
+// of each kind of ODR request, in nanoseconds.
+//
+// ODR helpers only turn to the backend if the requested data is not available
+// locally, so cache hits never show up in the histograms.
+type LatencyHistograms map[RequestKind]gometrics.Histogram
+
+// NewLatencyHistograms creates a histogram for every request kind, registered
+// under prefix/<kind>. The histograms are stubs unless metrics are enabled.
+func NewLatencyHistograms(prefix string) LatencyHistograms {
+	h := make(LatencyHistograms)
+	for kind := KindUnknown; kind < numRequestKinds; kind++ {
+		h[kind] = metrics.NewHistogram(prefix + "/" + kind.String())
+	}
+	return h
+}
+
+// Observe records the latency of a completed retrieval of the given kind.
+func (h LatencyHistograms) Observe(kind RequestKind, elapsed time.Duration) {
+	if hist, ok := h[kind]; ok {
+		hist.Update(int64(elapsed))
+	}
+}
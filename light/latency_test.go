@@ -0,0 +1,57 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/metrics"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+func TestLatencyHistograms(t *testing.T) {
+	defer func(enabled bool) { metrics.Enabled = enabled }(metrics.Enabled)
+	metrics.Enabled = true
+
+	// The histograms live in the global registry, drop them so reruns start empty
+	const prefix = "light/test/latency"
+	defer func() {
+		for kind := KindUnknown; kind < numRequestKinds; kind++ {
+			gometrics.DefaultRegistry.Unregister(prefix + "/" + kind.String())
+		}
+	}()
+	h := NewLatencyHistograms(prefix)
+	for i := 1; i <= 100; i++ {
+		h.Observe(KindTrie, time.Duration(i)*time.Millisecond)
+	}
+	h.Observe(KindCode, time.Second)
+
+	if count := h[KindTrie].Count(); count != 100 {
+		t.Errorf("trie sample count mismatch: have %d, want %d", count, 100)
+	}
+	if count := h[KindCode].Count(); count != 1 {
+		t.Errorf("code sample count mismatch: have %d, want %d", count, 1)
+	}
+	if count := h[KindBlock].Count(); count != 0 {
+		t.Errorf("block sample count mismatch: have %d, want %d", count, 0)
+	}
+	if p99 := time.Duration(h[KindTrie].Percentile(0.99)); p99 < 99*time.Millisecond {
+		t.Errorf("trie p99 too low: have %v, want >= %v", p99, 99*time.Millisecond)
+	}
+}
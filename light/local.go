@@ -0,0 +1,136 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// errNotCached is returned by the local database of requests never answered
+// from the database.
+var errNotCached = errors.New("not cached")
+
+// noCacheDatabase is the local database helpers read requests of the kinds in
+// the NoCache configuration from: nothing is ever found in it.
+type noCacheDatabase struct {
+	wtcdb.Database
+}
+
+func (noCacheDatabase) Get(key []byte) ([]byte, error) { return nil, errNotCached }
+func (noCacheDatabase) Has(key []byte) (bool, error)   { return false, nil }
+
+// localDatabase returns the database helpers try to answer requests of the
+// given kind from before retrieving them, an empty one if the configuration of
+// odr lists the kind in NoCache.
+func localDatabase(odr OdrBackend, kind RequestKind) wtcdb.Database {
+	config := BackendConfig(odr)
+	if config.NoCache[kind] {
+		return noCacheDatabase{odr.Database()}
+	}
+	return BindConfig(odr.Database(), config)
+}
+
+// ResolveLocally tries to answer req from the local database alone, filling in
+// its result fields the same way a network retrieval would. Trie requests are
+// answered whenever the whole path to the key is cached, even if that exact key
+// was never retrieved before. Backends call it before going to the network.
+// Requests of the kinds in the NoCache configuration bound to db are never
+// answered.
+func ResolveLocally(db wtcdb.Database, req OdrRequest) bool {
+	if ConfigOf(db).NoCache[KindOf(req)] {
+		return false
+	}
+	switch r := req.(type) {
+	case *TrieRequest:
+		proof, ok := localProof(db, r.Id.Root, r.Key)
+		if ok {
+			r.Proof, r.MatchedRoot = proof, r.Id.Root
+		}
+		return ok
+	case *AccountRequest:
+		key := addressHash(r.Address)
+		proof, ok := localProof(db, r.Id.Root, key[:])
+		if ok {
+			r.Proof = proof
+		}
+		return ok
+	case *StorageRootRequest:
+		key := addressHash(r.Address)
+		proof, ok := localProof(db, r.StateId.Root, key[:])
+		if ok {
+			r.Proof = proof
+		}
+		return ok
+	case *CodeHashRequest:
+		key := addressHash(r.Address)
+		proof, ok := localProof(db, r.StateId.Root, key[:])
+		if ok {
+			r.Proof = proof
+		}
+		return ok
+	case *CodeRequest:
+		data, err := ReadContent(db, r.Hash, ContentCode)
+		if err != nil || crypto.Keccak256Hash(data) != r.Hash {
+			return false
+		}
+		r.Data = data
+		return true
+	}
+	return false
+}
+
+// localProof creates the merkle proof of key from the local database, reporting
+// whether all nodes on the path were available. Paths deeper than MaxTrieDepth
+// are treated as unavailable.
+func localProof(db wtcdb.Database, root common.Hash, key []byte) ([]rlp.RawValue, bool) {
+	if root == types.EmptyRootHash {
+		return nil, true
+	}
+	guard := &depthGuard{Database: nodeReader{db}, limit: ConfigOf(db).maxTrieDepth()}
+	t, err := trie.New(root, guard)
+	if err != nil {
+		return nil, false
+	}
+	proof, complete := t.ProvePrefix(key)
+	if guard.exceeded {
+		return nil, false
+	}
+	return proof, complete
+}
+
+// localValue reads the value of key from the trie with the given root in the
+// local database, reporting whether the whole path to the key was available.
+// Like the ones of localProof, reads only resolve content stored as trie nodes
+// and paths deeper than MaxTrieDepth are treated as unavailable.
+func localValue(db wtcdb.Database, root common.Hash, key []byte) ([]byte, bool) {
+	t, err := trie.New(root, &depthGuard{Database: nodeReader{db}, limit: ConfigOf(db).maxTrieDepth()})
+	if err != nil {
+		return nil, false
+	}
+	value, err := t.TryGet(key)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestResolveLocally(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	id := StateTrieID(header)
+
+	// Nothing is cached yet, the request must go to the network
+	ldb, _ := wtcdb.NewMemDatabase()
+	if ResolveLocally(ldb, &AccountRequest{Id: id, Address: acc1Addr}) {
+		t.Fatalf("account resolved from empty database")
+	}
+	// Cache the whole state trie, then read keys never requested before
+	for _, key := range sdb.Keys() {
+		value, _ := sdb.Get(key)
+		ldb.Put(key, value)
+	}
+	acc := &AccountRequest{Id: id, Address: acc1Addr}
+	if !ResolveLocally(ldb, acc) {
+		t.Fatalf("cached account not resolved locally")
+	}
+	if err := acc.StoreResult(ldb); err != nil || acc.Account == nil {
+		t.Fatalf("locally resolved account invalid: %v, %v", acc.Account, err)
+	}
+	absent := &TrieRequest{Id: id, Key: crypto.Keccak256(acc2Addr[:])}
+	if !ResolveLocally(ldb, absent) {
+		t.Fatalf("absent account not resolved locally")
+	}
+	if value, err := trie.VerifyProof(id.Root, absent.Key, absent.Proof); err != nil || value != nil {
+		t.Errorf("local absence proof invalid: %x, %v", value, err)
+	}
+	// A backend with an unreachable provider should serve cached keys regardless
+	odr := NewHTTPOdrBackend(ldb, "http://127.0.0.1:0", http.Header{})
+	if account, err := GetAccount(NoOdr, odr, id, testStateContract); err != nil || account == nil {
+		t.Errorf("cached account not served locally: %v, %v", account, err)
+	}
+	code := &CodeRequest{Id: id, Hash: crypto.Keccak256Hash(testContractCode)}
+	if err := odr.Retrieve(NoOdr, code); err != nil {
+		t.Errorf("cached code not served locally: %v", err)
+	}
+}
+
+func TestNoCacheHelpers(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &countingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+
+	// Cached accounts are read from the database once retrieved
+	for i := 0; i < 2; i++ {
+		if _, err := GetAccount(NoOdr, odr, id, acc1Addr); err != nil {
+			t.Fatalf("failed to retrieve account: %v", err)
+		}
+	}
+	if odr.accounts != 1 {
+		t.Fatalf("account retrieval count mismatch: have %d, want %d", odr.accounts, 1)
+	}
+	// Non-cacheable kinds skip the database in the helpers as well
+	odr.config = &Config{NoCache: map[RequestKind]bool{KindAccount: true}}
+	account, err := GetAccount(NoOdr, odr, id, acc1Addr)
+	if err != nil || account == nil || account.Balance.Int64() != 1000 {
+		t.Fatalf("failed to retrieve non-cacheable account: %v, %v", account, err)
+	}
+	if odr.accounts != 2 {
+		t.Errorf("account retrieval count mismatch: have %d, want %d", odr.accounts, 2)
+	}
+	// Other kinds don't affect accounts
+	odr.config = &Config{NoCache: map[RequestKind]bool{KindCode: true}}
+	if _, err := GetAccount(NoOdr, odr, id, acc1Addr); err != nil {
+		t.Errorf("failed to read account: %v", err)
+	}
+	if odr.accounts != 2 {
+		t.Errorf("cached account retrieved: have %d retrievals, want %d", odr.accounts, 2)
+	}
+}
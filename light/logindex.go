@@ -0,0 +1,227 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var (
+	logIndexPrefix     = []byte("light-logs-")     // logIndexPrefix + num (uint64 big endian) + hash + address + topic0 -> RLP encoded logs
+	logIndexMarkPrefix = []byte("light-logsmark-") // logIndexMarkPrefix + num (uint64 big endian) + hash -> empty, the block is indexed
+)
+
+// indexedLogRLP is the stored form of a log in the index, without the address
+// and first topic which are part of the key.
+type indexedLogRLP struct {
+	Topics  []common.Hash
+	Data    []byte
+	TxHash  common.Hash
+	TxIndex uint64
+	Index   uint64
+}
+
+// blockKey returns prefix + num (uint64 big endian) + hash.
+func blockKey(prefix []byte, hash common.Hash, number uint64) []byte {
+	key := make([]byte, len(prefix)+8+common.HashLength)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], number)
+	copy(key[len(prefix)+8:], hash[:])
+	return key
+}
+
+// logIndexKey returns the database key of the logs of a block emitted by addr
+// with the given first topic, the zero hash for logs without topics.
+func logIndexKey(hash common.Hash, number uint64, addr common.Address, topic0 common.Hash) []byte {
+	key := blockKey(logIndexPrefix, hash, number)
+	key = append(key, addr[:]...)
+	return append(key, topic0[:]...)
+}
+
+// logTopic0 returns the first topic of a log, or the zero hash if it has none.
+func logTopic0(log *types.Log) common.Hash {
+	if len(log.Topics) == 0 {
+		return common.Hash{}
+	}
+	return log.Topics[0]
+}
+
+// indexReceiptLogs stores the logs of the receipts of a block in the log index,
+// grouped by address and first topic, then marks the block as indexed.
+func indexReceiptLogs(db wtcdb.Putter, hash common.Hash, number uint64, receipts types.Receipts) error {
+	type column struct {
+		addr   common.Address
+		topic0 common.Hash
+	}
+	var (
+		order   []column
+		columns = make(map[column][]indexedLogRLP)
+	)
+	for i, receipt := range receipts {
+		for _, log := range txLogs(receipts, receipt.TxHash, hash, number, uint64(i)) {
+			col := column{log.Address, logTopic0(log)}
+			if _, ok := columns[col]; !ok {
+				order = append(order, col)
+			}
+			var topics []common.Hash
+			if len(log.Topics) > 1 {
+				topics = log.Topics[1:]
+			}
+			columns[col] = append(columns[col], indexedLogRLP{topics, log.Data, log.TxHash, uint64(log.TxIndex), uint64(log.Index)})
+		}
+	}
+	for _, col := range order {
+		data, err := rlp.EncodeToBytes(columns[col])
+		if err != nil {
+			return err
+		}
+		if err := db.Put(logIndexKey(hash, number, col.addr, col.topic0), data); err != nil {
+			return err
+		}
+	}
+	return db.Put(blockKey(logIndexMarkPrefix, hash, number), []byte{})
+}
+
+// GetIndexedLogs returns the logs of a block emitted by addr with the given first
+// topic from the log index. The returned flag reports whether the block is
+// indexed at all; if it isn't, its receipts have to be scanned instead.
+func GetIndexedLogs(db wtcdb.Database, hash common.Hash, number uint64, addr common.Address, topic0 common.Hash) ([]*types.Log, bool) {
+	if ok, _ := db.Has(blockKey(logIndexMarkPrefix, hash, number)); !ok {
+		return nil, false
+	}
+	data, _ := db.Get(logIndexKey(hash, number, addr, topic0))
+	if len(data) == 0 {
+		return nil, true
+	}
+	var entries []indexedLogRLP
+	if err := rlp.DecodeBytes(data, &entries); err != nil {
+		return nil, false
+	}
+	logs := make([]*types.Log, len(entries))
+	for i, entry := range entries {
+		var topics []common.Hash
+		if topic0 != (common.Hash{}) || len(entry.Topics) > 0 {
+			topics = append([]common.Hash{topic0}, entry.Topics...)
+		}
+		logs[i] = &types.Log{
+			Address:     addr,
+			Topics:      topics,
+			Data:        entry.Data,
+			BlockNumber: number,
+			BlockHash:   hash,
+			TxHash:      entry.TxHash,
+			TxIndex:     uint(entry.TxIndex),
+			Index:       uint(entry.Index),
+		}
+	}
+	return logs, true
+}
+
+// FilterLocalLogs returns the logs emitted by addr with the given first topic in
+// the canonical blocks from from to to, inclusive, using the log index where
+// possible and the locally stored receipts otherwise. No retrieval is done;
+// ErrNoHeader or ErrNoReceipts is returned if a block isn't known locally.
+func FilterLocalLogs(db wtcdb.Database, from, to uint64, addr common.Address, topic0 common.Hash) ([]*types.Log, error) {
+	if from > to || to-from >= MaxCanonicalHashRange {
+		return nil, ErrInvalidRange
+	}
+	var logs []*types.Log
+	for number := from; number <= to; number++ {
+		hash := core.GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return nil, ErrNoHeader
+		}
+		if indexed, ok := GetIndexedLogs(db, hash, number, addr, topic0); ok {
+			logs = append(logs, indexed...)
+			continue
+		}
+		receipts := core.GetBlockReceipts(db, hash, number)
+		if receipts == nil {
+			return nil, ErrNoReceipts
+		}
+		logs = append(logs, filterReceiptLogs(receipts, hash, number, addr, topic0)...)
+	}
+	return logs, nil
+}
+
+// FilterLogs returns the logs emitted by addr with the given first topic in the
+// canonical blocks from from to to, inclusive, like FilterLocalLogs. Blocks
+// missing from the log index are scanned through their receipts, which are
+// retrieved if they aren't known locally, unless the NoIndexFallback option of
+// the backend is set. With its IndexReceiptLogs option enabled, the scanned
+// receipts are indexed, so a repeated filter over the same blocks is served
+// from the index.
+func FilterLogs(ctx context.Context, odr OdrBackend, from, to uint64, addr common.Address, topic0 common.Hash) ([]*types.Log, error) {
+	if from > to || to-from >= MaxCanonicalHashRange {
+		return nil, ErrInvalidRange
+	}
+	db, config := odr.Database(), BackendConfig(odr)
+
+	var logs []*types.Log
+	for number := from; number <= to; number++ {
+		hash, err := VerifiedHashForNumber(ctx, odr, number)
+		if err != nil {
+			return nil, err
+		}
+		if indexed, ok := GetIndexedLogs(db, hash, number, addr, topic0); ok {
+			logs = append(logs, indexed...)
+			continue
+		}
+		receipts := core.GetBlockReceipts(db, hash, number)
+		switch {
+		case receipts != nil:
+			// Stored before the index was enabled, index them now
+			if config.IndexReceiptLogs {
+				if err := indexReceiptLogs(db, hash, number, receipts); err != nil {
+					return nil, err
+				}
+			}
+		case !config.NoIndexFallback:
+			// Stored and indexed along with the verified receipts
+			r := &ReceiptsRequest{Hash: hash, Number: number}
+			if err := odr.Retrieve(ctx, r); err != nil {
+				return nil, err
+			}
+			receipts = r.Receipts
+		default:
+			return nil, ErrNoReceipts
+		}
+		logs = append(logs, filterReceiptLogs(receipts, hash, number, addr, topic0)...)
+	}
+	return logs, nil
+}
+
+// filterReceiptLogs returns the logs of the receipts of a block emitted by addr
+// with the given first topic.
+func filterReceiptLogs(receipts types.Receipts, hash common.Hash, number uint64, addr common.Address, topic0 common.Hash) []*types.Log {
+	var logs []*types.Log
+	for i, receipt := range receipts {
+		for _, log := range txLogs(receipts, receipt.TxHash, hash, number, uint64(i)) {
+			if log.Address == addr && logTopic0(log) == topic0 {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestFilterLocalLogsIndexed(t *testing.T) {
+	gdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(gdb)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	hash, number := block.Hash(), block.NumberU64()
+	topic := common.BigToHash(big.NewInt(1))
+
+	store := func(index bool) wtcdb.Database {
+		db, _ := wtcdb.NewMemDatabase()
+		core.WriteHeader(db, block.Header())
+		core.WriteCanonicalHash(db, hash, number)
+		req := &ReceiptsRequest{Hash: hash, Number: number, Receipts: receipts}
+		if err := req.StoreResult(BindConfig(db, &Config{IndexReceiptLogs: index})); err != nil {
+			t.Fatalf("failed to store receipts: %v", err)
+		}
+		return db
+	}
+	// Without the index the receipts are scanned
+	plain := store(false)
+	want, err := FilterLocalLogs(plain, number, number, testStateContract, topic)
+	if err != nil {
+		t.Fatalf("failed to filter receipts: %v", err)
+	}
+	if len(want) != 1 || want[0].TxHash != txs[1].Hash() || want[0].Index != 1 || want[0].BlockHash != hash {
+		t.Fatalf("filtered logs mismatch: have %v", want)
+	}
+	core.DeleteBlockReceipts(plain, hash, number)
+	if _, err := FilterLocalLogs(plain, number, number, testStateContract, topic); err != ErrNoReceipts {
+		t.Errorf("error mismatch without receipts: have %v, want %v", err, ErrNoReceipts)
+	}
+	// With the index the same logs are found without touching the receipts
+	indexed := store(true)
+	core.DeleteBlockReceipts(indexed, hash, number)
+	have, err := FilterLocalLogs(indexed, number, number, testStateContract, topic)
+	if err != nil {
+		t.Fatalf("failed to filter index: %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("indexed logs mismatch: have %v, want %v", have, want)
+	}
+	if logs, ok := GetIndexedLogs(indexed, hash, number, testStateContract, common.Hash{0xff}); !ok || len(logs) != 0 {
+		t.Errorf("unmatched topic mismatch: have %v, %v, want none, indexed", logs, ok)
+	}
+	if _, err := FilterLocalLogs(indexed, number, number+1, testStateContract, topic); err != ErrNoHeader {
+		t.Errorf("error mismatch beyond known blocks: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+// receiptsCountingOdr counts the receipts retrievals of a backend.
+type receiptsCountingOdr struct {
+	OdrBackend
+	receipts int
+}
+
+func (odr *receiptsCountingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if _, ok := req.(*ReceiptsRequest); ok {
+		odr.receipts++
+	}
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+func (odr *receiptsCountingOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+func TestFilterLogsIndexMiss(t *testing.T) {
+	config := DefaultConfig()
+	config.IndexReceiptLogs = true
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	hash, number := block.Hash(), block.NumberU64()
+	core.WriteBlockReceipts(sdb, hash, number, receipts)
+	topic := common.BigToHash(big.NewInt(1))
+
+	mem := NewMemoryOdrBackend(sdb)
+	mem.SetConfig(config)
+	odr := &receiptsCountingOdr{OdrBackend: mem}
+	db := odr.Database()
+	writeCanonicalHeaders(db, []*types.Header{block.Header()})
+	core.WriteHeadHeaderHash(db, hash)
+
+	// The first filter misses the index and falls back to the receipts
+	logs, err := FilterLogs(context.Background(), odr, number, number, testStateContract, topic)
+	if err != nil {
+		t.Fatalf("failed to filter logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].TxHash != txs[1].Hash() || odr.receipts != 1 {
+		t.Fatalf("fallback mismatch: have %v, %d retrievals", logs, odr.receipts)
+	}
+	// The second one is served by the index populated by the first
+	core.DeleteBlockReceipts(db, hash, number)
+	again, err := FilterLogs(context.Background(), odr, number, number, testStateContract, topic)
+	if err != nil {
+		t.Fatalf("failed to filter index: %v", err)
+	}
+	if !reflect.DeepEqual(again, logs) || odr.receipts != 1 {
+		t.Errorf("indexed filter mismatch: have %v, %d retrievals", again, odr.receipts)
+	}
+	// Receipts stored before the index was enabled are indexed on first use
+	ldb, _ := wtcdb.NewMemDatabase()
+	writeCanonicalHeaders(ldb, []*types.Header{block.Header()})
+	core.WriteHeadHeaderHash(ldb, hash)
+	core.WriteBlockReceipts(ldb, hash, number, receipts)
+	local := &testOdr{sdb: sdb, ldb: ldb, disable: true, config: config}
+	if logs, err := FilterLogs(context.Background(), local, number, number, testStateContract, topic); err != nil || len(logs) != 1 {
+		t.Errorf("local receipts filter mismatch: have %v, %v", logs, err)
+	}
+	if _, ok := GetIndexedLogs(ldb, hash, number, testStateContract, topic); !ok {
+		t.Errorf("local receipts not indexed")
+	}
+	// Without the fallback a miss isn't silently lossy either
+	config.NoIndexFallback = true
+	ldb, _ = wtcdb.NewMemDatabase()
+	writeCanonicalHeaders(ldb, []*types.Header{block.Header()})
+	core.WriteHeadHeaderHash(ldb, hash)
+	if _, err := FilterLogs(context.Background(), &testOdr{sdb: sdb, ldb: ldb, config: config}, number, number, testStateContract, topic); err != ErrNoReceipts {
+		t.Errorf("error mismatch without fallback: have %v, want %v", err, ErrNoReceipts)
+	}
+}
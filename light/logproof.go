@@ -0,0 +1,126 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+)
+
+// ErrInvalidLogProof is returned if a log proof doesn't prove its log.
+var ErrInvalidLogProof = errors.New("invalid log proof")
+
+// LogProof is a self-contained proof that a transaction emitted a log: the
+// receipt of the transaction with its merkle proof against the receipts root of
+// the block. It can be checked by Verify without any other data, but only proves
+// anything to a verifier trusting that ReceiptHash belongs to the header of the
+// block BlockHash.
+type LogProof struct {
+	BlockHash   common.Hash
+	Number      uint64
+	ReceiptHash common.Hash // receipts root of the block's header
+	TxHash      common.Hash
+	TxIndex     uint64         // position of the transaction in the block
+	LogIndex    uint           // position of the log among the transaction's logs
+	Proof       []rlp.RawValue // receipts trie nodes proving the receipt at TxIndex
+	Log         *types.Log     // the proven log, with its derived fields filled in
+}
+
+// LogInclusionProof builds the proof of the log at logIndex among the logs of a
+// transaction whose lookup entry is known locally. The receipts of its block are
+// retrieved if not available locally, and verified against the receipts root of
+// the block's header either way.
+func LogInclusionProof(ctx context.Context, odr OdrBackend, txHash common.Hash, logIndex uint) (*LogProof, error) {
+	db := odr.Database()
+	r, err := NewTxLogsRequest(db, txHash)
+	if err != nil {
+		return nil, err
+	}
+	header := getHeader(db, r.BlockHash, r.Number)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	receipts := core.GetBlockReceipts(db, r.BlockHash, r.Number)
+	if receipts == nil {
+		if err := odr.Retrieve(ctx, r); err != nil {
+			return nil, err
+		}
+		receipts = r.Receipts
+	}
+	if r.Index >= uint64(len(receipts)) || logIndex >= uint(len(receipts[r.Index].Logs)) {
+		return nil, ErrIndexOutOfRange
+	}
+	t := deriveTrie(receipts)
+	if t.Hash() != header.ReceiptHash {
+		return nil, ErrReceiptHashMismatch
+	}
+	return &LogProof{
+		BlockHash:   r.BlockHash,
+		Number:      r.Number,
+		ReceiptHash: header.ReceiptHash,
+		TxHash:      txHash,
+		TxIndex:     r.Index,
+		LogIndex:    logIndex,
+		Proof:       t.Prove(derivableListKey(uint(r.Index))),
+		Log:         txLogs(receipts, txHash, r.BlockHash, r.Number, r.Index)[logIndex],
+	}, nil
+}
+
+// Verify checks that the proof proves its log in the receipt at TxIndex under
+// ReceiptHash, returning the proven log.
+func (p *LogProof) Verify() (*types.Log, error) {
+	value, err := trie.VerifyProof(p.ReceiptHash, derivableListKey(uint(p.TxIndex)), p.Proof)
+	if err != nil || value == nil {
+		return nil, ErrInvalidLogProof
+	}
+	receipt := new(types.Receipt)
+	if err := rlp.DecodeBytes(value, receipt); err != nil || p.LogIndex >= uint(len(receipt.Logs)) {
+		return nil, ErrInvalidLogProof
+	}
+	proven := receipt.Logs[p.LogIndex]
+	if p.Log == nil || p.Log.Address != proven.Address || !bytes.Equal(p.Log.Data, proven.Data) || len(p.Log.Topics) != len(proven.Topics) {
+		return nil, ErrInvalidLogProof
+	}
+	for i, topic := range proven.Topics {
+		if p.Log.Topics[i] != topic {
+			return nil, ErrInvalidLogProof
+		}
+	}
+	if p.Log.BlockHash != p.BlockHash || p.Log.BlockNumber != p.Number || p.Log.TxHash != p.TxHash || p.Log.TxIndex != uint(p.TxIndex) {
+		return nil, ErrInvalidLogProof
+	}
+	return p.Log, nil
+}
+
+// VerifyLogProof checks a log proof produced by another client against its
+// embedded receipts root, using nothing but the trie and hash primitives, so it
+// works without a backend or database. Any inconsistency fails with
+// ErrInvalidLogProof.
+func VerifyLogProof(p *LogProof) error {
+	if p == nil {
+		return ErrInvalidLogProof
+	}
+	_, err := p.Verify()
+	return err
+}
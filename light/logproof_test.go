@@ -0,0 +1,100 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestLogInclusionProof(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+
+	extra := *receipts[2].Logs[0]
+	extra.Data = []byte{0xff}
+	receipts[2].Logs = append(receipts[2].Logs, &extra)
+	for _, receipt := range receipts {
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	}
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	core.WriteBlock(sdb, block)
+	core.WriteBlockReceipts(sdb, block.Hash(), block.NumberU64(), receipts)
+
+	odr := NewMemoryOdrBackend(sdb)
+	core.WriteHeader(odr.Database(), block.Header())
+	core.WriteTxLookupEntries(odr.Database(), block)
+
+	proof, err := LogInclusionProof(context.Background(), odr, txs[2].Hash(), 1)
+	if err != nil {
+		t.Fatalf("failed to build log proof: %v", err)
+	}
+	if proof.ReceiptHash != block.ReceiptHash() {
+		t.Errorf("receipts root mismatch: have %x, want %x", proof.ReceiptHash, block.ReceiptHash())
+	}
+	// A third party only gets the serialized proof
+	blob, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	var bundle LogProof
+	if err := json.Unmarshal(blob, &bundle); err != nil {
+		t.Fatalf("failed to decode proof: %v", err)
+	}
+	if err := VerifyLogProof(&bundle); err != nil {
+		t.Fatalf("failed to verify proof offline: %v", err)
+	}
+	log, err := bundle.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify proof: %v", err)
+	}
+	if log.TxHash != txs[2].Hash() || log.TxIndex != 2 || log.Index != 3 || log.Data[0] != 0xff {
+		t.Errorf("proven log mismatch: %+v", log)
+	}
+	// Tampering with any part of the bundle invalidates it
+	tampers := []func(p *LogProof){
+		func(p *LogProof) { p.Log.Data = []byte{0xfe} },
+		func(p *LogProof) { p.Log.Topics = append(p.Log.Topics, common.Hash{}) },
+		func(p *LogProof) { p.Log.TxHash = txs[1].Hash() },
+		func(p *LogProof) { p.ReceiptHash = common.Hash{1} },
+		func(p *LogProof) { p.TxIndex = 1 },
+		func(p *LogProof) { p.LogIndex = 0 },
+		func(p *LogProof) { p.Proof = p.Proof[:len(p.Proof)-1] },
+	}
+	for i, tamper := range tampers {
+		var bundle LogProof
+		json.Unmarshal(blob, &bundle)
+		tamper(&bundle)
+		if err := VerifyLogProof(&bundle); err != ErrInvalidLogProof {
+			t.Errorf("tamper %d: error mismatch: have %v, want %v", i, err, ErrInvalidLogProof)
+		}
+	}
+	if err := VerifyLogProof(nil); err != ErrInvalidLogProof {
+		t.Errorf("error mismatch for missing proof: have %v, want %v", err, ErrInvalidLogProof)
+	}
+	if _, err := LogInclusionProof(context.Background(), odr, txs[0].Hash(), 1); err != ErrIndexOutOfRange {
+		t.Errorf("error mismatch for missing log: have %v, want %v", err, ErrIndexOutOfRange)
+	}
+}
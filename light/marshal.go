@@ -0,0 +1,298 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// taggedRequest is the encoding of a request identity, tagged with its kind.
+type taggedRequest struct {
+	Kind uint64
+	Data rlp.RawValue
+}
+
+// The encodings of the identities of the individual request types, leaving out
+// the results and proofs.
+type (
+	trieRequestRLP struct {
+		Id         *TrieID `rlp:"nil"`
+		Key        []byte
+		FromLevel  uint
+		Candidates []common.Hash
+	}
+	accountRequestRLP struct {
+		Id      *TrieID `rlp:"nil"`
+		Address common.Address
+	}
+	codeRequestRLP struct {
+		Id   *TrieID `rlp:"nil"`
+		Hash common.Hash
+	}
+	blockRequestRLP struct {
+		Hash   common.Hash
+		Number uint64
+	}
+	batchHeaderRequestRLP struct {
+		Hashes  []common.Hash
+		ChtNum  uint64
+		ChtRoot common.Hash
+	}
+	batchTrieRequestRLP struct {
+		Requests []trieRequestRLP
+	}
+	batchBlockRequestRLP struct {
+		Hashes  []common.Hash
+		Numbers []uint64
+	}
+	txRequestRLP struct {
+		Hash          common.Hash
+		Number, Index uint64
+	}
+	chtRequestRLP struct {
+		ChtNum, BlockNum uint64
+		ChtRoot          common.Hash
+	}
+	stateRootRequestRLP struct {
+		Number  uint64
+		Hash    common.Hash
+		ChtNum  uint64
+		ChtRoot common.Hash
+	}
+	headerRequestRLP struct {
+		Hash    common.Hash
+		ChtNum  uint64
+		ChtRoot common.Hash
+	}
+	headerSegmentRequestRLP struct {
+		Anchor         common.Hash
+		Number, Amount uint64
+	}
+	txLogsRequestRLP struct {
+		TxHash        common.Hash
+		Hash          common.Hash
+		Number, Index uint64
+	}
+	txLookupRequestRLP struct {
+		TxHash common.Hash
+	}
+)
+
+// MarshalRequest encodes the identity of a request (what is requested, not the
+// response) so it can be logged and later replayed with UnmarshalRequest.
+func MarshalRequest(req OdrRequest) ([]byte, error) {
+	var data interface{}
+	switch r := req.(type) {
+	case *TrieRequest:
+		data = &trieRequestRLP{r.Id, r.Key, r.FromLevel, r.Candidates}
+	case *BatchTrieRequest:
+		batch := &batchTrieRequestRLP{Requests: make([]trieRequestRLP, len(r.Requests))}
+		for i, tr := range r.Requests {
+			batch.Requests[i] = trieRequestRLP{tr.Id, tr.Key, tr.FromLevel, tr.Candidates}
+		}
+		data = batch
+	case *AccountRequest:
+		data = &accountRequestRLP{r.Id, r.Address}
+	case *StorageRootRequest:
+		data = &accountRequestRLP{r.StateId, r.Address}
+	case *CodeHashRequest:
+		data = &accountRequestRLP{r.StateId, r.Address}
+	case *CodeRequest:
+		data = &codeRequestRLP{r.Id, r.Hash}
+	case *CodeSizeRequest:
+		data = &codeRequestRLP{r.Id, r.Hash}
+	case *BlockRequest:
+		data = &blockRequestRLP{r.Hash, r.Number}
+	case *ReceiptsRequest:
+		data = &blockRequestRLP{r.Hash, r.Number}
+	case *ReceiptsMetaRequest:
+		data = &blockRequestRLP{r.Hash, r.Number}
+	case *TxCountRequest:
+		data = &blockRequestRLP{r.BlockHash, r.Number}
+	case *BatchBlockRequest:
+		data = &batchBlockRequestRLP{r.Hashes, r.Numbers}
+	case *TxByIndexRequest:
+		data = &txRequestRLP{r.BlockHash, r.Number, r.Index}
+	case *TxLogsRequest:
+		data = &txLogsRequestRLP{r.TxHash, r.BlockHash, r.Number, r.Index}
+	case *TxLookupRequest:
+		data = &txLookupRequestRLP{r.TxHash}
+	case *ChtRequest:
+		data = &chtRequestRLP{r.ChtNum, r.BlockNum, r.ChtRoot}
+	case *StateRootRequest:
+		data = &stateRootRequestRLP{r.Number, r.Hash, r.ChtNum, r.ChtRoot}
+	case *BlockBloomRequest:
+		data = &stateRootRequestRLP{r.Number, r.Hash, r.ChtNum, r.ChtRoot}
+	case *HeaderByHashRequest:
+		data = &headerRequestRLP{r.Hash, r.ChtNum, r.ChtRoot}
+	case *BatchHeaderRequest:
+		data = &batchHeaderRequestRLP{r.Hashes, r.ChtNum, r.ChtRoot}
+	case *HeaderSegmentRequest:
+		data = &headerSegmentRequestRLP{r.Anchor, r.Number, r.Amount}
+	case *BloomTrieRootRequest:
+		data = r.Section
+	default:
+		return nil, ErrUnsupportedRequest
+	}
+	enc, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(&taggedRequest{uint64(KindOf(req)), enc})
+}
+
+// UnmarshalRequest decodes a request encoded by MarshalRequest. The returned
+// request is ready to be retrieved again.
+func UnmarshalRequest(enc []byte) (OdrRequest, error) {
+	var tagged taggedRequest
+	if err := rlp.DecodeBytes(enc, &tagged); err != nil {
+		return nil, err
+	}
+	switch RequestKind(tagged.Kind) {
+	case KindTrie:
+		var data trieRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		if len(data.Candidates) == 0 {
+			data.Candidates = nil
+		}
+		return &TrieRequest{Id: decodedTrieID(data.Id), Key: data.Key, FromLevel: data.FromLevel, Candidates: data.Candidates}, nil
+	case KindBatchTrie:
+		var data batchTrieRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		batch := &BatchTrieRequest{Requests: make([]*TrieRequest, len(data.Requests))}
+		for i, tr := range data.Requests {
+			if len(tr.Candidates) == 0 {
+				tr.Candidates = nil
+			}
+			batch.Requests[i] = &TrieRequest{Id: decodedTrieID(tr.Id), Key: tr.Key, FromLevel: tr.FromLevel, Candidates: tr.Candidates}
+		}
+		return batch, nil
+	case KindAccount, KindStorageRoot, KindCodeHash:
+		var data accountRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		switch RequestKind(tagged.Kind) {
+		case KindStorageRoot:
+			return &StorageRootRequest{StateId: decodedTrieID(data.Id), Address: data.Address}, nil
+		case KindCodeHash:
+			return &CodeHashRequest{StateId: decodedTrieID(data.Id), Address: data.Address}, nil
+		}
+		return &AccountRequest{Id: decodedTrieID(data.Id), Address: data.Address}, nil
+	case KindCode, KindCodeSize:
+		var data codeRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		if RequestKind(tagged.Kind) == KindCodeSize {
+			return &CodeSizeRequest{Id: decodedTrieID(data.Id), Hash: data.Hash}, nil
+		}
+		return &CodeRequest{Id: decodedTrieID(data.Id), Hash: data.Hash}, nil
+	case KindBlock, KindReceipts, KindReceiptsMeta, KindTxCount:
+		var data blockRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		switch RequestKind(tagged.Kind) {
+		case KindReceipts:
+			return &ReceiptsRequest{Hash: data.Hash, Number: data.Number}, nil
+		case KindReceiptsMeta:
+			return &ReceiptsMetaRequest{Hash: data.Hash, Number: data.Number}, nil
+		case KindTxCount:
+			return &TxCountRequest{BlockHash: data.Hash, Number: data.Number}, nil
+		}
+		return &BlockRequest{Hash: data.Hash, Number: data.Number}, nil
+	case KindBatchBlock:
+		var data batchBlockRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &BatchBlockRequest{Hashes: data.Hashes, Numbers: data.Numbers}, nil
+	case KindTxByIndex:
+		var data txRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &TxByIndexRequest{BlockHash: data.Hash, Number: data.Number, Index: data.Index}, nil
+	case KindTxLogs:
+		var data txLogsRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &TxLogsRequest{TxHash: data.TxHash, BlockHash: data.Hash, Number: data.Number, Index: data.Index}, nil
+	case KindTxLookup:
+		var data txLookupRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &TxLookupRequest{TxHash: data.TxHash}, nil
+	case KindCht:
+		var data chtRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &ChtRequest{ChtNum: data.ChtNum, BlockNum: data.BlockNum, ChtRoot: data.ChtRoot}, nil
+	case KindStateRoot, KindBlockBloom:
+		var data stateRootRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		if RequestKind(tagged.Kind) == KindBlockBloom {
+			return &BlockBloomRequest{Number: data.Number, Hash: data.Hash, ChtNum: data.ChtNum, ChtRoot: data.ChtRoot}, nil
+		}
+		return &StateRootRequest{Number: data.Number, Hash: data.Hash, ChtNum: data.ChtNum, ChtRoot: data.ChtRoot}, nil
+	case KindHeader:
+		var data headerRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &HeaderByHashRequest{Hash: data.Hash, ChtNum: data.ChtNum, ChtRoot: data.ChtRoot}, nil
+	case KindBatchHeader:
+		var data batchHeaderRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &BatchHeaderRequest{Hashes: data.Hashes, ChtNum: data.ChtNum, ChtRoot: data.ChtRoot}, nil
+	case KindHeaderSegment:
+		var data headerSegmentRequestRLP
+		if err := rlp.DecodeBytes(tagged.Data, &data); err != nil {
+			return nil, err
+		}
+		return &HeaderSegmentRequest{Anchor: data.Anchor, Number: data.Number, Amount: data.Amount}, nil
+	case KindBloomTrieRoot:
+		var section uint64
+		if err := rlp.DecodeBytes(tagged.Data, &section); err != nil {
+			return nil, err
+		}
+		return &BloomTrieRootRequest{Section: section}, nil
+	}
+	return nil, ErrUnsupportedRequest
+}
+
+// decodedTrieID restores the nil account key of a decoded state trie id, which
+// the encoding doesn't distinguish from an empty one.
+func decodedTrieID(id *TrieID) *TrieID {
+	if id != nil && len(id.AccKey) == 0 {
+		id.AccKey = nil
+	}
+	return id
+}
@@ -0,0 +1,81 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+func TestMarshalRequest(t *testing.T) {
+	state := &TrieID{BlockHash: common.HexToHash("01"), Root: common.HexToHash("02"), BlockNumber: 3}
+	storage := &TrieID{BlockHash: common.HexToHash("01"), Root: common.HexToHash("04"), BlockNumber: 3, AccKey: []byte{5}}
+	hash := common.HexToHash("06")
+
+	tests := []OdrRequest{
+		&TrieRequest{Id: storage, Key: []byte{7}, FromLevel: 2, Candidates: []common.Hash{hash}},
+		&TrieRequest{Id: state, Key: []byte{7}},
+		&BatchTrieRequest{Requests: []*TrieRequest{{Id: storage, Key: []byte{7}, FromLevel: 2}, {Id: state, Key: []byte{8}}}},
+		&AccountRequest{Id: state, Address: common.HexToAddress("08")},
+		&StorageRootRequest{StateId: state, Address: common.HexToAddress("08")},
+		&CodeRequest{Id: storage, Hash: hash},
+		&CodeSizeRequest{Id: storage, Hash: hash},
+		&BlockRequest{Hash: hash, Number: 9},
+		&ReceiptsRequest{Hash: hash, Number: 9},
+		&ReceiptsMetaRequest{Hash: hash, Number: 9},
+		&BatchBlockRequest{Hashes: []common.Hash{hash, common.HexToHash("0b")}, Numbers: []uint64{9, 12}},
+		&TxByIndexRequest{BlockHash: hash, Number: 9, Index: 2},
+		&TxCountRequest{BlockHash: hash, Number: 9},
+		&TxLogsRequest{TxHash: common.HexToHash("0c"), BlockHash: hash, Number: 9, Index: 2},
+		&TxLookupRequest{TxHash: common.HexToHash("0c")},
+		&CodeHashRequest{StateId: state, Address: common.HexToAddress("08")},
+		&ChtRequest{ChtNum: 1, BlockNum: 9, ChtRoot: hash},
+		&StateRootRequest{Number: 9, Hash: hash, ChtNum: 1, ChtRoot: hash},
+		&BlockBloomRequest{Number: 9, Hash: hash, ChtNum: 1, ChtRoot: hash},
+		&HeaderByHashRequest{Hash: hash, ChtNum: 1, ChtRoot: common.HexToHash("0a")},
+		&BatchHeaderRequest{Hashes: []common.Hash{hash, common.HexToHash("0b")}, ChtNum: 1, ChtRoot: common.HexToHash("0a")},
+		&HeaderSegmentRequest{Anchor: hash, Number: 4, Amount: 16},
+		&BloomTrieRootRequest{Section: 11},
+	}
+	for i, req := range tests {
+		enc, err := MarshalRequest(req)
+		if err != nil {
+			t.Errorf("test %d: failed to marshal %T: %v", i, req, err)
+			continue
+		}
+		dec, err := UnmarshalRequest(enc)
+		if err != nil {
+			t.Errorf("test %d: failed to unmarshal %T: %v", i, req, err)
+			continue
+		}
+		if !reflect.DeepEqual(dec, req) {
+			t.Errorf("test %d: round-trip mismatch: have %+v, want %+v", i, dec, req)
+		}
+	}
+	// Results shouldn't be part of the encoding
+	enc, _ := MarshalRequest(&CodeRequest{Id: storage, Hash: hash, Data: []byte{1, 2, 3}})
+	if dec, _ := UnmarshalRequest(enc); dec.(*CodeRequest).Data != nil {
+		t.Errorf("response data encoded: %x", dec.(*CodeRequest).Data)
+	}
+	unknown, _ := rlp.EncodeToBytes(&taggedRequest{Kind: uint64(numRequestKinds), Data: rlp.EmptyString})
+	if _, err := UnmarshalRequest(unknown); err != ErrUnsupportedRequest {
+		t.Errorf("error mismatch for unknown kind: have %v, want %v", err, ErrUnsupportedRequest)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// errMissingSource is returned if a memory backend can't find the data needed
+// to answer a request in its source database.
+var errMissingSource = errors.New("missing from source database")
+
+// MemoryOdrBackend is an OdrBackend answering requests from a full source
+// database held in memory, storing the verified results into a separate local
+// in-memory database. It's meant for tests and tooling, never for serving
+// untrusted data: the source is trusted as is.
+type MemoryOdrBackend struct {
+	source, db wtcdb.Database
+	responses  *ResponseCache
+	config     *Config
+}
+
+// NewMemoryOdrBackend creates a backend answering requests from source.
+func NewMemoryOdrBackend(source wtcdb.Database) *MemoryOdrBackend {
+	db, _ := wtcdb.NewMemDatabase()
+	return &MemoryOdrBackend{source: source, db: db, config: DefaultConfig()}
+}
+
+// SetConfig sets the configuration the retrieved results are verified and
+// stored with.
+func (m *MemoryOdrBackend) SetConfig(config *Config) {
+	m.config = config
+}
+
+// Config returns the configuration of the backend.
+func (m *MemoryOdrBackend) Config() *Config {
+	return m.config
+}
+
+// SetResponseCache makes the backend answer requests through the given response
+// cache, like a server would.
+func (m *MemoryOdrBackend) SetResponseCache(cache *ResponseCache) {
+	m.responses = cache
+}
+
+// Database returns the local database the retrieved results are stored in.
+func (m *MemoryOdrBackend) Database() wtcdb.Database {
+	return m.db
+}
+
+// Retrieve answers the request from the source database and stores the result
+// locally, verifying it the same way as a network retrieval.
+func (m *MemoryOdrBackend) Retrieve(ctx context.Context, req OdrRequest) error {
+	answer := answerRequest
+	if m.responses != nil {
+		answer = m.responses.Answer
+	}
+	if err := answer(m.source, req); err != nil {
+		return err
+	}
+	return storeBuffered(ctx, BindConfig(m.db, m.config), req)
+}
+
+// answerRequest fills in the result fields of req from the given full database,
+// the way a server would.
+func answerRequest(source wtcdb.Database, req OdrRequest) error {
+	switch r := req.(type) {
+	case *TrieRequest:
+		t, err := trie.New(r.Id.Root, source)
+		if err != nil {
+			return err
+		}
+		r.Proof, r.MatchedRoot = t.Prove(r.Key), r.Id.Root
+	case *BatchTrieRequest:
+		r.Proofs, r.Errs = make([][]rlp.RawValue, len(r.Requests)), nil
+		for i, tr := range r.Requests {
+			if err := answerRequest(source, tr); err != nil {
+				return err
+			}
+			r.Proofs[i] = tr.Proof
+		}
+	case *AccountRequest:
+		t, err := trie.New(r.Id.Root, source)
+		if err != nil {
+			return err
+		}
+		key := addressHash(r.Address)
+		r.Proof = t.Prove(key[:])
+	case *StorageRootRequest:
+		t, err := trie.New(r.StateId.Root, source)
+		if err != nil {
+			return err
+		}
+		key := addressHash(r.Address)
+		r.Proof = t.Prove(key[:])
+	case *CodeHashRequest:
+		t, err := trie.New(r.StateId.Root, source)
+		if err != nil {
+			return err
+		}
+		key := addressHash(r.Address)
+		r.Proof = t.Prove(key[:])
+	case *CodeRequest:
+		data, err := source.Get(r.Hash[:])
+		if err != nil {
+			return errMissingSource
+		}
+		r.Data = data
+	case *CodeSizeRequest:
+		data, err := source.Get(r.Hash[:])
+		if err != nil {
+			return errMissingSource
+		}
+		r.Size = uint64(len(data))
+	case *BlockRequest:
+		if r.Rlp = getBodyRLP(source, r.Hash, r.Number); r.Rlp == nil {
+			return errMissingSource
+		}
+	case *BatchBlockRequest:
+		r.Rlps = make([][]byte, len(r.Hashes))
+		for i, hash := range r.Hashes {
+			r.Rlps[i] = getBodyRLP(source, hash, r.Numbers[i])
+		}
+	case *TxByIndexRequest:
+		if r.Rlp = getBodyRLP(source, r.BlockHash, r.Number); r.Rlp == nil {
+			return errMissingSource
+		}
+	case *TxCountRequest:
+		body := getBody(source, r.BlockHash, r.Number)
+		if body == nil {
+			return errMissingSource
+		}
+		t := deriveTrie(types.Transactions(body.Transactions))
+		if r.Count = uint64(len(body.Transactions)); r.Count > 0 {
+			r.LastProof = t.Prove(derivableListKey(uint(r.Count - 1)))
+			r.EndProof = t.Prove(derivableListKey(uint(r.Count)))
+		}
+	case *ReceiptsMetaRequest:
+		receipts := core.GetBlockReceipts(source, r.Hash, r.Number)
+		if receipts == nil {
+			return errMissingSource
+		}
+		r.Stripped, r.Meta = true, ReceiptsMeta(receipts)
+	case *ReceiptsRequest:
+		if r.Receipts = core.GetBlockReceipts(source, r.Hash, r.Number); r.Receipts == nil {
+			return errMissingSource
+		}
+	case *TxLogsRequest:
+		if r.Receipts = core.GetBlockReceipts(source, r.BlockHash, r.Number); r.Receipts == nil {
+			return errMissingSource
+		}
+	case *TxLookupRequest:
+		if r.BlockHash, r.Number, r.Index = core.GetTxLookupEntry(source, r.TxHash); r.BlockHash == (common.Hash{}) {
+			return errMissingSource
+		}
+		if r.Rlp = getBodyRLP(source, r.BlockHash, r.Number); r.Rlp == nil {
+			return errMissingSource
+		}
+	case *ChtRequest:
+		hash := core.GetCanonicalHash(source, r.BlockNum)
+		if r.Header = core.GetHeader(source, hash, r.BlockNum); r.Header == nil {
+			return errMissingSource
+		}
+		r.Td = core.GetTd(source, hash, r.BlockNum)
+		t, err := trie.New(r.ChtRoot, source)
+		if err != nil {
+			return err
+		}
+		r.Proof = t.Prove(chtKey(r.BlockNum))
+	case *StateRootRequest:
+		hash := core.GetCanonicalHash(source, r.Number)
+		if r.Header = core.GetHeader(source, hash, r.Number); r.Header == nil {
+			return errMissingSource
+		}
+		r.Td = core.GetTd(source, hash, r.Number)
+		t, err := trie.New(r.ChtRoot, source)
+		if err != nil {
+			return err
+		}
+		r.Proof = t.Prove(chtKey(r.Number))
+	case *BlockBloomRequest:
+		hash := core.GetCanonicalHash(source, r.Number)
+		if r.Header = core.GetHeader(source, hash, r.Number); r.Header == nil {
+			return errMissingSource
+		}
+		r.Td = core.GetTd(source, hash, r.Number)
+		t, err := trie.New(r.ChtRoot, source)
+		if err != nil {
+			return err
+		}
+		r.Proof = t.Prove(chtKey(r.Number))
+	case *HeaderByHashRequest:
+		num := core.GetBlockNumber(source, r.Hash)
+		if r.Header = core.GetHeader(source, r.Hash, num); r.Header == nil {
+			return errMissingSource
+		}
+		if num < r.ChtNum*ChtFrequency {
+			t, err := trie.New(r.ChtRoot, source)
+			if err != nil {
+				return err
+			}
+			r.Proof = t.Prove(chtKey(num))
+		}
+	case *BatchHeaderRequest:
+		r.Headers, r.Proofs = make([]*types.Header, len(r.Hashes)), make([][]rlp.RawValue, len(r.Hashes))
+		for i, hash := range r.Hashes {
+			single := &HeaderByHashRequest{Hash: hash, ChtNum: r.ChtNum, ChtRoot: r.ChtRoot}
+			if answerRequest(source, single) == nil {
+				r.Headers[i], r.Proofs[i] = single.Header, single.Proof
+			}
+		}
+	case *HeaderSegmentRequest:
+		for num := r.Number + 1; num <= r.Number+r.Amount; num++ {
+			header := core.GetHeader(source, core.GetCanonicalHash(source, num), num)
+			if header == nil {
+				break
+			}
+			r.Headers = append(r.Headers, header)
+		}
+		if len(r.Headers) == 0 {
+			return errMissingSource
+		}
+	case *BloomTrieRootRequest:
+		cp := GetCheckpoint(source, r.Section)
+		if cp == nil {
+			return errMissingSource
+		}
+		r.Root = cp.BloomRoot
+	default:
+		return ErrUnsupportedRequest
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+// OdrMiddleware wraps an OdrBackend into one adding some behaviour, like the
+// decorators of this package do, e.g.
+//
+//	func(backend OdrBackend) OdrBackend { return NewTrieLimitOdr(backend, 8) }
+type OdrMiddleware func(OdrBackend) OdrBackend
+
+// Chain stacks the middlewares on top of base. The first middleware is the
+// outermost one: retrievals pass through mws in order before reaching base.
+func Chain(base OdrBackend, mws ...OdrMiddleware) OdrBackend {
+	backend := base
+	for i := len(mws) - 1; i >= 0; i-- {
+		backend = mws[i](backend)
+	}
+	return backend
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// tracingOdr is a backend recording its name in a shared trace on every
+// retrieval before passing it on.
+type tracingOdr struct {
+	OdrBackend
+	name  string
+	trace *[]string
+}
+
+func (odr *tracingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	*odr.trace = append(*odr.trace, odr.name)
+	if odr.OdrBackend == nil {
+		return nil
+	}
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+func TestChain(t *testing.T) {
+	var trace []string
+	tracing := func(name string) OdrMiddleware {
+		return func(backend OdrBackend) OdrBackend {
+			return &tracingOdr{OdrBackend: backend, name: name, trace: &trace}
+		}
+	}
+	base := &tracingOdr{name: "base", trace: &trace}
+	if err := Chain(base, tracing("outer"), tracing("inner")).Retrieve(NoOdr, &BlockRequest{}); err != nil {
+		t.Fatalf("failed to retrieve: %v", err)
+	}
+	if want := []string{"outer", "inner", "base"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("retrieval order mismatch: have %v, want %v", trace, want)
+	}
+	if Chain(base) != OdrBackend(base) {
+		t.Errorf("empty chain doesn't return the base backend")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// EvictionExemptHeads is the number of most recent head state roots whose trie
+// nodes a NodeLRUDatabase never evicts.
+var EvictionExemptHeads = 2
+
+// exemptNodeLimit is the maximum number of nodes a NodeLRUDatabase exempts from
+// eviction for the recent heads.
+var exemptNodeLimit = 100000
+
+// NodeLRUDatabase wraps the database of an ODR backend, capping the number of
+// trie nodes cached in it. Nodes are evicted least recently used first, except
+// the ones reachable from the last EvictionExemptHeads head state roots set by
+// SetHead, which are pinned implicitly so that queries against the head don't
+// miss nodes just evicted. The exempt working set is approximate: it's found
+// by walking the cached nodes of the heads when they are set, and extended by
+// the nodes referenced by exempt ones as they are stored, up to exemptNodeLimit
+// nodes. Exempt nodes don't count against the cap. Storage tries aren't
+// followed. Nothing is evicted if the wrapped database is bound to a
+// configuration in archive mode.
+type NodeLRUDatabase struct {
+	wtcdb.Database
+
+	lock   sync.Mutex
+	nodes  *simplelru.LRU           // non-exempt cached nodes by recency
+	limit  int                      // maximum number of non-exempt nodes
+	heads  []common.Hash            // recent head state roots, oldest first
+	exempt map[common.Hash]struct{} // cached nodes reachable from the heads
+	refs   map[common.Hash]struct{} // nodes referenced by exempt ones or heads
+}
+
+// NewNodeLRUDatabase creates a wrapper around db keeping at most limit trie
+// nodes besides the exempt ones. Only nodes stored through the wrapper are
+// tracked and evicted.
+func NewNodeLRUDatabase(db wtcdb.Database, limit int) *NodeLRUDatabase {
+	// Evictions are done by hand, so they can be refused in archive mode
+	nodes, _ := simplelru.NewLRU(math.MaxInt32, nil)
+	return &NodeLRUDatabase{
+		Database: db,
+		nodes:    nodes,
+		limit:    limit,
+		exempt:   make(map[common.Hash]struct{}),
+		refs:     make(map[common.Hash]struct{}),
+	}
+}
+
+// SetHead records a new head state root, exempting the nodes reachable from it
+// and dropping the exemption of the heads beyond EvictionExemptHeads. Nodes no
+// longer exempt become evictable as if just used.
+func (db *NodeLRUDatabase) SetHead(root common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.heads = append(db.heads, root)
+	if len(db.heads) > EvictionExemptHeads {
+		db.heads = db.heads[len(db.heads)-EvictionExemptHeads:]
+	}
+	old := db.exempt
+	db.exempt = make(map[common.Hash]struct{})
+	db.refs = make(map[common.Hash]struct{})
+	for _, head := range db.heads {
+		db.refs[head] = struct{}{}
+	}
+	// Walk the cached nodes of the heads, newest first
+	for i := len(db.heads) - 1; i >= 0; i-- {
+		queue := []common.Hash{db.heads[i]}
+		for len(queue) > 0 && len(db.exempt) < exemptNodeLimit {
+			hash := queue[0]
+			queue = queue[1:]
+			if _, ok := db.exempt[hash]; ok {
+				continue
+			}
+			blob, err := db.Database.Get(hash[:])
+			if err != nil || len(blob) == 0 {
+				continue
+			}
+			queue = append(queue, db.markExempt(hash, blob)...)
+		}
+	}
+	for hash := range old {
+		if _, ok := db.exempt[hash]; !ok {
+			db.nodes.Add(hash, nil)
+		}
+	}
+	db.evict()
+}
+
+// markExempt exempts a cached node, returning the nodes it references.
+func (db *NodeLRUDatabase) markExempt(hash common.Hash, blob []byte) []common.Hash {
+	db.exempt[hash] = struct{}{}
+	db.nodes.Remove(hash)
+
+	children, _ := nodeChildren(blob)
+	for _, child := range children {
+		db.refs[child] = struct{}{}
+	}
+	return children
+}
+
+// Put stores a value, tracking it as a trie node if keyed by a hash.
+func (db *NodeLRUDatabase) Put(key []byte, value []byte) error {
+	if err := db.Database.Put(key, value); err != nil {
+		return err
+	}
+	if len(key) != common.HashLength {
+		return nil
+	}
+	hash := common.BytesToHash(key)
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.exempt[hash]; ok {
+		return nil
+	}
+	if _, ok := db.refs[hash]; ok && len(db.exempt) < exemptNodeLimit {
+		db.markExempt(hash, value)
+		return nil
+	}
+	db.nodes.Add(hash, nil)
+	db.evict()
+	return nil
+}
+
+// Get reads a value, marking it as recently used if it's a tracked node.
+func (db *NodeLRUDatabase) Get(key []byte) ([]byte, error) {
+	if len(key) == common.HashLength {
+		db.lock.Lock()
+		db.nodes.Get(common.BytesToHash(key))
+		db.lock.Unlock()
+	}
+	return db.Database.Get(key)
+}
+
+// Delete removes a value, forgetting it if it's a tracked node.
+func (db *NodeLRUDatabase) Delete(key []byte) error {
+	if len(key) == common.HashLength {
+		db.lock.Lock()
+		db.nodes.Remove(common.BytesToHash(key))
+		delete(db.exempt, common.BytesToHash(key))
+		db.lock.Unlock()
+	}
+	return db.Database.Delete(key)
+}
+
+// NewBatch creates a batch tracking the stored nodes on Write.
+func (db *NodeLRUDatabase) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: db}
+}
+
+// evict deletes the least recently used nodes beyond the cap.
+func (db *NodeLRUDatabase) evict() {
+	if ConfigOf(db.Database).ArchiveMode {
+		return
+	}
+	for db.nodes.Len() > db.limit {
+		hash, _, _ := db.nodes.RemoveOldest()
+		key := hash.(common.Hash)
+		db.Database.Delete(key[:])
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestNodeLRUDatabase(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	st, _ := trie.New(header.Root, sdb)
+	proof := st.Prove(crypto.Keccak256(acc1Addr[:]))
+
+	disk, _ := wtcdb.NewMemDatabase()
+	db := NewNodeLRUDatabase(disk, 4)
+	db.SetHead(header.Root)
+
+	// Retrieve an account of the head, its proof must be exempt from eviction
+	if _, err := GetAccount(NoOdr, &testOdr{sdb: sdb, ldb: db}, StateTrieID(header), acc1Addr); err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	filler := make([]common.Hash, 12)
+	for i := range filler {
+		blob, _ := rlp.EncodeToBytes([]uint{uint(i), uint(i)})
+		filler[i] = crypto.Keccak256Hash(blob)
+		db.Put(filler[i][:], blob)
+		if i == 10 {
+			db.Get(filler[7][:]) // keep using the oldest node
+		}
+	}
+	present := func(hash common.Hash) bool {
+		ok, _ := disk.Has(hash[:])
+		return ok
+	}
+	for _, node := range proof {
+		if !present(crypto.Keccak256Hash(node)) {
+			t.Errorf("head node %x evicted", crypto.Keccak256(node))
+		}
+	}
+	for i, hash := range filler {
+		if want := i >= 9 || i == 7; present(hash) != want {
+			t.Errorf("filler node %d presence mismatch: have %v, want %v", i, present(hash), want)
+		}
+	}
+	// Once enough newer heads are set, the old head's nodes become evictable
+	for i := 0; i < EvictionExemptHeads; i++ {
+		db.SetHead(common.Hash{byte(i + 1)})
+	}
+	for i := 0; i < 4; i++ {
+		blob, _ := rlp.EncodeToBytes([]uint{uint(i), uint(i), uint(i)})
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	for _, node := range proof {
+		if present(crypto.Keccak256Hash(node)) {
+			t.Errorf("node %x of stale head not evicted", crypto.Keccak256(node))
+		}
+	}
+}
@@ -19,17 +19,90 @@
 package light
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"math/big"
+	"sort"
 
 	"github.com/wtc/go-wtc/common"
 	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
 	"github.com/wtc/go-wtc/core/types"
 	"github.com/wtc/go-wtc/crypto"
 	"github.com/wtc/go-wtc/wtcdb"
+	"github.com/wtc/go-wtc/params"
 	"github.com/wtc/go-wtc/rlp"
 )
 
+var (
+	// ErrUncleHashMismatch is returned if a retrieved block body contains an
+	// uncle list that doesn't hash to the UncleHash of its header.
+	ErrUncleHashMismatch = errors.New("uncle hash mismatch")
+
+	// ErrMalformedResponse is returned if a retrieved response is internally
+	// inconsistent or doesn't answer the request it was received for.
+	ErrMalformedResponse = errors.New("malformed response")
+
+	// ErrBloomMismatch is returned if a retrieved receipt set contains a logs
+	// bloom inconsistent with the logs it is derived from.
+	ErrBloomMismatch = errors.New("logs bloom mismatch")
+
+	// ErrEmptyProof is returned if a merkle proof retrieved for a non-empty trie
+	// contains no nodes at all.
+	ErrEmptyProof = errors.New("empty proof")
+
+	// ErrUnknownParent is returned if a header retrieved by hash outside of the
+	// trusted CHT range doesn't link to any locally known header.
+	ErrUnknownParent = errors.New("unknown parent")
+
+	// ErrUnsupportedRequest is returned by an ODR backend unable to serve a
+	// certain type of request.
+	ErrUnsupportedRequest = errors.New("unsupported request type")
+
+	// ErrNoCheckpoint is returned if a retrieved value can only be trusted by
+	// matching it against a checkpoint, but none is known.
+	ErrNoCheckpoint = errors.New("no trusted checkpoint")
+
+	// ErrCheckpointMismatch is returned if a retrieved value contradicts the
+	// trusted checkpoint it is checked against.
+	ErrCheckpointMismatch = errors.New("checkpoint mismatch")
+
+	// ErrBlockHashMismatch is returned if the verified canonical header of a
+	// block number doesn't have the hash it was claimed to have.
+	ErrBlockHashMismatch = errors.New("block hash mismatch")
+
+	// ErrHashCollision is returned in paranoid mode if a proof node is already
+	// stored under its hash with different contents.
+	ErrHashCollision = errors.New("trie node hash collision")
+
+	// ErrInvalidSender is returned by a strictly checked block body containing
+	// a transaction whose sender can't be recovered from its signature.
+	ErrInvalidSender = errors.New("invalid transaction sender")
+
+	// ErrNoChainConfig is returned if a strict signature check is requested
+	// without the chain config the signer is derived from.
+	ErrNoChainConfig = errors.New("no chain config")
+
+	// ErrStaleStateRoot is returned if a retrieved merkle proof starts at another
+	// root than the requested one, typically because the server answered from an
+	// older state than the one of the requested block.
+	ErrStaleStateRoot = errors.New("stale state root")
+)
+
+// TransientRetries returns the number of times a backend retries a retrieval
+// failing verification with err regardless of its verification failure policy.
+func (c *Config) TransientRetries(err error) int {
+	switch err {
+	case ErrEmptyProof:
+		return c.RetryOnEmpty
+	case ErrStaleStateRoot:
+		return c.RetryOnStaleRoot
+	}
+	return 0
+}
+
 // NoOdr is the default context passed to an ODR capable function when the ODR
 // service is not required.
 var NoOdr = context.Background()
@@ -42,7 +115,142 @@ type OdrBackend interface {
 
 // OdrRequest is an interface for retrieval requests
 type OdrRequest interface {
-	StoreResult(db wtcdb.Database)
+	StoreResult(db wtcdb.Database) error
+}
+
+// RequestKind identifies the type of an ODR request
+type RequestKind int
+
+const (
+	KindUnknown RequestKind = iota
+	KindTrie
+	KindCode
+	KindBlock
+	KindReceipts
+	KindCht
+	KindHeader
+	KindCodeSize
+	KindAccount
+	KindBloomTrieRoot
+	KindStorageRoot
+	KindTxByIndex
+	KindReceiptsMeta
+	KindStateRoot
+	KindBatchBlock
+	KindHeaderSegment
+	KindTxLogs
+	KindTxLookup
+	KindCodeHash
+	KindBatchHeader
+	KindBatchTrie
+	KindBlockBloom
+	KindTxCount
+
+	numRequestKinds // number of request kinds, must be last
+)
+
+// String implements fmt.Stringer
+func (k RequestKind) String() string {
+	switch k {
+	case KindTrie:
+		return "trie"
+	case KindCode:
+		return "code"
+	case KindBlock:
+		return "block"
+	case KindReceipts:
+		return "receipts"
+	case KindCht:
+		return "cht"
+	case KindHeader:
+		return "header"
+	case KindCodeSize:
+		return "codesize"
+	case KindAccount:
+		return "account"
+	case KindBloomTrieRoot:
+		return "bloomtrieroot"
+	case KindStorageRoot:
+		return "storageroot"
+	case KindTxByIndex:
+		return "txbyindex"
+	case KindReceiptsMeta:
+		return "receiptsmeta"
+	case KindStateRoot:
+		return "stateroot"
+	case KindBatchBlock:
+		return "batchblock"
+	case KindHeaderSegment:
+		return "headersegment"
+	case KindTxLogs:
+		return "txlogs"
+	case KindTxLookup:
+		return "txlookup"
+	case KindCodeHash:
+		return "codehash"
+	case KindBatchHeader:
+		return "batchheader"
+	case KindBatchTrie:
+		return "batchtrie"
+	case KindBlockBloom:
+		return "blockbloom"
+	case KindTxCount:
+		return "txcount"
+	default:
+		return "unknown"
+	}
+}
+
+// KindOf returns the kind of the given ODR request
+func KindOf(req OdrRequest) RequestKind {
+	switch req.(type) {
+	case *TrieRequest:
+		return KindTrie
+	case *CodeRequest:
+		return KindCode
+	case *BlockRequest:
+		return KindBlock
+	case *ReceiptsRequest:
+		return KindReceipts
+	case *ChtRequest:
+		return KindCht
+	case *HeaderByHashRequest:
+		return KindHeader
+	case *CodeSizeRequest:
+		return KindCodeSize
+	case *AccountRequest:
+		return KindAccount
+	case *BloomTrieRootRequest:
+		return KindBloomTrieRoot
+	case *StorageRootRequest:
+		return KindStorageRoot
+	case *TxByIndexRequest:
+		return KindTxByIndex
+	case *ReceiptsMetaRequest:
+		return KindReceiptsMeta
+	case *StateRootRequest:
+		return KindStateRoot
+	case *BatchBlockRequest:
+		return KindBatchBlock
+	case *HeaderSegmentRequest:
+		return KindHeaderSegment
+	case *TxLogsRequest:
+		return KindTxLogs
+	case *TxLookupRequest:
+		return KindTxLookup
+	case *CodeHashRequest:
+		return KindCodeHash
+	case *BatchHeaderRequest:
+		return KindBatchHeader
+	case *BatchTrieRequest:
+		return KindBatchTrie
+	case *BlockBloomRequest:
+		return KindBlockBloom
+	case *TxCountRequest:
+		return KindTxCount
+	default:
+		return KindUnknown
+	}
 }
 
 // TrieID identifies a state or account storage trie
@@ -76,27 +284,227 @@ func StorageTrieID(state *TrieID, addrHash, root common.Hash) *TrieID {
 }
 
 // TrieRequest is the ODR request type for state/storage trie entries
+//
+// Near the chain head the root of a block may be ambiguous during a reorg, so a
+// request may list a few alternative candidate roots to accept proofs for. The
+// root the proof was verified against is reported in MatchedRoot.
 type TrieRequest struct {
 	OdrRequest
-	Id    *TrieID
-	Key   []byte
-	Proof []rlp.RawValue
+	Id          *TrieID
+	Key         []byte
+	FromLevel   uint          // number of leading proof nodes already available locally
+	Candidates  []common.Hash // alternative roots to verify against, at most MaxCandidateRoots
+	MaxDepth    uint          // maximum number of proof nodes accepted, unlimited if zero
+	MatchedRoot common.Hash
+	Proof       []rlp.RawValue
+}
+
+// MaxCandidateRoots is the maximum number of candidate roots a trie request may
+// be verified against besides its own root.
+const MaxCandidateRoots = 3
+
+// newTrieRequest creates a request for the merkle proof of key, asking only for
+// the part of the proof not already available in the local database.
+func newTrieRequest(db wtcdb.Database, id *TrieID, key []byte) *TrieRequest {
+	return &TrieRequest{
+		Id:        id,
+		Key:       key,
+		FromLevel: uint(len(localProofPrefix(db, id.Root, key))),
+	}
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *TrieRequest) StoreResult(db wtcdb.Database) error {
+	if err := checkBlacklist(db, req.Id.Root); err != nil {
+		return err
+	}
+	if err := checkProofPresence(req.Id.Root, req.Proof); err != nil {
+		return err
+	}
+	if req.MaxDepth > 0 && uint(len(req.Proof)) > req.MaxDepth {
+		return ErrProofTooDeep
+	}
+	if err := storeProof(db, req.Proof); err != nil {
+		return err
+	}
+	if ConfigOf(db).IndexTrieValues {
+		root := req.MatchedRoot
+		if root == (common.Hash{}) {
+			root = req.Id.Root
+		}
+		return indexProof(db, root, req.Key, req.Proof)
+	}
+	return nil
+}
+
+// BatchTrieRequest is the ODR request type for retrieving the merkle proofs of
+// several trie entries in one round trip. Every proof is verified and stored
+// like the one of the corresponding TrieRequest, whose results are filled in,
+// the proofs of entries of the same trie being verified together. Failures are
+// reported per entry in Errs, aligned by index with Requests and Proofs.
+//
+// Backends completing the received proofs with CompleteTrieProofs verify them
+// on the way and set Errs along with Proofs, so that they aren't verified again
+// when storing. If Errs is nil, StoreResult completes and verifies the proofs.
+type BatchTrieRequest struct {
+	OdrRequest
+	Requests []*TrieRequest
+	Proofs   [][]rlp.RawValue // full proofs of the entries, nil if failed
+	Errs     []error          // per-entry verification errors
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BatchTrieRequest) StoreResult(db wtcdb.Database) error {
+	if len(req.Proofs) != len(req.Requests) {
+		return ErrMalformedResponse
+	}
+	if req.Errs == nil {
+		req.Proofs, req.Errs = CompleteTrieProofs(db, req.Requests, req.Proofs)
+	}
+	if len(req.Errs) != len(req.Requests) {
+		return ErrMalformedResponse
+	}
+	for i, r := range req.Requests {
+		if req.Errs[i] != nil {
+			continue
+		}
+		r.Proof = req.Proofs[i]
+		req.Errs[i] = r.StoreResult(db)
+	}
+	return nil
+}
+
+// AccountRequest is the ODR request type for retrieving an account from a state
+// trie along with its merkle proof
+type AccountRequest struct {
+	OdrRequest
+	Id      *TrieID // references the state trie
+	Address common.Address
+	Proof   []rlp.RawValue
+	Account *state.Account // nil if the account doesn't exist
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *AccountRequest) StoreResult(db wtcdb.Database) error {
+	if err := checkBlacklist(db, req.Id.Root); err != nil {
+		return err
+	}
+	if err := checkProofPresence(req.Id.Root, req.Proof); err != nil {
+		return err
+	}
+	if len(req.Proof) == 0 {
+		req.Account = nil // empty state, nothing exists
+		return nil
+	}
+	key := addressHash(req.Address)
+	value, err := verifyProofCached(db, req.Id.Root, key[:], req.Proof)
+	if err != nil {
+		if err := ConfigOf(db).CheckProofRoot(req.Id.Root, req.Proof); err != nil {
+			return err
+		}
+		return ErrMalformedResponse
+	}
+	req.Account = nil
+	if value != nil {
+		req.Account = new(state.Account)
+		if err := rlp.DecodeBytes(value, req.Account); err != nil {
+			return ErrMalformedResponse
+		}
+	}
+	if err := storeProof(db, req.Proof); err != nil {
+		return err
+	}
+	if ConfigOf(db).IndexTrieValues {
+		return indexProof(db, req.Id.Root, key[:], req.Proof)
+	}
+	return nil
+}
+
+// StorageRootRequest is the ODR request type for retrieving the storage trie root
+// of an account, proven against the state trie
+type StorageRootRequest struct {
+	OdrRequest
+	StateId *TrieID // references the state trie
+	Address common.Address
+	Proof   []rlp.RawValue
+	Root    common.Hash // storage root, the empty root if the account doesn't exist
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *StorageRootRequest) StoreResult(db wtcdb.Database) error {
+	acc := &AccountRequest{Id: req.StateId, Address: req.Address, Proof: req.Proof}
+	if err := acc.StoreResult(db); err != nil {
+		return err
+	}
+	req.Root = types.EmptyRootHash
+	if acc.Account != nil {
+		req.Root = acc.Account.Root
+	}
+	return nil
+}
+
+// CodeHashRequest is the ODR request type for retrieving the code hash of an
+// account without its code, proven against the state trie
+type CodeHashRequest struct {
+	OdrRequest
+	StateId  *TrieID // references the state trie
+	Address  common.Address
+	Proof    []rlp.RawValue
+	CodeHash common.Hash // hash of the empty code if the account has none or doesn't exist
 }
 
 // StoreResult stores the retrieved data in local database
-func (req *TrieRequest) StoreResult(db wtcdb.Database) {
-	storeProof(db, req.Proof)
+func (req *CodeHashRequest) StoreResult(db wtcdb.Database) error {
+	acc := &AccountRequest{Id: req.StateId, Address: req.Address, Proof: req.Proof}
+	if err := acc.StoreResult(db); err != nil {
+		return err
+	}
+	req.CodeHash = sha3_nil
+	if acc.Account != nil {
+		req.CodeHash = common.BytesToHash(acc.Account.CodeHash)
+	}
+	return nil
+}
+
+// CheckProofRoot returns ErrStaleStateRoot if none of the nodes of a full merkle
+// proof is the node of the given root. It's meant to tell why a proof failed
+// verification, so proofs of tries with a custom layout are never reported.
+func (c *Config) CheckProofRoot(root common.Hash, proof []rlp.RawValue) error {
+	if !c.standardTrie() || len(proof) == 0 {
+		return nil
+	}
+	for _, node := range proof {
+		if crypto.Keccak256Hash(node) == root {
+			return nil
+		}
+	}
+	return ErrStaleStateRoot
+}
+
+// checkProofPresence ensures a proof is not empty, unless it's for the empty trie
+// where there are no nodes to prove anything with.
+func checkProofPresence(root common.Hash, proof []rlp.RawValue) error {
+	if len(proof) == 0 && root != types.EmptyRootHash {
+		return ErrEmptyProof
+	}
+	return nil
 }
 
 // storeProof stores the new trie nodes obtained from a merkle proof in the database
-func storeProof(db wtcdb.Database, proof []rlp.RawValue) {
+func storeProof(db wtcdb.Database, proof []rlp.RawValue) error {
 	for _, buf := range proof {
 		hash := crypto.Keccak256(buf)
 		val, _ := db.Get(hash)
 		if val == nil {
 			db.Put(hash, buf)
+		} else if ConfigOf(db).ParanoidProofStore && !bytes.Equal(val, buf) {
+			return ErrHashCollision
+		}
+		if err := tagContent(db, common.BytesToHash(hash), ContentNode); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // CodeRequest is the ODR request type for retrieving contract code
@@ -108,8 +516,33 @@ type CodeRequest struct {
 }
 
 // StoreResult stores the retrieved data in local database
-func (req *CodeRequest) StoreResult(db wtcdb.Database) {
-	db.Put(req.Hash[:], req.Data)
+func (req *CodeRequest) StoreResult(db wtcdb.Database) error {
+	if req.Id != nil {
+		if err := checkBlacklist(db, req.Id.Root); err != nil {
+			return err
+		}
+	}
+	if err := db.Put(req.Hash[:], req.Data); err != nil {
+		return err
+	}
+	return tagContent(db, req.Hash, ContentCode)
+}
+
+// CodeSizeRequest is the ODR request type for retrieving the size of contract
+// code without the code itself. Unlike the code, its size can't be verified
+// against the code hash, so backends should only serve it from trusted sources.
+// LES has no message for it, LesOdr fails it with ErrUnsupportedRequest and
+// GetCodeSize falls back to retrieving the code.
+type CodeSizeRequest struct {
+	OdrRequest
+	Id   *TrieID // references storage trie of the account
+	Hash common.Hash
+	Size uint64
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *CodeSizeRequest) StoreResult(db wtcdb.Database) error {
+	return nil // unverified, not worth caching
 }
 
 // BlockRequest is the ODR request type for retrieving block bodies
@@ -118,11 +551,170 @@ type BlockRequest struct {
 	Hash   common.Hash
 	Number uint64
 	Rlp    []byte
+
+	// StrictSignatureCheck makes StoreResult also reject the body if the sender
+	// of any transaction can't be recovered by the signer of Config at the block.
+	// It's CPU heavy, recovering every signature, so it's opt-in.
+	StrictSignatureCheck bool
+	Config               *params.ChainConfig
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BlockRequest) StoreResult(db wtcdb.Database) error {
+	header, body, err := verifyBody(db, req.Hash, req.Number, req.Rlp)
+	if err != nil {
+		return err
+	}
+	if req.StrictSignatureCheck {
+		if req.Config == nil {
+			return ErrNoChainConfig
+		}
+		signer := types.MakeSigner(req.Config, header.Number)
+		for _, tx := range body.Transactions {
+			if _, err := types.Sender(signer, tx); err != nil {
+				return ErrInvalidSender
+			}
+		}
+	}
+	return writeBody(db, req.Hash, req.Number, req.Rlp)
+}
+
+// BatchBlockRequest is the ODR request type for retrieving the bodies of several
+// blocks in one round trip. Rlps and Errs are aligned by index with Hashes and
+// Numbers. A body failing verification is reported in Errs and not stored,
+// without failing the rest of the batch.
+type BatchBlockRequest struct {
+	OdrRequest
+	Hashes  []common.Hash
+	Numbers []uint64
+	Rlps    [][]byte // RLP encoded block bodies
+	Errs    []error  // per-block verification errors
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BatchBlockRequest) StoreResult(db wtcdb.Database) error {
+	if len(req.Numbers) != len(req.Hashes) || len(req.Rlps) != len(req.Hashes) {
+		return ErrMalformedResponse
+	}
+	req.Errs = make([]error, len(req.Hashes))
+	for i, hash := range req.Hashes {
+		req.Errs[i] = storeBody(db, hash, req.Numbers[i], req.Rlps[i])
+	}
+	return nil
+}
+
+// Completed returns the indices of the blocks whose bodies were retrieved and
+// stored, which after a cancelled or partly failed retrieval is a subset of the
+// requested ones.
+func (req *BatchBlockRequest) Completed() []int {
+	var done []int
+	for i := range req.Hashes {
+		if i < len(req.Errs) && i < len(req.Rlps) && req.Errs[i] == nil && req.Rlps[i] != nil {
+			done = append(done, i)
+		}
+	}
+	return done
+}
+
+// storeBody verifies a block body against the roots of its header and stores it.
+func storeBody(db wtcdb.Database, hash common.Hash, number uint64, data []byte) error {
+	if _, _, err := verifyBody(db, hash, number, data); err != nil {
+		return err
+	}
+	return writeBody(db, hash, number, data)
+}
+
+// verifyBody decodes a retrieved block body and checks its transactions and
+// uncles against the locally known header of the block.
+func verifyBody(db wtcdb.Database, hash common.Hash, number uint64, data []byte) (*types.Header, *types.Body, error) {
+	if len(data) == 0 {
+		return nil, nil, ErrNoBody
+	}
+	header := getHeader(db, hash, number)
+	if header == nil {
+		return nil, nil, ErrNoHeader
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(data, body); err != nil {
+		return nil, nil, ErrMalformedResponse
+	}
+	if types.DeriveSha(types.Transactions(body.Transactions)) != header.TxHash {
+		return nil, nil, ErrTxHashMismatch
+	}
+	if types.CalcUncleHash(body.Uncles) != header.UncleHash {
+		return nil, nil, ErrUncleHashMismatch
+	}
+	return header, body, nil
+}
+
+// TxByIndexRequest is the ODR request type for retrieving the transaction at a
+// given position of a block. It's served as a block body, which is verified and
+// stored along with the lookup entries of its transactions.
+type TxByIndexRequest struct {
+	OdrRequest
+	BlockHash common.Hash
+	Number    uint64
+	Index     uint64
+	Rlp       []byte // RLP encoded block body
+	Tx        *types.Transaction
 }
 
 // StoreResult stores the retrieved data in local database
-func (req *BlockRequest) StoreResult(db wtcdb.Database) {
-	core.WriteBodyRLP(db, req.Hash, req.Number, req.Rlp)
+func (req *TxByIndexRequest) StoreResult(db wtcdb.Database) error {
+	header, body, err := verifyBody(db, req.BlockHash, req.Number, req.Rlp)
+	if err != nil {
+		return err
+	}
+	// The body checks out, so it's worth keeping even if the index doesn't
+	if err := writeBody(db, req.BlockHash, req.Number, req.Rlp); err != nil {
+		return err
+	}
+	if err := writeTxLookupEntries(db, types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles)); err != nil {
+		return err
+	}
+	if req.Index >= uint64(len(body.Transactions)) {
+		return ErrIndexOutOfRange
+	}
+	req.Tx = body.Transactions[req.Index]
+	return nil
+}
+
+// TxCountRequest is the ODR request type for retrieving the number of
+// transactions in a block without its body. The count is proven against the
+// transaction root of the header by a proof of the last transaction and one of
+// the absence of the transaction following it. LES has no message for it,
+// LesOdr fails it with ErrUnsupportedRequest and GetTxCount falls back to
+// retrieving the body.
+type TxCountRequest struct {
+	OdrRequest
+	BlockHash common.Hash
+	Number    uint64
+	Count     uint64
+	LastProof []rlp.RawValue // proof of the transaction at Count-1, if any
+	EndProof  []rlp.RawValue // proof of absence of the transaction at Count
+}
+
+// StoreResult verifies the retrieved count. There is nothing to store, as the
+// transactions themselves aren't retrieved.
+func (req *TxCountRequest) StoreResult(db wtcdb.Database) error {
+	header := getHeader(db, req.BlockHash, req.Number)
+	if header == nil {
+		return ErrNoHeader
+	}
+	if req.Count == 0 {
+		if header.TxHash != types.EmptyRootHash {
+			return ErrTxHashMismatch
+		}
+		return nil
+	}
+	config := ConfigOf(db)
+	if value, err := config.VerifyProof(header.TxHash, derivableListKey(uint(req.Count-1)), req.LastProof); err != nil || value == nil {
+		return ErrTxHashMismatch
+	}
+	if value, err := config.VerifyProof(header.TxHash, derivableListKey(uint(req.Count)), req.EndProof); err != nil || value != nil {
+		return ErrTxHashMismatch
+	}
+	return nil
 }
 
 // ReceiptsRequest is the ODR request type for retrieving block bodies
@@ -134,8 +726,39 @@ type ReceiptsRequest struct {
 }
 
 // StoreResult stores the retrieved data in local database
-func (req *ReceiptsRequest) StoreResult(db wtcdb.Database) {
-	core.WriteBlockReceipts(db, req.Hash, req.Number, req.Receipts)
+func (req *ReceiptsRequest) StoreResult(db wtcdb.Database) error {
+	// Make sure the blooms weren't tampered with independently of the logs
+	for _, receipt := range req.Receipts {
+		if types.BytesToBloom(types.LogsBloom(receipt.Logs).Bytes()) != receipt.Bloom {
+			return ErrBloomMismatch
+		}
+	}
+	if header := getHeader(db, req.Hash, req.Number); header != nil {
+		if types.CreateBloom(req.Receipts) != header.Bloom {
+			return ErrBloomMismatch
+		}
+		if header.GasUsed != nil && receiptsGasUsed(req.Receipts).Cmp(header.GasUsed) != 0 {
+			return ErrGasUsedMismatch
+		}
+	}
+	if err := core.WriteBlockReceipts(db, req.Hash, req.Number, req.Receipts); err != nil {
+		return err
+	}
+	archiveBlock(db, req.Hash, req.Number)
+	if ConfigOf(db).IndexReceiptLogs {
+		return indexReceiptLogs(db, req.Hash, req.Number, req.Receipts)
+	}
+	return nil
+}
+
+// receiptsGasUsed returns the gas used by a block according to its receipts,
+// i.e. the cumulative gas used of the last one. A receipt missing its gas is
+// treated as having used none, failing the check against a busy block.
+func receiptsGasUsed(receipts types.Receipts) *big.Int {
+	if len(receipts) == 0 || receipts[len(receipts)-1].CumulativeGasUsed == nil {
+		return new(big.Int)
+	}
+	return receipts[len(receipts)-1].CumulativeGasUsed
 }
 
 // TrieRequest is the ODR request type for state/storage trie entries
@@ -149,11 +772,272 @@ type ChtRequest struct {
 }
 
 // StoreResult stores the retrieved data in local database
-func (req *ChtRequest) StoreResult(db wtcdb.Database) {
+func (req *ChtRequest) StoreResult(db wtcdb.Database) error {
+	if _, err := VerifyChtProof(db, req.ChtRoot, req.BlockNum, req.Header, req.Proof); err != nil {
+		return err
+	}
 	// if there is a canonical hash, there is a header too
-	core.WriteHeader(db, req.Header)
+	if err := writeHeader(db, req.Header); err != nil {
+		return err
+	}
 	hash, num := req.Header.Hash(), req.Header.Number.Uint64()
-	core.WriteTd(db, hash, num, req.Td)
-	core.WriteCanonicalHash(db, hash, num)
+	if err := core.WriteTd(db, hash, num, req.Td); err != nil {
+		return err
+	}
+	return core.WriteCanonicalHash(db, hash, num)
 	//storeProof(db, req.Proof)
 }
+
+// StateRootRequest is the ODR request type for retrieving the state root of a
+// block, so state reads can be anchored to a verified root. It's served as a CHT
+// request for the block's number, and the canonical header proven by the CHT
+// must have the claimed hash.
+type StateRootRequest struct {
+	OdrRequest
+	Number  uint64
+	Hash    common.Hash // claimed hash of the block
+	ChtNum  uint64
+	ChtRoot common.Hash
+	Header  *types.Header
+	Td      *big.Int
+	Proof   []rlp.RawValue
+	Root    common.Hash // verified state root
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *StateRootRequest) StoreResult(db wtcdb.Database) error {
+	cht := &ChtRequest{ChtNum: req.ChtNum, BlockNum: req.Number, ChtRoot: req.ChtRoot, Header: req.Header, Td: req.Td, Proof: req.Proof}
+	if err := cht.StoreResult(db); err != nil {
+		return err
+	}
+	if req.Header.Hash() != req.Hash {
+		return ErrBlockHashMismatch
+	}
+	req.Root = req.Header.Root
+	return nil
+}
+
+// BlockBloomRequest is the ODR request type for retrieving the logs bloom of a
+// block, so blocks can be checked for possibly matching logs before retrieving
+// their receipts. Like a StateRootRequest it's served as a CHT request for the
+// block's number, and the bloom is taken from the canonical header proven by the
+// CHT, which must have the claimed hash.
+type BlockBloomRequest struct {
+	OdrRequest
+	Number  uint64
+	Hash    common.Hash // claimed hash of the block
+	ChtNum  uint64
+	ChtRoot common.Hash
+	Header  *types.Header
+	Td      *big.Int
+	Proof   []rlp.RawValue
+	Bloom   types.Bloom // verified logs bloom
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BlockBloomRequest) StoreResult(db wtcdb.Database) error {
+	cht := &ChtRequest{ChtNum: req.ChtNum, BlockNum: req.Number, ChtRoot: req.ChtRoot, Header: req.Header, Td: req.Td, Proof: req.Proof}
+	if err := cht.StoreResult(db); err != nil {
+		return err
+	}
+	if req.Header.Hash() != req.Hash {
+		return ErrBlockHashMismatch
+	}
+	req.Bloom = req.Header.Bloom
+	return nil
+}
+
+// HeaderByHashRequest is the ODR request type for retrieving a block header by
+// its hash. Headers inside the trusted CHT range are cross-checked against the
+// canonical entry of their number, newer ones must link to a known parent. A
+// header requested as the parent of a known one is trusted by that link instead,
+// canonical or not, which allows walking side chains backwards. LES has no
+// message for it, LesOdr fails it with ErrUnsupportedRequest.
+type HeaderByHashRequest struct {
+	OdrRequest
+	Hash    common.Hash
+	ChtNum  uint64
+	ChtRoot common.Hash
+	Child   common.Hash // known header naming the requested one as parent, if any
+	Header  *types.Header
+	Proof   []rlp.RawValue // CHT proof of the header's number, if in CHT range
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *HeaderByHashRequest) StoreResult(db wtcdb.Database) error {
+	if req.Header == nil || req.Header.Number == nil || req.Header.Hash() != req.Hash {
+		return ErrMalformedResponse
+	}
+	num := req.Header.Number.Uint64()
+	if req.Child != (common.Hash{}) {
+		if child := getHeader(db, req.Child, num+1); child != nil && child.ParentHash == req.Hash {
+			return writeHeader(db, req.Header)
+		}
+	}
+	if num < req.ChtNum*ChtFrequency {
+		// Covered by the CHT, the header must be the canonical one
+		if err := checkBlacklist(db, req.ChtRoot); err != nil {
+			return err
+		}
+		value, err := verifyProofCached(db, req.ChtRoot, chtKey(num), req.Proof)
+		if err != nil || value == nil {
+			return ErrMalformedResponse
+		}
+		var node ChtNode
+		if err := rlp.DecodeBytes(value, &node); err != nil || node.Hash != req.Hash {
+			return ErrMalformedResponse
+		}
+		if err := writeHeader(db, req.Header); err != nil {
+			return err
+		}
+		if err := core.WriteTd(db, req.Hash, num, node.Td); err != nil {
+			return err
+		}
+		return core.WriteCanonicalHash(db, req.Hash, num)
+	}
+	// Beyond the CHT, the header must extend a header we already know
+	if num == 0 || getHeader(db, req.Header.ParentHash, num-1) == nil {
+		return ErrUnknownParent
+	}
+	if err := writeHeader(db, req.Header); err != nil {
+		return err
+	}
+	if td := core.GetTd(db, req.Header.ParentHash, num-1); td != nil {
+		return core.WriteTd(db, req.Hash, num, new(big.Int).Add(td, req.Header.Difficulty))
+	}
+	return nil
+}
+
+// BatchHeaderRequest is the ODR request type for retrieving several headers by
+// their hashes in one round trip. Every header is verified like the one of a
+// HeaderByHashRequest: against the CHT if its number is covered, by linkage to
+// a known parent otherwise. Parents may be part of the same batch. Failures are
+// reported per header in Errs, aligned by index with Hashes and Headers. Like
+// HeaderByHashRequest, it isn't served over LES.
+type BatchHeaderRequest struct {
+	OdrRequest
+	Hashes  []common.Hash
+	ChtNum  uint64
+	ChtRoot common.Hash
+	Headers []*types.Header
+	Proofs  [][]rlp.RawValue // CHT proofs of the headers' numbers, if in CHT range
+	Errs    []error          // per-header verification errors
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BatchHeaderRequest) StoreResult(db wtcdb.Database) error {
+	if len(req.Headers) != len(req.Hashes) || len(req.Proofs) != len(req.Hashes) {
+		return ErrMalformedResponse
+	}
+	// Store lower headers first, so that parents in the batch are known
+	order := make([]int, len(req.Hashes))
+	for i := range order {
+		order[i] = i
+	}
+	number := func(i int) uint64 {
+		if header := req.Headers[i]; header != nil && header.Number != nil {
+			return header.Number.Uint64()
+		}
+		return 0
+	}
+	sort.SliceStable(order, func(a, b int) bool { return number(order[a]) < number(order[b]) })
+
+	req.Errs = make([]error, len(req.Hashes))
+	for _, i := range order {
+		r := &HeaderByHashRequest{Hash: req.Hashes[i], ChtNum: req.ChtNum, ChtRoot: req.ChtRoot, Header: req.Headers[i], Proof: req.Proofs[i]}
+		req.Errs[i] = r.StoreResult(db)
+	}
+	return nil
+}
+
+// MaxHeaderSegment is the maximum number of headers retrieved by a single
+// HeaderSegmentRequest.
+const MaxHeaderSegment = 192
+
+// HeaderVerifier checks a contiguous header chain segment against the consensus
+// rules. The parent of the first header is available locally.
+type HeaderVerifier func(headers []*types.Header) error
+
+// HeaderSegmentRequest is the ODR request type for retrieving the headers
+// following a known-good anchor header, e.g. the genesis or an earlier verified
+// header. Instead of a CHT, the headers are trusted through their parent hash
+// linkage to the anchor and, if Verify is set, the consensus rules. They are
+// stored with their total difficulties but not made canonical. LES has no
+// message for it, LesOdr fails it with ErrUnsupportedRequest.
+type HeaderSegmentRequest struct {
+	OdrRequest
+	Anchor  common.Hash
+	Number  uint64         // number of the anchor
+	Amount  uint64         // maximum number of headers to retrieve
+	Verify  HeaderVerifier // consensus check, not part of the request identity
+	Headers []*types.Header
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *HeaderSegmentRequest) StoreResult(db wtcdb.Database) error {
+	if len(req.Headers) == 0 || uint64(len(req.Headers)) > req.Amount {
+		return ErrMalformedResponse
+	}
+	anchor := getHeader(db, req.Anchor, req.Number)
+	if anchor == nil {
+		return ErrUnknownParent
+	}
+	if err := VerifyHeaderChain(append([]*types.Header{anchor}, req.Headers...)); err != nil {
+		return ErrMalformedResponse
+	}
+	for _, header := range req.Headers {
+		if header.Difficulty == nil {
+			return ErrMalformedResponse
+		}
+	}
+	if req.Verify != nil {
+		if err := req.Verify(req.Headers); err != nil {
+			return err
+		}
+	}
+	td := core.GetTd(db, req.Anchor, req.Number)
+	for _, header := range req.Headers {
+		if err := writeHeader(db, header); err != nil {
+			return err
+		}
+		if td == nil {
+			continue
+		}
+		td = new(big.Int).Add(td, header.Difficulty)
+		if err := core.WriteTd(db, header.Hash(), header.Number.Uint64(), td); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BloomTrieRootRequest is the ODR request type for retrieving the root of the
+// BloomTrie belonging to a section. Headers don't commit to the BloomTrie, so
+// there is nothing in the CHT to anchor a proof to: the root is only accepted
+// if it matches the trusted checkpoint of the section. Once stored, it's served
+// by GetTrustedBloomTrieRoot as the anchor of the bloom bits of the section.
+// LES has no message for it, LesOdr fails it with ErrUnsupportedRequest.
+type BloomTrieRootRequest struct {
+	OdrRequest
+	Section uint64
+	Root    common.Hash
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *BloomTrieRootRequest) StoreResult(db wtcdb.Database) error {
+	cp := GetCheckpoint(db, req.Section)
+	if cp == nil || cp.BloomRoot == (common.Hash{}) {
+		return ErrNoCheckpoint
+	}
+	if cp.BloomRoot != req.Root {
+		return ErrCheckpointMismatch
+	}
+	return db.Put(sectionKey(bloomTrieRootPrefix, req.Section), req.Root[:])
+}
+
+// chtKey returns the key of a block number in the canonical hash trie
+func chtKey(number uint64) []byte {
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], number)
+	return enc[:]
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"reflect"
 	"testing"
 	"time"
 
@@ -58,12 +59,17 @@ type testOdr struct {
 	OdrBackend
 	sdb, ldb wtcdb.Database
 	disable  bool
+	config   *Config
 }
 
 func (odr *testOdr) Database() wtcdb.Database {
 	return odr.ldb
 }
 
+func (odr *testOdr) Config() *Config {
+	return odr.config
+}
+
 var ErrOdrDisabled = errors.New("ODR disabled")
 
 func (odr *testOdr) Retrieve(ctx context.Context, req OdrRequest) error {
@@ -75,14 +81,29 @@ func (odr *testOdr) Retrieve(ctx context.Context, req OdrRequest) error {
 		req.Rlp = core.GetBodyRLP(odr.sdb, req.Hash, core.GetBlockNumber(odr.sdb, req.Hash))
 	case *ReceiptsRequest:
 		req.Receipts = core.GetBlockReceipts(odr.sdb, req.Hash, core.GetBlockNumber(odr.sdb, req.Hash))
+	case *TxByIndexRequest:
+		req.Rlp = core.GetBodyRLP(odr.sdb, req.BlockHash, req.Number)
+	case *TxCountRequest:
+		answerRequest(odr.sdb, req)
 	case *TrieRequest:
 		t, _ := trie.New(req.Id.Root, odr.sdb)
 		req.Proof = t.Prove(req.Key)
+	case *AccountRequest:
+		t, _ := trie.New(req.Id.Root, odr.sdb)
+		req.Proof = t.Prove(crypto.Keccak256(req.Address[:]))
+	case *StorageRootRequest:
+		t, _ := trie.New(req.StateId.Root, odr.sdb)
+		req.Proof = t.Prove(crypto.Keccak256(req.Address[:]))
+	case *CodeHashRequest:
+		t, _ := trie.New(req.StateId.Root, odr.sdb)
+		req.Proof = t.Prove(crypto.Keccak256(req.Address[:]))
 	case *CodeRequest:
 		req.Data, _ = odr.sdb.Get(req.Hash[:])
+	case *CodeSizeRequest:
+		data, _ := odr.sdb.Get(req.Hash[:])
+		req.Size = uint64(len(data))
 	}
-	req.StoreResult(odr.ldb)
-	return nil
+	return req.StoreResult(StoreDatabase(BindConfig(odr.ldb, odr.config), req))
 }
 
 type odrTestFn func(ctx context.Context, db wtcdb.Database, bc *core.BlockChain, lc *LightChain, bhash common.Hash) ([]byte, error)
@@ -297,3 +318,1271 @@ func testChainOdr(t *testing.T, protocol int, fn odrTestFn) {
 	odr.disable = true
 	test(len(gchain))
 }
+
+// makeTestBlock assembles a block on top of parent with the given contents,
+// deriving all the header commitments from them.
+func makeTestBlock(parent *types.Header, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) *types.Block {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Difficulty: big.NewInt(131072),
+		GasLimit:   big.NewInt(4712388),
+		GasUsed:    new(big.Int),
+		Time:       new(big.Int).Add(parent.Time, big.NewInt(10)),
+		CodeAge:    new(big.Int),
+	}
+	if len(receipts) > 0 {
+		header.GasUsed = new(big.Int).Set(receipts[len(receipts)-1].CumulativeGasUsed)
+	}
+	return types.NewBlock(header, txs, uncles, receipts)
+}
+
+// writeTestBlock stores a block with its receipts in the server database and
+// makes its header known to the light client database.
+func writeTestBlock(sdb, ldb wtcdb.Database, block *types.Block, receipts types.Receipts) {
+	core.WriteBlock(sdb, block)
+	core.WriteBlockReceipts(sdb, block.Hash(), block.NumberU64(), receipts)
+	core.WriteCanonicalHash(sdb, block.Hash(), block.NumberU64())
+	core.WriteHeader(ldb, block.Header())
+	core.WriteCanonicalHash(ldb, block.Hash(), block.NumberU64())
+}
+
+func newTestUncle(parent *types.Header, extra string) *types.Header {
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Difficulty: big.NewInt(131072),
+		GasLimit:   big.NewInt(4712388),
+		GasUsed:    new(big.Int),
+		Time:       new(big.Int).Add(parent.Time, big.NewInt(5)),
+		CodeAge:    new(big.Int),
+		Extra:      []byte(extra),
+	}
+}
+
+func TestOdrGetUncles(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+
+	uncles := []*types.Header{newTestUncle(genesis.Header(), "foo"), newTestUncle(genesis.Header(), "bar")}
+	block := makeTestBlock(genesis.Header(), nil, uncles, nil)
+	writeTestBlock(sdb, ldb, block, nil)
+
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	if _, err := GetUncles(ldb, block.Hash(), block.NumberU64()); err != ErrNoBody {
+		t.Fatalf("uncles available before retrieval: %v", err)
+	}
+	if _, err := GetBody(context.Background(), odr, block.Hash(), block.NumberU64()); err != nil {
+		t.Fatalf("failed to retrieve body: %v", err)
+	}
+	have, err := GetUncles(ldb, block.Hash(), block.NumberU64())
+	if err != nil {
+		t.Fatalf("failed to get uncles: %v", err)
+	}
+	if len(have) != len(uncles) {
+		t.Fatalf("uncle count mismatch: have %d, want %d", len(have), len(uncles))
+	}
+	for i := range uncles {
+		if have[i].Hash() != uncles[i].Hash() {
+			t.Errorf("uncle %d mismatch: have %x, want %x", i, have[i].Hash(), uncles[i].Hash())
+		}
+	}
+}
+
+func TestOdrRejectBadUncles(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+
+	block := makeTestBlock(genesis.Header(), nil, []*types.Header{newTestUncle(genesis.Header(), "foo")}, nil)
+	writeTestBlock(sdb, ldb, block, nil)
+
+	forged := &types.Body{Uncles: []*types.Header{newTestUncle(genesis.Header(), "forged")}}
+	data, _ := rlp.EncodeToBytes(forged)
+	req := &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: data}
+	if err := req.StoreResult(ldb); err != ErrUncleHashMismatch {
+		t.Fatalf("forged uncles error mismatch: have %v, want %v", err, ErrUncleHashMismatch)
+	}
+	if core.GetBodyRLP(ldb, block.Hash(), block.NumberU64()) != nil {
+		t.Fatalf("forged body stored")
+	}
+}
+
+func TestOdrRejectBadBodyTxs(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+
+	block := makeTestBlock(genesis.Header(), nil, nil, nil)
+	writeTestBlock(sdb, ldb, block, nil)
+
+	// Transactions not matching the header's transaction root are rejected
+	tx := types.NewTransaction(0, acc1Addr, big.NewInt(1), bigTxGas, nil, nil)
+	data, _ := rlp.EncodeToBytes(&types.Body{Transactions: []*types.Transaction{tx}})
+	req := &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: data}
+	if err := req.StoreResult(ldb); err != ErrTxHashMismatch {
+		t.Fatalf("forged transactions error mismatch: have %v, want %v", err, ErrTxHashMismatch)
+	}
+	if core.GetBodyRLP(ldb, block.Hash(), block.NumberU64()) != nil {
+		t.Fatalf("forged body stored")
+	}
+	// Undecodable bodies are reported as malformed responses
+	req = &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: []byte{0xff}}
+	if err := req.StoreResult(ldb); err != ErrMalformedResponse {
+		t.Fatalf("malformed body error mismatch: have %v, want %v", err, ErrMalformedResponse)
+	}
+}
+
+// makeTestCht builds a canonical hash trie over the given headers in db and
+// returns its root. The total difficulty of each entry is its block number.
+func makeTestCht(db wtcdb.Database, headers []*types.Header) common.Hash {
+	t, _ := trie.New(common.Hash{}, db)
+	for _, header := range headers {
+		node, _ := rlp.EncodeToBytes(ChtNode{Hash: header.Hash(), Td: new(big.Int).Set(header.Number)})
+		t.Update(chtKey(header.Number.Uint64()), node)
+	}
+	root, _ := t.CommitTo(db)
+	return root
+}
+
+// makeTestHeaders creates a chain of n linked empty headers on top of parent.
+func makeTestHeaders(parent *types.Header, n int) []*types.Header {
+	headers := make([]*types.Header, n)
+	for i := range headers {
+		headers[i] = makeTestBlock(parent, nil, nil, nil).Header()
+		parent = headers[i]
+	}
+	return headers
+}
+
+func TestChtRequestWrongNumber(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 8)
+	root := makeTestCht(db, headers)
+	cht, _ := trie.New(root, db)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	tests := []struct {
+		number uint64
+		header *types.Header
+		proof  uint64
+		err    error
+	}{
+		{3, headers[2], 3, nil},
+		{3, headers[3], 3, ErrMalformedResponse}, // header for another block
+		{3, headers[3], 4, ErrMalformedResponse}, // header and proof for another block
+		{3, headers[2], 4, ErrMalformedResponse}, // proof for another block
+	}
+	for i, tt := range tests {
+		req := &ChtRequest{
+			ChtRoot:  root,
+			BlockNum: tt.number,
+			Header:   tt.header,
+			Td:       tt.header.Number,
+			Proof:    cht.Prove(chtKey(tt.proof)),
+		}
+		if err := req.StoreResult(ldb); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if hash := core.GetCanonicalHash(ldb, 4); hash != (common.Hash{}) {
+		t.Errorf("substituted header stored as canonical")
+	}
+	if hash := core.GetCanonicalHash(ldb, 3); hash != headers[2].Hash() {
+		t.Errorf("canonical hash mismatch: have %x, want %x", hash, headers[2].Hash())
+	}
+}
+
+func TestBlockRequestStrictSignatureCheck(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	txs := makeTestTxs(2)
+
+	// Forge a signature of all zeros, which recovers to no sender at all
+	bad, err := txs[1].WithSignature(types.HomesteadSigner{}, make([]byte, 65))
+	if err != nil {
+		t.Fatalf("failed to forge signature: %v", err)
+	}
+	good := makeTestBlock(genesis.Header(), txs, nil, nil)
+	forged := makeTestBlock(genesis.Header(), []*types.Transaction{txs[0], bad}, nil, nil)
+
+	store := func(block *types.Block, strict bool, config *params.ChainConfig) error {
+		ldb, _ := wtcdb.NewMemDatabase()
+		core.WriteHeader(ldb, block.Header())
+		data, _ := rlp.EncodeToBytes(block.Body())
+		req := &BlockRequest{Hash: block.Hash(), Number: block.NumberU64(), Rlp: data, StrictSignatureCheck: strict, Config: config}
+		return req.StoreResult(ldb)
+	}
+	// The body matches its header, so only the strict check catches it
+	if err := store(forged, false, nil); err != nil {
+		t.Errorf("forged body rejected without strict check: %v", err)
+	}
+	if err := store(forged, true, params.TestChainConfig); err != ErrInvalidSender {
+		t.Errorf("error mismatch for forged body: have %v, want %v", err, ErrInvalidSender)
+	}
+	if err := store(good, true, params.TestChainConfig); err != nil {
+		t.Errorf("valid body rejected by strict check: %v", err)
+	}
+	if err := store(good, true, nil); err != ErrNoChainConfig {
+		t.Errorf("error mismatch without chain config: have %v, want %v", err, ErrNoChainConfig)
+	}
+}
+
+func TestBatchBlockRequest(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	parent := new(core.Genesis).MustCommit(db).Header()
+	blocks := make([]*types.Block, 3)
+	for i := range blocks {
+		blocks[i] = makeTestBlock(parent, makeTestTxs(i+1), nil, nil)
+		parent = blocks[i].Header()
+	}
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, blocks[0].Header())
+	core.WriteHeader(ldb, blocks[1].Header())
+
+	// Block 1 is valid, block 2 gets the body of block 1, block 3 has no known
+	// header and the body of an unknown block is missing
+	body := func(b *types.Block) []byte {
+		data, _ := rlp.EncodeToBytes(b.Body())
+		return data
+	}
+	unknown := newTestUncle(blocks[0].Header(), "unknown")
+	req := &BatchBlockRequest{
+		Hashes:  []common.Hash{blocks[0].Hash(), blocks[1].Hash(), blocks[2].Hash(), unknown.Hash()},
+		Numbers: []uint64{1, 2, 3, 2},
+		Rlps:    [][]byte{body(blocks[0]), body(blocks[0]), body(blocks[2]), nil},
+	}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store batch: %v", err)
+	}
+	want := []error{nil, ErrTxHashMismatch, ErrNoHeader, ErrNoBody}
+	if !reflect.DeepEqual(req.Errs, want) {
+		t.Errorf("per-block errors mismatch: have %v, want %v", req.Errs, want)
+	}
+	if have := core.GetBodyRLP(ldb, blocks[0].Hash(), 1); !bytes.Equal(have, body(blocks[0])) {
+		t.Errorf("valid body not stored")
+	}
+	if have := core.GetBodyRLP(ldb, blocks[1].Hash(), 2); have != nil {
+		t.Errorf("invalid body stored")
+	}
+	req = &BatchBlockRequest{Hashes: req.Hashes, Numbers: req.Numbers, Rlps: req.Rlps[:3]}
+	if err := req.StoreResult(ldb); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for misaligned reply: have %v, want %v", err, ErrMalformedResponse)
+	}
+}
+
+func TestTxByIndexRequest(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	block := makeTestBlock(genesis.Header(), txs, nil, nil)
+	core.WriteBlock(sdb, block)
+	hash, num := block.Hash(), block.NumberU64()
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	tx, err := GetTransactionByIndex(NoOdr, odr, hash, num, 1)
+	if err != nil {
+		t.Fatalf("failed to retrieve transaction: %v", err)
+	}
+	if tx.Hash() != txs[1].Hash() {
+		t.Errorf("transaction mismatch: have %x, want %x", tx.Hash(), txs[1].Hash())
+	}
+	if lhash, lnum, lindex := core.GetTxLookupEntry(ldb, txs[2].Hash()); lhash != hash || lnum != num || lindex != 2 {
+		t.Errorf("lookup entry mismatch: have %x/%d/%d, want %x/%d/%d", lhash, lnum, lindex, hash, num, 2)
+	}
+	// Out of range indices should be rejected, both retrieved and local
+	req := &TxByIndexRequest{BlockHash: hash, Number: num, Index: 3, Rlp: core.GetBodyRLP(sdb, hash, num)}
+	if err := req.StoreResult(ldb); err != ErrIndexOutOfRange {
+		t.Errorf("error mismatch for out of range index: have %v, want %v", err, ErrIndexOutOfRange)
+	}
+	odr.disable = true
+	if _, err := GetTransactionByIndex(NoOdr, odr, hash, num, 3); err != ErrIndexOutOfRange {
+		t.Errorf("error mismatch for local out of range index: have %v, want %v", err, ErrIndexOutOfRange)
+	}
+	// Bodies not matching the header should be rejected
+	ldb, _ = wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+	req.Index = 0
+	req.Rlp, _ = rlp.EncodeToBytes(&types.Body{Transactions: txs[:2]})
+	if err := req.StoreResult(ldb); err != ErrTxHashMismatch {
+		t.Errorf("error mismatch for tampered body: have %v, want %v", err, ErrTxHashMismatch)
+	}
+	if core.GetBodyRLP(ldb, hash, num) != nil {
+		t.Errorf("tampered body stored")
+	}
+	// Empty replies are reported like the ones to block requests
+	req.Rlp = nil
+	if err := req.StoreResult(ldb); err != ErrNoBody {
+		t.Errorf("error mismatch for empty body: have %v, want %v", err, ErrNoBody)
+	}
+}
+
+// countlessOdr is a test backend unable to serve count-only body requests.
+type countlessOdr struct {
+	*testOdr
+	countReqs int
+}
+
+func (odr *countlessOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if _, ok := req.(*TxCountRequest); ok {
+		odr.countReqs++
+		return ErrUnsupportedRequest
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestGetTxCount(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	block := makeTestBlock(genesis.Header(), makeTestTxs(5), nil, nil)
+	empty := makeTestBlock(block.Header(), nil, nil, nil)
+	core.WriteBlock(sdb, block)
+	hash, num := block.Hash(), block.NumberU64()
+
+	// Count-only retrieval shouldn't store the body
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+	core.WriteHeader(ldb, empty.Header())
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	if count, err := GetTxCount(NoOdr, odr, hash, num); err != nil || count != 5 {
+		t.Errorf("count-only retrieval mismatch: have %d, %v, want 5", count, err)
+	}
+	if core.GetBodyRLP(ldb, hash, num) != nil {
+		t.Errorf("body stored by count-only retrieval")
+	}
+	// Counts not matching the proofs should be rejected
+	for _, count := range []uint64{0, 4, 6} {
+		req := &TxCountRequest{BlockHash: hash, Number: num}
+		answerRequest(sdb, req)
+		req.Count = count
+		if err := req.StoreResult(ldb); err != ErrTxHashMismatch {
+			t.Errorf("error mismatch for count %d: have %v, want %v", count, err, ErrTxHashMismatch)
+		}
+	}
+	// Empty blocks are known to have no transactions from the header alone
+	odr.disable = true
+	if count, err := GetTxCount(NoOdr, odr, empty.Hash(), empty.NumberU64()); err != nil || count != 0 {
+		t.Errorf("empty block count mismatch: have %d, %v, want 0", count, err)
+	}
+	// Fallback retrieval should make the body locally available
+	ldb, _ = wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+	fallback := &countlessOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+	if count, err := GetTxCount(NoOdr, fallback, hash, num); err != nil || count != 5 {
+		t.Errorf("fallback retrieval mismatch: have %d, %v, want 5", count, err)
+	}
+	if core.GetBodyRLP(ldb, hash, num) == nil {
+		t.Errorf("body not stored by fallback retrieval")
+	}
+	fallback.testOdr.disable = true
+	if count, err := GetTxCount(NoOdr, fallback, hash, num); err != nil || count != 5 {
+		t.Errorf("local count mismatch: have %d, %v, want 5", count, err)
+	}
+	if fallback.countReqs != 1 {
+		t.Errorf("count-only request count mismatch: have %d, want 1", fallback.countReqs)
+	}
+}
+
+func TestCanonicalHashes(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 6)
+	for _, header := range headers {
+		if n := header.Number.Uint64(); n != 3 && n != 6 {
+			core.WriteCanonicalHash(db, header.Hash(), n)
+		}
+	}
+	hashes, missing, err := CanonicalHashes(db, 2, 7)
+	if err != nil {
+		t.Fatalf("failed to resolve range: %v", err)
+	}
+	for i, hash := range hashes {
+		var want common.Hash
+		if n := uint64(i + 2); n <= 6 && n != 3 && n != 6 {
+			want = headers[n-1].Hash()
+		}
+		if hash != want {
+			t.Errorf("hash %d mismatch: have %x, want %x", i+2, hash, want)
+		}
+	}
+	if !reflect.DeepEqual(missing, []uint64{3, 6, 7}) {
+		t.Errorf("missing numbers mismatch: have %v, want %v", missing, []uint64{3, 6, 7})
+	}
+	if _, _, err := CanonicalHashes(db, 5, 4); err != ErrInvalidRange {
+		t.Errorf("error mismatch for reversed range: have %v, want %v", err, ErrInvalidRange)
+	}
+	if _, _, err := CanonicalHashes(db, 0, MaxCanonicalHashRange); err != ErrInvalidRange {
+		t.Errorf("error mismatch for oversized range: have %v, want %v", err, ErrInvalidRange)
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	if _, err := Confirmations(db, 0); err != ErrNoHead {
+		t.Errorf("error mismatch without head: have %v, want %v", err, ErrNoHead)
+	}
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 5)
+	writeCanonicalHeaders(db, headers)
+	core.WriteHeadHeaderHash(db, headers[4].Hash())
+
+	tests := []struct {
+		number uint64
+		confs  uint64
+		err    error
+	}{
+		{5, 1, nil}, // the head itself
+		{3, 3, nil},
+		{0, 6, nil}, // the genesis block
+		{6, 0, ErrAheadOfHead},
+	}
+	for i, tt := range tests {
+		confs, err := Confirmations(db, tt.number)
+		if confs != tt.confs || err != tt.err {
+			t.Errorf("test %d: confirmations mismatch: have %d, %v, want %d, %v", i, confs, err, tt.confs, tt.err)
+		}
+	}
+	// A head that isn't part of the canonical chain isn't trusted
+	fork := newTestUncle(headers[3], "fork")
+	core.WriteHeader(db, fork)
+	core.WriteHeadHeaderHash(db, fork.Hash())
+	if _, err := Confirmations(db, 3); err != ErrNoHead {
+		t.Errorf("error mismatch for non-canonical head: have %v, want %v", err, ErrNoHead)
+	}
+}
+
+func TestBaseFee(t *testing.T) {
+	odr := NewMemoryOdrBackend(nil)
+	if _, err := BaseFee(NoOdr, odr); err != ErrNoHead {
+		t.Errorf("error mismatch without head: have %v, want %v", err, ErrNoHead)
+	}
+	db := odr.Database()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 3)
+	writeCanonicalHeaders(db, headers)
+	core.WriteHeadHeaderHash(db, headers[2].Hash())
+
+	// Headers have no base fee, so every verified head predates the fee market
+	if fee, err := BaseFee(NoOdr, odr); fee != nil || err != ErrBaseFeeNotApplicable {
+		t.Errorf("base fee mismatch: have %v, %v, want nil, %v", fee, err, ErrBaseFeeNotApplicable)
+	}
+	// A spoofed head that isn't canonical isn't consulted
+	fork := newTestUncle(headers[1], "fork")
+	core.WriteHeader(db, fork)
+	core.WriteHeadHeaderHash(db, fork.Hash())
+	if _, err := BaseFee(NoOdr, odr); err != ErrNoHead {
+		t.Errorf("error mismatch for non-canonical head: have %v, want %v", err, ErrNoHead)
+	}
+}
+
+func TestHeadTd(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 6)
+	td := new(big.Int).Set(genesis.Difficulty())
+	for _, header := range headers {
+		td.Add(td, header.Difficulty)
+		core.WriteTd(sdb, header.Hash(), header.Number.Uint64(), new(big.Int).Set(td))
+	}
+	writeCanonicalHeaders(sdb, headers)
+	odr := NewMemoryOdrBackend(sdb)
+	db := odr.Database()
+	WriteTrustedCht(db, TrustedCht{Number: 1, Root: makeTestCht(sdb, headers[:3])})
+
+	if _, err := HeadTd(NoOdr, odr); err != ErrNoHead {
+		t.Errorf("error mismatch without head: have %v, want %v", err, ErrNoHead)
+	}
+	// A head inside the CHT has its total difficulty proven directly
+	writeCanonicalHeaders(db, headers[1:2])
+	core.WriteHeadHeaderHash(db, headers[1].Hash())
+	if have, want := mustHeadTd(t, odr), core.GetTd(sdb, headers[1].Hash(), 2); have.Cmp(want) != 0 {
+		t.Errorf("td mismatch inside the CHT: have %v, want %v", have, want)
+	}
+	// A newer head accumulates the difficulties above the last CHT block
+	writeCanonicalHeaders(db, headers[3:])
+	core.WriteHeadHeaderHash(db, headers[5].Hash())
+	if have, want := mustHeadTd(t, odr), core.GetTd(sdb, headers[5].Hash(), 6); have.Cmp(want) != 0 {
+		t.Errorf("td mismatch beyond the CHT: have %v, want %v", have, want)
+	}
+	// A stored total difficulty inconsistent with the chain is rejected
+	core.WriteTd(db, headers[5].Hash(), 6, big.NewInt(1))
+	if _, err := HeadTd(NoOdr, odr); err != ErrTdMismatch {
+		t.Errorf("error mismatch for forged td: have %v, want %v", err, ErrTdMismatch)
+	}
+	// So is a gap in the header chain
+	core.DeleteHeader(db, headers[4].Hash(), 5)
+	core.WriteTd(db, headers[5].Hash(), 6, core.GetTd(sdb, headers[5].Hash(), 6))
+	if _, err := HeadTd(NoOdr, odr); err != ErrNoHeader {
+		t.Errorf("error mismatch for header gap: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+func mustHeadTd(t *testing.T, odr OdrBackend) *big.Int {
+	td, err := HeadTd(NoOdr, odr)
+	if err != nil {
+		t.Fatalf("failed to retrieve head td: %v", err)
+	}
+	return td
+}
+
+func TestVerifiedHashForNumber(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 10)
+	for _, header := range headers {
+		core.WriteTd(sdb, header.Hash(), header.Number.Uint64(), header.Number)
+	}
+	writeCanonicalHeaders(sdb, headers)
+	odr := NewMemoryOdrBackend(sdb)
+	WriteTrustedCht(odr.Database(), TrustedCht{Number: 1, Root: makeTestCht(sdb, headers[:3])})
+
+	// Without a verified head only the CHT covered blocks can be resolved
+	if _, err := VerifiedHashForNumber(NoOdr, odr, 6); err != ErrNoHead {
+		t.Errorf("error mismatch without head: have %v, want %v", err, ErrNoHead)
+	}
+	// The local header chain holds the blocks after the CHT, with only the head
+	// recorded as canonical
+	for _, header := range headers[3:] {
+		core.WriteHeader(odr.Database(), header)
+	}
+	core.WriteCanonicalHash(odr.Database(), headers[9].Hash(), 10)
+	core.WriteHeadHeaderHash(odr.Database(), headers[9].Hash())
+
+	tests := []struct {
+		number uint64
+		hash   common.Hash
+		err    error
+	}{
+		{2, headers[1].Hash(), nil},  // proven by the CHT
+		{6, headers[5].Hash(), nil},  // linked to the head
+		{10, headers[9].Hash(), nil}, // the head itself
+		{11, common.Hash{}, ErrAheadOfHead},
+	}
+	for i, tt := range tests {
+		hash, err := VerifiedHashForNumber(NoOdr, odr, tt.number)
+		if hash != tt.hash || err != tt.err {
+			t.Errorf("test %d: hash mismatch: have %x, %v, want %x, %v", i, hash, err, tt.hash, tt.err)
+		}
+	}
+	// The resolved mappings are cached
+	for _, n := range []uint64{2, 6, 7, 8, 9} {
+		if hash := core.GetCanonicalHash(odr.Database(), n); hash != headers[n-1].Hash() {
+			t.Errorf("canonical hash %d mismatch: have %x, want %x", n, hash, headers[n-1].Hash())
+		}
+	}
+	// A gap in the local header chain can't be bridged
+	core.DeleteHeader(odr.Database(), headers[3].Hash(), 4)
+	if _, err := VerifiedHashForNumber(NoOdr, odr, 4); err != ErrNoHeader {
+		t.Errorf("error mismatch for unlinked block: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+func TestParanoidProofStore(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	st, _ := trie.New(id.Root, sdb)
+	proof := st.Prove(crypto.Keccak256(acc1Addr[:]))
+
+	// Store a corrupt node under the hash of the last proof node
+	ldb, _ := wtcdb.NewMemDatabase()
+	ldb.Put(crypto.Keccak256(proof[len(proof)-1]), []byte{0xc0})
+
+	for _, paranoid := range []bool{false, true} {
+		config := &Config{ParanoidProofStore: paranoid}
+		req := &AccountRequest{Id: id, Address: acc1Addr, Proof: proof}
+		err := req.StoreResult(BindConfig(ldb, config))
+		if paranoid && err != ErrHashCollision {
+			t.Errorf("error mismatch in paranoid mode: have %v, want %v", err, ErrHashCollision)
+		}
+		if !paranoid && err != nil {
+			t.Errorf("failed to store proof: %v", err)
+		}
+	}
+}
+
+func TestGetHeaderSegment(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	gspec := core.Genesis{Config: params.TestChainConfig}
+	genesis := gspec.MustCommit(sdb)
+	headers := makeHeaderChain(genesis.Header(), 8, sdb, canonicalSeed)
+	writeCanonicalHeaders(sdb, headers)
+
+	odr := NewMemoryOdrBackend(sdb)
+	gspec.MustCommit(odr.Database())
+	engine := ethash.NewFaker()
+	hc, err := core.NewHeaderChain(odr.Database(), gspec.Config, engine, func() bool { return false })
+	if err != nil {
+		t.Fatalf("failed to create header chain: %v", err)
+	}
+	ctx := context.Background()
+	last, err := GetHeaderSegment(ctx, odr, genesis.Header(), 6, EngineVerifier(engine, hc))
+	if err != nil {
+		t.Fatalf("failed to retrieve segment: %v", err)
+	}
+	if last.Hash() != headers[5].Hash() {
+		t.Fatalf("last verified header mismatch: have %d, want %d", last.Number, headers[5].Number)
+	}
+	td := core.GetTd(odr.Database(), genesis.Hash(), 0)
+	for _, header := range headers[:6] {
+		td = new(big.Int).Add(td, header.Difficulty)
+		if have := core.GetTd(odr.Database(), header.Hash(), header.Number.Uint64()); have == nil || have.Cmp(td) != 0 {
+			t.Errorf("header %d: td mismatch: have %v, want %v", header.Number, have, td)
+		}
+	}
+	if getHeader(odr.Database(), headers[6].Hash(), 7) != nil {
+		t.Errorf("header beyond the requested segment stored")
+	}
+
+	// Continuing from the last verified header, a failing consensus check stops
+	// the segment without storing anything
+	errInvalid := errors.New("invalid")
+	reject := func([]*types.Header) error { return errInvalid }
+	if have, err := GetHeaderSegment(ctx, odr, last, 2, reject); err != errInvalid || have != last {
+		t.Errorf("rejected segment: have %d, %v, want %d, %v", have.Number, err, last.Number, errInvalid)
+	}
+	if getHeader(odr.Database(), headers[6].Hash(), 7) != nil {
+		t.Errorf("rejected header stored")
+	}
+
+	// Headers not linked to the anchor are refused
+	req := &HeaderSegmentRequest{Anchor: last.Hash(), Number: 6, Amount: 2, Headers: headers[7:]}
+	if err := req.StoreResult(odr.Database()); err != ErrMalformedResponse {
+		t.Errorf("unlinked segment: error mismatch: have %v, want %v", err, ErrMalformedResponse)
+	}
+	req = &HeaderSegmentRequest{Anchor: headers[7].Hash(), Number: 8, Amount: 1, Headers: headers[7:]}
+	if err := req.StoreResult(odr.Database()); err != ErrUnknownParent {
+		t.Errorf("unknown anchor: error mismatch: have %v, want %v", err, ErrUnknownParent)
+	}
+}
+
+func TestOdrGetAccount(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	account, err := GetAccount(NoOdr, odr, id, acc1Addr)
+	if err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	if account == nil || account.Balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("account mismatch: have %v, want balance %d", account, 1000)
+	}
+	if account, err := GetAccount(NoOdr, odr, id, acc2Addr); account != nil || err != nil {
+		t.Errorf("absent account mismatch: have %v, %v, want nil", account, err)
+	}
+	// Both the existing and absent accounts should be proven locally by now
+	odr.disable = true
+	if account, err := GetAccount(NoOdr, odr, id, acc1Addr); err != nil || account == nil {
+		t.Errorf("local account lookup failed: %v, %v", account, err)
+	}
+	if account, err := GetAccount(NoOdr, odr, id, acc2Addr); err != nil || account != nil {
+		t.Errorf("local absent account lookup failed: %v, %v", account, err)
+	}
+	odr.disable = false
+
+	st, _ := state.New(header.Root, state.NewDatabase(sdb))
+	want := st.StorageTrie(testStateContract).Hash()
+	storage, err := ResolveStorageTrieID(NoOdr, odr, id, testStateContract)
+	if err != nil {
+		t.Fatalf("failed to resolve storage trie: %v", err)
+	}
+	if storage.Root != want || !bytes.Equal(storage.AccKey, crypto.Keccak256(testStateContract[:])) {
+		t.Errorf("storage trie id mismatch: have %x/%x, want %x", storage.Root, storage.AccKey, want)
+	}
+	if storage, _ := ResolveStorageTrieID(NoOdr, odr, id, acc2Addr); storage.Root != types.EmptyRootHash {
+		t.Errorf("absent account storage root mismatch: have %x, want %x", storage.Root, types.EmptyRootHash)
+	}
+}
+
+// forgedStorageOdr serves storage trie proofs from a forged storage trie.
+type forgedStorageOdr struct {
+	*testOdr
+	forged common.Hash
+}
+
+func (odr *forgedStorageOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if req, ok := req.(*TrieRequest); ok && req.Id.AccKey != nil {
+		t, _ := trie.New(odr.forged, odr.sdb)
+		req.Proof = t.Prove(req.Key)
+		return req.StoreResult(StoreDatabase(odr.ldb, req))
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestVerifiedStorageRead(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	value, err := VerifiedStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(2))
+	if err != nil {
+		t.Fatalf("failed to read storage slot: %v", err)
+	}
+	if !bytes.Equal(value, []byte{3}) {
+		t.Errorf("slot content mismatch: have %x, want %x", value, []byte{3})
+	}
+	if value, err := VerifiedStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(testStateSlots)); err != nil || value != nil {
+		t.Errorf("missing slot mismatch: have %x, %v, want nil", value, err)
+	}
+	if value, err := VerifiedStorageRead(NoOdr, odr, id, acc2Addr, testStateSlot(2)); err != nil || value != nil {
+		t.Errorf("missing account mismatch: have %x, %v, want nil", value, err)
+	}
+
+	// A storage proof not leading to the verified storage root is rejected
+	slot := testStateSlot(2)
+	storage, _ := trie.New(common.Hash{}, sdb)
+	storage.Update(crypto.Keccak256(slot[:]), []byte{100})
+	root, _ := storage.CommitTo(sdb)
+	fdb, _ := wtcdb.NewMemDatabase()
+	forged := &forgedStorageOdr{testOdr: &testOdr{sdb: sdb, ldb: fdb}, forged: root}
+	if _, err := VerifiedStorageRead(NoOdr, forged, id, testStateContract, testStateSlot(2)); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for forged storage proof: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// A failing account retrieval fails the read
+	ddb, _ := wtcdb.NewMemDatabase()
+	disabled := &testOdr{sdb: sdb, ldb: ddb, disable: true}
+	if _, err := VerifiedStorageRead(NoOdr, disabled, id, testStateContract, testStateSlot(2)); err != ErrOdrDisabled {
+		t.Errorf("error mismatch for failing account retrieval: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
+
+func TestStorageAt(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	tests := []struct {
+		addr common.Address
+		slot common.Hash
+		want common.Hash
+	}{
+		{testStateContract, testStateSlot(2), common.BigToHash(big.NewInt(3))},
+		{testStateContract, testStateSlot(testStateSlots), common.Hash{}},
+		{acc2Addr, testStateSlot(2), common.Hash{}},
+	}
+	for i, tt := range tests {
+		if value, err := StorageAt(NoOdr, odr, id, tt.addr, tt.slot); err != nil || value != tt.want {
+			t.Errorf("test %d: slot mismatch: have %x, %v, want %x", i, value, err, tt.want)
+		}
+	}
+	// A failing retrieval must not be mistaken for an unset slot
+	ddb, _ := wtcdb.NewMemDatabase()
+	disabled := &testOdr{sdb: sdb, ldb: ddb, disable: true}
+	if _, err := StorageAt(NoOdr, disabled, id, testStateContract, testStateSlot(testStateSlots)); err != ErrOdrDisabled {
+		t.Errorf("error mismatch for failing retrieval: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
+
+func TestBalanceAndNonce(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	balance, nonce, err := BalanceAndNonce(NoOdr, odr, id, testBankAddress)
+	if err != nil {
+		t.Fatalf("failed to retrieve bank account: %v", err)
+	}
+	if balance.Cmp(testBankFunds) != 0 || nonce != 3 {
+		t.Errorf("bank account mismatch: have %v/%d, want %v/%d", balance, nonce, testBankFunds, 3)
+	}
+	balance, nonce, err = BalanceAndNonce(NoOdr, odr, id, acc2Addr)
+	if err != nil {
+		t.Fatalf("failed to retrieve absent account: %v", err)
+	}
+	if balance.Sign() != 0 || nonce != 0 {
+		t.Errorf("absent account mismatch: have %v/%d, want 0/0", balance, nonce)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	if nonce, err := Nonce(NoOdr, odr, id, testBankAddress); err != nil || nonce != 3 {
+		t.Errorf("bank nonce mismatch: have %d, %v, want 3", nonce, err)
+	}
+	if nonce, err := Nonce(NoOdr, odr, id, acc2Addr); err != nil || nonce != 0 {
+		t.Errorf("new account nonce mismatch: have %d, %v, want 0", nonce, err)
+	}
+	// A failing retrieval must not be mistaken for a new account
+	ddb, _ := wtcdb.NewMemDatabase()
+	if _, err := Nonce(NoOdr, &testOdr{sdb: sdb, ldb: ddb, disable: true}, id, acc1Addr); err != ErrOdrDisabled {
+		t.Errorf("error mismatch for failing retrieval: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
+
+func TestOdrGetStorageRoot(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+
+	// Create a block changing the contract storage and one changing an account only
+	st, _ := state.New(header.Root, state.NewDatabase(sdb))
+	st.SetState(testStateContract, testStateSlot(0), common.BigToHash(big.NewInt(100)))
+	changed, _ := st.CommitTo(sdb, true)
+	st, _ = state.New(header.Root, state.NewDatabase(sdb))
+	st.SetBalance(acc1Addr, big.NewInt(2000), new(big.Int), new(big.Int))
+	unchanged, _ := st.CommitTo(sdb, true)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	root := func(stateRoot common.Hash, addr common.Address) common.Hash {
+		id := StateTrieID(&types.Header{Number: big.NewInt(1), Root: stateRoot})
+		r := &StorageRootRequest{StateId: id, Address: addr}
+		if err := odr.Retrieve(NoOdr, r); err != nil {
+			t.Fatalf("failed to retrieve storage root: %v", err)
+		}
+		if local, err := GetStorageRoot(NoOdr, odr, id, addr); err != nil || local != r.Root {
+			t.Errorf("local storage root mismatch: have %x, %v, want %x", local, err, r.Root)
+		}
+		return r.Root
+	}
+	base := root(header.Root, testStateContract)
+	if base == types.EmptyRootHash {
+		t.Fatalf("contract storage root is empty")
+	}
+	if root(changed, testStateContract) == base {
+		t.Errorf("storage change not detected")
+	}
+	if root(unchanged, testStateContract) != base {
+		t.Errorf("storage change detected for unchanged storage")
+	}
+	if root(header.Root, acc2Addr) != types.EmptyRootHash {
+		t.Errorf("absent account storage root not empty")
+	}
+}
+
+func TestIsContract(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	tests := []struct {
+		addr     common.Address
+		contract bool
+	}{
+		{testStateContract, true},
+		{acc1Addr, false},
+		{common.HexToAddress("c3"), false}, // non-existent
+	}
+	for i, tt := range tests {
+		contract, err := IsContract(NoOdr, odr, id, tt.addr)
+		if err != nil {
+			t.Fatalf("test %d: failed to check account: %v", i, err)
+		}
+		if contract != tt.contract {
+			t.Errorf("test %d: contract mismatch: have %v, want %v", i, contract, tt.contract)
+		}
+	}
+	// Without the account proof nothing is asserted
+	ldb, _ = wtcdb.NewMemDatabase()
+	odr = &testOdr{sdb: sdb, ldb: ldb, disable: true}
+	if _, err := IsContract(NoOdr, odr, id, testStateContract); err != ErrOdrDisabled {
+		t.Errorf("error mismatch without backend: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
+
+func TestGetCodeHash(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+
+	// Deploy a clone of the test contract and a contract with other code
+	clone, other := common.HexToAddress("c1"), common.HexToAddress("c2")
+	st, _ := state.New(header.Root, state.NewDatabase(sdb))
+	st.SetCode(clone, testContractCode)
+	st.SetCode(other, []byte{0x60, 0x01, 0x00})
+	root, _ := st.CommitTo(sdb, true)
+	id := StateTrieID(&types.Header{Number: big.NewInt(1), Root: root})
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	hash := func(addr common.Address) common.Hash {
+		r := &CodeHashRequest{StateId: id, Address: addr}
+		if err := odr.Retrieve(NoOdr, r); err != nil {
+			t.Fatalf("failed to retrieve code hash: %v", err)
+		}
+		if local, err := GetCodeHash(NoOdr, odr, id, addr); err != nil || local != r.CodeHash {
+			t.Errorf("local code hash mismatch: have %x, %v, want %x", local, err, r.CodeHash)
+		}
+		return r.CodeHash
+	}
+	if have, want := hash(testStateContract), crypto.Keccak256Hash(testContractCode); have != want {
+		t.Errorf("contract code hash mismatch: have %x, want %x", have, want)
+	}
+	if hash(clone) != hash(testStateContract) {
+		t.Errorf("identical code hashes differ")
+	}
+	if hash(other) == hash(testStateContract) {
+		t.Errorf("different code hashes equal")
+	}
+	if have := hash(acc1Addr); have != sha3_nil {
+		t.Errorf("account code hash mismatch: have %x, want %x", have, sha3_nil)
+	}
+	if have := hash(common.HexToAddress("c3")); have != sha3_nil {
+		t.Errorf("absent account code hash mismatch: have %x, want %x", have, sha3_nil)
+	}
+	// The code hash is only accepted with the account proof
+	stateTrie, _ := trie.New(root, sdb)
+	key := addressHash(other)
+	proof := stateTrie.Prove(key[:])
+	db, _ := wtcdb.NewMemDatabase()
+	r := &CodeHashRequest{StateId: id, Address: other, Proof: proof[:len(proof)-1]}
+	if err := r.StoreResult(db); err == nil {
+		t.Errorf("truncated proof accepted")
+	}
+}
+
+// sizelessOdr is a test backend unable to serve size-only code requests.
+type sizelessOdr struct {
+	*testOdr
+	sizeReqs int
+}
+
+func (odr *sizelessOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if _, ok := req.(*CodeSizeRequest); ok {
+		odr.sizeReqs++
+		return ErrUnsupportedRequest
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+func TestGetCodeSize(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	code := bytes.Repeat([]byte{0x5b}, 100)
+	hash := crypto.Keccak256Hash(code)
+	sdb.Put(hash[:], code)
+	id := &TrieID{}
+
+	// Size-only retrieval shouldn't store the code
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	if size, err := GetCodeSize(NoOdr, odr, id, hash); err != nil || size != 100 {
+		t.Errorf("size-only retrieval mismatch: have %d, %v, want %d", size, err, 100)
+	}
+	if ok, _ := ldb.Has(hash[:]); ok {
+		t.Errorf("code stored by size-only retrieval")
+	}
+	// Fallback retrieval should make the code locally available
+	ldb, _ = wtcdb.NewMemDatabase()
+	fallback := &sizelessOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+	if size, err := GetCodeSize(NoOdr, fallback, id, hash); err != nil || size != 100 {
+		t.Errorf("fallback retrieval mismatch: have %d, %v, want %d", size, err, 100)
+	}
+	if data, _ := ldb.Get(hash[:]); !bytes.Equal(data, code) {
+		t.Errorf("code not stored by fallback retrieval")
+	}
+	fallback.testOdr.disable = true
+	if size, err := GetCodeSize(NoOdr, fallback, id, hash); err != nil || size != 100 {
+		t.Errorf("local size mismatch: have %d, %v, want %d", size, err, 100)
+	}
+	if size, err := GetCodeSize(NoOdr, fallback, id, sha3_nil); err != nil || size != 0 {
+		t.Errorf("empty code size mismatch: have %d, %v, want %d", size, err, 0)
+	}
+	if fallback.sizeReqs != 1 {
+		t.Errorf("size request count mismatch: have %d, want %d", fallback.sizeReqs, 1)
+	}
+}
+
+func TestHeaderByHashRequestCht(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 8)
+	root := makeTestCht(db, headers[:3])
+	cht, _ := trie.New(root, db)
+	forged := newTestUncle(headers[0], "forged")
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	tests := []struct {
+		hash   common.Hash
+		header *types.Header
+		err    error
+	}{
+		{headers[1].Hash(), headers[1], nil},
+		{headers[1].Hash(), headers[2], ErrMalformedResponse}, // header for another hash
+		{forged.Hash(), forged, ErrMalformedResponse},         // non-canonical header
+	}
+	for i, tt := range tests {
+		req := &HeaderByHashRequest{
+			Hash:    tt.hash,
+			ChtNum:  1,
+			ChtRoot: root,
+			Header:  tt.header,
+			Proof:   cht.Prove(chtKey(tt.header.Number.Uint64())),
+		}
+		if err := req.StoreResult(ldb); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if hash := core.GetCanonicalHash(ldb, 2); hash != headers[1].Hash() {
+		t.Errorf("canonical hash mismatch: have %x, want %x", hash, headers[1].Hash())
+	}
+	if header := core.GetHeader(ldb, forged.Hash(), 2); header != nil {
+		t.Errorf("forged header stored")
+	}
+}
+
+func TestGetStateRoot(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 6)
+	for _, header := range headers {
+		core.WriteHeader(sdb, header)
+		core.WriteTd(sdb, header.Hash(), header.Number.Uint64(), header.Number)
+		core.WriteCanonicalHash(sdb, header.Hash(), header.Number.Uint64())
+	}
+	odr := NewMemoryOdrBackend(sdb)
+	WriteTrustedCht(odr.Database(), TrustedCht{Number: 1, Root: makeTestCht(sdb, headers[:3])})
+
+	// A claimed hash not matching the verified header is rejected
+	if _, err := GetStateRoot(NoOdr, odr, 2, headers[2].Hash()); err != ErrBlockHashMismatch {
+		t.Errorf("error mismatch for wrong hash: have %v, want %v", err, ErrBlockHashMismatch)
+	}
+	odr = NewMemoryOdrBackend(sdb)
+	WriteTrustedCht(odr.Database(), TrustedCht{Number: 1, Root: makeTestCht(sdb, headers[:3])})
+	root, err := GetStateRoot(NoOdr, odr, 2, headers[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve state root: %v", err)
+	}
+	if root != headers[1].Root {
+		t.Errorf("state root mismatch: have %x, want %x", root, headers[1].Root)
+	}
+	if hash := core.GetCanonicalHash(odr.Database(), 2); hash != headers[1].Hash() {
+		t.Errorf("canonical hash mismatch: have %x, want %x", hash, headers[1].Hash())
+	}
+	// Locally known blocks are checked the same way
+	if _, err := GetStateRoot(NoOdr, odr, 2, headers[2].Hash()); err != ErrBlockHashMismatch {
+		t.Errorf("error mismatch for wrong local hash: have %v, want %v", err, ErrBlockHashMismatch)
+	}
+	if _, err := GetStateRoot(NoOdr, odr, 5, headers[4].Hash()); err != ErrNoTrustedCht {
+		t.Errorf("error mismatch beyond the CHT: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	// A canonical hash without its header is reported instead of crashing
+	core.DeleteHeader(odr.Database(), headers[1].Hash(), 2)
+	if _, err := GetStateRoot(NoOdr, odr, 2, headers[1].Hash()); err != ErrNoHeader {
+		t.Errorf("error mismatch for missing header: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+func TestGetBlockBloom(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 2)
+	headers[1].Bloom = types.BytesToBloom(types.LogsBloom([]*types.Log{{Address: testContractAddr}}).Bytes())
+	headers = append(headers, makeTestHeaders(headers[1], 4)...)
+	for _, header := range headers {
+		core.WriteHeader(sdb, header)
+		core.WriteTd(sdb, header.Hash(), header.Number.Uint64(), header.Number)
+		core.WriteCanonicalHash(sdb, header.Hash(), header.Number.Uint64())
+	}
+	chtRoot := makeTestCht(sdb, headers[:3])
+
+	odr := NewMemoryOdrBackend(sdb)
+	WriteTrustedCht(odr.Database(), TrustedCht{Number: 1, Root: chtRoot})
+	bloom, err := GetBlockBloom(NoOdr, odr, 2, headers[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve bloom: %v", err)
+	}
+	if bloom != headers[1].Bloom || !types.BloomLookup(bloom, testContractAddr) {
+		t.Errorf("bloom mismatch: have %x, want %x", bloom, headers[1].Bloom)
+	}
+	if _, err := GetBlockBloom(NoOdr, odr, 2, headers[2].Hash()); err != ErrBlockHashMismatch {
+		t.Errorf("error mismatch for wrong hash: have %v, want %v", err, ErrBlockHashMismatch)
+	}
+	if _, err := GetBlockBloom(NoOdr, odr, 5, headers[4].Hash()); err != ErrNoTrustedCht {
+		t.Errorf("error mismatch beyond the CHT: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	core.DeleteHeader(odr.Database(), headers[1].Hash(), 2)
+	if _, err := GetBlockBloom(NoOdr, odr, 2, headers[1].Hash()); err != ErrNoHeader {
+		t.Errorf("error mismatch for missing header: have %v, want %v", err, ErrNoHeader)
+	}
+	// A bloom asserted by the server apart from the proven header is rejected
+	req := &BlockBloomRequest{Number: 2, Hash: headers[1].Hash(), ChtNum: 1, ChtRoot: chtRoot}
+	if err := answerRequest(sdb, req); err != nil {
+		t.Fatalf("failed to answer request: %v", err)
+	}
+	req.Header = types.CopyHeader(req.Header)
+	req.Header.Bloom = types.Bloom{}
+	ldb, _ := wtcdb.NewMemDatabase()
+	if err := req.StoreResult(ldb); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for forged bloom: have %v, want %v", err, ErrMalformedResponse)
+	}
+	if req.Bloom != (types.Bloom{}) {
+		t.Errorf("forged bloom accepted: %x", req.Bloom)
+	}
+}
+
+func TestHeaderByHashRequestHead(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 4)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	req := &HeaderByHashRequest{Hash: headers[3].Hash(), Header: headers[3]}
+	if err := req.StoreResult(ldb); err != ErrUnknownParent {
+		t.Fatalf("error mismatch for unlinked header: have %v, want %v", err, ErrUnknownParent)
+	}
+	core.WriteHeader(ldb, headers[2])
+	core.WriteTd(ldb, headers[2].Hash(), 3, big.NewInt(100))
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store linked header: %v", err)
+	}
+	if header := core.GetHeader(ldb, headers[3].Hash(), 4); header == nil || header.Hash() != headers[3].Hash() {
+		t.Errorf("header not stored")
+	}
+	if td, want := core.GetTd(ldb, headers[3].Hash(), 4), new(big.Int).Add(big.NewInt(100), headers[3].Difficulty); td == nil || td.Cmp(want) != 0 {
+		t.Errorf("td mismatch: have %v, want %v", td, want)
+	}
+}
+
+func TestGetHeadersByHash(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 6)
+	writeCanonicalHeaders(sdb, headers)
+	odr := NewMemoryOdrBackend(sdb)
+	WriteTrustedCht(odr.Database(), TrustedCht{Number: 1, Root: makeTestCht(sdb, headers[:3])})
+	core.WriteHeader(odr.Database(), headers[3])
+
+	// A header inside the CHT, one linking to a local header and one linking to
+	// a header of the same batch, ahead of it
+	hashes := []common.Hash{headers[1].Hash(), headers[5].Hash(), headers[4].Hash(), common.HexToHash("0bad"), headers[3].Hash()}
+	have, errs := GetHeadersByHash(NoOdr, odr, hashes)
+	for i, want := range []*types.Header{headers[1], headers[5], headers[4], nil, headers[3]} {
+		if want == nil {
+			if errs[i] == nil {
+				t.Errorf("header %d: unknown header retrieved", i)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("header %d: failed to retrieve: %v", i, errs[i])
+		} else if have[i].Hash() != want.Hash() {
+			t.Errorf("header %d: hash mismatch: have %x, want %x", i, have[i].Hash(), want.Hash())
+		}
+	}
+	db := odr.Database()
+	for _, header := range []*types.Header{headers[1], headers[4], headers[5]} {
+		if getHeader(db, header.Hash(), header.Number.Uint64()) == nil {
+			t.Errorf("header %d not stored", header.Number)
+		}
+	}
+	if hash := core.GetCanonicalHash(db, 2); hash != headers[1].Hash() {
+		t.Errorf("canonical hash mismatch: have %x, want %x", hash, headers[1].Hash())
+	}
+}
+
+// makeTestReceipts creates a receipt for each transaction, each of them
+// emitting a single log with a topic derived from its index.
+func makeTestReceipts(txs []*types.Transaction) types.Receipts {
+	receipts := make(types.Receipts, len(txs))
+	gas := new(big.Int)
+	for i, tx := range txs {
+		gas.Add(gas, bigTxGas)
+		receipt := types.NewReceipt(nil, false, new(big.Int).Set(gas))
+		receipt.TxHash = tx.Hash()
+		receipt.GasUsed = new(big.Int).Set(bigTxGas)
+		receipt.Logs = []*types.Log{{
+			Address: testStateContract,
+			Topics:  []common.Hash{common.BigToHash(big.NewInt(int64(i)))},
+			Data:    []byte{byte(i)},
+			TxHash:  tx.Hash(),
+			TxIndex: uint(i),
+			Index:   uint(i),
+		}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts[i] = receipt
+	}
+	return receipts
+}
+
+func TestReceiptsRequestBloom(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+
+	// Without a local header only the receipt blooms can be checked
+	ldb, _ := wtcdb.NewMemDatabase()
+	req := &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: receipts}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("valid receipts rejected: %v", err)
+	}
+	// Stripping the logs of a receipt must be detected
+	stripped := makeTestReceipts(txs)
+	stripped[1].Logs = nil
+	req = &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: stripped}
+	if err := req.StoreResult(ldb); err != ErrBloomMismatch {
+		t.Fatalf("stripped logs error mismatch: have %v, want %v", err, ErrBloomMismatch)
+	}
+	// Dropping a whole receipt keeps receipt blooms consistent but not the block's
+	core.WriteHeader(ldb, block.Header())
+	req = &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: receipts[:2]}
+	if err := req.StoreResult(ldb); err != ErrBloomMismatch {
+		t.Fatalf("truncated receipts error mismatch: have %v, want %v", err, ErrBloomMismatch)
+	}
+	req = &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: receipts}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("valid receipts rejected with header: %v", err)
+	}
+}
+
+func TestReceiptsRequestGasUsed(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+
+	// Receipts consistent in their logs but not in the gas they used
+	forged := makeTestReceipts(txs)
+	forged[2].CumulativeGasUsed = new(big.Int).Add(forged[2].CumulativeGasUsed, common.Big1)
+	req := &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: forged}
+	if err := req.StoreResult(ldb); err != ErrGasUsedMismatch {
+		t.Fatalf("error mismatch for forged gas: have %v, want %v", err, ErrGasUsedMismatch)
+	}
+	if core.GetBlockReceipts(ldb, block.Hash(), block.NumberU64()) != nil {
+		t.Errorf("forged receipts stored")
+	}
+	req = &ReceiptsRequest{Hash: block.Hash(), Number: block.NumberU64(), Receipts: receipts}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("valid receipts rejected: %v", err)
+	}
+}
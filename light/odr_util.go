@@ -24,6 +24,7 @@ import (
 
 	"github.com/wtc/go-wtc/common"
 	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
 	"github.com/wtc/go-wtc/core/types"
 	"github.com/wtc/go-wtc/crypto"
 	"github.com/wtc/go-wtc/wtcdb"
@@ -35,6 +36,28 @@ var sha3_nil = crypto.Keccak256Hash(nil)
 var (
 	ErrNoTrustedCht = errors.New("No trusted canonical hash trie")
 	ErrNoHeader     = errors.New("Header not found")
+	ErrNoBody       = errors.New("Block body not found")
+
+	// ErrNoReceipts is returned if the receipts of a block aren't known locally.
+	ErrNoReceipts = errors.New("block receipts not found")
+
+	// ErrInvalidRange is returned if a block range is empty or longer than
+	// MaxCanonicalHashRange.
+	ErrInvalidRange = errors.New("invalid block range")
+
+	// ErrNoHead is returned if the locally verified chain head is unknown.
+	ErrNoHead = errors.New("chain head unknown")
+
+	// ErrAheadOfHead is returned if a block is newer than the local chain head.
+	ErrAheadOfHead = errors.New("block ahead of chain head")
+
+	// ErrTdMismatch is returned if a locally stored total difficulty doesn't
+	// match the one accumulated along the verified header chain.
+	ErrTdMismatch = errors.New("total difficulty mismatch")
+
+	// ErrBaseFeeNotApplicable is returned by BaseFee for a head without a base
+	// fee, i.e. one predating an EIP-1559 style fee market.
+	ErrBaseFeeNotApplicable = errors.New("base fee not applicable")
 
 	ChtFrequency     = uint64(4096)
 	ChtConfirmations = uint64(2048)
@@ -60,13 +83,19 @@ func GetTrustedCht(db wtcdb.Database) TrustedCht {
 	return res
 }
 
+// WriteTrustedCht stores the trusted CHT. If it advances to a newer section, the
+// superseded one is remembered for the Config.ChtGraceWindow.
 func WriteTrustedCht(db wtcdb.Database, cht TrustedCht) {
+	if old := GetTrustedCht(db); old.Number < cht.Number && old.Root != (common.Hash{}) {
+		writePreviousCht(db, old, clock.Now())
+	}
 	data, _ := rlp.EncodeToBytes(cht)
 	db.Put(trustedChtKey, data)
 }
 
 func DeleteTrustedCht(db wtcdb.Database) {
 	db.Delete(trustedChtKey)
+	db.Delete(previousChtKey)
 }
 
 func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*types.Header, error) {
@@ -74,7 +103,7 @@ func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*typ
 	hash := core.GetCanonicalHash(db, number)
 	if (hash != common.Hash{}) {
 		// if there is a canonical hash, there is a header too
-		header := core.GetHeader(db, hash, number)
+		header := getHeader(db, hash, number)
 		if header == nil {
 			panic("Canonical hash present but header not found")
 		}
@@ -94,6 +123,57 @@ func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*typ
 	}
 }
 
+// GetHeaderByHash retrieves the header with the given hash, verifying it against
+// the trusted CHT or the local chain if it has to be fetched from the network.
+func GetHeaderByHash(ctx context.Context, odr OdrBackend, hash common.Hash) (*types.Header, error) {
+	db := odr.Database()
+	if header := getHeader(db, hash, core.GetBlockNumber(db, hash)); header != nil {
+		return header, nil
+	}
+	cht := GetTrustedCht(db)
+	r := &HeaderByHashRequest{Hash: hash, ChtNum: cht.Number, ChtRoot: cht.Root}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Header, nil
+}
+
+// GetHeadersByHash retrieves the headers with the given hashes, fetching the ones
+// not known locally in a single batch. Failures are reported per header.
+func GetHeadersByHash(ctx context.Context, odr OdrBackend, hashes []common.Hash) ([]*types.Header, []error) {
+	var (
+		db      = odr.Database()
+		headers = make([]*types.Header, len(hashes))
+		errs    = make([]error, len(hashes))
+		missing []int
+	)
+	for i, hash := range hashes {
+		if headers[i] = getHeader(db, hash, core.GetBlockNumber(db, hash)); headers[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return headers, errs
+	}
+	cht := GetTrustedCht(db)
+	r := &BatchHeaderRequest{Hashes: make([]common.Hash, len(missing)), ChtNum: cht.Number, ChtRoot: cht.Root}
+	for j, i := range missing {
+		r.Hashes[j] = hashes[i]
+	}
+	err := odr.Retrieve(ctx, r)
+	for j, i := range missing {
+		switch {
+		case j < len(r.Errs) && r.Errs[j] != nil:
+			errs[i] = r.Errs[j]
+		case err != nil:
+			errs[i] = err
+		default:
+			headers[i] = r.Headers[j]
+		}
+	}
+	return headers, errs
+}
+
 func GetCanonicalHash(ctx context.Context, odr OdrBackend, number uint64) (common.Hash, error) {
 	hash := core.GetCanonicalHash(odr.Database(), number)
 	if (hash != common.Hash{}) {
@@ -106,9 +186,450 @@ func GetCanonicalHash(ctx context.Context, odr OdrBackend, number uint64) (commo
 	return common.Hash{}, err
 }
 
+// VerifiedHashForNumber resolves the hash of the canonical block with the given
+// number. Blocks covered by the trusted CHT are proven by it, newer ones are
+// resolved by following the parent hashes down from the verified local head.
+// The resolved hashes are cached as canonical ones. ErrAheadOfHead is returned
+// for blocks newer than the head.
+func VerifiedHashForNumber(ctx context.Context, odr OdrBackend, number uint64) (common.Hash, error) {
+	db := odr.Database()
+	head := verifiedHead(db)
+	if head != nil && number > head.Number.Uint64() {
+		return common.Hash{}, ErrAheadOfHead
+	}
+	if hash := core.GetCanonicalHash(db, number); hash != (common.Hash{}) {
+		return hash, nil
+	}
+	if cht := GetTrustedCht(db); number < cht.Number*ChtFrequency {
+		r := &ChtRequest{ChtRoot: cht.Root, ChtNum: cht.Number, BlockNum: number}
+		if err := odr.Retrieve(ctx, r); err != nil {
+			return common.Hash{}, err
+		}
+		return r.Header.Hash(), nil
+	}
+	if head == nil {
+		return common.Hash{}, ErrNoHead
+	}
+	for header := head; header.Number.Uint64() > number; {
+		parent := getHeader(db, header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return common.Hash{}, ErrNoHeader
+		}
+		if err := core.WriteCanonicalHash(db, header.ParentHash, parent.Number.Uint64()); err != nil {
+			return common.Hash{}, err
+		}
+		header = parent
+	}
+	return core.GetCanonicalHash(db, number), nil
+}
+
+// verifiedHead returns the local head header if it's known and canonical.
+func verifiedHead(db wtcdb.Database) *types.Header {
+	hash := core.GetHeadHeaderHash(db)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	head := getHeader(db, hash, core.GetBlockNumber(db, hash))
+	if head == nil || core.GetCanonicalHash(db, head.Number.Uint64()) != hash {
+		return nil
+	}
+	return head
+}
+
+// HeadTd returns the verified total difficulty of the local head. A head covered
+// by the trusted CHT has its total difficulty proven by it, a newer one gets the
+// difficulties of the headers above the last CHT covered block (or the genesis)
+// added to the proven total difficulty of that block. A stored total difficulty
+// of the head disagreeing with the result fails with ErrTdMismatch.
+func HeadTd(ctx context.Context, odr OdrBackend) (*big.Int, error) {
+	db := odr.Database()
+	head := verifiedHead(db)
+	if head == nil {
+		return nil, ErrNoHead
+	}
+	number := head.Number.Uint64()
+	cht := GetTrustedCht(db)
+	if number < cht.Number*ChtFrequency {
+		return chtTd(ctx, odr, cht, number, head.Hash())
+	}
+	var (
+		checkpoint uint64 // last block with a known total difficulty
+		td         = new(big.Int).Set(head.Difficulty)
+	)
+	if cht.Number > 0 {
+		checkpoint = cht.Number*ChtFrequency - 1
+	}
+	header := head
+	for header.Number.Uint64() > checkpoint+1 {
+		if header = getHeader(db, header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return nil, ErrNoHeader
+		}
+		td.Add(td, header.Difficulty)
+	}
+	switch {
+	case cht.Number > 0:
+		base, err := chtTd(ctx, odr, cht, checkpoint, header.ParentHash)
+		if err != nil {
+			return nil, err
+		}
+		td.Add(td, base)
+	case number > 0:
+		genesis := getHeader(db, header.ParentHash, 0)
+		if genesis == nil {
+			return nil, ErrNoHeader
+		}
+		td.Add(td, genesis.Difficulty)
+	}
+	if stored := core.GetTd(db, head.Hash(), number); stored != nil && stored.Cmp(td) != 0 {
+		return nil, ErrTdMismatch
+	}
+	if err := core.WriteTd(db, head.Hash(), number, td); err != nil {
+		return nil, err
+	}
+	return td, nil
+}
+
+// BaseFee returns the base fee of the locally verified head, which can't be
+// spoofed by a peer the way an advertised head could. Headers of this chain have
+// no base fee field, as it has no EIP-1559 style fee market, so any verified head
+// is reported as pre-fork with ErrBaseFeeNotApplicable; callers should fall back
+// to gas price based estimation.
+func BaseFee(ctx context.Context, odr OdrBackend) (*big.Int, error) {
+	if head := verifiedHead(odr.Database()); head == nil {
+		return nil, ErrNoHead
+	}
+	return nil, ErrBaseFeeNotApplicable
+}
+
+// chtTd retrieves the total difficulty of the canonical block with the given
+// number from the CHT, checking that its hash is the expected one.
+func chtTd(ctx context.Context, odr OdrBackend, cht TrustedCht, number uint64, hash common.Hash) (*big.Int, error) {
+	r := &ChtRequest{ChtRoot: cht.Root, ChtNum: cht.Number, BlockNum: number}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	if r.Header.Hash() != hash {
+		return nil, ErrBlockHashMismatch
+	}
+	return r.Td, nil
+}
+
+// MaxCanonicalHashRange is the maximum number of blocks CanonicalHashes resolves
+// at once.
+const MaxCanonicalHashRange = 4096
+
+// CanonicalHashes reads the locally known canonical hashes of the blocks from
+// from to to, inclusive. Hashes of blocks not known locally are left empty and
+// their numbers are returned separately, so they can be retrieved by ChtRequest.
+// No retrieval is done.
+func CanonicalHashes(db wtcdb.Database, from, to uint64) ([]common.Hash, []uint64, error) {
+	if from > to || to-from >= MaxCanonicalHashRange {
+		return nil, nil, ErrInvalidRange
+	}
+	var (
+		hashes  = make([]common.Hash, to-from+1)
+		missing []uint64
+	)
+	for i := range hashes {
+		number := from + uint64(i)
+		if hashes[i] = core.GetCanonicalHash(db, number); hashes[i] == (common.Hash{}) {
+			missing = append(missing, number)
+		}
+	}
+	return hashes, missing, nil
+}
+
+// GetHeadersByNumber retrieves the canonical headers of the blocks from from to
+// to, inclusive, fetching the ones not known locally through the trusted CHT.
+// Progress is reported per header to progress, which may be nil.
+func GetHeadersByNumber(ctx context.Context, odr OdrBackend, from, to uint64, progress Progress) (headers []*types.Header, err error) {
+	if from > to || to-from >= MaxCanonicalHashRange {
+		return nil, ErrInvalidRange
+	}
+	progress = progressOrDefault(progress)
+	progress.OnStart(int(to - from + 1))
+	defer func() { progress.OnDone(err) }()
+
+	headers = make([]*types.Header, to-from+1)
+	for i := range headers {
+		if headers[i], err = GetHeaderByNumber(ctx, odr, from+uint64(i)); err != nil {
+			return nil, err
+		}
+		progress.OnAdvance(i + 1)
+	}
+	return headers, nil
+}
+
+// GetHeaderSegment retrieves up to count headers following anchor, which must be
+// available locally, trusting them through their linkage to the anchor instead
+// of a CHT. The headers are retrieved in batches of at most MaxHeaderSegment and
+// checked by verify if it's not nil. The last verified header is returned even
+// if the retrieval fails, the anchor itself if nothing could be verified.
+func GetHeaderSegment(ctx context.Context, odr OdrBackend, anchor *types.Header, count uint64, verify HeaderVerifier) (*types.Header, error) {
+	last := anchor
+	for count > 0 {
+		amount := count
+		if amount > MaxHeaderSegment {
+			amount = MaxHeaderSegment
+		}
+		r := &HeaderSegmentRequest{Anchor: last.Hash(), Number: last.Number.Uint64(), Amount: amount, Verify: verify}
+		if err := odr.Retrieve(ctx, r); err != nil {
+			return last, err
+		}
+		last = r.Headers[len(r.Headers)-1]
+		count -= uint64(len(r.Headers))
+	}
+	return last, nil
+}
+
+// Confirmations returns the number of confirmations of the block with the given
+// number, counting the block itself. The head is the one the local header chain
+// verified and recorded in db, never one asserted by a peer.
+func Confirmations(db wtcdb.Database, number uint64) (uint64, error) {
+	head := verifiedHead(db)
+	if head == nil {
+		return 0, ErrNoHead
+	}
+	if number > head.Number.Uint64() {
+		return 0, ErrAheadOfHead
+	}
+	return head.Number.Uint64() - number + 1, nil
+}
+
+// GetStateRoot retrieves the state root of the canonical block with the given
+// number, verified through the trusted CHT unless the header is known locally.
+// ErrBlockHashMismatch is returned if the block doesn't have the given hash.
+func GetStateRoot(ctx context.Context, odr OdrBackend, number uint64, hash common.Hash) (common.Hash, error) {
+	db := odr.Database()
+	if canonical := core.GetCanonicalHash(db, number); canonical != (common.Hash{}) {
+		if canonical != hash {
+			return common.Hash{}, ErrBlockHashMismatch
+		}
+		header := getHeader(db, hash, number)
+		if header == nil {
+			return common.Hash{}, ErrNoHeader
+		}
+		return header.Root, nil
+	}
+	cht := GetTrustedCht(db)
+	if number >= cht.Number*ChtFrequency {
+		return common.Hash{}, ErrNoTrustedCht
+	}
+	r := &StateRootRequest{Number: number, Hash: hash, ChtNum: cht.Number, ChtRoot: cht.Root}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return common.Hash{}, err
+	}
+	return r.Root, nil
+}
+
+// GetBlockBloom retrieves the logs bloom of the canonical block with the given
+// number, verified through the trusted CHT unless the header is known locally.
+// It can be checked with types.BloomLookup before retrieving the receipts of the
+// block. ErrBlockHashMismatch is returned if the block doesn't have the given hash.
+func GetBlockBloom(ctx context.Context, odr OdrBackend, number uint64, hash common.Hash) (types.Bloom, error) {
+	db := odr.Database()
+	if canonical := core.GetCanonicalHash(db, number); canonical != (common.Hash{}) {
+		if canonical != hash {
+			return types.Bloom{}, ErrBlockHashMismatch
+		}
+		header := getHeader(db, hash, number)
+		if header == nil {
+			return types.Bloom{}, ErrNoHeader
+		}
+		return header.Bloom, nil
+	}
+	cht := GetTrustedCht(db)
+	if number >= cht.Number*ChtFrequency {
+		return types.Bloom{}, ErrNoTrustedCht
+	}
+	r := &BlockBloomRequest{Number: number, Hash: hash, ChtNum: cht.Number, ChtRoot: cht.Root}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return types.Bloom{}, err
+	}
+	return r.Bloom, nil
+}
+
+// GetAccount retrieves the account with the given address from the state trie
+// identified by id. The returned account is nil if it doesn't exist.
+func GetAccount(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (*state.Account, error) {
+	key := addressHash(addr)
+	if value, ok := localValue(localDatabase(odr, KindAccount), id.Root, key[:]); ok {
+		if value == nil {
+			return nil, nil
+		}
+		account := new(state.Account)
+		if err := rlp.DecodeBytes(value, account); err != nil {
+			return nil, err
+		}
+		return account, nil
+	}
+	r := &AccountRequest{Id: id, Address: addr}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Account, nil
+}
+
+// BalanceAndNonce retrieves the verified balance and nonce of the account with
+// the given address. A non-existent account has a zero balance and nonce.
+func BalanceAndNonce(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (*big.Int, uint64, error) {
+	account, err := GetAccount(ctx, odr, id, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if account == nil {
+		return new(big.Int), 0, nil
+	}
+	return account.Balance, account.Nonce, nil
+}
+
+// Nonce retrieves the verified nonce of the account with the given address, e.g.
+// for constructing its next transaction. A non-existent account has a zero
+// nonce.
+func Nonce(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (uint64, error) {
+	_, nonce, err := BalanceAndNonce(ctx, odr, id, addr)
+	return nonce, err
+}
+
+// GetStorageRoot retrieves the storage trie root of the account with the given
+// address, which is the empty root if the account doesn't exist. Comparing the
+// roots of two blocks tells whether the storage of the account changed.
+func GetStorageRoot(ctx context.Context, odr OdrBackend, stateId *TrieID, addr common.Address) (common.Hash, error) {
+	key := addressHash(addr)
+	if value, ok := localValue(localDatabase(odr, KindStorageRoot), stateId.Root, key[:]); ok {
+		if value == nil {
+			return types.EmptyRootHash, nil
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return common.Hash{}, err
+		}
+		return account.Root, nil
+	}
+	r := &StorageRootRequest{StateId: stateId, Address: addr}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return common.Hash{}, err
+	}
+	return r.Root, nil
+}
+
+// GetCodeHash retrieves the code hash of the account with the given address,
+// which is the hash of the empty code for accounts without code and those that
+// don't exist. Equal hashes mean the accounts run identical code.
+func GetCodeHash(ctx context.Context, odr OdrBackend, stateId *TrieID, addr common.Address) (common.Hash, error) {
+	key := addressHash(addr)
+	if value, ok := localValue(localDatabase(odr, KindCodeHash), stateId.Root, key[:]); ok {
+		if value == nil {
+			return sha3_nil, nil
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return common.Hash{}, err
+		}
+		return common.BytesToHash(account.CodeHash), nil
+	}
+	r := &CodeHashRequest{StateId: stateId, Address: addr}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return common.Hash{}, err
+	}
+	return r.CodeHash, nil
+}
+
+// IsContract reports whether the account with the given address has code, based
+// on its verified code hash. Accounts that don't exist aren't contracts.
+func IsContract(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (bool, error) {
+	hash, err := GetCodeHash(ctx, odr, id, addr)
+	if err != nil {
+		return false, err
+	}
+	return hash != sha3_nil && hash != (common.Hash{}), nil
+}
+
+// ResolveStorageTrieID retrieves the account with the given address from the
+// state trie identified by state and returns the ID of its storage trie.
+func ResolveStorageTrieID(ctx context.Context, odr OdrBackend, state *TrieID, addr common.Address) (*TrieID, error) {
+	account, err := GetAccount(ctx, odr, state, addr)
+	if err != nil {
+		return nil, err
+	}
+	root := types.EmptyRootHash
+	if account != nil {
+		root = account.Root
+	}
+	return StorageTrieID(state, addressHash(addr), root), nil
+}
+
+// VerifiedStorageRead retrieves the content of a storage slot of the account with
+// the given address. The account is proven against the state trie identified by
+// state first, and the slot is then proven against the storage root of that
+// account, so no storage root asserted by a server is ever trusted. The content
+// is nil if either the account or the slot doesn't exist.
+func VerifiedStorageRead(ctx context.Context, odr OdrBackend, state *TrieID, addr common.Address, slot common.Hash) ([]byte, error) {
+	account, err := GetAccount(ctx, odr, state, addr)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	return readStorageSlot(ctx, odr, StorageTrieID(state, addressHash(addr), account.Root), slot)
+}
+
+// StorageAt retrieves a storage slot of the account with the given address as a
+// 32 byte word, the way the EVM sees it. Slots never set and accounts that don't
+// exist are proven absent and read as the zero hash, so a zero result is always
+// verified, while a failed retrieval returns an error instead.
+func StorageAt(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address, slot common.Hash) (common.Hash, error) {
+	content, err := VerifiedStorageRead(ctx, odr, id, addr, slot)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(content) > common.HashLength {
+		return common.Hash{}, ErrMalformedResponse
+	}
+	return common.BytesToHash(content), nil
+}
+
+// readStorageSlot retrieves the content of a storage slot from the storage trie
+// identified by id, whose root must have been verified by the caller.
+func readStorageSlot(ctx context.Context, odr OdrBackend, id *TrieID, slot common.Hash) ([]byte, error) {
+	value, found, err := VerifiedValue(ctx, odr, id, crypto.Keccak256(slot[:]))
+	if err != nil || !found {
+		return nil, err
+	}
+	_, content, _, err := rlp.Split(value)
+	if err != nil {
+		return nil, ErrMalformedResponse
+	}
+	return content, nil
+}
+
+// GetCodeSize retrieves the size of the contract code with the given hash. A
+// size-only retrieval is attempted first, falling back to retrieving the whole
+// code if the backend doesn't support it. The code is stored locally in that
+// case, so a later code retrieval is served from the database.
+func GetCodeSize(ctx context.Context, odr OdrBackend, id *TrieID, hash common.Hash) (uint64, error) {
+	if hash == sha3_nil {
+		return 0, nil
+	}
+	if code, err := ReadContent(localDatabase(odr, KindCodeSize), hash, ContentCode); err == nil {
+		return uint64(len(code)), nil
+	}
+	r := &CodeSizeRequest{Id: id, Hash: hash}
+	err := odr.Retrieve(ctx, r)
+	if err == nil {
+		return r.Size, nil
+	}
+	if err != ErrUnsupportedRequest {
+		return 0, err
+	}
+	cr := &CodeRequest{Id: id, Hash: hash}
+	if err := odr.Retrieve(ctx, cr); err != nil {
+		return 0, err
+	}
+	return uint64(len(cr.Data)), nil
+}
+
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (rlp.RawValue, error) {
-	if data := core.GetBodyRLP(odr.Database(), hash, number); data != nil {
+	if data := getBodyRLP(localDatabase(odr, KindBlock), hash, number); data != nil {
 		return data, nil
 	}
 	r := &BlockRequest{Hash: hash, Number: number}
@@ -133,11 +654,54 @@ func GetBody(ctx context.Context, odr OdrBackend, hash common.Hash, number uint6
 	return body, nil
 }
 
+// GetTransactionByIndex retrieves the transaction at the given index of a block,
+// returning ErrIndexOutOfRange if the block has fewer transactions.
+func GetTransactionByIndex(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64, index uint64) (*types.Transaction, error) {
+	if body := getBody(localDatabase(odr, KindTxByIndex), hash, number); body != nil {
+		if index >= uint64(len(body.Transactions)) {
+			return nil, ErrIndexOutOfRange
+		}
+		return body.Transactions[index], nil
+	}
+	r := &TxByIndexRequest{BlockHash: hash, Number: number, Index: index}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Tx, nil
+}
+
+// GetTxCount retrieves the number of transactions in a block. A count-only
+// retrieval proven against the transaction root is attempted first, falling back
+// to retrieving the whole body if the backend doesn't support it. The body is
+// stored locally in that case, so a later body retrieval is served from the
+// database.
+func GetTxCount(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (uint64, error) {
+	if body := getBody(localDatabase(odr, KindTxCount), hash, number); body != nil {
+		return uint64(len(body.Transactions)), nil
+	}
+	if header := getHeader(odr.Database(), hash, number); header != nil && header.TxHash == types.EmptyRootHash {
+		return 0, nil
+	}
+	r := &TxCountRequest{BlockHash: hash, Number: number}
+	err := odr.Retrieve(ctx, r)
+	if err == nil {
+		return r.Count, nil
+	}
+	if err != ErrUnsupportedRequest {
+		return 0, err
+	}
+	body, err := GetBody(ctx, odr, hash, number)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(body.Transactions)), nil
+}
+
 // GetBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body.
 func GetBlock(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (*types.Block, error) {
 	// Retrieve the block header and body contents
-	header := core.GetHeader(odr.Database(), hash, number)
+	header := getHeader(odr.Database(), hash, number)
 	if header == nil {
 		return nil, ErrNoHeader
 	}
@@ -149,10 +713,27 @@ func GetBlock(ctx context.Context, odr OdrBackend, hash common.Hash, number uint
 	return types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles), nil
 }
 
+// GetUncles retrieves the uncle headers of a locally stored block body,
+// verifying that they hash to the UncleHash of the corresponding header.
+func GetUncles(db wtcdb.Database, hash common.Hash, number uint64) ([]*types.Header, error) {
+	header := getHeader(db, hash, number)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	body := getBody(db, hash, number)
+	if body == nil {
+		return nil, ErrNoBody
+	}
+	if types.CalcUncleHash(body.Uncles) != header.UncleHash {
+		return nil, ErrUncleHashMismatch
+	}
+	return body.Uncles, nil
+}
+
 // GetBlockReceipts retrieves the receipts generated by the transactions included
 // in a block given by its hash.
 func GetBlockReceipts(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) (types.Receipts, error) {
-	receipts := core.GetBlockReceipts(odr.Database(), hash, number)
+	receipts := core.GetBlockReceipts(localDatabase(odr, KindReceipts), hash, number)
 	if receipts != nil {
 		return receipts, nil
 	}
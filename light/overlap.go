@@ -0,0 +1,140 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/metrics"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// DefaultOverlapWindow is the number of retrievals the proof path overlap is
+// averaged over if no other window is configured.
+const DefaultOverlapWindow = 64
+
+var proofOverlapGauge = metrics.NewGaugeFloat64("light/odr/proofoverlap")
+
+// OverlapOdr wraps an OdrBackend, measuring how much of the proof of each
+// retrieval was already part of the proof retrieved before it. A high overlap
+// means sequential requests keep fetching the same upper trie nodes, which a
+// larger cache or partial proofs extending local ones would avoid. Requests
+// without a proof are not counted.
+type OverlapOdr struct {
+	OdrBackend
+
+	lock    sync.Mutex
+	prev    map[string]struct{} // node hashes of the previous proof
+	samples []float64           // overlap ratios of the last retrievals
+	next    int
+	filled  int
+}
+
+// NewOverlapOdr creates an overlap measuring wrapper around backend, averaging
+// over the given number of retrievals, or DefaultOverlapWindow if window isn't
+// positive.
+func NewOverlapOdr(backend OdrBackend, window int) *OverlapOdr {
+	if window <= 0 {
+		window = DefaultOverlapWindow
+	}
+	return &OverlapOdr{OdrBackend: backend, samples: make([]float64, window)}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *OverlapOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve forwards the request to the wrapped backend, comparing the proof of
+// a successful retrieval with the previous one.
+func (odr *OverlapOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if err := odr.OdrBackend.Retrieve(ctx, req); err != nil {
+		return err
+	}
+	proof := requestProof(req)
+	if len(proof) == 0 {
+		return nil
+	}
+	nodes := make(map[string]struct{}, len(proof))
+	for _, node := range proof {
+		nodes[string(crypto.Keccak256(node))] = struct{}{}
+	}
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	if odr.prev != nil {
+		seen := 0
+		for hash := range nodes {
+			if _, ok := odr.prev[hash]; ok {
+				seen++
+			}
+		}
+		odr.samples[odr.next] = float64(seen) / float64(len(nodes))
+		odr.next = (odr.next + 1) % len(odr.samples)
+		if odr.filled < len(odr.samples) {
+			odr.filled++
+		}
+		proofOverlapGauge.Update(odr.overlap())
+	}
+	odr.prev = nodes
+	return nil
+}
+
+// Overlap returns the average share of proof nodes that were also part of the
+// previous proof, over the window of the last retrievals. It's between 0 and 1.
+func (odr *OverlapOdr) Overlap() float64 {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return odr.overlap()
+}
+
+func (odr *OverlapOdr) overlap() float64 {
+	if odr.filled == 0 {
+		return 0
+	}
+	var sum float64
+	for _, sample := range odr.samples[:odr.filled] {
+		sum += sample
+	}
+	return sum / float64(odr.filled)
+}
+
+// requestProof returns the retrieved merkle proof of a request, if it has one.
+func requestProof(req OdrRequest) []rlp.RawValue {
+	switch r := req.(type) {
+	case *TrieRequest:
+		return r.Proof
+	case *AccountRequest:
+		return r.Proof
+	case *StorageRootRequest:
+		return r.Proof
+	case *CodeHashRequest:
+		return r.Proof
+	case *ChtRequest:
+		return r.Proof
+	case *StateRootRequest:
+		return r.Proof
+	case *BlockBloomRequest:
+		return r.Proof
+	case *HeaderByHashRequest:
+		return r.Proof
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// proofOdr is a backend answering every trie request with the next of a list
+// of proofs.
+type proofOdr struct {
+	OdrBackend
+	proofs [][]rlp.RawValue
+}
+
+func (odr *proofOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if r, ok := req.(*TrieRequest); ok {
+		r.Proof, odr.proofs = odr.proofs[0], odr.proofs[1:]
+	}
+	return nil
+}
+
+func TestOverlapOdr(t *testing.T) {
+	node := func(b byte) rlp.RawValue { return rlp.RawValue{0xc1, b} }
+	backend := &proofOdr{}
+	odr := NewOverlapOdr(backend, 4)
+
+	retrieve := func(proof ...rlp.RawValue) {
+		backend.proofs = append(backend.proofs, proof)
+		if err := odr.Retrieve(NoOdr, &TrieRequest{}); err != nil {
+			t.Fatalf("failed to retrieve: %v", err)
+		}
+	}
+	// Disjoint proofs don't overlap at all
+	retrieve(node(1), node(2))
+	retrieve(node(3), node(4))
+	if overlap := odr.Overlap(); overlap != 0 {
+		t.Errorf("overlap of disjoint proofs: have %v, want 0", overlap)
+	}
+	// Proofs sharing their upper nodes raise the overlap
+	retrieve(node(3), node(4), node(5))
+	retrieve(node(3), node(4), node(6))
+	low := odr.Overlap()
+	if low <= 0 {
+		t.Fatalf("overlap not raised by shared nodes: %v", low)
+	}
+	retrieve(node(3), node(4), node(6))
+	retrieve(node(3), node(4), node(6))
+	if high := odr.Overlap(); high <= low {
+		t.Errorf("overlap not raised by repeated proofs: have %v, had %v", high, low)
+	}
+	// The window only covers the last retrievals
+	for i := 0; i < 4; i++ {
+		retrieve(node(3), node(4), node(6))
+	}
+	if overlap := odr.Overlap(); overlap != 1 {
+		t.Errorf("overlap of identical proofs: have %v, want 1", overlap)
+	}
+	// Requests without proofs are ignored
+	if err := odr.Retrieve(NoOdr, &BlockRequest{}); err != nil || odr.Overlap() != 1 {
+		t.Errorf("proofless request counted: overlap %v, %v", odr.Overlap(), err)
+	}
+}
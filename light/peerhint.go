@@ -0,0 +1,37 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import "context"
+
+type peerHintKey struct{}
+
+// WithPeerHint tags all retrievals made with the returned context with the id
+// of a peer likely to answer them quickly, e.g. because it just served related
+// data and has it cached. Backends able to choose their peers try the hinted
+// one first if it can serve the request right away, and otherwise fall back to
+// their normal selection. The hint only applies to the first attempt: retries
+// after a failure or timeout never stick to the hinted peer.
+func WithPeerHint(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, peerHintKey{}, id)
+}
+
+// PeerHint returns the peer hint of ctx set by WithPeerHint, if any.
+func PeerHint(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(peerHintKey{}).(string)
+	return id, ok
+}
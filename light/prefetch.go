@@ -0,0 +1,180 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/log"
+)
+
+// prefetchThreshold is the number of consecutive sequential reads of blocks or
+// receipts after which the following ones start to be prefetched.
+var prefetchThreshold = 2
+
+// accessPattern tracks the sequential reads of a single request kind.
+type accessPattern struct {
+	last   uint64             // number of the last block read
+	run    int                // number of consecutive sequential reads
+	next   uint64             // first block number not yet scheduled for prefetching
+	ctx    context.Context    // context of the running speculative retrievals
+	cancel context.CancelFunc // cancels the running speculative retrievals
+}
+
+// PrefetchOdr wraps an OdrBackend, detecting sequential reads of canonical
+// block bodies or receipts. Once a sequential pattern is seen, the following
+// blocks up to a configured distance are speculatively retrieved in the
+// background, so the subsequent reads are served locally. The speculative
+// retrievals are cancelled as soon as the pattern breaks.
+type PrefetchOdr struct {
+	OdrBackend
+	ahead int
+
+	lock       sync.Mutex
+	patterns   map[RequestKind]*accessPattern
+	prefetched uint64
+
+	wg sync.WaitGroup
+}
+
+// NewPrefetchOdr creates a prefetcher around backend, retrieving up to ahead
+// blocks beyond a sequential read.
+func NewPrefetchOdr(backend OdrBackend, ahead int) *PrefetchOdr {
+	return &PrefetchOdr{
+		OdrBackend: backend,
+		ahead:      ahead,
+		patterns:   make(map[RequestKind]*accessPattern),
+	}
+}
+
+// Stop cancels the running speculative retrievals and waits for them to return.
+func (odr *PrefetchOdr) Stop() {
+	odr.lock.Lock()
+	for _, p := range odr.patterns {
+		odr.reset(p)
+	}
+	odr.lock.Unlock()
+
+	odr.wg.Wait()
+}
+
+// Prefetched returns the number of blocks speculatively retrieved so far.
+func (odr *PrefetchOdr) Prefetched() uint64 {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return odr.prefetched
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *PrefetchOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve retrieves req through the wrapped backend, scheduling prefetches if
+// it continues a sequential pattern.
+func (odr *PrefetchOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	switch req := req.(type) {
+	case *BlockRequest:
+		odr.observe(KindBlock, req.Number)
+	case *ReceiptsRequest:
+		odr.observe(KindReceipts, req.Number)
+	}
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+// observe records a read of the given block and starts prefetching the ones not
+// yet scheduled within the configured distance if the read is sequential.
+func (odr *PrefetchOdr) observe(kind RequestKind, number uint64) {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	p := odr.patterns[kind]
+	if p == nil {
+		p = new(accessPattern)
+		odr.patterns[kind] = p
+	}
+	if p.run > 0 && number == p.last+1 {
+		p.run++
+	} else {
+		odr.reset(p)
+		p.run, p.next = 1, number+1
+	}
+	p.last = number
+
+	limit := number + uint64(odr.ahead)
+	if p.run < prefetchThreshold || p.next > limit {
+		return
+	}
+	if p.cancel == nil {
+		p.ctx, p.cancel = context.WithCancel(context.Background())
+	}
+	from := p.next
+	p.next = limit + 1
+
+	odr.wg.Add(1)
+	go odr.prefetch(p.ctx, kind, from, limit)
+}
+
+// reset cancels the speculative retrievals of an access pattern.
+func (odr *PrefetchOdr) reset(p *accessPattern) {
+	if p.cancel != nil {
+		p.cancel()
+		p.ctx, p.cancel = nil, nil
+	}
+}
+
+// prefetch retrieves the bodies or receipts of the canonical blocks in the given
+// range which are not available locally, stopping at the first unknown block or
+// failure.
+func (odr *PrefetchOdr) prefetch(ctx context.Context, kind RequestKind, from, to uint64) {
+	defer odr.wg.Done()
+
+	db := backendDatabase(odr)
+	for number := from; number <= to; number++ {
+		if ctx.Err() != nil {
+			return
+		}
+		hash := core.GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return
+		}
+		var req OdrRequest
+		switch kind {
+		case KindBlock:
+			if getBodyRLP(db, hash, number) != nil {
+				continue
+			}
+			req = &BlockRequest{Hash: hash, Number: number}
+		case KindReceipts:
+			if core.GetBlockReceipts(db, hash, number) != nil {
+				continue
+			}
+			req = &ReceiptsRequest{Hash: hash, Number: number}
+		}
+		if err := odr.OdrBackend.Retrieve(ctx, req); err != nil {
+			log.Debug("Speculative retrieval failed", "kind", kind, "number", number, "err", err)
+			return
+		}
+		odr.lock.Lock()
+		odr.prefetched++
+		odr.lock.Unlock()
+	}
+}
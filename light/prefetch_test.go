@@ -0,0 +1,76 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestPrefetchOdr(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 10)
+	writeCanonicalHeaders(sdb, headers)
+	writeCanonicalHeaders(ldb, headers)
+	body, _ := rlp.EncodeToBytes(new(types.Body))
+	for _, header := range headers {
+		core.WriteBodyRLP(sdb, header.Hash(), header.Number.Uint64(), body)
+	}
+	odr := NewPrefetchOdr(&testOdr{sdb: sdb, ldb: ldb}, 3)
+	defer odr.Stop()
+
+	read := func(n int) {
+		header := headers[n-1]
+		if _, err := GetBodyRLP(context.Background(), odr, header.Hash(), header.Number.Uint64()); err != nil {
+			t.Fatalf("block %d: read failed: %v", n, err)
+		}
+	}
+	// A single read doesn't trigger prefetching, a sequential one does
+	read(1)
+	if n := odr.Prefetched(); n != 0 {
+		t.Fatalf("prefetched %d blocks after a single read", n)
+	}
+	read(2)
+	for deadline := time.Now().Add(time.Second); odr.Prefetched() < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := odr.Prefetched(); n != 3 {
+		t.Fatalf("prefetched %d blocks, want 3", n)
+	}
+	for _, header := range headers[2:5] {
+		if core.GetBodyRLP(ldb, header.Hash(), header.Number.Uint64()) == nil {
+			t.Errorf("block %d not prefetched", header.Number)
+		}
+	}
+	// Breaking the pattern stops prefetching
+	read(9)
+	odr.Stop()
+	if n := odr.Prefetched(); n != 3 {
+		t.Errorf("prefetched %d blocks after the pattern broke, want 3", n)
+	}
+	if core.GetBodyRLP(ldb, headers[9].Hash(), 10) != nil {
+		t.Errorf("block 10 prefetched after the pattern broke")
+	}
+}
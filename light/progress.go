@@ -0,0 +1,44 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+// Progress receives progress reports from long running bulk operations, so they
+// can be rendered consistently by user interfaces. OnStart is called once with
+// the total number of items, OnAdvance after each processed item with the number
+// of items done so far, and OnDone once at the end with the operation's result.
+type Progress interface {
+	OnStart(total int)
+	OnAdvance(done int)
+	OnDone(err error)
+}
+
+// NoProgress is a Progress that ignores all reports.
+var NoProgress Progress = noProgress{}
+
+type noProgress struct{}
+
+func (noProgress) OnStart(int)   {}
+func (noProgress) OnAdvance(int) {}
+func (noProgress) OnDone(error)  {}
+
+// progressOrDefault returns p, or NoProgress if p is nil.
+func progressOrDefault(p Progress) Progress {
+	if p == nil {
+		return NoProgress
+	}
+	return p
+}
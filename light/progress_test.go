@@ -0,0 +1,85 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// recordingProgress records the progress reports it receives.
+type recordingProgress struct {
+	total   int
+	advance []int
+	done    bool
+	err     error
+}
+
+func (p *recordingProgress) OnStart(total int)  { p.total = total }
+func (p *recordingProgress) OnAdvance(done int) { p.advance = append(p.advance, done) }
+func (p *recordingProgress) OnDone(err error)   { p.done, p.err = true, err }
+
+func TestGetHeadersByNumberProgress(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 4)
+	writeCanonicalHeaders(db, headers)
+	odr := &testOdr{ldb: db}
+
+	progress := new(recordingProgress)
+	have, err := GetHeadersByNumber(NoOdr, odr, 1, 4, progress)
+	if err != nil {
+		t.Fatalf("failed to retrieve headers: %v", err)
+	}
+	for i, header := range have {
+		if header.Hash() != headers[i].Hash() {
+			t.Errorf("header %d mismatch: have %x, want %x", i+1, header.Hash(), headers[i].Hash())
+		}
+	}
+	if progress.total != 4 {
+		t.Errorf("total mismatch: have %d, want 4", progress.total)
+	}
+	if len(progress.advance) != 4 {
+		t.Fatalf("advance count mismatch: have %d, want 4", len(progress.advance))
+	}
+	for i, done := range progress.advance {
+		if done != i+1 {
+			t.Errorf("advance %d mismatch: have %d, want %d", i, done, i+1)
+		}
+	}
+	if !progress.done || progress.err != nil {
+		t.Errorf("completion mismatch: have done %v err %v, want done with no error", progress.done, progress.err)
+	}
+
+	// A header that's neither known locally nor covered by a CHT aborts the
+	// operation, which is reported as its result
+	progress = new(recordingProgress)
+	if _, err := GetHeadersByNumber(NoOdr, odr, 3, 6, progress); err != ErrNoTrustedCht {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	if progress.total != 4 || len(progress.advance) != 2 {
+		t.Errorf("progress mismatch: have total %d with %d advances, want 4 with 2", progress.total, len(progress.advance))
+	}
+	if !progress.done || progress.err != ErrNoTrustedCht {
+		t.Errorf("completion error mismatch: have %v, want %v", progress.err, ErrNoTrustedCht)
+	}
+	if _, err := GetHeadersByNumber(NoOdr, odr, 1, 2, nil); err != nil {
+		t.Errorf("failed to retrieve headers without progress: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var (
+	ErrIndexOutOfRange = errors.New("index out of range")
+	ErrTxHashMismatch  = errors.New("transaction hash mismatch")
+
+	// ErrTooManyCandidates is returned if a trie request lists more candidate
+	// roots than MaxCandidateRoots.
+	ErrTooManyCandidates = errors.New("too many candidate roots")
+)
+
+// deriveTrie builds the index keyed trie whose root is calculated by
+// types.DeriveSha for the given list.
+func deriveTrie(list types.DerivableList) *trie.Trie {
+	keybuf := new(bytes.Buffer)
+	t := new(trie.Trie)
+	for i := 0; i < list.Len(); i++ {
+		keybuf.Reset()
+		rlp.Encode(keybuf, uint(i))
+		t.Update(keybuf.Bytes(), list.GetRlp(i))
+	}
+	return t
+}
+
+// derivableListKey returns the trie key of the given index in a derived trie.
+func derivableListKey(index uint) []byte {
+	key, _ := rlp.EncodeToBytes(index)
+	return key
+}
+
+// TxInclusionProof builds a merkle proof of the transaction at txIndex in the
+// locally stored body of the given block against the TxHash of its header. The
+// proof is returned as the RLP encoding of the list of trie nodes, suitable for
+// verification with Config.VerifyProof using the RLP encoded index as key.
+func TxInclusionProof(db wtcdb.Database, blockHash common.Hash, number uint64, txIndex int) ([]byte, error) {
+	header := getHeader(db, blockHash, number)
+	if header == nil {
+		return nil, ErrNoHeader
+	}
+	body := getBody(db, blockHash, number)
+	if body == nil {
+		return nil, ErrNoBody
+	}
+	if txIndex < 0 || txIndex >= len(body.Transactions) {
+		return nil, ErrIndexOutOfRange
+	}
+	t := deriveTrie(types.Transactions(body.Transactions))
+	if t.Hash() != header.TxHash {
+		return nil, ErrTxHashMismatch
+	}
+	return rlp.EncodeToBytes(t.Prove(derivableListKey(uint(txIndex))))
+}
+
+// localProofPrefix returns the leading nodes of the merkle proof of key in the
+// trie with the given root that are available in the local database.
+func localProofPrefix(db wtcdb.Database, root common.Hash, key []byte) []rlp.RawValue {
+	guard := &depthGuard{Database: nodeReader{db}, limit: ConfigOf(db).maxTrieDepth()}
+	t, err := trie.New(root, guard)
+	if err != nil {
+		return nil
+	}
+	proof, _ := t.ProvePrefix(key)
+	if guard.exceeded {
+		return nil
+	}
+	return proof
+}
+
+// CompleteTrieProof turns the proof received for req into a full proof of its
+// key. Servers supporting partial proofs omit the first FromLevel nodes, which
+// are then taken from the local database; servers not supporting them always
+// reply with full proofs, which are returned as they are. The resulting proof
+// is verified against the root of the requested trie, or any of the candidate
+// roots of the request, recording the root that matched in the request. Full
+// proofs of none of these roots fail with ErrStaleStateRoot.
+func CompleteTrieProof(db wtcdb.Database, req *TrieRequest, proof []rlp.RawValue) ([]rlp.RawValue, error) {
+	if len(req.Candidates) > MaxCandidateRoots {
+		return nil, ErrTooManyCandidates
+	}
+	full, err := completeProof(db, req.Id.Root, req.Key, req.FromLevel, proof)
+	if err == nil {
+		req.MatchedRoot = req.Id.Root
+		return full, nil
+	}
+	for _, root := range req.Candidates {
+		if full, cerr := completeProof(db, root, req.Key, req.FromLevel, proof); cerr == nil {
+			req.MatchedRoot = root
+			return full, nil
+		}
+	}
+	if req.FromLevel == 0 && ConfigOf(db).CheckProofRoot(req.Id.Root, proof) != nil {
+		return nil, ErrStaleStateRoot
+	}
+	return nil, err
+}
+
+// CompleteTrieProofs turns the proofs received for the entries of a batch into
+// full proofs like CompleteTrieProof, aligned by index with reqs and nil where
+// they failed. The full proofs of entries of the same trie are verified together
+// with VerifyMultiProof, so the nodes shared by their paths are hashed only
+// once. Entries with candidate roots, and those of a group failing verification,
+// are completed one by one, attributing the failure to the right entry. The
+// failures are reported like the ones of single trie requests: ErrEmptyProof,
+// ErrStaleStateRoot and ErrTooManyCandidates as they are, invalid proofs as
+// ErrMalformedResponse.
+func CompleteTrieProofs(db wtcdb.Database, reqs []*TrieRequest, proofs [][]rlp.RawValue) ([][]rlp.RawValue, []error) {
+	var (
+		full  = make([][]rlp.RawValue, len(reqs))
+		errs  = make([]error, len(reqs))
+		roots = make([]common.Hash, len(reqs))
+		keys  = make([][]byte, len(reqs))
+	)
+	for i, req := range reqs {
+		if len(req.Candidates) > 0 || len(proofs[i]) == 0 {
+			continue
+		}
+		root, proof := req.Id.Root, proofs[i]
+		if req.FromLevel > 0 && crypto.Keccak256Hash(proof[0]) != root {
+			// A partial proof, take the leading nodes from the local database
+			prefix := localProofPrefix(db, root, req.Key)
+			if uint(len(prefix)) < req.FromLevel {
+				continue
+			}
+			proof = append(prefix[:req.FromLevel:req.FromLevel], proof...)
+		}
+		full[i], roots[i], keys[i] = proof, root, req.Key
+	}
+	verified := verifyProofGroups(ConfigOf(db), roots, keys, full)
+	for i, req := range reqs {
+		if verified[i] {
+			req.MatchedRoot = req.Id.Root
+			continue
+		}
+		full[i], errs[i] = CompleteTrieProof(db, req, proofs[i])
+		switch errs[i] {
+		case nil, ErrEmptyProof, ErrStaleStateRoot, ErrTooManyCandidates:
+		default:
+			errs[i] = ErrMalformedResponse
+		}
+	}
+	return full, errs
+}
+
+// verifyProofGroups verifies the proofs of the entries of a batch sharing the
+// same root together with VerifyMultiProof, proofs[i] being the full proof of
+// keys[i] against roots[i]. Entries with a zero root are left out. It reports
+// for every entry whether its proof was verified this way; the ones of single
+// entry and failing groups are not, so they can be checked one by one.
+func verifyProofGroups(config *Config, roots []common.Hash, keys [][]byte, proofs [][]rlp.RawValue) []bool {
+	groups := make(map[common.Hash][]int)
+	for i, root := range roots {
+		if root != (common.Hash{}) {
+			groups[root] = append(groups[root], i)
+		}
+	}
+	verified := make([]bool, len(roots))
+	for root, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		gkeys, gproofs := make([][]byte, len(group)), make([][]rlp.RawValue, len(group))
+		for j, i := range group {
+			gkeys[j], gproofs[j] = keys[i], proofs[i]
+		}
+		if _, err := config.VerifyMultiProof(root, gkeys, gproofs); err != nil {
+			continue
+		}
+		for _, i := range group {
+			verified[i] = true
+		}
+	}
+	return verified
+}
+
+// completeProof turns a possibly partial proof of key into a full one verified
+// against root.
+func completeProof(db wtcdb.Database, root common.Hash, key []byte, fromLevel uint, proof []rlp.RawValue) ([]rlp.RawValue, error) {
+	if len(proof) == 0 && (fromLevel == 0 || root == types.EmptyRootHash) {
+		return proof, checkProofPresence(root, proof)
+	}
+	_, err := verifyProofCached(db, root, key, proof)
+	if err == nil || fromLevel == 0 {
+		return proof, err
+	}
+	prefix := localProofPrefix(db, root, key)
+	if uint(len(prefix)) < fromLevel {
+		return nil, err
+	}
+	full := append(prefix[:fromLevel:fromLevel], proof...)
+	if _, err := verifyProofCached(db, root, key, full); err != nil {
+		return nil, err
+	}
+	return full, nil
+}
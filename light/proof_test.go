@@ -0,0 +1,308 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeTestTxs creates n signed value transfers from the test bank account.
+func makeTestTxs(n int) []*types.Transaction {
+	signer := types.HomesteadSigner{}
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		tx := types.NewTransaction(uint64(i), acc1Addr, big.NewInt(int64(1000+i)), bigTxGas, big.NewInt(1), nil)
+		txs[i], _ = types.SignTx(tx, signer, testBankKey)
+	}
+	return txs
+}
+
+func TestTxInclusionProof(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	block := makeTestBlock(genesis.Header(), makeTestTxs(5), nil, nil)
+	core.WriteBlock(db, block)
+
+	for i, tx := range block.Transactions() {
+		enc, err := TxInclusionProof(db, block.Hash(), block.NumberU64(), i)
+		if err != nil {
+			t.Fatalf("tx %d: failed to build proof: %v", i, err)
+		}
+		var proof []rlp.RawValue
+		if err := rlp.DecodeBytes(enc, &proof); err != nil {
+			t.Fatalf("tx %d: failed to decode proof: %v", i, err)
+		}
+		value, err := trie.VerifyProof(block.TxHash(), derivableListKey(uint(i)), proof)
+		if err != nil {
+			t.Fatalf("tx %d: proof verification failed: %v", i, err)
+		}
+		want, _ := rlp.EncodeToBytes(tx)
+		if !bytes.Equal(value, want) {
+			t.Errorf("tx %d: proven value mismatch: have %x, want %x", i, value, want)
+		}
+	}
+	if _, err := TxInclusionProof(db, block.Hash(), block.NumberU64(), 5); err != ErrIndexOutOfRange {
+		t.Errorf("out of range index error mismatch: have %v, want %v", err, ErrIndexOutOfRange)
+	}
+	if _, err := TxInclusionProof(db, common.Hash{1}, 1, 0); err != ErrNoHeader {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+// partialProofOdr is a test backend serving trie proofs from the requested
+// level on, like a server supporting partial proofs does.
+type partialProofOdr struct {
+	*testOdr
+	partial bool   // whether partial proofs are supported
+	levels  []uint // requested levels
+	served  []int  // number of proof nodes served
+}
+
+func (odr *partialProofOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	r, ok := req.(*TrieRequest)
+	if !ok {
+		return odr.testOdr.Retrieve(ctx, req)
+	}
+	t, _ := trie.New(r.Id.Root, odr.sdb)
+	proof := t.Prove(r.Key)
+	if odr.partial && int(r.FromLevel) < len(proof) {
+		proof = proof[r.FromLevel:]
+	}
+	odr.levels = append(odr.levels, r.FromLevel)
+	odr.served = append(odr.served, len(proof))
+
+	full, err := CompleteTrieProof(odr.ldb, r, proof)
+	if err != nil {
+		return err
+	}
+	r.Proof = full
+	return r.StoreResult(odr.ldb)
+}
+
+func TestPartialTrieProofs(t *testing.T) {
+	for _, partial := range []bool{true, false} {
+		sdb, _ := wtcdb.NewMemDatabase()
+		ldb, _ := wtcdb.NewMemDatabase()
+		id := makeTestStorage(sdb, 300)
+		full, _ := trie.New(id.Root, sdb)
+
+		odr := &partialProofOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}, partial: partial}
+		tr := &odrTrie{db: &odrDatabase{ctx: context.Background(), id: id, backend: odr}, id: id}
+		for i := 0; i < 2; i++ {
+			slot := testStateSlot(i)
+			have, err := tr.TryGet(slot[:])
+			if err != nil {
+				t.Fatalf("partial=%v: slot %d: read failed: %v", partial, i, err)
+			}
+			if want := full.Get(crypto.Keccak256(slot[:])); !bytes.Equal(have, want) {
+				t.Fatalf("partial=%v: slot %d: value mismatch: have %x, want %x", partial, i, have, want)
+			}
+		}
+		// The second read shares the upper nodes of the first one
+		if len(odr.levels) != 2 || odr.levels[0] != 0 || odr.levels[1] == 0 {
+			t.Fatalf("partial=%v: requested levels mismatch: %v", partial, odr.levels)
+		}
+		if partial && odr.served[1] >= len(full.Prove(crypto.Keccak256(testStateSlot(1).Bytes()))) {
+			t.Errorf("partial=%v: full proof served for overlapping path", partial)
+		}
+	}
+}
+
+func TestEmptyProof(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(db)
+	key := crypto.Keccak256(acc1Addr[:])
+
+	// An empty proof for a populated trie must be rejected
+	req := &TrieRequest{Id: StateTrieID(header), Key: key}
+	if _, err := CompleteTrieProof(db, req, nil); err != ErrEmptyProof {
+		t.Errorf("verification error mismatch: have %v, want %v", err, ErrEmptyProof)
+	}
+	if err := req.StoreResult(db); err != ErrEmptyProof {
+		t.Errorf("trie store error mismatch: have %v, want %v", err, ErrEmptyProof)
+	}
+	acc := &AccountRequest{Id: StateTrieID(header), Address: acc1Addr}
+	if err := acc.StoreResult(db); err != ErrEmptyProof {
+		t.Errorf("account store error mismatch: have %v, want %v", err, ErrEmptyProof)
+	}
+	// The empty trie has nothing to prove with, so an empty proof is fine
+	empty := &types.Header{Number: new(big.Int), Root: types.EmptyRootHash}
+	req = &TrieRequest{Id: StateTrieID(empty), Key: key}
+	if _, err := CompleteTrieProof(db, req, nil); err != nil {
+		t.Errorf("verification of empty trie proof failed: %v", err)
+	}
+	if err := req.StoreResult(db); err != nil {
+		t.Errorf("storing empty trie proof failed: %v", err)
+	}
+	acc = &AccountRequest{Id: StateTrieID(empty), Address: acc1Addr, Account: new(state.Account)}
+	if err := acc.StoreResult(db); err != nil || acc.Account != nil {
+		t.Errorf("empty state account mismatch: have %v, %v, want nil", acc.Account, err)
+	}
+}
+
+func TestCandidateRoots(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(db)
+
+	// Create a competing state for the same block where acc1 has another balance
+	st, _ := state.New(header.Root, state.NewDatabase(db))
+	st.SetBalance(acc1Addr, big.NewInt(2000), new(big.Int), new(big.Int))
+	other, _ := st.CommitTo(db, true)
+
+	key := crypto.Keccak256(acc1Addr[:])
+	tr, _ := trie.New(other, db)
+	proof := tr.Prove(key)
+
+	req := &TrieRequest{Id: StateTrieID(header), Key: key}
+	if _, err := CompleteTrieProof(db, req, proof); err == nil {
+		t.Fatalf("proof of another root accepted")
+	}
+	req.Candidates = []common.Hash{common.HexToHash("0x01"), other}
+	if _, err := CompleteTrieProof(db, req, proof); err != nil {
+		t.Fatalf("proof of candidate root rejected: %v", err)
+	}
+	if req.MatchedRoot != other {
+		t.Errorf("matched root mismatch: have %x, want %x", req.MatchedRoot, other)
+	}
+	tr, _ = trie.New(header.Root, db)
+	if _, err := CompleteTrieProof(db, req, tr.Prove(key)); err != nil || req.MatchedRoot != header.Root {
+		t.Errorf("proof of own root mismatch: %v, matched %x", err, req.MatchedRoot)
+	}
+	req.Candidates = make([]common.Hash, MaxCandidateRoots+1)
+	req.Candidates[0] = other
+	if _, err := CompleteTrieProof(db, req, proof); err != ErrTooManyCandidates {
+		t.Errorf("error mismatch for too many candidates: have %v, want %v", err, ErrTooManyCandidates)
+	}
+}
+
+// makeGroupedProofs returns the proofs of two accounts of the test state, the
+// first one without the root node, so it's only complete along with the second.
+func makeGroupedProofs(sdb wtcdb.Database, root common.Hash) ([][]byte, [][]rlp.RawValue) {
+	tr, _ := trie.New(root, sdb)
+	keys := [][]byte{crypto.Keccak256(acc1Addr[:]), crypto.Keccak256(testBankAddress[:])}
+	return keys, [][]rlp.RawValue{tr.Prove(keys[0])[1:], tr.Prove(keys[1])}
+}
+
+func TestBatchTrieRequestGrouped(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	keys, proofs := makeGroupedProofs(sdb, id.Root)
+
+	// The proofs of a trie are verified together, not one by one
+	db, _ := wtcdb.NewMemDatabase()
+	req := &BatchTrieRequest{Requests: []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}, Proofs: proofs}
+	if err := req.StoreResult(db); err != nil {
+		t.Fatalf("failed to store batch: %v", err)
+	}
+	for i, err := range req.Errs {
+		if err != nil {
+			t.Errorf("entry %d: failed to store proof verified with the batch: %v", i, err)
+		}
+	}
+	if _, ok := localValue(db, id.Root, keys[0]); !ok {
+		t.Errorf("grouped entry not available locally")
+	}
+	// A forged proof fails its own entry only
+	forged := append([]rlp.RawValue{}, proofs[1]...)
+	forged[len(forged)-1] = append(rlp.RawValue{}, forged[len(forged)-1]...)
+	forged[len(forged)-1][len(forged[len(forged)-1])-1] ^= 0x01
+
+	db, _ = wtcdb.NewMemDatabase()
+	tr, _ := trie.New(id.Root, sdb)
+	req = &BatchTrieRequest{Requests: []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}, Proofs: [][]rlp.RawValue{tr.Prove(keys[0]), forged}}
+	if err := req.StoreResult(db); err != nil {
+		t.Fatalf("failed to store batch: %v", err)
+	}
+	if req.Errs[0] != nil || req.Errs[1] != ErrMalformedResponse {
+		t.Errorf("entry errors mismatch: have %v, want [<nil> %v]", req.Errs, ErrMalformedResponse)
+	}
+}
+
+// Tests that the proofs of a batch completed on receipt aren't verified again
+// when the batch is stored, and that their failures are kept.
+func TestBatchTrieRequestVerifiedOnce(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	tr, _ := trie.New(id.Root, sdb)
+	keys := [][]byte{crypto.Keccak256(acc1Addr[:]), crypto.Keccak256(testBankAddress[:])}
+	proofs := [][]rlp.RawValue{tr.Prove(keys[0]), tr.Prove(keys[1])}
+
+	verifier := new(stubVerifier)
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := BindConfig(mdb, &Config{ProofVerifier: verifier})
+	req := &BatchTrieRequest{Requests: []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}}
+	req.Proofs, req.Errs = CompleteTrieProofs(db, req.Requests, proofs)
+	if err := req.StoreResult(db); err != nil {
+		t.Fatalf("failed to store batch: %v", err)
+	}
+	for i, err := range req.Errs {
+		if err != nil {
+			t.Errorf("entry %d: failed to store proof: %v", i, err)
+		}
+	}
+	if verifier.calls != len(keys) {
+		t.Errorf("verification count mismatch: have %d, want %d", verifier.calls, len(keys))
+	}
+	// Entries failing on receipt are reported without being verified again
+	verifier.calls, verifier.reject = 0, true
+	req = &BatchTrieRequest{Requests: []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}}
+	req.Proofs, req.Errs = CompleteTrieProofs(db, req.Requests, proofs)
+	calls := verifier.calls
+	if err := req.StoreResult(db); err != nil {
+		t.Fatalf("failed to store batch: %v", err)
+	}
+	for i, err := range req.Errs {
+		if err != ErrMalformedResponse {
+			t.Errorf("entry %d: error mismatch: have %v, want %v", i, err, ErrMalformedResponse)
+		}
+	}
+	if verifier.calls != calls {
+		t.Errorf("failed proofs verified again when storing")
+	}
+}
+
+func TestCompleteTrieProofsGrouped(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	keys, proofs := makeGroupedProofs(sdb, id.Root)
+
+	db, _ := wtcdb.NewMemDatabase()
+	reqs := []*TrieRequest{{Id: id, Key: keys[0]}, {Id: id, Key: keys[1]}}
+	full, errs := CompleteTrieProofs(db, reqs, proofs)
+	for i := range reqs {
+		if errs[i] != nil || full[i] == nil || reqs[i].MatchedRoot != id.Root {
+			t.Errorf("entry %d: proof not verified with the batch: %v", i, errs[i])
+		}
+	}
+	// Alone, the incomplete proof fails
+	full, errs = CompleteTrieProofs(db, reqs[:1], proofs[:1])
+	if errs[0] == nil || full[0] != nil {
+		t.Errorf("incomplete proof accepted on its own")
+	}
+}
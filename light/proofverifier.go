@@ -0,0 +1,240 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/metrics"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ProofVerifier verifies merkle proofs of trie entries, returning the proven
+// value of key, or nil if the proof proves its absence.
+type ProofVerifier interface {
+	VerifyProof(root common.Hash, key []byte, proof []rlp.RawValue) (value []byte, err error)
+}
+
+// ErrUnsupportedLayout is returned by a ProofVerifier that can't verify a proof
+// because it doesn't understand the layout of the trie. The verifier may return
+// the value it located in the proof along with the error; see the
+// BestEffortVerification option of Config.
+var ErrUnsupportedLayout = errors.New("unsupported trie layout")
+
+// TrieProofVerifier verifies proofs of the standard merkle patricia trie.
+type TrieProofVerifier struct{}
+
+// VerifyProof implements ProofVerifier.
+func (TrieProofVerifier) VerifyProof(root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	return trie.VerifyProof(root, key, proof)
+}
+
+// verifier returns the proof verifier of the configuration.
+func (c *Config) verifier() ProofVerifier {
+	if c.ProofVerifier == nil {
+		return TrieProofVerifier{}
+	}
+	return c.ProofVerifier
+}
+
+// standardTrie reports whether proofs are verified as standard trie proofs,
+// whose node layout is known.
+func (c *Config) standardTrie() bool {
+	_, ok := c.verifier().(TrieProofVerifier)
+	return ok
+}
+
+var (
+	bestEffortProofCounter = metrics.NewCounter("light/odr/besteffortproofs")
+	bestEffortWarning      sync.Once
+)
+
+// VerifyProof verifies a merkle proof of key against root with the configured
+// proof verifier.
+func (c *Config) VerifyProof(root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	value, err := c.verify(root, key, proof)
+	if err != nil && c.ReorderProofs && c.standardTrie() {
+		if ordered, ok := orderProof(root, key, proof); ok {
+			return c.verifier().VerifyProof(root, key, ordered)
+		}
+	}
+	return value, err
+}
+
+// verify verifies a merkle proof with the configured proof verifier, falling
+// back to the content-address checks of BestEffortVerification if it doesn't
+// support the trie layout.
+func (c *Config) verify(root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	value, err := c.verifier().VerifyProof(root, key, proof)
+	if err != ErrUnsupportedLayout || !c.BestEffortVerification {
+		return value, err
+	}
+	if !linkedProof(root, proof) {
+		return nil, ErrMalformedResponse
+	}
+	bestEffortWarning.Do(func() {
+		log.Warn("Trie layout unsupported by proof verifier, checking proofs by content address only")
+	})
+	bestEffortProofCounter.Inc(1)
+	return value, nil
+}
+
+// linkedProof reports whether the first node of proof hashes to root and every
+// further node is referenced by the hash of a node before it. No assumption is
+// made about the node encoding, so references are found by byte comparison.
+func linkedProof(root common.Hash, proof []rlp.RawValue) bool {
+	if len(proof) == 0 || crypto.Keccak256Hash(proof[0]) != root {
+		return false
+	}
+	for i := 1; i < len(proof); i++ {
+		hash := crypto.Keccak256(proof[i])
+		linked := false
+		for _, parent := range proof[:i] {
+			if bytes.Contains(parent, hash) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			return false
+		}
+	}
+	return true
+}
+
+// orderProof arranges the nodes of a proof of key in path order by looking them
+// up by hash while walking from root. Nodes not on the path are dropped; if the
+// path is incomplete, the nodes leading up to the gap are returned.
+func orderProof(root common.Hash, key []byte, proof []rlp.RawValue) ([]rlp.RawValue, bool) {
+	nodes, _ := wtcdb.NewMemDatabase()
+	for _, node := range proof {
+		nodes.Put(crypto.Keccak256(node), node)
+	}
+	t, err := trie.New(root, nodes)
+	if err != nil {
+		return nil, false
+	}
+	ordered, _ := t.ProvePrefix(key)
+	return ordered, true
+}
+
+// VerifyMultiProof verifies the proofs of several keys against the same root
+// at once, proofs[i] being the proof of keys[i]. Nodes shared by the proofs are
+// hashed and decoded only once, so for keys with overlapping paths this is
+// considerably cheaper than verifying the proofs one by one. The returned
+// values are nil for keys proven absent.
+//
+// If a verifier other than TrieProofVerifier is configured, the proofs are
+// verified one by one with it, as the node layout of its trie is unknown.
+func (c *Config) VerifyMultiProof(root common.Hash, keys [][]byte, proofs [][]rlp.RawValue) ([][]byte, error) {
+	if len(keys) != len(proofs) {
+		return nil, ErrMalformedResponse
+	}
+	values := make([][]byte, len(keys))
+	if !c.standardTrie() {
+		for i, key := range keys {
+			value, err := c.verify(root, key, proofs[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+	var (
+		nodes, _ = wtcdb.NewMemDatabase()
+		seen     = make(map[string]bool)
+	)
+	for _, proof := range proofs {
+		for _, node := range proof {
+			if !seen[string(node)] {
+				seen[string(node)] = true
+				nodes.Put(crypto.Keccak256(node), node)
+			}
+		}
+	}
+	t, err := trie.New(root, nodes)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		value, err := t.TryGet(key)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// VerifyStorageSlots verifies the proofs of several slots of a storage trie at
+// once, like VerifyMultiProof: the nodes of all proofs are combined into a single
+// trie and every slot is resolved against it, so the upper nodes shared by the
+// paths are hashed only once. The slots are mapped to their contents, absent
+// ones to nil, or to the error of their verification if their path can't be
+// resolved from the combined nodes.
+func (c *Config) VerifyStorageSlots(storageRoot common.Hash, slots map[common.Hash][]rlp.RawValue) (map[common.Hash][]byte, map[common.Hash]error) {
+	var (
+		values = make(map[common.Hash][]byte)
+		errs   = make(map[common.Hash]error)
+		get    func(key []byte, proof []rlp.RawValue) ([]byte, error)
+	)
+	switch {
+	case storageRoot == types.EmptyRootHash:
+		get = func([]byte, []rlp.RawValue) ([]byte, error) { return nil, nil }
+	case !c.standardTrie():
+		get = func(key []byte, proof []rlp.RawValue) ([]byte, error) {
+			return c.verify(storageRoot, key, proof)
+		}
+	default:
+		nodes, _ := wtcdb.NewMemDatabase()
+		for _, proof := range slots {
+			for _, node := range proof {
+				nodes.Put(crypto.Keccak256(node), node)
+			}
+		}
+		t, err := trie.New(storageRoot, nodes)
+		get = func(key []byte, _ []rlp.RawValue) ([]byte, error) {
+			if err != nil {
+				return nil, err
+			}
+			return t.TryGet(key)
+		}
+	}
+	for slot, proof := range slots {
+		value, err := get(crypto.Keccak256(slot[:]), proof)
+		if err == nil && value != nil {
+			if _, value, _, err = rlp.Split(value); err != nil {
+				err = ErrMalformedResponse
+			}
+		}
+		if err != nil {
+			errs[slot] = err
+			continue
+		}
+		values[slot] = value
+	}
+	return values, errs
+}
@@ -0,0 +1,326 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// stubVerifier counts the verified proofs, rejecting them all if reject is set.
+type stubVerifier struct {
+	calls  int
+	reject bool
+}
+
+func (v *stubVerifier) VerifyProof(root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	v.calls++
+	if v.reject {
+		return nil, errors.New("rejected by stub")
+	}
+	return TrieProofVerifier{}.VerifyProof(root, key, proof)
+}
+
+func TestProofVerifierConfig(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+
+	verifier := new(stubVerifier)
+	config := &Config{ProofVerifier: verifier}
+	ldb, _ := wtcdb.NewMemDatabase()
+	if _, err := GetAccount(NoOdr, &testOdr{sdb: sdb, ldb: ldb, config: config}, id, acc1Addr); err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	if verifier.calls == 0 {
+		t.Errorf("custom verifier not invoked")
+	}
+	verifier.reject = true
+	ldb, _ = wtcdb.NewMemDatabase()
+	if _, err := GetAccount(NoOdr, &testOdr{sdb: sdb, ldb: ldb, config: config}, id, acc1Addr); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for rejected proof: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// Other backends keep verifying with their own, standard verifier
+	calls := verifier.calls
+	if _, err := GetAccount(NoOdr, &testOdr{sdb: sdb, ldb: ldb}, id, acc1Addr); err != nil {
+		t.Errorf("failed to retrieve account with standard verifier: %v", err)
+	}
+	if verifier.calls != calls {
+		t.Errorf("custom verifier invoked for another backend")
+	}
+}
+
+// makeMultiProof creates a trie of n entries and the proofs of every step-th
+// key and the extra ones, returning the root, the proven keys and their proofs.
+func makeMultiProof(n, step int, extra ...[]byte) (common.Hash, [][]byte, [][]rlp.RawValue) {
+	db, _ := wtcdb.NewMemDatabase()
+	tr, _ := trie.New(common.Hash{}, db)
+	for i := 0; i < n; i++ {
+		key := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})
+		tr.Update(key, []byte{byte(i), 1})
+	}
+	root, _ := tr.CommitTo(db)
+
+	var keys [][]byte
+	for i := 0; i < n; i += step {
+		keys = append(keys, crypto.Keccak256([]byte{byte(i), byte(i >> 8)}))
+	}
+	keys = append(keys, extra...)
+	proofs := make([][]rlp.RawValue, len(keys))
+	for i, key := range keys {
+		proofs[i] = tr.Prove(key)
+	}
+	return root, keys, proofs
+}
+
+func TestVerifyMultiProof(t *testing.T) {
+	config := DefaultConfig()
+	absent := crypto.Keccak256([]byte("absent"))
+	root, keys, proofs := makeMultiProof(256, 8, absent)
+
+	values, err := config.VerifyMultiProof(root, keys, proofs)
+	if err != nil {
+		t.Fatalf("failed to verify multiproof: %v", err)
+	}
+	for i, key := range keys {
+		want, err := config.VerifyProof(root, key, proofs[i])
+		if err != nil {
+			t.Fatalf("key %x: proof invalid: %v", key, err)
+		}
+		if !bytes.Equal(values[i], want) {
+			t.Errorf("key %x: value mismatch: have %x, want %x", key, values[i], want)
+		}
+	}
+	if values[len(values)-1] != nil {
+		t.Errorf("absent key proven with value %x", values[len(values)-1])
+	}
+	// Truncating a proof makes the key unprovable unless another proof covers
+	// the dropped node
+	last := len(keys) - 1
+	truncated := append([][]rlp.RawValue{}, proofs...)
+	truncated[last] = proofs[last][:len(proofs[last])-1]
+	if _, err := config.VerifyMultiProof(root, keys[last:], truncated[last:]); err == nil {
+		t.Errorf("truncated proof accepted")
+	}
+	if _, err := config.VerifyMultiProof(root, keys, proofs[1:]); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for missing proof: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// A custom verifier gets every proof separately
+	verifier := new(stubVerifier)
+	if _, err := (&Config{ProofVerifier: verifier}).VerifyMultiProof(root, keys[:3], proofs[:3]); err != nil {
+		t.Fatalf("failed to verify with custom verifier: %v", err)
+	}
+	if verifier.calls != 3 {
+		t.Errorf("custom verifier called %d times, want 3", verifier.calls)
+	}
+}
+
+func BenchmarkVerifyProofIndependent(b *testing.B) {
+	config := DefaultConfig()
+	root, keys, proofs := makeMultiProof(4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, key := range keys {
+			if _, err := config.VerifyProof(root, key, proofs[j]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkVerifyMultiProof(b *testing.B) {
+	config := DefaultConfig()
+	root, keys, proofs := makeMultiProof(4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := config.VerifyMultiProof(root, keys, proofs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReorderProofs(t *testing.T) {
+	config := DefaultConfig()
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	st, _ := trie.New(id.Root, sdb)
+	key := addressHash(acc1Addr)
+	proof := st.Prove(key[:])
+	if len(proof) < 2 {
+		t.Fatalf("proof too short to shuffle: %d nodes", len(proof))
+	}
+	shuffled := make([]rlp.RawValue, len(proof))
+	for i := range proof {
+		shuffled[i] = proof[len(proof)-1-i]
+	}
+	want, _ := config.VerifyProof(id.Root, key[:], proof)
+
+	if _, err := config.VerifyProof(id.Root, key[:], shuffled); err == nil {
+		t.Fatalf("shuffled proof accepted without reordering")
+	}
+	config.ReorderProofs = true
+	value, err := config.VerifyProof(id.Root, key[:], shuffled)
+	if err != nil {
+		t.Fatalf("shuffled proof rejected: %v", err)
+	}
+	if !bytes.Equal(value, want) {
+		t.Errorf("value mismatch: have %x, want %x", value, want)
+	}
+	mdb, _ := wtcdb.NewMemDatabase()
+	ldb := BindConfig(mdb, config)
+	req := &AccountRequest{Id: id, Address: acc1Addr, Proof: shuffled}
+	if err := req.StoreResult(ldb); err != nil || req.Account == nil {
+		t.Fatalf("failed to store shuffled account proof: %v", err)
+	}
+	// Reordering doesn't make up for missing nodes
+	if _, err := config.VerifyProof(id.Root, key[:], shuffled[1:]); err == nil {
+		t.Errorf("incomplete shuffled proof accepted")
+	}
+}
+
+// layoutVerifier reports every proof as of an unsupported layout, locating the
+// value as the last proof node.
+type layoutVerifier struct{}
+
+func (layoutVerifier) VerifyProof(root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	if len(proof) == 0 {
+		return nil, ErrUnsupportedLayout
+	}
+	return proof[len(proof)-1], ErrUnsupportedLayout
+}
+
+func TestBestEffortVerification(t *testing.T) {
+	root, keys, proofs := makeMultiProof(256, 64)
+	config := &Config{ProofVerifier: layoutVerifier{}}
+
+	// Strict verification fails on unsupported layouts
+	if _, err := config.VerifyProof(root, keys[0], proofs[0]); err != ErrUnsupportedLayout {
+		t.Fatalf("error mismatch in strict mode: have %v, want %v", err, ErrUnsupportedLayout)
+	}
+	// Best-effort verification accepts proofs linked by content address
+	config.BestEffortVerification = true
+	value, err := config.VerifyProof(root, keys[0], proofs[0])
+	if err != nil {
+		t.Fatalf("linked proof rejected: %v", err)
+	}
+	if last := proofs[0][len(proofs[0])-1]; !bytes.Equal(value, last) {
+		t.Errorf("value mismatch: have %x, want %x", value, last)
+	}
+	if _, err := config.VerifyMultiProof(root, keys, proofs); err != nil {
+		t.Errorf("linked multiproof rejected: %v", err)
+	}
+	// Proofs not hanging off the root or with unreferenced nodes are rejected
+	if _, err := config.VerifyProof(common.Hash{1}, keys[0], proofs[0]); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for foreign root: have %v, want %v", err, ErrMalformedResponse)
+	}
+	forged := append(append([]rlp.RawValue{}, proofs[0]...), rlp.RawValue{0xc0})
+	if _, err := config.VerifyProof(root, keys[0], forged); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for unlinked node: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// Other verification errors aren't softened
+	config = &Config{ProofVerifier: &stubVerifier{reject: true}, BestEffortVerification: true}
+	if _, err := config.VerifyProof(root, keys[0], proofs[0]); err == nil {
+		t.Errorf("rejected proof accepted in best-effort mode")
+	}
+}
+
+// makeStorageProofs creates a storage trie of n slots, each holding its index
+// plus one, and the proofs of every step-th slot and the extra ones.
+func makeStorageProofs(n, step int, extra ...common.Hash) (common.Hash, map[common.Hash][]rlp.RawValue) {
+	db, _ := wtcdb.NewMemDatabase()
+	tr, _ := trie.New(common.Hash{}, db)
+	for i := 0; i < n; i++ {
+		slot := testStateSlot(i)
+		value, _ := rlp.EncodeToBytes([]byte{byte(i + 1), byte((i + 1) >> 8)})
+		tr.Update(crypto.Keccak256(slot[:]), value)
+	}
+	root, _ := tr.CommitTo(db)
+
+	proofs := make(map[common.Hash][]rlp.RawValue)
+	for i := 0; i < n; i += step {
+		slot := testStateSlot(i)
+		proofs[slot] = tr.Prove(crypto.Keccak256(slot[:]))
+	}
+	for _, slot := range extra {
+		proofs[slot] = tr.Prove(crypto.Keccak256(slot[:]))
+	}
+	return root, proofs
+}
+
+func TestVerifyStorageSlots(t *testing.T) {
+	config := DefaultConfig()
+	absent := common.HexToHash("0xdead")
+	root, proofs := makeStorageProofs(256, 16, absent)
+
+	values, errs := config.VerifyStorageSlots(root, proofs)
+	if len(errs) != 0 {
+		t.Fatalf("verification errors: %v", errs)
+	}
+	for i := 0; i < 256; i += 16 {
+		want := []byte{byte(i + 1), byte((i + 1) >> 8)}
+		if have := values[testStateSlot(i)]; !bytes.Equal(have, want) {
+			t.Errorf("slot %d: value mismatch: have %x, want %x", i, have, want)
+		}
+	}
+	if value, ok := values[absent]; !ok || value != nil {
+		t.Errorf("absent slot mismatch: have %x (present %v)", value, ok)
+	}
+	// Proofs against another root fail every slot
+	other, _ := makeStorageProofs(512, 512)
+	if _, errs := config.VerifyStorageSlots(other, proofs); len(errs) != len(proofs) {
+		t.Errorf("error count mismatch for foreign root: have %d, want %d", len(errs), len(proofs))
+	}
+	// An incomplete proof only fails its own slot
+	values, errs = config.VerifyStorageSlots(root, map[common.Hash][]rlp.RawValue{
+		testStateSlot(0):  proofs[testStateSlot(0)],
+		testStateSlot(16): proofs[testStateSlot(16)][:1],
+	})
+	if errs[testStateSlot(16)] == nil || errs[testStateSlot(0)] != nil || values[testStateSlot(0)] == nil {
+		t.Errorf("per-slot errors mismatch: have %v", errs)
+	}
+}
+
+func BenchmarkVerifyStorageSlotsIndependent(b *testing.B) {
+	config := DefaultConfig()
+	root, proofs := makeStorageProofs(4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for slot, proof := range proofs {
+			if _, err := config.VerifyProof(root, crypto.Keccak256(slot[:]), proof); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkVerifyStorageSlots(b *testing.B) {
+	config := DefaultConfig()
+	root, proofs := makeStorageProofs(4096, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, errs := config.VerifyStorageSlots(root, proofs); len(errs) != 0 {
+			b.Fatal(errs)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/wtc/go-wtc/common"
+)
+
+// ProxyImplementationSlot is the storage slot EIP-1967 proxies keep the address
+// of their implementation contract in, keccak256("eip1967.proxy.implementation")
+// minus one.
+var ProxyImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+
+// ProxyImplementation retrieves the implementation address of the EIP-1967 proxy
+// with the given address, read from ProxyImplementationSlot the same way as by
+// StorageAt. An empty slot, including that of an account that doesn't exist, is
+// proven so and reported as not found, so the account isn't such a proxy.
+func ProxyImplementation(ctx context.Context, odr OdrBackend, id *TrieID, proxy common.Address) (common.Address, bool, error) {
+	value, err := StorageAt(ctx, odr, id, proxy, ProxyImplementationSlot)
+	if err != nil || value == (common.Hash{}) {
+		return common.Address{}, false, err
+	}
+	return common.BytesToAddress(value[common.HashLength-common.AddressLength:]), true, nil
+}
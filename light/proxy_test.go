@@ -0,0 +1,66 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestProxyImplementationSlot(t *testing.T) {
+	slot := crypto.Keccak256Hash([]byte("eip1967.proxy.implementation")).Big()
+	if want := common.BigToHash(slot.Sub(slot, big.NewInt(1))); ProxyImplementationSlot != want {
+		t.Errorf("slot mismatch: have %x, want %x", ProxyImplementationSlot, want)
+	}
+}
+
+func TestProxyImplementation(t *testing.T) {
+	var (
+		proxy = common.HexToAddress("0x1967")
+		impl  = common.HexToAddress("0xfeedfeedfeedfeedfeedfeedfeedfeedfeedfeed")
+	)
+	sdb, _ := wtcdb.NewMemDatabase()
+	st, _ := state.New(common.Hash{}, state.NewDatabase(sdb))
+	st.SetCode(proxy, testContractCode)
+	st.SetState(proxy, ProxyImplementationSlot, impl.Hash())
+	st.SetCode(testStateContract, testContractCode)
+	st.SetState(testStateContract, testStateSlot(0), common.BigToHash(big.NewInt(1)))
+	root, _ := st.CommitTo(sdb, true)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := &TrieID{Root: root}
+
+	if addr, found, err := ProxyImplementation(NoOdr, odr, id, proxy); err != nil || !found || addr != impl {
+		t.Errorf("proxy implementation mismatch: have %x, %v, %v, want %x", addr, found, err, impl)
+	}
+	for _, addr := range []common.Address{testStateContract, acc2Addr} {
+		if impl, found, err := ProxyImplementation(NoOdr, odr, id, addr); err != nil || found {
+			t.Errorf("%x: implementation found for non-proxy: %x, %v", addr, impl, err)
+		}
+	}
+	// A failing retrieval must not be mistaken for a non-proxy
+	ddb, _ := wtcdb.NewMemDatabase()
+	if _, _, err := ProxyImplementation(NoOdr, &testOdr{sdb: sdb, ldb: ddb, disable: true}, id, proxy); err != ErrOdrDisabled {
+		t.Errorf("error mismatch for failing retrieval: have %v, want %v", err, ErrOdrDisabled)
+	}
+}
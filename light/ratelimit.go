@@ -0,0 +1,88 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitOdr wraps an OdrBackend, limiting the rate of retrievals passed to
+// it. Retrievals beyond the rate wait for their turn, or until their context is
+// done. Short bursts of up to burst retrievals are let through at once.
+type RateLimitOdr struct {
+	OdrBackend
+	rate  float64 // retrievals per second
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitOdr creates a wrapper around backend doing at most rate retrievals
+// per second on average.
+func NewRateLimitOdr(backend OdrBackend, rate float64, burst int) *RateLimitOdr {
+	return &RateLimitOdr{
+		OdrBackend: backend,
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       clock.Now(),
+	}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *RateLimitOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve waits for the rate limit to allow another retrieval, then forwards
+// the request to the wrapped backend.
+func (odr *RateLimitOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if err := odr.wait(ctx); err != nil {
+		return err
+	}
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+// wait takes a token from the bucket, waiting for one to become available.
+func (odr *RateLimitOdr) wait(ctx context.Context) error {
+	for {
+		odr.lock.Lock()
+		now := clock.Now()
+		odr.tokens += now.Sub(odr.last).Seconds() * odr.rate
+		if odr.tokens > odr.burst {
+			odr.tokens = odr.burst
+		}
+		odr.last = now
+		if odr.tokens >= 1 {
+			odr.tokens--
+			odr.lock.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - odr.tokens) / odr.rate * float64(time.Second))
+		odr.lock.Unlock()
+
+		select {
+		case <-clock.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestRateLimitOdr(t *testing.T) {
+	c, restore := useManualClock()
+	defer restore()
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := NewRateLimitOdr(&testOdr{sdb: sdb, ldb: ldb}, 2, 2)
+
+	retrieve := func() chan error {
+		done := make(chan error, 1)
+		go func() { done <- odr.Retrieve(NoOdr, &AccountRequest{Id: id, Address: acc1Addr}) }()
+		return done
+	}
+	// The burst passes right away
+	for i := 0; i < 2; i++ {
+		if err := <-retrieve(); err != nil {
+			t.Fatalf("burst retrieval %d failed: %v", i, err)
+		}
+	}
+	// The next one waits for a token, which takes half a second at 2/s
+	done := retrieve()
+	c.waitTimers(1)
+	c.Advance(400 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatalf("retrieval not rate limited")
+	default:
+	}
+	c.Advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("limited retrieval failed: %v", err)
+	}
+	// A waiting retrieval is abandoned with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- odr.Retrieve(ctx, &AccountRequest{Id: id, Address: acc1Addr}) }()
+	c.waitTimers(1)
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("error mismatch for cancelled wait: have %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// errNotFound is returned for keys deleted in the memory of a ReadOnlyDatabase.
+var errNotFound = errors.New("not found")
+
+// ReadOnlyDatabase wraps a database that mustn't be written, e.g. a snapshot
+// shared with other processes. Results are still verified before being stored,
+// but the writes of StoreResult and everything else are kept in memory only, so
+// retrieved data is served to the callers and the readers of the database until
+// the process exits, while the wrapped database is never written.
+type ReadOnlyDatabase struct {
+	wtcdb.Database
+
+	lock    sync.RWMutex
+	mem     map[string][]byte
+	deleted map[string]struct{} // keys of the wrapped database deleted in memory
+}
+
+// NewReadOnlyDatabase creates a read-only wrapper around db.
+func NewReadOnlyDatabase(db wtcdb.Database) *ReadOnlyDatabase {
+	return &ReadOnlyDatabase{
+		Database: db,
+		mem:      make(map[string][]byte),
+		deleted:  make(map[string]struct{}),
+	}
+}
+
+// Put stores a value in memory.
+func (db *ReadOnlyDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.mem[string(key)] = common.CopyBytes(value)
+	delete(db.deleted, string(key))
+	return nil
+}
+
+// Get retrieves a value from memory or the wrapped database.
+func (db *ReadOnlyDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	value, ok := db.mem[string(key)]
+	_, deleted := db.deleted[string(key)]
+	db.lock.RUnlock()
+
+	if ok {
+		return value, nil
+	}
+	if deleted {
+		return nil, errNotFound
+	}
+	return db.Database.Get(key)
+}
+
+// Has checks whether key is present in memory or the wrapped database.
+func (db *ReadOnlyDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	_, ok := db.mem[string(key)]
+	_, deleted := db.deleted[string(key)]
+	db.lock.RUnlock()
+
+	if ok || deleted {
+		return ok, nil
+	}
+	return db.Database.Has(key)
+}
+
+// Delete hides key from the readers of the database, leaving the wrapped one
+// untouched.
+func (db *ReadOnlyDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	delete(db.mem, string(key))
+	db.deleted[string(key)] = struct{}{}
+	return nil
+}
+
+// NewBatch creates a batch storing its entries in memory on Write.
+func (db *ReadOnlyDatabase) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: db}
+}
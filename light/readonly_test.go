@@ -0,0 +1,78 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// writeCountingDatabase counts the writes done to a database.
+type writeCountingDatabase struct {
+	wtcdb.Database
+	writes int
+}
+
+func (db *writeCountingDatabase) Put(key []byte, value []byte) error {
+	db.writes++
+	return db.Database.Put(key, value)
+}
+
+func (db *writeCountingDatabase) Delete(key []byte) error {
+	db.writes++
+	return db.Database.Delete(key)
+}
+
+func (db *writeCountingDatabase) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: db}
+}
+
+func TestReadOnlyDatabase(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+
+	mdb, _ := wtcdb.NewMemDatabase()
+	mdb.Put([]byte("existing"), []byte{1})
+	snapshot := &writeCountingDatabase{Database: mdb}
+	ldb := NewReadOnlyDatabase(snapshot)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	value, err := VerifiedStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(2))
+	if err != nil {
+		t.Fatalf("failed to read storage slot: %v", err)
+	}
+	if !bytes.Equal(value, []byte{3}) {
+		t.Errorf("slot content mismatch: have %x, want %x", value, []byte{3})
+	}
+	// The verified results are served from memory later on
+	odr.disable = true
+	if value, err := VerifiedStorageRead(NoOdr, odr, id, testStateContract, testStateSlot(2)); err != nil || !bytes.Equal(value, []byte{3}) {
+		t.Errorf("cached slot mismatch: have %x, %v, want %x", value, err, []byte{3})
+	}
+	ldb.Delete([]byte("existing"))
+	if ok, _ := ldb.Has([]byte("existing")); ok {
+		t.Errorf("deleted key still present")
+	}
+	if ok, _ := mdb.Has([]byte("existing")); !ok {
+		t.Errorf("key deleted from the wrapped database")
+	}
+	if snapshot.writes != 0 {
+		t.Errorf("wrapped database written %d times", snapshot.writes)
+	}
+}
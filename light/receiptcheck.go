@@ -0,0 +1,78 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// ErrReceiptsDiverged is returned if the cached receipts of a block differ from
+// a freshly retrieved and verified set.
+var ErrReceiptsDiverged = errors.New("cached receipts diverged")
+
+// ReVerifyReceipts audits the cached receipts of a block without trusting them.
+// The receipts are retrieved anew from the network and verified against the
+// receipt root of header; a fresh set passing the check replaces the cached one,
+// which is reported with ErrReceiptsDiverged if the two differ, pointing at a
+// corrupted cache or an earlier bad write. If the fresh set fails the check the
+// cached one is left in place.
+func ReVerifyReceipts(ctx context.Context, backend OdrBackend, hash common.Hash, number uint64, header *types.Header) error {
+	db := backend.Database()
+	cached := core.GetBlockReceipts(db, hash, number)
+
+	r := &ReceiptsRequest{Hash: hash, Number: number}
+	err := backend.Retrieve(ctx, r)
+	if err == nil && types.DeriveSha(r.Receipts) != header.ReceiptHash {
+		err = ErrReceiptHashMismatch
+	}
+	if err != nil {
+		if cached != nil {
+			if err := core.WriteBlockReceipts(db, hash, number, cached); err != nil {
+				log.Error("Failed to restore cached receipts", "hash", hash, "err", err)
+			}
+		}
+		return err
+	}
+	if cached == nil {
+		return nil
+	}
+	have, _ := rlp.EncodeToBytes(storageReceipts(cached))
+	want, _ := rlp.EncodeToBytes(storageReceipts(r.Receipts))
+	if !bytes.Equal(have, want) {
+		log.Warn("Cached receipts diverged", "number", number, "hash", hash)
+		return ErrReceiptsDiverged
+	}
+	return nil
+}
+
+// storageReceipts converts receipts to their database representation, which
+// is what the cache is able to reproduce.
+func storageReceipts(receipts types.Receipts) []*types.ReceiptForStorage {
+	storage := make([]*types.ReceiptForStorage, len(receipts))
+	for i, receipt := range receipts {
+		storage[i] = (*types.ReceiptForStorage)(receipt)
+	}
+	return storage
+}
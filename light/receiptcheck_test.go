@@ -0,0 +1,64 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestReVerifyReceipts(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	core.WriteHeader(sdb, block.Header())
+	core.WriteBlockReceipts(sdb, block.Hash(), block.NumberU64(), receipts)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	ctx := context.Background()
+
+	// An intact cache passes the audit
+	core.WriteBlockReceipts(ldb, block.Hash(), block.NumberU64(), receipts)
+	if err := ReVerifyReceipts(ctx, odr, block.Hash(), block.NumberU64(), block.Header()); err != nil {
+		t.Fatalf("intact receipts failed the audit: %v", err)
+	}
+	// A corrupted receipt is detected and repaired
+	corrupted := makeTestReceipts(txs)
+	corrupted[1].Logs[0].Data = []byte{0xff}
+	core.WriteBlockReceipts(ldb, block.Hash(), block.NumberU64(), corrupted)
+	if err := ReVerifyReceipts(ctx, odr, block.Hash(), block.NumberU64(), block.Header()); err != ErrReceiptsDiverged {
+		t.Fatalf("error mismatch for corrupted receipts: have %v, want %v", err, ErrReceiptsDiverged)
+	}
+	cached := core.GetBlockReceipts(ldb, block.Hash(), block.NumberU64())
+	if types.DeriveSha(cached) != block.ReceiptHash() {
+		t.Errorf("corrupted receipts not replaced")
+	}
+	// A header with a different receipt root rejects the fresh set
+	header := types.CopyHeader(block.Header())
+	header.ReceiptHash = types.EmptyRootHash
+	if err := ReVerifyReceipts(ctx, odr, block.Hash(), block.NumberU64(), header); err != ErrReceiptHashMismatch {
+		t.Errorf("error mismatch for wrong root: have %v, want %v", err, ErrReceiptHashMismatch)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// lenientReceiptRLP is the consensus encoding of a receipt, swallowing any
+// fields appended to it by other client versions.
+type lenientReceiptRLP struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed *big.Int
+	Bloom             types.Bloom
+	Logs              []*types.Log
+	Extra             []rlp.RawValue `rlp:"tail"`
+}
+
+// DecodeReceipts decodes the consensus encoding of a list of receipts. Unknown
+// trailing fields of a receipt are ignored for forward compatibility, so only
+// the known fields the receipts root commits to have to be well formed. The
+// result still has to be verified against the receipts root.
+func DecodeReceipts(data []byte) (types.Receipts, error) {
+	var receipts types.Receipts
+	if err := rlp.DecodeBytes(data, &receipts); err == nil {
+		return receipts, nil
+	}
+	var raws []rlp.RawValue
+	if err := rlp.DecodeBytes(data, &raws); err != nil {
+		return nil, err
+	}
+	receipts = make(types.Receipts, len(raws))
+	for i, raw := range raws {
+		var dec lenientReceiptRLP
+		if err := rlp.DecodeBytes(raw, &dec); err != nil {
+			return nil, err
+		}
+		// Decode the known fields through the receipt itself to interpret the status
+		enc, err := rlp.EncodeToBytes([]interface{}{dec.PostStateOrStatus, dec.CumulativeGasUsed, dec.Bloom, dec.Logs})
+		if err != nil {
+			return nil, err
+		}
+		receipts[i] = new(types.Receipt)
+		if err := rlp.DecodeBytes(enc, receipts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return receipts, nil
+}
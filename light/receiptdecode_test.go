@@ -0,0 +1,80 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+)
+
+// extendReceipts encodes receipts with the given raw fields appended to each.
+func extendReceipts(t *testing.T, receipts types.Receipts, extra ...rlp.RawValue) []byte {
+	raws := make([]rlp.RawValue, len(receipts))
+	for i, receipt := range receipts {
+		enc, _ := rlp.EncodeToBytes(receipt)
+		var fields []rlp.RawValue
+		if err := rlp.DecodeBytes(enc, &fields); err != nil {
+			t.Fatalf("failed to split receipt: %v", err)
+		}
+		raws[i], _ = rlp.EncodeToBytes(append(fields, extra...))
+	}
+	data, _ := rlp.EncodeToBytes(raws)
+	return data
+}
+
+func TestDecodeReceiptsTrailingFields(t *testing.T) {
+	receipts := makeTestReceipts(makeTestTxs(3))
+	root := types.DeriveSha(receipts)
+
+	number, _ := rlp.EncodeToBytes(uint64(7))
+	list, _ := rlp.EncodeToBytes([]string{"future", "fields"})
+	data := extendReceipts(t, receipts, number, list)
+	if err := rlp.DecodeBytes(data, new(types.Receipts)); err == nil {
+		t.Fatalf("strict decoder accepted trailing fields")
+	}
+	decoded, err := DecodeReceipts(data)
+	if err != nil {
+		t.Fatalf("failed to decode receipts with trailing fields: %v", err)
+	}
+	if have := types.DeriveSha(decoded); have != root {
+		t.Errorf("receipts root mismatch: have %x, want %x", have, root)
+	}
+	if len(decoded[1].Logs) != 1 || decoded[1].Logs[0].Data[0] != 1 {
+		t.Errorf("logs mismatch: have %v", decoded[1].Logs)
+	}
+	// Plain receipts decode as before
+	plain, _ := rlp.EncodeToBytes(receipts)
+	if decoded, err := DecodeReceipts(plain); err != nil || types.DeriveSha(decoded) != root {
+		t.Errorf("plain receipts mismatch: %v", err)
+	}
+	// Malformed known fields are still rejected
+	bloom, _ := rlp.EncodeToBytes([]byte{1, 2, 3})
+	var broken []rlp.RawValue
+	enc, _ := rlp.EncodeToBytes(receipts[0])
+	rlp.DecodeBytes(enc, &broken)
+	broken[2] = bloom
+	raw, _ := rlp.EncodeToBytes(broken)
+	data, _ = rlp.EncodeToBytes([]rlp.RawValue{raw})
+	if _, err := DecodeReceipts(data); err == nil {
+		t.Errorf("malformed bloom accepted")
+	}
+	if _, err := DecodeReceipts([]byte{0xc3, 0x01}); err == nil {
+		t.Errorf("truncated list accepted")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrGasUsedMismatch is returned if the gas used by retrieved receipts, stripped
+// or not, doesn't add up to the GasUsed of their header.
+var ErrGasUsedMismatch = errors.New("gas used mismatch")
+
+var receiptsMetaPrefix = []byte("light-receiptmeta-") // receiptsMetaPrefix + num (uint64 big endian) + hash -> stripped receipts
+
+// ReceiptMeta is a receipt stripped of its logs. It's a separate type so that a
+// stripped receipt can never pass for one that emitted no logs.
+type ReceiptMeta struct {
+	PostState         []byte // intermediate state root, only before byzantium
+	Status            uint
+	CumulativeGasUsed *big.Int
+	Bloom             types.Bloom
+}
+
+// ReceiptsMeta strips the logs from full receipts.
+func ReceiptsMeta(receipts types.Receipts) []ReceiptMeta {
+	meta := make([]ReceiptMeta, len(receipts))
+	for i, receipt := range receipts {
+		meta[i] = ReceiptMeta{
+			PostState:         receipt.PostState,
+			Status:            receipt.Status,
+			CumulativeGasUsed: receipt.CumulativeGasUsed,
+			Bloom:             receipt.Bloom,
+		}
+	}
+	return meta
+}
+
+// ReceiptsMetaRequest is the ODR request type for retrieving the receipts of a
+// block without their logs. Backends whose servers can strip the logs set
+// Stripped and fill in Meta, the others fall back to retrieving the full
+// Receipts. Stripped receipts can't be checked against the receipt trie of the
+// header, only against its bloom and gas used, so their status is unverified.
+// They're stored apart from full receipts, never to be served to log queries.
+type ReceiptsMetaRequest struct {
+	OdrRequest
+	Hash     common.Hash
+	Number   uint64
+	Stripped bool
+	Meta     []ReceiptMeta
+	Receipts types.Receipts // full receipts if the server couldn't strip them
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *ReceiptsMetaRequest) StoreResult(db wtcdb.Database) error {
+	if !req.Stripped {
+		full := &ReceiptsRequest{Hash: req.Hash, Number: req.Number, Receipts: req.Receipts}
+		if err := full.StoreResult(db); err != nil {
+			return err
+		}
+		req.Meta = ReceiptsMeta(req.Receipts)
+		return nil
+	}
+	header := getHeader(db, req.Hash, req.Number)
+	if header == nil {
+		return ErrNoHeader
+	}
+	var (
+		gas   = new(big.Int)
+		bloom types.Bloom
+	)
+	for _, meta := range req.Meta {
+		if meta.CumulativeGasUsed == nil || meta.CumulativeGasUsed.Cmp(gas) < 0 {
+			return ErrGasUsedMismatch
+		}
+		gas = meta.CumulativeGasUsed
+		for i := range bloom {
+			bloom[i] |= meta.Bloom[i]
+		}
+	}
+	if header.GasUsed == nil || gas.Cmp(header.GasUsed) != 0 {
+		return ErrGasUsedMismatch
+	}
+	if bloom != header.Bloom {
+		return ErrBloomMismatch
+	}
+	data, err := rlp.EncodeToBytes(req.Meta)
+	if err != nil {
+		return err
+	}
+	return db.Put(receiptsMetaKey(req.Hash, req.Number), data)
+}
+
+// receiptsMetaKey returns the database key of the stripped receipts of a block.
+func receiptsMetaKey(hash common.Hash, number uint64) []byte {
+	key := make([]byte, len(receiptsMetaPrefix)+8+common.HashLength)
+	copy(key, receiptsMetaPrefix)
+	binary.BigEndian.PutUint64(key[len(receiptsMetaPrefix):], number)
+	copy(key[len(receiptsMetaPrefix)+8:], hash[:])
+	return key
+}
+
+// getStoredReceiptsMeta returns the locally stored stripped receipts of a block.
+func getStoredReceiptsMeta(db wtcdb.Database, hash common.Hash, number uint64) []ReceiptMeta {
+	data, _ := db.Get(receiptsMetaKey(hash, number))
+	if len(data) == 0 {
+		return nil
+	}
+	meta, err := decodeReceiptsMeta(data)
+	if err != nil {
+		return nil
+	}
+	return meta
+}
+
+// decodeReceiptsMeta decodes a list of stripped receipts, restoring the missing
+// post states of byzantium receipts to nil.
+func decodeReceiptsMeta(data []byte) ([]ReceiptMeta, error) {
+	var meta []ReceiptMeta
+	if err := rlp.DecodeBytes(data, &meta); err != nil {
+		return nil, err
+	}
+	for i := range meta {
+		if len(meta[i].PostState) == 0 {
+			meta[i].PostState = nil
+		}
+	}
+	return meta, nil
+}
+
+// GetReceiptsMeta retrieves the receipts of a block without their logs, using
+// the full receipts if they're available locally.
+func GetReceiptsMeta(ctx context.Context, odr OdrBackend, hash common.Hash, number uint64) ([]ReceiptMeta, error) {
+	db := localDatabase(odr, KindReceiptsMeta)
+	if receipts := core.GetBlockReceipts(db, hash, number); receipts != nil {
+		return ReceiptsMeta(receipts), nil
+	}
+	if meta := getStoredReceiptsMeta(db, hash, number); meta != nil {
+		return meta, nil
+	}
+	r := &ReceiptsMetaRequest{Hash: hash, Number: number}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Meta, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// makeReceiptsChain creates a database with a block and its receipts on top of
+// the genesis block.
+func makeReceiptsChain() (wtcdb.Database, *types.Block, types.Receipts) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	core.WriteBlock(db, block)
+	core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts)
+	return db, block, receipts
+}
+
+func TestReceiptsMetaStripped(t *testing.T) {
+	sdb, block, receipts := makeReceiptsChain()
+	hash, num := block.Hash(), block.NumberU64()
+
+	odr := NewMemoryOdrBackend(sdb)
+	core.WriteHeader(odr.Database(), block.Header())
+
+	meta, err := GetReceiptsMeta(NoOdr, odr, hash, num)
+	if err != nil {
+		t.Fatalf("failed to retrieve stripped receipts: %v", err)
+	}
+	if !reflect.DeepEqual(meta, ReceiptsMeta(receipts)) {
+		t.Errorf("stripped receipts mismatch: have %v, want %v", meta, ReceiptsMeta(receipts))
+	}
+	// Stripped receipts must never be mistaken for receipts without logs
+	if core.GetBlockReceipts(odr.Database(), hash, num) != nil {
+		t.Errorf("stripped receipts served as full ones")
+	}
+	if stored := getStoredReceiptsMeta(odr.Database(), hash, num); !reflect.DeepEqual(stored, meta) {
+		t.Errorf("stored stripped receipts mismatch: have %v, want %v", stored, meta)
+	}
+	// Stripped receipts not adding up to the header should be rejected
+	ldb, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(ldb, block.Header())
+
+	tampered := ReceiptsMeta(receipts)
+	tampered[2].CumulativeGasUsed = new(big.Int).Add(tampered[2].CumulativeGasUsed, big.NewInt(1))
+	req := &ReceiptsMetaRequest{Hash: hash, Number: num, Stripped: true, Meta: tampered}
+	if err := req.StoreResult(ldb); err != ErrGasUsedMismatch {
+		t.Errorf("error mismatch for tampered gas: have %v, want %v", err, ErrGasUsedMismatch)
+	}
+	tampered = ReceiptsMeta(receipts)[1:]
+	req = &ReceiptsMetaRequest{Hash: hash, Number: num, Stripped: true, Meta: tampered}
+	if err := req.StoreResult(ldb); err != ErrBloomMismatch {
+		t.Errorf("error mismatch for dropped receipt: have %v, want %v", err, ErrBloomMismatch)
+	}
+}
+
+func TestReceiptsMetaFallback(t *testing.T) {
+	_, block, receipts := makeReceiptsChain()
+	hash, num := block.Hash(), block.NumberU64()
+
+	for _, stripping := range []bool{false, true} {
+		var kinds []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req httpOdrRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			kinds = append(kinds, req.Kind)
+
+			var resp httpOdrResponse
+			switch {
+			case req.Kind == "receiptsmeta" && stripping:
+				resp.Data, _ = rlp.EncodeToBytes(ReceiptsMeta(receipts))
+			case req.Kind == "receipts":
+				resp.Data, _ = rlp.EncodeToBytes(receipts)
+			default:
+				http.Error(w, "unsupported", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(&resp)
+		}))
+		ldb, _ := wtcdb.NewMemDatabase()
+		core.WriteHeader(ldb, block.Header())
+		odr := NewHTTPOdrBackend(ldb, srv.URL, nil)
+
+		req := &ReceiptsMetaRequest{Hash: hash, Number: num}
+		if err := odr.Retrieve(NoOdr, req); err != nil {
+			t.Fatalf("stripping %v: failed to retrieve stripped receipts: %v", stripping, err)
+		}
+		srv.Close()
+
+		if req.Stripped != stripping {
+			t.Errorf("stripping %v: stripped flag mismatch: have %v", stripping, req.Stripped)
+		}
+		if !reflect.DeepEqual(req.Meta, ReceiptsMeta(receipts)) {
+			t.Errorf("stripping %v: stripped receipts mismatch: have %v, want %v", stripping, req.Meta, ReceiptsMeta(receipts))
+		}
+		want := []string{"receiptsmeta"}
+		if !stripping {
+			want = append(want, "receipts")
+		}
+		if !reflect.DeepEqual(kinds, want) {
+			t.Errorf("stripping %v: requested kinds mismatch: have %v, want %v", stripping, kinds, want)
+		}
+		// Only the fallback has the logs, which are then available to log queries
+		if full := core.GetBlockReceipts(ldb, hash, num); (full != nil) == stripping {
+			t.Errorf("stripping %v: full receipts stored: %v", stripping, full != nil)
+		}
+	}
+}
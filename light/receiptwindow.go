@@ -0,0 +1,103 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// ReceiptWindowConcurrency is the number of blocks RetrieveReceiptWindow
+// retrieves the receipts of concurrently.
+var ReceiptWindowConcurrency = 4
+
+// ReceiptWindowError is returned by RetrieveReceiptWindow if the receipts of
+// some blocks of the window couldn't be retrieved.
+type ReceiptWindowError struct {
+	Errs map[uint64]error // errors by block number
+}
+
+func (e *ReceiptWindowError) Error() string {
+	return fmt.Sprintf("receipts of %d blocks not retrieved", len(e.Errs))
+}
+
+// RetrieveReceiptWindow retrieves, verifies and caches the receipts of the
+// blocks [center-radius, center+radius], e.g. to track the confirmations of
+// recent transactions. The headers of the blocks are looked up by headerFor,
+// returning nil for unknown ones. Blocks with cached receipts are skipped, the
+// others retrieved at most ReceiptWindowConcurrency at a time. If some blocks
+// fail, including the ones not attempted because ctx was cancelled, their
+// errors are returned in a *ReceiptWindowError.
+func RetrieveReceiptWindow(ctx context.Context, odr OdrBackend, center, radius uint64, headerFor func(uint64) *types.Header) error {
+	first, last := uint64(0), center+radius
+	if center > radius {
+		first = center - radius
+	}
+	var (
+		db      = odr.Database()
+		pending = make(chan *types.Header)
+		lock    sync.Mutex
+		errs    = make(map[uint64]error)
+		wg      sync.WaitGroup
+	)
+	fail := func(number uint64, err error) {
+		lock.Lock()
+		errs[number] = err
+		lock.Unlock()
+	}
+	for i := 0; i < ReceiptWindowConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for header := range pending {
+				r := &ReceiptsRequest{Hash: header.Hash(), Number: header.Number.Uint64()}
+				if err := odr.Retrieve(ctx, r); err != nil {
+					fail(r.Number, err)
+				}
+			}
+		}()
+	}
+	for number := first; number <= last; number++ {
+		header := headerFor(number)
+		if header == nil {
+			fail(number, ErrNoHeader)
+			continue
+		}
+		if core.GetBlockReceipts(db, header.Hash(), number) != nil {
+			continue
+		}
+		if ctx.Err() == nil {
+			select {
+			case pending <- header:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		fail(number, ctx.Err())
+	}
+	close(pending)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ReceiptWindowError{Errs: errs}
+	}
+	return nil
+}
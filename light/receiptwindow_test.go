@@ -0,0 +1,106 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// recordingOdr is a backend recording the numbers of the retrieved receipts.
+type recordingOdr struct {
+	OdrBackend
+	lock      sync.Mutex
+	retrieved map[uint64]bool
+}
+
+func (odr *recordingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	odr.lock.Lock()
+	odr.retrieved[req.(*ReceiptsRequest).Number] = true
+	odr.lock.Unlock()
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+func TestRetrieveReceiptWindow(t *testing.T) {
+	// Create a chain of 8 blocks, the receipts of the last one unavailable
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(2)
+	receipts := makeTestReceipts(txs)
+	blocks := []*types.Block{genesis}
+	for i := 0; i < 8; i++ {
+		block := makeTestBlock(blocks[len(blocks)-1].Header(), txs, nil, receipts)
+		core.WriteBlock(sdb, block)
+		if i < 7 {
+			core.WriteBlockReceipts(sdb, block.Hash(), block.NumberU64(), receipts)
+		}
+		blocks = append(blocks, block)
+	}
+	memory := NewMemoryOdrBackend(sdb)
+	for _, block := range blocks[1:] {
+		core.WriteHeader(memory.Database(), block.Header())
+	}
+	// Blocks 4 and 5 are cached already
+	for _, block := range blocks[4:6] {
+		core.WriteBlockReceipts(memory.Database(), block.Hash(), block.NumberU64(), receipts)
+	}
+	headerFor := func(number uint64) *types.Header {
+		if number >= uint64(len(blocks)) || number == 0 {
+			return nil
+		}
+		return blocks[number].Header()
+	}
+	odr := &recordingOdr{OdrBackend: memory, retrieved: make(map[uint64]bool)}
+	err := RetrieveReceiptWindow(NoOdr, odr, 6, 3, headerFor)
+	werr, ok := err.(*ReceiptWindowError)
+	if !ok {
+		t.Fatalf("error mismatch: have %v, want *ReceiptWindowError", err)
+	}
+	if len(werr.Errs) != 2 || werr.Errs[9] != ErrNoHeader || werr.Errs[8] != errMissingSource {
+		t.Errorf("per-block errors mismatch: have %v", werr.Errs)
+	}
+	for number := uint64(3); number <= 9; number++ {
+		if have, want := odr.retrieved[number], number != 4 && number != 5 && number != 9; have != want {
+			t.Errorf("block %d: retrieved %v, want %v", number, have, want)
+		}
+	}
+	for _, block := range blocks[3:8] {
+		if core.GetBlockReceipts(memory.Database(), block.Hash(), block.NumberU64()) == nil {
+			t.Errorf("block %d: receipts not cached", block.NumberU64())
+		}
+	}
+	// The window is fully cached by now
+	odr.retrieved = make(map[uint64]bool)
+	if err := RetrieveReceiptWindow(NoOdr, odr, 5, 2, headerFor); err != nil {
+		t.Errorf("cached window failed: %v", err)
+	}
+	if len(odr.retrieved) != 0 {
+		t.Errorf("cached blocks retrieved again: %v", odr.retrieved)
+	}
+	// Cancellation fails the remaining blocks
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = RetrieveReceiptWindow(ctx, odr, 1, 1, headerFor)
+	if werr, ok := err.(*ReceiptWindowError); !ok || werr.Errs[0] != ErrNoHeader || werr.Errs[1] != context.Canceled || werr.Errs[2] != context.Canceled {
+		t.Errorf("error mismatch after cancellation: have %v", err)
+	}
+}
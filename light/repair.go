@@ -0,0 +1,98 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// blockReceiptsKey is the database key of the receipts of a block, following the
+// core database schema. It's used to detect receipts stored in a malformed
+// encoding, which core.GetBlockReceipts can't tell apart from missing ones.
+func blockReceiptsKey(hash common.Hash, number uint64) []byte {
+	key := make([]byte, 1+8+common.HashLength)
+	key[0] = 'r'
+	binary.BigEndian.PutUint64(key[1:], number)
+	copy(key[9:], hash[:])
+	return key
+}
+
+// RepairBlockData scans the canonical blocks from from to to, inclusive, for
+// bodies and receipts left inconsistent with their headers, e.g. by a crash in
+// the middle of a write. The body and receipts of every affected block are
+// deleted, so they are simply retrieved again when needed, and the numbers of
+// the affected blocks are returned. Deleting is idempotent, an interrupted repair
+// is completed by scanning again. Blocks without a header are
+// skipped, as are blocks whose body or receipts are missing altogether, since
+// these are retrieved on demand anyway.
+func RepairBlockData(db wtcdb.Database, from, to uint64) ([]uint64, error) {
+	if from > to {
+		return nil, ErrInvalidRange
+	}
+	var affected []uint64
+	for number := from; ; number++ {
+		hash := core.GetCanonicalHash(db, number)
+		if header := core.GetHeader(db, hash, number); header != nil && !blockDataConsistent(db, header) {
+			core.DeleteBody(db, hash, number)
+			core.DeleteBlockReceipts(db, hash, number)
+			affected = append(affected, number)
+		}
+		if number == to {
+			break
+		}
+	}
+	return affected, nil
+}
+
+// blockDataConsistent tells whether the locally stored body and receipts of the
+// block with the given header match it.
+func blockDataConsistent(db wtcdb.Database, header *types.Header) bool {
+	hash, number := header.Hash(), header.Number.Uint64()
+
+	var body *types.Body
+	if data := getBodyRLP(db, hash, number); len(data) > 0 {
+		body = new(types.Body)
+		if err := rlp.DecodeBytes(data, body); err != nil {
+			return false
+		}
+		if types.DeriveSha(types.Transactions(body.Transactions)) != header.TxHash || types.CalcUncleHash(body.Uncles) != header.UncleHash {
+			return false
+		}
+	}
+	data, _ := db.Get(blockReceiptsKey(hash, number))
+	if len(data) == 0 {
+		return true
+	}
+	var receipts []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		return false
+	}
+	if body != nil && len(receipts) != len(body.Transactions) {
+		return false
+	}
+	plain := make(types.Receipts, len(receipts))
+	for i, receipt := range receipts {
+		plain[i] = (*types.Receipt)(receipt)
+	}
+	return types.CreateBloom(plain) == header.Bloom
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestRepairBlockData(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	parent := new(core.Genesis).MustCommit(db).Header()
+	blocks := make([]*types.Block, 4)
+	for i := range blocks {
+		txs := makeTestTxs(2)
+		receipts := makeTestReceipts(txs)
+		blocks[i] = makeTestBlock(parent, txs, nil, receipts)
+		core.WriteBlock(db, blocks[i])
+		core.WriteCanonicalHash(db, blocks[i].Hash(), blocks[i].NumberU64())
+		core.WriteBlockReceipts(db, blocks[i].Hash(), blocks[i].NumberU64(), receipts)
+		parent = blocks[i].Header()
+	}
+	// Block 1 stays consistent, block 2 lost a receipt, block 3 has a torn body
+	// and block 4 torn receipts
+	hash, num := blocks[1].Hash(), blocks[1].NumberU64()
+	core.WriteBlockReceipts(db, hash, num, core.GetBlockReceipts(db, hash, num)[:1])
+	core.WriteBodyRLP(db, blocks[2].Hash(), blocks[2].NumberU64(), []byte{0xc5, 0x01})
+	db.Put(blockReceiptsKey(blocks[3].Hash(), blocks[3].NumberU64()), []byte{0xc5, 0x01})
+
+	affected, err := RepairBlockData(db, 1, 5)
+	if err != nil {
+		t.Fatalf("failed to repair: %v", err)
+	}
+	if !reflect.DeepEqual(affected, []uint64{2, 3, 4}) {
+		t.Errorf("affected blocks mismatch: have %v, want [2 3 4]", affected)
+	}
+	for _, block := range blocks[1:] {
+		hash, num := block.Hash(), block.NumberU64()
+		if core.GetBodyRLP(db, hash, num) != nil {
+			t.Errorf("block %d: partial body not deleted", num)
+		}
+		if data, _ := db.Get(blockReceiptsKey(hash, num)); data != nil {
+			t.Errorf("block %d: partial receipts not deleted", num)
+		}
+		if core.GetHeader(db, hash, num) == nil {
+			t.Errorf("block %d: header deleted", num)
+		}
+	}
+	if core.GetBodyRLP(db, blocks[0].Hash(), 1) == nil || core.GetBlockReceipts(db, blocks[0].Hash(), 1) == nil {
+		t.Errorf("consistent block data deleted")
+	}
+	if affected, _ := RepairBlockData(db, 1, 5); len(affected) != 0 {
+		t.Errorf("repaired blocks still affected: %v", affected)
+	}
+	if _, err := RepairBlockData(db, 5, 4); err != ErrInvalidRange {
+		t.Errorf("error mismatch for reversed range: have %v, want %v", err, ErrInvalidRange)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	"github.com/wtc/go-wtc/metrics"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// DefaultResponseBufferLimit is the number of bytes of response data the
+// backends hold at once between accepting responses and storing their results.
+const DefaultResponseBufferLimit = 32 * 1024 * 1024
+
+// ResponseBuffer is the budget shared by all backends for response data that
+// was accepted but not yet stored. A backend acquires the size of a response
+// before storing it and releases it once StoreResult returned, so if many
+// retrievals complete at once, the later ones wait for the earlier ones to be
+// stored. For LES peers this holds up the delivery of further replies.
+//
+// Unlike the options of Config, it's deliberately global: it bounds the memory
+// of the whole process, which per-backend budgets couldn't do once several
+// backends share it.
+var ResponseBuffer = &ByteBudget{limit: DefaultResponseBufferLimit, gauge: metrics.NewGauge("light/odr/buffered")}
+
+// ByteBudget bounds the number of bytes held at once. An acquisition larger than
+// the whole budget is admitted if nothing else is held, so oversized responses
+// can't block forever. A budget with no positive limit admits everything.
+type ByteBudget struct {
+	lock  sync.Mutex
+	limit int
+	used  int
+	peak  int
+	freed chan struct{} // closed and replaced whenever bytes are released
+	gauge gometrics.Gauge
+}
+
+// NewByteBudget creates a budget admitting up to limit bytes at once.
+func NewByteBudget(limit int) *ByteBudget {
+	return &ByteBudget{limit: limit}
+}
+
+// Acquire waits until n bytes fit into the budget and takes them, or returns the
+// error of ctx if it's done first.
+func (b *ByteBudget) Acquire(ctx context.Context, n int) error {
+	for {
+		b.lock.Lock()
+		if b.limit <= 0 || b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			if b.used > b.peak {
+				b.peak = b.used
+			}
+			b.report()
+			b.lock.Unlock()
+			return nil
+		}
+		if b.freed == nil {
+			b.freed = make(chan struct{})
+		}
+		freed := b.freed
+		b.lock.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release returns n previously acquired bytes to the budget.
+func (b *ByteBudget) Release(n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.used -= n
+	b.report()
+	if b.freed != nil {
+		close(b.freed)
+		b.freed = nil
+	}
+}
+
+// Buffered returns the number of bytes currently held.
+func (b *ByteBudget) Buffered() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.used
+}
+
+// report updates the gauge of the budget, if any.
+func (b *ByteBudget) report() {
+	if b.gauge != nil {
+		b.gauge.Update(int64(b.used))
+	}
+}
+
+// storeBuffered stores the result of an answered request, holding its size in
+// the ResponseBuffer until it's stored. Verification is bounded by the
+// VerificationTimeout of the backend configuration.
+func storeBuffered(ctx context.Context, db wtcdb.Database, req OdrRequest) error {
+	size := ResultSize(req)
+	if err := ResponseBuffer.Acquire(ctx, size); err != nil {
+		return err
+	}
+	defer ResponseBuffer.Release(size)
+
+	return VerifyWithTimeout(StoreDatabase(db, req), req.StoreResult)
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// Tests that many large retrievals completing at once never hold more response
+// data than the budget admits.
+func TestResponseBufferBounded(t *testing.T) {
+	defer func(b *ByteBudget) { ResponseBuffer = b }(ResponseBuffer)
+	ResponseBuffer = NewByteBudget(256 * 1024)
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	codes := make([][]byte, 32)
+	for i := range codes {
+		codes[i] = make([]byte, 64*1024)
+		codes[i][0] = byte(i)
+		sdb.Put(crypto.Keccak256(codes[i]), codes[i])
+	}
+	odr := NewMemoryOdrBackend(sdb)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(codes))
+	for _, code := range codes {
+		wg.Add(1)
+		go func(code []byte) {
+			defer wg.Done()
+			errs <- odr.Retrieve(context.Background(), &CodeRequest{Hash: crypto.Keccak256Hash(code)})
+		}(code)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("failed to retrieve code: %v", err)
+		}
+	}
+	if peak := ResponseBuffer.peak; peak > 256*1024 {
+		t.Errorf("buffered bytes exceeded budget: have %d, want at most %d", peak, 256*1024)
+	}
+	if have := ResponseBuffer.Buffered(); have != 0 {
+		t.Errorf("buffered bytes left after retrievals: have %d, want 0", have)
+	}
+}
+
+func TestByteBudget(t *testing.T) {
+	b := NewByteBudget(100)
+	if err := b.Acquire(context.Background(), 60); err != nil {
+		t.Fatalf("failed to acquire: %v", err)
+	}
+	// Exceeding the budget waits until enough is released
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Acquire(ctx, 50); err != context.DeadlineExceeded {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	done := make(chan error)
+	go func() { done <- b.Acquire(context.Background(), 50) }()
+	select {
+	case <-done:
+		t.Fatalf("acquired beyond the budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.Release(60)
+	if err := <-done; err != nil {
+		t.Fatalf("failed to acquire after release: %v", err)
+	}
+	b.Release(50)
+
+	// An oversized acquisition is admitted into an empty budget
+	if err := b.Acquire(context.Background(), 500); err != nil {
+		t.Fatalf("failed to acquire oversized: %v", err)
+	}
+	if have := b.Buffered(); have != 500 {
+		t.Errorf("buffered bytes mismatch: have %d, want 500", have)
+	}
+}
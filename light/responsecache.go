@@ -0,0 +1,71 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ResponseCache memoizes the answers assembled for requests by their identity,
+// as encoded by MarshalRequest, so a server receiving the same request from many
+// clients (e.g. for a popular account or contract) builds the proof only once.
+type ResponseCache struct {
+	cache        *lru.Cache
+	hits, misses uint64
+}
+
+// NewResponseCache creates a cache of the answers to the given number of most
+// recently served requests.
+func NewResponseCache(size int) *ResponseCache {
+	cache, _ := lru.New(size)
+	return &ResponseCache{cache: cache}
+}
+
+// Answer fills in the result fields of req from the cache, or from the source
+// database if the request wasn't answered before.
+func (c *ResponseCache) Answer(source wtcdb.Database, req OdrRequest) error {
+	key, err := MarshalRequest(req)
+	if err != nil {
+		return answerRequest(source, req)
+	}
+	if cached, ok := c.cache.Get(string(key)); ok {
+		atomic.AddUint64(&c.hits, 1)
+		// Requests are plain structs and the cached one has the same identity,
+		// so it's copied over wholesale
+		reflect.ValueOf(req).Elem().Set(reflect.ValueOf(cached).Elem())
+		return nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	if err := answerRequest(source, req); err != nil {
+		return err
+	}
+	// Cache a copy, as storing the result may update the request
+	answer := reflect.New(reflect.TypeOf(req).Elem())
+	answer.Elem().Set(reflect.ValueOf(req).Elem())
+	c.cache.Add(string(key), answer.Interface())
+	return nil
+}
+
+// Stats returns the number of requests answered from the cache and from the
+// source database.
+func (c *ResponseCache) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
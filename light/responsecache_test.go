@@ -0,0 +1,55 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestResponseCache(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	cache := NewResponseCache(16)
+
+	// Two clients asking for the same account are answered with one proof
+	for i := 0; i < 2; i++ {
+		odr := NewMemoryOdrBackend(sdb)
+		odr.SetResponseCache(cache)
+		account, err := GetAccount(NoOdr, odr, id, acc1Addr)
+		if err != nil {
+			t.Fatalf("client %d: failed to retrieve account: %v", i, err)
+		}
+		if account == nil || account.Balance.Cmp(big.NewInt(1000)) != 0 {
+			t.Errorf("client %d: account mismatch: have %v, want balance %d", i, account, 1000)
+		}
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("cache stats mismatch: have %d hits, %d misses, want 1, 1", hits, misses)
+	}
+	// Requests for another identity aren't served from the cache
+	odr := NewMemoryOdrBackend(sdb)
+	odr.SetResponseCache(cache)
+	if _, err := GetAccount(NoOdr, odr, id, acc2Addr); err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 2 {
+		t.Errorf("cache stats mismatch: have %d hits, %d misses, want 1, 2", hits, misses)
+	}
+}
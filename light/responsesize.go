@@ -0,0 +1,102 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrResponseTooLarge is returned if a response exceeds the limit configured for
+// its request kind, see the MaxResponseBytes option of Config.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// ResponseLimits holds the maximum size in bytes of the responses to retrievals
+// of each kind, as read off the wire before any decoding.
+type ResponseLimits map[RequestKind]int64
+
+// defaultResponseLimits are the limits enforced by the network layers of the
+// backends for the kinds missing from their configuration. They are generous for
+// the kinds whose responses grow with the chain data they carry (bodies,
+// receipts, batches), and tight for single proofs and headers. It's never
+// modified.
+var defaultResponseLimits = ResponseLimits{
+	KindTrie:          1 << 20,
+	KindAccount:       1 << 20,
+	KindStorageRoot:   1 << 20,
+	KindCodeHash:      1 << 20,
+	KindTxCount:       1 << 20,
+	KindCode:          4 << 20,
+	KindCodeSize:      1 << 10,
+	KindBlock:         32 << 20,
+	KindTxByIndex:     32 << 20,
+	KindTxLookup:      32 << 20,
+	KindBatchBlock:    64 << 20,
+	KindReceipts:      32 << 20,
+	KindReceiptsMeta:  32 << 20,
+	KindTxLogs:        32 << 20,
+	KindBatchTrie:     16 << 20,
+	KindBatchHeader:   16 << 20,
+	KindHeaderSegment: 16 << 20,
+	KindCht:           1 << 20,
+	KindStateRoot:     1 << 20,
+	KindBlockBloom:    1 << 20,
+	KindHeader:        1 << 20,
+}
+
+// fallbackResponseLimit is used for request kinds missing from the table.
+const fallbackResponseLimit = 16 << 20
+
+// Limit returns the configured response size limit for the given request kind.
+func (l ResponseLimits) Limit(kind RequestKind) int64 {
+	if limit, ok := l[kind]; ok {
+		return limit
+	}
+	return fallbackResponseLimit
+}
+
+// ResponseLimit returns the response size limit for the given request kind, the
+// default one if it's missing from MaxResponseBytes.
+func (c *Config) ResponseLimit(kind RequestKind) int64 {
+	if limit, ok := c.MaxResponseBytes[kind]; ok {
+		return limit
+	}
+	return defaultResponseLimits.Limit(kind)
+}
+
+// limitedReader reads a response off the wire, failing with ErrResponseTooLarge
+// as soon as more than the allowed number of bytes arrive. Unlike io.LimitReader
+// it doesn't silently truncate the response, and it never reads more than one
+// byte past the limit, so an oversized reply isn't buffered.
+type limitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+// Read implements io.Reader.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.left {
+		l.left = -1
+		return 0, ErrResponseTooLarge
+	}
+	l.left -= int64(n)
+	return n, err
+}
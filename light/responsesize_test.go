@@ -0,0 +1,95 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// endlessBody is a response body streaming a JSON reply whose data never ends,
+// counting the bytes read off it.
+type endlessBody struct {
+	prefix []byte
+	read   int
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	for i := range p {
+		if b.read < len(b.prefix) {
+			p[i] = b.prefix[b.read]
+		} else {
+			p[i] = '0'
+		}
+		b.read++
+	}
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error { return nil }
+
+// stubTransport is a network layer answering every request with the same body.
+type stubTransport struct {
+	body io.ReadCloser
+}
+
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: t.body, Request: req}, nil
+}
+
+func TestHTTPOdrBackendResponseLimit(t *testing.T) {
+	ldb, _ := wtcdb.NewMemDatabase()
+	hash := crypto.Keccak256Hash(testContractCode)
+
+	// An oversized reply is aborted right past the limit
+	body := &endlessBody{prefix: []byte(`{"data":"0x`)}
+	odr := NewHTTPOdrBackend(ldb, "http://provider", nil)
+	config := DefaultConfig()
+	config.MaxResponseBytes = ResponseLimits{KindCode: 1024}
+	odr.SetConfig(config)
+	odr.client = &http.Client{Transport: &stubTransport{body}}
+	if err := odr.Retrieve(NoOdr, &CodeRequest{Id: &TrieID{}, Hash: hash}); err != ErrResponseTooLarge {
+		t.Fatalf("error mismatch for oversized reply: have %v, want %v", err, ErrResponseTooLarge)
+	}
+	if body.read > 1025 {
+		t.Errorf("oversized reply buffered: %d bytes read, limit 1024", body.read)
+	}
+	// A reply within the limit is accepted
+	reply := []byte(`{"data":"0x` + common.Bytes2Hex(testContractCode) + `"}`)
+	odr.client = &http.Client{Transport: &stubTransport{ioutil.NopCloser(bytes.NewReader(reply))}}
+	code := &CodeRequest{Id: &TrieID{}, Hash: hash}
+	if err := odr.Retrieve(NoOdr, code); err != nil {
+		t.Fatalf("failed to retrieve code within limit: %v", err)
+	}
+	if !bytes.Equal(code.Data, testContractCode) {
+		t.Errorf("code mismatch: have %x, want %x", code.Data, testContractCode)
+	}
+	// Kinds without a configured limit fall back to the default one
+	if limit := config.ResponseLimit(KindTrie); limit != defaultResponseLimits[KindTrie] {
+		t.Errorf("default limit mismatch: have %d, want %d", limit, defaultResponseLimits[KindTrie])
+	}
+	if limit := config.ResponseLimit(KindBloomTrieRoot); limit != fallbackResponseLimit {
+		t.Errorf("fallback limit mismatch: have %d, want %d", limit, fallbackResponseLimit)
+	}
+}
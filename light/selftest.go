@@ -0,0 +1,565 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// errOffline is returned by the backend the self test reads results back with,
+// so anything not stored locally is reported instead of retrieved.
+var errOffline = errors.New("self test is offline")
+
+// offlineOdr is an OdrBackend that only has a local database.
+type offlineOdr struct {
+	db wtcdb.Database
+}
+
+func (o offlineOdr) Database() wtcdb.Database                           { return o.db }
+func (o offlineOdr) Retrieve(ctx context.Context, req OdrRequest) error { return errOffline }
+
+// selfTestFixture is the synthetic chain the self test retrieves data from.
+type selfTestFixture struct {
+	db      wtcdb.Database
+	addr    common.Address
+	state   *TrieID
+	storage *TrieID
+	slot    common.Hash
+	code    []byte
+	block   *types.Block
+	child   *types.Header
+	chtRoot common.Hash
+}
+
+// newSelfTestFixture deterministically creates a chain of a single block with a
+// contract in its state, its receipts, a CHT and a checkpoint covering it, and
+// a header extending it.
+func newSelfTestFixture() (*selfTestFixture, error) {
+	db, _ := wtcdb.NewMemDatabase()
+	f := &selfTestFixture{
+		db:   db,
+		addr: common.BytesToAddress(crypto.Keccak256([]byte("light self test"))),
+		slot: common.BigToHash(big.NewInt(1)),
+		code: []byte{byte(0x60), byte(0x01), byte(0x00)}, // PUSH1 1 STOP
+	}
+	st, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	st.SetBalance(f.addr, big.NewInt(1000), new(big.Int), new(big.Int))
+	st.SetNonce(f.addr, 7)
+	st.SetCode(f.addr, f.code)
+	st.SetState(f.addr, f.slot, common.BigToHash(big.NewInt(42)))
+	root, err := st.CommitTo(db, true)
+	if err != nil {
+		return nil, err
+	}
+	// Create a block with a single logging transaction on top of the state
+	receipt := types.NewReceipt(nil, false, big.NewInt(21000))
+	receipt.Logs = []*types.Log{{Address: f.addr, Topics: []common.Hash{f.slot}}}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	tx := types.NewTransaction(0, f.addr, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), GasUsed: big.NewInt(21000), Root: root}
+	f.block = types.NewBlock(header, []*types.Transaction{tx}, nil, []*types.Receipt{receipt})
+
+	hash, num := f.block.Hash(), f.block.NumberU64()
+	if err := core.WriteBlock(db, f.block); err != nil {
+		return nil, err
+	}
+	if err := core.WriteBlockReceipts(db, hash, num, types.Receipts{receipt}); err != nil {
+		return nil, err
+	}
+	if err := core.WriteTxLookupEntries(db, f.block); err != nil {
+		return nil, err
+	}
+	if err := core.WriteTd(db, hash, num, f.block.Difficulty()); err != nil {
+		return nil, err
+	}
+	if err := core.WriteCanonicalHash(db, hash, num); err != nil {
+		return nil, err
+	}
+	// Extend it with a header known only by its linkage to the block
+	f.child = &types.Header{ParentHash: hash, Number: big.NewInt(2), Time: big.NewInt(1), Difficulty: big.NewInt(1)}
+	if err := core.WriteHeader(db, f.child); err != nil {
+		return nil, err
+	}
+	if err := core.WriteCanonicalHash(db, f.child.Hash(), 2); err != nil {
+		return nil, err
+	}
+	// Commit the block into a CHT and checkpoint the section
+	cht, _ := trie.New(common.Hash{}, db)
+	node, _ := rlp.EncodeToBytes(ChtNode{Hash: hash, Td: f.block.Difficulty()})
+	cht.Update(chtKey(num), node)
+	if f.chtRoot, err = cht.CommitTo(db); err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{SectionHead: hash, ChtRoot: f.chtRoot, BloomRoot: crypto.Keccak256Hash(f.chtRoot[:])}
+	if err := WriteCheckpoint(db, cp); err != nil {
+		return nil, err
+	}
+	f.state = StateTrieID(f.block.Header())
+	f.storage = StorageTrieID(f.state, crypto.Keccak256Hash(f.addr[:]), st.StorageTrie(f.addr).Hash())
+	return f, nil
+}
+
+// selfTestCase is a single round-trip of the self test: the request is answered
+// from the fixture, stored, then read back by check. If tamper is set, it must
+// turn an answered request into one that fails verification.
+type selfTestCase struct {
+	local  bool // whether the result goes into the scratch database
+	req    func() OdrRequest
+	check  func(ctx context.Context, odr OdrBackend) error
+	tamper func(req OdrRequest)
+}
+
+// SelfTest runs a deterministic round-trip of every request kind through the
+// database of the backend: a synthetic result is stored the way a retrieval
+// would, read back and compared, then a tampered result is checked to be
+// rejected. It never touches the network, so it's safe to run on a live node
+// as a health check. Results keyed by block are stored in a scratch database
+// so the synthetic chain can't mix with the real one; trie nodes and code are
+// content addressed and go into the backend database, where they stay.
+func SelfTest(backend OdrBackend) error {
+	f, err := newSelfTestFixture()
+	if err != nil {
+		return fmt.Errorf("failed to create fixture: %v", err)
+	}
+	scratch, _ := wtcdb.NewMemDatabase()
+	var (
+		ctx       = context.Background()
+		hash, num = f.block.Hash(), f.block.NumberU64()
+		bodyRlp   = getBodyRLP(f.db, hash, num)
+		code      = crypto.Keccak256Hash(f.code)
+		chtNum    = num/ChtFrequency + 1
+	)
+	checkSlot := func(ctx context.Context, odr OdrBackend) error {
+		t, err := trie.New(f.storage.Root, odr.Database())
+		if err != nil {
+			return err
+		}
+		value, err := t.TryGet(crypto.Keccak256(f.slot[:]))
+		if err != nil {
+			return err
+		}
+		want, _ := rlp.EncodeToBytes([]byte{42})
+		if !bytes.Equal(value, want) {
+			return fmt.Errorf("storage slot mismatch: have %x, want %x", value, want)
+		}
+		return nil
+	}
+	cases := map[RequestKind]selfTestCase{
+		KindTrie: {
+			req:    func() OdrRequest { return &TrieRequest{Id: f.storage, Key: crypto.Keccak256(f.slot[:])} },
+			check:  checkSlot,
+			tamper: truncateProof,
+		},
+		KindBatchTrie: {
+			req: func() OdrRequest {
+				return &BatchTrieRequest{Requests: []*TrieRequest{{Id: f.storage, Key: crypto.Keccak256(f.slot[:])}}}
+			},
+			check: checkSlot,
+			tamper: func(req OdrRequest) {
+				r := req.(*BatchTrieRequest)
+				r.Proofs = r.Proofs[:0]
+			},
+		},
+		KindAccount: {
+			req: func() OdrRequest { return &AccountRequest{Id: f.state, Address: f.addr} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				balance, nonce, err := BalanceAndNonce(ctx, odr, f.state, f.addr)
+				if err != nil {
+					return err
+				}
+				if balance.Cmp(big.NewInt(1000)) != 0 || nonce != 7 {
+					return fmt.Errorf("account mismatch: have %v/%d, want 1000/7", balance, nonce)
+				}
+				return nil
+			},
+			tamper: truncateProof,
+		},
+		KindStorageRoot: {
+			req: func() OdrRequest { return &StorageRootRequest{StateId: f.state, Address: f.addr} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				root, err := GetStorageRoot(ctx, odr, f.state, f.addr)
+				if err != nil {
+					return err
+				}
+				if root != f.storage.Root {
+					return fmt.Errorf("storage root mismatch: have %x, want %x", root, f.storage.Root)
+				}
+				return nil
+			},
+			tamper: truncateProof,
+		},
+		KindCodeHash: {
+			req: func() OdrRequest { return &CodeHashRequest{StateId: f.state, Address: f.addr} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				hash, err := GetCodeHash(ctx, odr, f.state, f.addr)
+				if err != nil {
+					return err
+				}
+				if hash != code {
+					return fmt.Errorf("code hash mismatch: have %x, want %x", hash, code)
+				}
+				return nil
+			},
+			tamper: truncateProof,
+		},
+		KindCode: {
+			req: func() OdrRequest { return &CodeRequest{Id: f.storage, Hash: code} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				if data, _ := odr.Database().Get(code[:]); !bytes.Equal(data, f.code) {
+					return fmt.Errorf("code mismatch: have %x, want %x", data, f.code)
+				}
+				return nil
+			},
+		},
+		KindCodeSize: {
+			req: func() OdrRequest { return &CodeSizeRequest{Id: f.storage, Hash: code} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				size, err := GetCodeSize(ctx, odr, f.storage, code)
+				if err != nil {
+					return err
+				}
+				if size != uint64(len(f.code)) {
+					return fmt.Errorf("code size mismatch: have %d, want %d", size, len(f.code))
+				}
+				return nil
+			},
+		},
+		KindCht: {
+			local: true,
+			req:   func() OdrRequest { return &ChtRequest{ChtNum: chtNum, BlockNum: num, ChtRoot: f.chtRoot} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				if have := core.GetCanonicalHash(odr.Database(), num); have != hash {
+					return fmt.Errorf("canonical hash mismatch: have %x, want %x", have, hash)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*ChtRequest)
+				r.Header = types.CopyHeader(r.Header)
+				r.Header.Extra = []byte("tampered")
+			},
+		},
+		KindStateRoot: {
+			local: true,
+			req: func() OdrRequest {
+				return &StateRootRequest{Number: num, Hash: hash, ChtNum: chtNum, ChtRoot: f.chtRoot}
+			},
+			check: func(ctx context.Context, odr OdrBackend) error {
+				root, err := GetStateRoot(ctx, odr, num, hash)
+				if err != nil {
+					return err
+				}
+				if root != f.block.Root() {
+					return fmt.Errorf("state root mismatch: have %x, want %x", root, f.block.Root())
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*StateRootRequest)
+				r.Header = types.CopyHeader(r.Header)
+				r.Header.Root = common.Hash{}
+			},
+		},
+		KindBlockBloom: {
+			local: true,
+			req: func() OdrRequest {
+				return &BlockBloomRequest{Number: num, Hash: hash, ChtNum: chtNum, ChtRoot: f.chtRoot}
+			},
+			check: func(ctx context.Context, odr OdrBackend) error {
+				bloom, err := GetBlockBloom(ctx, odr, num, hash)
+				if err != nil {
+					return err
+				}
+				if bloom != f.block.Bloom() {
+					return fmt.Errorf("logs bloom mismatch: have %x, want %x", bloom, f.block.Bloom())
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*BlockBloomRequest)
+				r.Header = types.CopyHeader(r.Header)
+				r.Header.Bloom[0] ^= 0xff
+			},
+		},
+		KindHeader: {
+			local: true,
+			req:   func() OdrRequest { return &HeaderByHashRequest{Hash: hash, ChtNum: chtNum, ChtRoot: f.chtRoot} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				header, err := GetHeaderByHash(ctx, odr, hash)
+				if err != nil {
+					return err
+				}
+				if header.Hash() != hash {
+					return fmt.Errorf("header mismatch: have %x, want %x", header.Hash(), hash)
+				}
+				return nil
+			},
+			tamper: truncateProof,
+		},
+		KindBatchHeader: {
+			local: true,
+			req: func() OdrRequest {
+				return &BatchHeaderRequest{Hashes: []common.Hash{hash, f.child.Hash()}, ChtNum: chtNum, ChtRoot: f.chtRoot}
+			},
+			check: func(ctx context.Context, odr OdrBackend) error {
+				hashes := []common.Hash{hash, f.child.Hash()}
+				headers, errs := GetHeadersByHash(ctx, odr, hashes)
+				for i, header := range headers {
+					if errs[i] != nil {
+						return errs[i]
+					}
+					if header.Hash() != hashes[i] {
+						return fmt.Errorf("header %d mismatch: have %x, want %x", i, header.Hash(), hashes[i])
+					}
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*BatchHeaderRequest)
+				r.Headers = r.Headers[:1]
+			},
+		},
+		KindHeaderSegment: {
+			local: true,
+			req:   func() OdrRequest { return &HeaderSegmentRequest{Anchor: hash, Number: num, Amount: 1} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				if getHeader(odr.Database(), f.child.Hash(), num+1) == nil {
+					return fmt.Errorf("header %x not stored", f.child.Hash())
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*HeaderSegmentRequest)
+				r.Headers = []*types.Header{types.CopyHeader(r.Headers[0])}
+				r.Headers[0].ParentHash = common.Hash{}
+			},
+		},
+		KindBlock: {
+			local: true,
+			req:   func() OdrRequest { return &BlockRequest{Hash: hash, Number: num} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				if have := getBodyRLP(backendDatabase(odr), hash, num); !bytes.Equal(have, bodyRlp) {
+					return fmt.Errorf("body mismatch: have %x, want %x", have, bodyRlp)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*BlockRequest)
+				r.Rlp, _ = rlp.EncodeToBytes(&types.Body{Uncles: []*types.Header{f.block.Header()}})
+			},
+		},
+		KindBatchBlock: {
+			local: true,
+			req: func() OdrRequest {
+				return &BatchBlockRequest{Hashes: []common.Hash{hash, crypto.Keccak256Hash(hash[:])}, Numbers: []uint64{num, num}}
+			},
+			check: func(ctx context.Context, odr OdrBackend) error {
+				if have := getBodyRLP(backendDatabase(odr), hash, num); !bytes.Equal(have, bodyRlp) {
+					return fmt.Errorf("body mismatch: have %x, want %x", have, bodyRlp)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*BatchBlockRequest)
+				r.Rlps = r.Rlps[:1]
+			},
+		},
+		KindTxByIndex: {
+			local: true,
+			req:   func() OdrRequest { return &TxByIndexRequest{BlockHash: hash, Number: num} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				tx, err := GetTransactionByIndex(ctx, odr, hash, num, 0)
+				if err != nil {
+					return err
+				}
+				if want := f.block.Transactions()[0].Hash(); tx.Hash() != want {
+					return fmt.Errorf("transaction mismatch: have %x, want %x", tx.Hash(), want)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				req.(*TxByIndexRequest).Index = 1
+			},
+		},
+		KindTxCount: {
+			local: true,
+			req:   func() OdrRequest { return &TxCountRequest{BlockHash: hash, Number: num} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				count, err := GetTxCount(ctx, odr, hash, num)
+				if err != nil {
+					return err
+				}
+				if want := uint64(len(f.block.Transactions())); count != want {
+					return fmt.Errorf("transaction count mismatch: have %d, want %d", count, want)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				req.(*TxCountRequest).Count--
+			},
+		},
+		KindReceipts: {
+			local: true,
+			req:   func() OdrRequest { return &ReceiptsRequest{Hash: hash, Number: num} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				receipts, err := GetBlockReceipts(ctx, odr, hash, num)
+				if err != nil {
+					return err
+				}
+				if have, want := types.DeriveSha(receipts), f.block.ReceiptHash(); have != want {
+					return fmt.Errorf("receipts mismatch: have %x, want %x", have, want)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*ReceiptsRequest)
+				receipt := *r.Receipts[0]
+				receipt.Logs = []*types.Log{{Address: f.addr, Topics: []common.Hash{hash}}}
+				r.Receipts = types.Receipts{&receipt}
+			},
+		},
+		KindTxLogs: {
+			local: true,
+			req: func() OdrRequest {
+				return &TxLogsRequest{TxHash: f.block.Transactions()[0].Hash(), BlockHash: hash, Number: num}
+			},
+			check: func(ctx context.Context, odr OdrBackend) error {
+				receipts := core.GetBlockReceipts(odr.Database(), hash, num)
+				if len(receipts) != 1 || len(receipts[0].Logs) != 1 {
+					return fmt.Errorf("stored receipts mismatch: have %v", receipts)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*TxLogsRequest)
+				receipt := *r.Receipts[0]
+				receipt.Logs = nil
+				r.Receipts = types.Receipts{&receipt}
+			},
+		},
+		KindTxLookup: {
+			local: true,
+			req:   func() OdrRequest { return &TxLookupRequest{TxHash: f.block.Transactions()[0].Hash()} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				have, _, _ := core.GetTxLookupEntry(odr.Database(), f.block.Transactions()[0].Hash())
+				if have != hash {
+					return fmt.Errorf("lookup entry mismatch: have %x, want %x", have, hash)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				req.(*TxLookupRequest).Index = 1
+			},
+		},
+		KindReceiptsMeta: {
+			local: true,
+			req:   func() OdrRequest { return &ReceiptsMetaRequest{Hash: hash, Number: num} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				meta := getStoredReceiptsMeta(odr.Database(), hash, num)
+				if len(meta) != 1 || meta[0].CumulativeGasUsed.Cmp(f.block.GasUsed()) != 0 {
+					return fmt.Errorf("stripped receipts mismatch: have %v", meta)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				r := req.(*ReceiptsMetaRequest)
+				r.Meta[0].Bloom = types.Bloom{}
+			},
+		},
+		KindBloomTrieRoot: {
+			local: true,
+			req:   func() OdrRequest { return &BloomTrieRootRequest{} },
+			check: func(ctx context.Context, odr OdrBackend) error {
+				want := GetCheckpoint(f.db, 0).BloomRoot
+				if have := GetTrustedBloomTrieRoot(odr.Database(), 0); have != want {
+					return fmt.Errorf("bloom trie root mismatch: have %x, want %x", have, want)
+				}
+				return nil
+			},
+			tamper: func(req OdrRequest) {
+				req.(*BloomTrieRootRequest).Root = common.Hash{}
+			},
+		},
+	}
+	// The block keyed requests need the checkpoint and the header available
+	if err := WriteCheckpoint(scratch, GetCheckpoint(f.db, 0)); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := core.WriteHeader(scratch, f.block.Header()); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+	for kind := KindTrie; kind < numRequestKinds; kind++ {
+		tc, ok := cases[kind]
+		if !ok {
+			return fmt.Errorf("%v: no self test", kind)
+		}
+		config := BackendConfig(backend)
+		db := BindConfig(backend.Database(), config)
+		if tc.local {
+			db = BindConfig(scratch, config)
+		}
+		req := tc.req()
+		if err := answerRequest(f.db, req); err != nil {
+			return fmt.Errorf("%v: failed to answer: %v", kind, err)
+		}
+		if err := req.StoreResult(StoreDatabase(db, req)); err != nil {
+			return fmt.Errorf("%v: failed to store: %v", kind, err)
+		}
+		if err := tc.check(ctx, offlineOdr{db}); err != nil {
+			return fmt.Errorf("%v: %v", kind, err)
+		}
+		if tc.tamper == nil {
+			continue
+		}
+		req = tc.req()
+		answerRequest(f.db, req)
+		tc.tamper(req)
+		if err := req.StoreResult(BindConfig(scratch, config)); err == nil {
+			return fmt.Errorf("%v: tampered result accepted", kind)
+		}
+	}
+	return nil
+}
+
+// truncateProof drops the last node of the proof in a trie based request.
+func truncateProof(req OdrRequest) {
+	switch r := req.(type) {
+	case *TrieRequest:
+		r.Proof = r.Proof[:len(r.Proof)-1]
+	case *AccountRequest:
+		r.Proof = r.Proof[:len(r.Proof)-1]
+	case *StorageRootRequest:
+		r.Proof = r.Proof[:len(r.Proof)-1]
+	case *CodeHashRequest:
+		r.Proof = r.Proof[:len(r.Proof)-1]
+	case *HeaderByHashRequest:
+		r.Proof = r.Proof[:len(r.Proof)-1]
+	}
+}
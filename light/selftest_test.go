@@ -0,0 +1,62 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(NewMemoryOdrBackend(nil)); err != nil {
+		t.Fatalf("self test failed: %v", err)
+	}
+	// A backend that can't store anything should fail the self test
+	db, _ := wtcdb.NewMemDatabase()
+	broken := &testOdr{ldb: &failingDatabase{db}}
+	if err := SelfTest(broken); err == nil {
+		t.Fatalf("self test passed with a failing database")
+	}
+}
+
+func TestMemoryOdrBackend(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := NewMemoryOdrBackend(sdb)
+
+	balance, nonce, err := BalanceAndNonce(NoOdr, odr, StateTrieID(header), testBankAddress)
+	if err != nil {
+		t.Fatalf("failed to retrieve account: %v", err)
+	}
+	if balance.Cmp(testBankFunds) != 0 || nonce != 3 {
+		t.Errorf("account mismatch: have %v/%d, want %v/%d", balance, nonce, testBankFunds, 3)
+	}
+	if err := odr.Retrieve(NoOdr, &BloomTrieRootRequest{}); err != errMissingSource {
+		t.Errorf("error mismatch for missing checkpoint: have %v, want %v", err, errMissingSource)
+	}
+}
+
+// failingDatabase is a database rejecting all writes.
+type failingDatabase struct {
+	wtcdb.Database
+}
+
+func (db *failingDatabase) Put(key []byte, value []byte) error {
+	return errors.New("write failed")
+}
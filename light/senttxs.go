@@ -0,0 +1,113 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// SentTransactionsConcurrency is the number of blocks SentTransactions retrieves
+// the bodies of concurrently.
+var SentTransactionsConcurrency = 4
+
+// MaxSentTransactionsRange is the maximum number of blocks SentTransactions
+// scans at once.
+const MaxSentTransactionsRange = 1024
+
+// SentTransactions retrieves the transactions sent by addr in the blocks from
+// from to to, inclusive, in chain order. The headers of the blocks are looked up
+// by headerFor, returning nil for unknown ones. The body of every block is
+// retrieved, verified against the transaction root of its header and cached,
+// at most SentTransactionsConcurrency at a time, and the sender of every
+// transaction recovered. That's heavy, which is why ranges are limited to
+// MaxSentTransactionsRange blocks, and callers should prefer much smaller ones.
+func SentTransactions(ctx context.Context, odr OdrBackend, addr common.Address, from, to uint64, headerFor func(uint64) *types.Header) ([]*types.Transaction, error) {
+	if from > to || to-from >= MaxSentTransactionsRange {
+		return nil, ErrInvalidRange
+	}
+	var (
+		sent    = make([][]*types.Transaction, to-from+1)
+		errs    = make([]error, to-from+1)
+		pending = make(chan *types.Header)
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < SentTransactionsConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for header := range pending {
+				i := header.Number.Uint64() - from
+				sent[i], errs[i] = sentInBlock(ctx, odr, addr, header)
+			}
+		}()
+	}
+	for number := from; number <= to; number++ {
+		header := headerFor(number)
+		if header == nil {
+			errs[number-from] = ErrNoHeader
+			break
+		}
+		if ctx.Err() == nil {
+			select {
+			case pending <- header:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		errs[number-from] = ctx.Err()
+		break
+	}
+	close(pending)
+	wg.Wait()
+
+	var txs []*types.Transaction
+	for i := range sent {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		txs = append(txs, sent[i]...)
+	}
+	return txs, nil
+}
+
+// sentInBlock retrieves the verified body of the block with the given header and
+// returns the transactions in it sent by addr.
+func sentInBlock(ctx context.Context, odr OdrBackend, addr common.Address, header *types.Header) ([]*types.Transaction, error) {
+	body, err := GetBody(ctx, odr, header.Hash(), header.Number.Uint64())
+	if err != nil {
+		return nil, err
+	}
+	if types.DeriveSha(types.Transactions(body.Transactions)) != header.TxHash {
+		return nil, ErrTxHashMismatch
+	}
+	var txs []*types.Transaction
+	for _, tx := range body.Transactions {
+		// Unprotected transactions are recovered as homestead ones by the signer
+		from, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+		if err != nil {
+			return nil, ErrInvalidSender
+		}
+		if from == addr {
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestSentTransactions(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+
+	// Mix transactions of the bank, some replay protected, with foreign ones
+	var (
+		bank    = makeTestTxs(3)
+		eip155  = types.NewEIP155Signer(big.NewInt(1))
+		protect = func(tx *types.Transaction) *types.Transaction {
+			tx, _ = types.SignTx(types.NewTransaction(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), tx.GasPrice(), nil), eip155, testBankKey)
+			return tx
+		}
+		foreign, _ = types.SignTx(types.NewTransaction(0, acc2Addr, big.NewInt(1), bigTxGas, big.NewInt(1), nil), types.HomesteadSigner{}, acc1Key)
+		bodies     = [][]*types.Transaction{{bank[0], foreign}, nil, {protect(bank[1]), bank[2]}, {foreign}}
+		headers    = make(map[uint64]*types.Header)
+		parent     = genesis.Header()
+	)
+	for _, txs := range bodies {
+		block := makeTestBlock(parent, txs, nil, nil)
+		writeTestBlock(sdb, ldb, block, nil)
+		headers[block.NumberU64()], parent = block.Header(), block.Header()
+	}
+	headerFor := func(number uint64) *types.Header { return headers[number] }
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+
+	txs, err := SentTransactions(context.Background(), odr, testBankAddress, 1, 4, headerFor)
+	if err != nil {
+		t.Fatalf("failed to retrieve sent transactions: %v", err)
+	}
+	want := []*types.Transaction{bank[0], bodies[2][0], bank[2]}
+	if len(txs) != len(want) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), len(want))
+	}
+	for i, tx := range txs {
+		if tx.Hash() != want[i].Hash() {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, tx.Hash(), want[i].Hash())
+		}
+	}
+	for number, header := range headers {
+		if core.GetBodyRLP(ldb, header.Hash(), number) == nil {
+			t.Errorf("body of block %d not cached", number)
+		}
+	}
+	// Unknown headers, bodies not matching their header and cancellation fail
+	if _, err := SentTransactions(context.Background(), odr, testBankAddress, 1, 5, headerFor); err != ErrNoHeader {
+		t.Errorf("error mismatch for unknown header: have %v, want %v", err, ErrNoHeader)
+	}
+	fdb, _ := wtcdb.NewMemDatabase()
+	core.WriteBody(sdb, headers[4].Hash(), 4, &types.Body{Transactions: bank[:1]})
+	for _, header := range headers {
+		core.WriteHeader(fdb, header)
+	}
+	if _, err := SentTransactions(context.Background(), &testOdr{sdb: sdb, ldb: fdb}, testBankAddress, 1, 4, headerFor); err != ErrTxHashMismatch {
+		t.Errorf("error mismatch for forged body: have %v, want %v", err, ErrTxHashMismatch)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cdb, _ := wtcdb.NewMemDatabase()
+	if _, err := SentTransactions(ctx, &testOdr{sdb: sdb, ldb: cdb}, testBankAddress, 1, 4, headerFor); err != context.Canceled {
+		t.Errorf("error mismatch for cancelled scan: have %v, want %v", err, context.Canceled)
+	}
+	if _, err := SentTransactions(context.Background(), odr, testBankAddress, 0, MaxSentTransactionsRange, headerFor); err != ErrInvalidRange {
+		t.Errorf("error mismatch for oversized range: have %v, want %v", err, ErrInvalidRange)
+	}
+}
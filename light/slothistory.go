@@ -0,0 +1,145 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/types"
+)
+
+// HistoricalSlot retrieves the content of a storage slot of the account with the
+// given address at each of the listed blocks, rootFor resolving the state trie of
+// a block. Every value is proven the same way as by VerifiedStorageRead. Values
+// and errors are aligned by index with blocks, values being nil where the account
+// or the slot doesn't exist, and blocks rootFor returns nil for fail with
+// ErrNoHeader. Adjacent blocks sharing the storage root of the account share the
+// proof of the slot too, so the slot is only retrieved where the storage changed.
+func HistoricalSlot(ctx context.Context, odr OdrBackend, addr common.Address, slot common.Hash, blocks []uint64, rootFor func(uint64) *TrieID) ([][]byte, []error) {
+	var (
+		values = make([][]byte, len(blocks))
+		errs   = make([]error, len(blocks))
+
+		prevRoot  common.Hash // storage root of the previous block, if read
+		prevValue []byte
+		prevOk    bool
+	)
+	for i, number := range blocks {
+		id := rootFor(number)
+		if id == nil {
+			errs[i], prevOk = ErrNoHeader, false
+			continue
+		}
+		account, err := GetAccount(ctx, odr, id, addr)
+		if err != nil {
+			errs[i], prevOk = err, false
+			continue
+		}
+		root := types.EmptyRootHash
+		if account != nil {
+			root = account.Root
+		}
+		if prevOk && root == prevRoot {
+			values[i] = prevValue
+			continue
+		}
+		if root != types.EmptyRootHash {
+			values[i], errs[i] = readStorageSlot(ctx, odr, StorageTrieID(id, addressHash(addr), root), slot)
+		}
+		prevRoot, prevValue, prevOk = root, values[i], errs[i] == nil
+	}
+	return values, errs
+}
+
+// StorageChange is a change of the content of a storage slot, Old being the
+// content at the block before Number and New the one at Number. Contents are nil
+// where the account or the slot doesn't exist.
+type StorageChange struct {
+	Number   uint64
+	Old, New []byte
+}
+
+// StorageChangeStream streams the changes of a storage slot of the account with
+// the given address across the blocks from from to to, rootFor resolving the
+// state trie of a block. Only blocks at which the content differs from the one
+// at the previous block are delivered, the content at from serving as the first
+// old value. The account is proven at every block, so no change can be missed,
+// but the slot only where the storage root of the account changed.
+//
+// The changes channel is closed once the range is covered or the stream fails,
+// after which the error channel yields the failure, or nil. Blocks rootFor
+// returns nil for fail with ErrNoHeader.
+func StorageChangeStream(ctx context.Context, odr OdrBackend, addr common.Address, slot common.Hash, from, to uint64, rootFor func(uint64) *TrieID) (<-chan StorageChange, <-chan error) {
+	changes, errc := make(chan StorageChange), make(chan error, 1)
+	go func() {
+		defer close(changes)
+		errc <- streamStorageChanges(ctx, odr, addr, slot, from, to, rootFor, changes)
+	}()
+	return changes, errc
+}
+
+// streamStorageChanges delivers the changes of a storage slot across a block
+// range for StorageChangeStream.
+func streamStorageChanges(ctx context.Context, odr OdrBackend, addr common.Address, slot common.Hash, from, to uint64, rootFor func(uint64) *TrieID, changes chan<- StorageChange) error {
+	if from > to {
+		return ErrInvalidRange
+	}
+	var (
+		prevRoot  common.Hash
+		prevValue []byte
+	)
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id := rootFor(number)
+		if id == nil {
+			return ErrNoHeader
+		}
+		account, err := GetAccount(ctx, odr, id, addr)
+		if err != nil {
+			return err
+		}
+		root := types.EmptyRootHash
+		if account != nil {
+			root = account.Root
+		}
+		if number > from && root == prevRoot {
+			continue
+		}
+		var value []byte
+		if root != types.EmptyRootHash {
+			if value, err = readStorageSlot(ctx, odr, StorageTrieID(id, addressHash(addr), root), slot); err != nil {
+				return err
+			}
+		}
+		if number > from && !bytes.Equal(value, prevValue) {
+			select {
+			case changes <- StorageChange{Number: number, Old: prevValue, New: value}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		prevRoot, prevValue = root, value
+		if number == to {
+			break // avoid wrapping around at the end of the number space
+		}
+	}
+	return nil
+}
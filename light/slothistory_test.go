@@ -0,0 +1,148 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// trieCountingOdr counts the trie retrievals served by a testOdr.
+type trieCountingOdr struct {
+	*testOdr
+	tries int
+}
+
+func (odr *trieCountingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	if _, ok := req.(*TrieRequest); ok {
+		odr.tries++
+	}
+	return odr.testOdr.Retrieve(ctx, req)
+}
+
+// makeTestSlotHistory commits the states of eight blocks into db, in which the
+// given slot of the test contract is set at block 2, changed at block 5 and
+// cleared at block 7, while block 4 only changes another account. It returns
+// the state trie IDs of the blocks.
+func makeTestSlotHistory(db wtcdb.Database, slot common.Hash) map[uint64]*TrieID {
+	var (
+		roots = make(map[uint64]*TrieID)
+		root  common.Hash
+	)
+	st, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for number := uint64(0); number < 8; number++ {
+		switch number {
+		case 1:
+			st.SetCode(testStateContract, testContractCode)
+		case 2:
+			st.SetState(testStateContract, slot, common.BigToHash(big.NewInt(1)))
+		case 4:
+			st.SetBalance(acc1Addr, big.NewInt(1000), new(big.Int), new(big.Int))
+		case 5:
+			st.SetState(testStateContract, slot, common.BigToHash(big.NewInt(2)))
+		case 7:
+			st.SetState(testStateContract, slot, common.Hash{})
+		}
+		root, _ = st.CommitTo(db, true)
+		st, _ = state.New(root, state.NewDatabase(db))
+		roots[number] = &TrieID{Root: root}
+	}
+	return roots
+}
+
+func TestHistoricalSlot(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	slot := testStateSlot(0)
+	roots := makeTestSlotHistory(sdb, slot)
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &trieCountingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+
+	blocks := []uint64{0, 1, 2, 3, 4, 5, 6, 7, 9}
+	values, errs := HistoricalSlot(NoOdr, odr, testStateContract, slot, blocks, func(number uint64) *TrieID {
+		return roots[number]
+	})
+	want := [][]byte{nil, nil, {1}, {1}, {1}, {2}, {2}, nil, nil}
+	for i, number := range blocks[:len(blocks)-1] {
+		if errs[i] != nil {
+			t.Errorf("block %d: retrieval failed: %v", number, errs[i])
+		}
+		if !bytes.Equal(values[i], want[i]) {
+			t.Errorf("block %d: value mismatch: have %x, want %x", number, values[i], want[i])
+		}
+	}
+	if errs[len(blocks)-1] != ErrNoHeader {
+		t.Errorf("error mismatch for unknown block: have %v, want %v", errs[len(blocks)-1], ErrNoHeader)
+	}
+	// The slot is only proven at the blocks changing it to a value, clearing it
+	// empties the storage
+	if odr.tries != 2 {
+		t.Errorf("slot retrieval count mismatch: have %d, want 2", odr.tries)
+	}
+}
+
+func TestStorageChangeStream(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	slot := testStateSlot(0)
+	roots := makeTestSlotHistory(sdb, slot)
+	rootFor := func(number uint64) *TrieID { return roots[number] }
+
+	ldb, _ := wtcdb.NewMemDatabase()
+	odr := &trieCountingOdr{testOdr: &testOdr{sdb: sdb, ldb: ldb}}
+	changes, errc := StorageChangeStream(NoOdr, odr, testStateContract, slot, 0, 7, rootFor)
+	var have []StorageChange
+	for change := range changes {
+		have = append(have, change)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	want := []StorageChange{{2, nil, []byte{1}}, {5, []byte{1}, []byte{2}}, {7, []byte{2}, nil}}
+	if len(have) != len(want) {
+		t.Fatalf("change count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i].Number != want[i].Number || !bytes.Equal(have[i].Old, want[i].Old) || !bytes.Equal(have[i].New, want[i].New) {
+			t.Errorf("change %d mismatch: have %d %x->%x, want %d %x->%x", i, have[i].Number, have[i].Old, have[i].New, want[i].Number, want[i].Old, want[i].New)
+		}
+	}
+	// The slot is only proven where the storage root changed to a non-empty one
+	if odr.tries != 2 {
+		t.Errorf("slot retrieval count mismatch: have %d, want 2", odr.tries)
+	}
+	// A block without a state root ends the stream with an error
+	changes, errc = StorageChangeStream(NoOdr, odr, testStateContract, slot, 3, 9, rootFor)
+	have = have[:0]
+	for change := range changes {
+		have = append(have, change)
+	}
+	if err := <-errc; err != ErrNoHeader {
+		t.Errorf("error mismatch for unknown block: have %v, want %v", err, ErrNoHeader)
+	}
+	if len(have) != 2 {
+		t.Errorf("change count mismatch before failure: have %d, want 2", len(have))
+	}
+	if _, errc := StorageChangeStream(NoOdr, odr, testStateContract, slot, 5, 4, rootFor); <-errc != ErrInvalidRange {
+		t.Errorf("reversed range accepted")
+	}
+}
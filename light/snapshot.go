@@ -0,0 +1,130 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrMalformedSnapshot is returned if a header snapshot doesn't cover exactly the
+// section of its checkpoint or its total difficulties are inconsistent.
+var ErrMalformedSnapshot = errors.New("malformed header snapshot")
+
+// headerSnapshot is the encoding of the canonical headers of a CHT section along
+// with the checkpoint they are verified against.
+type headerSnapshot struct {
+	Checkpoint Checkpoint
+	Headers    []*types.Header
+	Tds        []*big.Int
+}
+
+// ExportHeaderSnapshot writes the canonical headers of a section along with their
+// total difficulties and the trusted checkpoint of the section to w, to be
+// imported by other clients with ImportHeaderSnapshot. The whole section must be
+// available locally.
+func ExportHeaderSnapshot(db wtcdb.Database, w io.Writer, section uint64) error {
+	cp := GetCheckpoint(db, section)
+	if cp == nil {
+		return ErrNoCheckpoint
+	}
+	snap := &headerSnapshot{Checkpoint: *cp}
+	for n := section * ChtFrequency; n < (section+1)*ChtFrequency; n++ {
+		hash := core.GetCanonicalHash(db, n)
+		header := getHeader(db, hash, n)
+		if header == nil {
+			return ErrNoHeader
+		}
+		snap.Headers = append(snap.Headers, header)
+		snap.Tds = append(snap.Tds, core.GetTd(db, hash, n))
+	}
+	return rlp.Encode(w, snap)
+}
+
+// ImportHeaderSnapshot reads a snapshot written by ExportHeaderSnapshot and stores
+// its headers, total difficulties and canonical hashes. The snapshot is only
+// accepted if its checkpoint equals the locally trusted one of the section, its
+// headers form a chain ending in the section head and total difficulties add up,
+// so no header has to be retrieved to trust the section.
+func ImportHeaderSnapshot(db wtcdb.Database, r io.Reader) error {
+	var snap headerSnapshot
+	if err := rlp.Decode(r, &snap); err != nil {
+		return err
+	}
+	cp := snap.Checkpoint
+	trusted := GetCheckpoint(db, cp.Section)
+	if trusted == nil {
+		return ErrNoCheckpoint
+	}
+	if *trusted != cp {
+		return ErrCheckpointMismatch
+	}
+	if cp.SectionHead == (common.Hash{}) {
+		return ErrCheckpointUnverifiable
+	}
+	if uint64(len(snap.Headers)) != ChtFrequency || len(snap.Tds) != len(snap.Headers) {
+		return ErrMalformedSnapshot
+	}
+	if err := VerifyHeaderChain(snap.Headers); err != nil {
+		return err
+	}
+	start := cp.Section * ChtFrequency
+	if snap.Headers[0].Number.Uint64() != start {
+		return ErrMalformedSnapshot
+	}
+	if snap.Headers[len(snap.Headers)-1].Hash() != cp.SectionHead {
+		return ErrCheckpointMismatch
+	}
+	for i, header := range snap.Headers {
+		if snap.Tds[i] == nil || header.Difficulty == nil {
+			return ErrMalformedSnapshot
+		}
+		parentTd := new(big.Int)
+		if i > 0 {
+			parentTd = snap.Tds[i-1]
+		} else if start > 0 {
+			// Only checkable if the previous section is known locally
+			if parentTd = core.GetTd(db, header.ParentHash, start-1); parentTd == nil {
+				continue
+			}
+		}
+		if snap.Tds[i].Cmp(new(big.Int).Add(parentTd, header.Difficulty)) != 0 {
+			return ErrMalformedSnapshot
+		}
+	}
+	// Everything checks out, store the section
+	for i, header := range snap.Headers {
+		hash, number := header.Hash(), header.Number.Uint64()
+		if err := writeHeader(db, header); err != nil {
+			return err
+		}
+		if err := core.WriteTd(db, hash, number, snap.Tds[i]); err != nil {
+			return err
+		}
+		if err := core.WriteCanonicalHash(db, hash, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
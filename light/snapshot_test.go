@@ -0,0 +1,98 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestHeaderSnapshot(t *testing.T) {
+	defer func(freq uint64) { ChtFrequency = freq }(ChtFrequency)
+	ChtFrequency = 4
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 8)
+	td := core.GetTd(sdb, genesis.Hash(), 0)
+	for _, header := range headers {
+		td = new(big.Int).Add(td, header.Difficulty)
+		core.WriteTd(sdb, header.Hash(), header.Number.Uint64(), td)
+	}
+	writeCanonicalHeaders(sdb, headers)
+	cp := &Checkpoint{Section: 1, SectionHead: headers[6].Hash()}
+	WriteCheckpoint(sdb, cp)
+
+	var snap bytes.Buffer
+	if err := ExportHeaderSnapshot(sdb, &snap, 1); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	// Import into a client trusting the same checkpoint
+	ldb, _ := wtcdb.NewMemDatabase()
+	WriteCheckpoint(ldb, cp)
+	if err := ImportHeaderSnapshot(ldb, bytes.NewReader(snap.Bytes())); err != nil {
+		t.Fatalf("failed to import snapshot: %v", err)
+	}
+	for _, header := range headers[3:7] {
+		hash, n := header.Hash(), header.Number.Uint64()
+		if have := core.GetCanonicalHash(ldb, n); have != hash {
+			t.Errorf("block %d: canonical hash mismatch: have %x, want %x", n, have, hash)
+		}
+		if core.GetHeader(ldb, hash, n) == nil {
+			t.Errorf("block %d: header missing", n)
+		}
+		if have, want := core.GetTd(ldb, hash, n), core.GetTd(sdb, hash, n); have == nil || have.Cmp(want) != 0 {
+			t.Errorf("block %d: td mismatch: have %v, want %v", n, have, want)
+		}
+	}
+	// Clients with another or no checkpoint reject the snapshot
+	ldb, _ = wtcdb.NewMemDatabase()
+	if err := ImportHeaderSnapshot(ldb, bytes.NewReader(snap.Bytes())); err != ErrNoCheckpoint {
+		t.Errorf("error mismatch without checkpoint: have %v, want %v", err, ErrNoCheckpoint)
+	}
+	WriteCheckpoint(ldb, &Checkpoint{Section: 1, SectionHead: headers[5].Hash()})
+	if err := ImportHeaderSnapshot(ldb, bytes.NewReader(snap.Bytes())); err != ErrCheckpointMismatch {
+		t.Errorf("error mismatch for other checkpoint: have %v, want %v", err, ErrCheckpointMismatch)
+	}
+	// Tampered snapshots are rejected too
+	tamper := func(fn func(s *headerSnapshot)) []byte {
+		var s headerSnapshot
+		rlp.DecodeBytes(snap.Bytes(), &s)
+		fn(&s)
+		enc, _ := rlp.EncodeToBytes(&s)
+		return enc
+	}
+	ldb, _ = wtcdb.NewMemDatabase()
+	WriteCheckpoint(ldb, cp)
+	forged := tamper(func(s *headerSnapshot) { s.Tds[2] = new(big.Int).Add(s.Tds[2], big.NewInt(1)) })
+	if err := ImportHeaderSnapshot(ldb, bytes.NewReader(forged)); err != ErrMalformedSnapshot {
+		t.Errorf("error mismatch for forged td: have %v, want %v", err, ErrMalformedSnapshot)
+	}
+	unlinked := tamper(func(s *headerSnapshot) { s.Headers[1] = newTestUncle(s.Headers[0], "forged") })
+	if err := ImportHeaderSnapshot(ldb, bytes.NewReader(unlinked)); err == nil {
+		t.Errorf("unlinked snapshot accepted")
+	}
+	if core.GetCanonicalHash(ldb, 5) != (common.Hash{}) {
+		t.Errorf("rejected snapshot stored")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStateUnavailable is returned if the state of a block can't be served by
+// the backend, not even as of an earlier checkpoint.
+var ErrStateUnavailable = errors.New("state unavailable")
+
+// StateCheckpointer is implemented by ODR backends whose servers only retain
+// state at certain blocks (e.g. pruned full nodes keeping periodic snapshots).
+type StateCheckpointer interface {
+	// NearestStateCheckpoint returns the number of the latest block not after
+	// target whose state is retained, or ErrStateUnavailable.
+	NearestStateCheckpoint(target uint64) (uint64, error)
+}
+
+// PeriodicStateOdr wraps an OdrBackend whose servers retain the state of every
+// Interval-th block only, starting from block Oldest.
+type PeriodicStateOdr struct {
+	OdrBackend
+	Interval uint64
+	Oldest   uint64
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *PeriodicStateOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// NearestStateCheckpoint implements StateCheckpointer.
+func (odr *PeriodicStateOdr) NearestStateCheckpoint(target uint64) (uint64, error) {
+	number := target
+	if odr.Interval > 0 {
+		number -= target % odr.Interval
+	}
+	if number < odr.Oldest {
+		return 0, ErrStateUnavailable
+	}
+	return number, nil
+}
+
+// StateCheckpointTrieID returns the state TrieID of the nearest block not after
+// target whose state the backend can serve. The header of that block is
+// resolved (and verified through the CHT if needed), so the returned ID can be
+// used for state retrievals right away; its BlockNumber tells the caller which
+// block the state is actually as-of.
+func StateCheckpointTrieID(ctx context.Context, odr OdrBackend, target uint64) (*TrieID, error) {
+	number := target
+	if cp, ok := odr.(StateCheckpointer); ok {
+		var err error
+		if number, err = cp.NearestStateCheckpoint(target); err != nil {
+			return nil, err
+		}
+	}
+	header, err := GetHeaderByNumber(ctx, odr, number)
+	if err != nil {
+		return nil, err
+	}
+	return StateTrieID(header), nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestStateCheckpointTrieID(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(db)
+	headers := makeTestHeaders(genesis.Header(), 10)
+	for _, header := range headers {
+		header.Root[0] = byte(header.Number.Uint64()) // make state roots distinct
+	}
+	for i := 1; i < len(headers); i++ {
+		headers[i].ParentHash = headers[i-1].Hash()
+	}
+	for _, header := range headers {
+		core.WriteHeader(db, header)
+		core.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+	}
+	odr := &PeriodicStateOdr{OdrBackend: &testOdr{ldb: db, disable: true}, Interval: 4, Oldest: 4}
+
+	tests := []struct {
+		target, number uint64
+		err            error
+	}{
+		{2, 0, ErrStateUnavailable},
+		{4, 4, nil},
+		{7, 4, nil},
+		{8, 8, nil},
+		{10, 8, nil},
+	}
+	for _, tt := range tests {
+		id, err := StateCheckpointTrieID(context.Background(), odr, tt.target)
+		if err != tt.err {
+			t.Errorf("target %d: error mismatch: have %v, want %v", tt.target, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		header := headers[tt.number-1]
+		if id.BlockNumber != tt.number || id.Root != header.Root || id.BlockHash != header.Hash() {
+			t.Errorf("target %d: checkpoint mismatch: have #%d %x, want #%d %x", tt.target, id.BlockNumber, id.Root, tt.number, header.Root)
+		}
+	}
+	// Backends without checkpoints serve the exact block
+	id, err := StateCheckpointTrieID(context.Background(), odr.OdrBackend, 7)
+	if err != nil {
+		t.Fatalf("plain backend: failed to resolve state: %v", err)
+	}
+	if id.BlockNumber != 7 {
+		t.Errorf("plain backend: block mismatch: have #%d, want #7", id.BlockNumber)
+	}
+}
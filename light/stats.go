@@ -0,0 +1,231 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/wtc/go-wtc/rlp"
+)
+
+type tenantKey struct{}
+
+// WithTenant tags all retrievals made with the returned context with a tenant,
+// so a StatsOdr accounts for them separately.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// KindStats contains the retrieval statistics of a request kind.
+type KindStats struct {
+	Kind     RequestKind
+	Requests uint64        // number of retrievals
+	Failures uint64        // number of failed retrievals
+	Time     time.Duration // total time spent retrieving
+}
+
+// TenantStats contains the retrieval statistics of a tenant.
+type TenantStats struct {
+	Requests uint64 // number of retrievals
+	Failures uint64 // number of failed retrievals
+	Bytes    uint64 // amount of data retrieved successfully
+}
+
+// StatsOdr wraps an OdrBackend, gathering retrieval statistics per request kind
+// and per tenant for retrievals tagged with WithTenant.
+type StatsOdr struct {
+	OdrBackend
+
+	lock    sync.Mutex
+	stats   map[RequestKind]*KindStats
+	tenants map[string]*TenantStats
+}
+
+// NewStatsOdr creates a statistics gathering wrapper around backend.
+func NewStatsOdr(backend OdrBackend) *StatsOdr {
+	return &StatsOdr{
+		OdrBackend: backend,
+		stats:      make(map[RequestKind]*KindStats),
+		tenants:    make(map[string]*TenantStats),
+	}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *StatsOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve forwards the request to the wrapped backend, recording its outcome.
+func (odr *StatsOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	start := clock.Now()
+	err := odr.OdrBackend.Retrieve(ctx, req)
+	elapsed := since(start)
+
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	kind := KindOf(req)
+	stats := odr.stats[kind]
+	if stats == nil {
+		stats = &KindStats{Kind: kind}
+		odr.stats[kind] = stats
+	}
+	stats.Requests++
+	if err != nil {
+		stats.Failures++
+	}
+	stats.Time += elapsed
+
+	if id, ok := ctx.Value(tenantKey{}).(string); ok {
+		tenant := odr.tenants[id]
+		if tenant == nil {
+			tenant = new(TenantStats)
+			odr.tenants[id] = tenant
+		}
+		tenant.Requests++
+		if err != nil {
+			tenant.Failures++
+		} else {
+			tenant.Bytes += uint64(ResultSize(req))
+		}
+	}
+	return err
+}
+
+// TenantStats returns the statistics of the retrievals tagged with the given
+// tenant.
+func (odr *StatsOdr) TenantStats(id string) TenantStats {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	if tenant := odr.tenants[id]; tenant != nil {
+		return *tenant
+	}
+	return TenantStats{}
+}
+
+// ResultSize returns the amount of data retrieved for a request.
+func ResultSize(req OdrRequest) int {
+	switch r := req.(type) {
+	case *TrieRequest:
+		return proofSize(r.Proof)
+	case *BatchTrieRequest:
+		size := 0
+		for _, proof := range r.Proofs {
+			size += proofSize(proof)
+		}
+		return size
+	case *AccountRequest:
+		return proofSize(r.Proof)
+	case *StorageRootRequest:
+		return proofSize(r.Proof)
+	case *CodeHashRequest:
+		return proofSize(r.Proof)
+	case *CodeRequest:
+		return len(r.Data)
+	case *BlockRequest:
+		return len(r.Rlp)
+	case *TxByIndexRequest:
+		return len(r.Rlp)
+	case *TxCountRequest:
+		return proofSize(r.LastProof) + proofSize(r.EndProof)
+	case *TxLookupRequest:
+		return len(r.Rlp)
+	case *BatchBlockRequest:
+		size := 0
+		for _, data := range r.Rlps {
+			size += len(data)
+		}
+		return size
+	case *ReceiptsMetaRequest:
+		var enc []byte
+		if r.Stripped {
+			enc, _ = rlp.EncodeToBytes(r.Meta)
+		} else {
+			enc, _ = rlp.EncodeToBytes(r.Receipts)
+		}
+		return len(enc)
+	case *ReceiptsRequest:
+		enc, _ := rlp.EncodeToBytes(r.Receipts)
+		return len(enc)
+	case *TxLogsRequest:
+		enc, _ := rlp.EncodeToBytes(r.Receipts)
+		return len(enc)
+	case *ChtRequest:
+		enc, _ := rlp.EncodeToBytes(r.Header)
+		return len(enc) + proofSize(r.Proof)
+	case *StateRootRequest:
+		enc, _ := rlp.EncodeToBytes(r.Header)
+		return len(enc) + proofSize(r.Proof)
+	case *BlockBloomRequest:
+		enc, _ := rlp.EncodeToBytes(r.Header)
+		return len(enc) + proofSize(r.Proof)
+	case *HeaderByHashRequest:
+		enc, _ := rlp.EncodeToBytes(r.Header)
+		return len(enc) + proofSize(r.Proof)
+	case *BatchHeaderRequest:
+		enc, _ := rlp.EncodeToBytes(r.Headers)
+		size := len(enc)
+		for _, proof := range r.Proofs {
+			size += proofSize(proof)
+		}
+		return size
+	case *HeaderSegmentRequest:
+		enc, _ := rlp.EncodeToBytes(r.Headers)
+		return len(enc)
+	default:
+		return 0
+	}
+}
+
+// proofSize returns the total size of the nodes of a merkle proof.
+func proofSize(proof []rlp.RawValue) int {
+	size := 0
+	for _, node := range proof {
+		size += len(node)
+	}
+	return size
+}
+
+// Stats returns the statistics of all request kinds retrieved so far, ordered
+// by kind.
+func (odr *StatsOdr) Stats() []KindStats {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	var stats []KindStats
+	for kind := KindUnknown; kind < numRequestKinds; kind++ {
+		if s := odr.stats[kind]; s != nil {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
+
+// ExportStats writes the statistics to w in the format of enc, or JSON if enc
+// is nil.
+func (odr *StatsOdr) ExportStats(w io.Writer, enc Encoder) error {
+	stats := odr.Stats()
+	rows := make([][]interface{}, len(stats))
+	for i, s := range stats {
+		rows[i] = []interface{}{s.Kind.String(), s.Requests, s.Failures, int64(s.Time)}
+	}
+	return export(w, enc, []string{"kind", "requests", "failures", "time_ns"}, rows)
+}
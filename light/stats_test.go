@@ -0,0 +1,64 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestTenantStats(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	sdb.Put(crypto.Keccak256(testContractCode), testContractCode)
+	odr := NewStatsOdr(&testOdr{sdb: sdb, ldb: ldb})
+
+	var (
+		alice = WithTenant(NoOdr, "alice")
+		bob   = WithTenant(NoOdr, "bob")
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			odr.Retrieve(alice, &CodeRequest{Hash: crypto.Keccak256Hash(testContractCode)})
+		}()
+		go func() {
+			defer wg.Done()
+			odr.Retrieve(bob, &CodeRequest{Hash: crypto.Keccak256Hash(nil)})
+		}()
+	}
+	wg.Wait()
+	odr.Retrieve(NoOdr, &CodeRequest{Hash: crypto.Keccak256Hash(testContractCode)})
+
+	if s := odr.TenantStats("alice"); s.Requests != 10 || s.Bytes != uint64(10*len(testContractCode)) {
+		t.Errorf("alice stats mismatch: %+v", s)
+	}
+	if s := odr.TenantStats("bob"); s.Requests != 10 || s.Bytes != 0 {
+		t.Errorf("bob stats mismatch: %+v", s)
+	}
+	if s := odr.TenantStats("carol"); s != (TenantStats{}) {
+		t.Errorf("unknown tenant stats mismatch: %+v", s)
+	}
+	if s := odr.Stats(); len(s) != 1 || s[0].Requests != 21 {
+		t.Errorf("kind stats mismatch: %+v", s)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// RequestDatabase is implemented by databases that treat the writes of ODR
+// requests differently depending on the request doing the write.
+type RequestDatabase interface {
+	wtcdb.Database
+
+	// ForRequest returns the database view that req should store its result into.
+	ForRequest(req OdrRequest) wtcdb.Database
+}
+
+// StoreDatabase returns the database that an ODR backend should pass to the
+// StoreResult method of a retrieved request. A configuration bound to db is kept.
+func StoreDatabase(db wtcdb.Database, req OdrRequest) wtcdb.Database {
+	if cdb, ok := db.(*configDatabase); ok {
+		return BindConfig(StoreDatabase(cdb.Database, req), cdb.config)
+	}
+	if rdb, ok := db.(RequestDatabase); ok {
+		return rdb.ForRequest(req)
+	}
+	return db
+}
+
+// StoreFilter decides whether the database write of a key/value pair done while
+// storing the result of req should be persisted.
+type StoreFilter func(req OdrRequest, key, value []byte) bool
+
+// FilterDatabase wraps a persistent database, keeping the entries rejected by
+// its store filter in memory only. Reads see both the in-memory and persistent
+// entries, so filtered data is still served until the process exits.
+//
+// Filtering happens on the database writes of StoreResult, which are only done
+// after the retrieved data passed verification.
+type FilterDatabase struct {
+	wtcdb.Database
+	filter StoreFilter
+
+	lock sync.RWMutex
+	mem  map[string][]byte
+}
+
+// NewFilterDatabase creates a filtering wrapper around db.
+func NewFilterDatabase(db wtcdb.Database, filter StoreFilter) *FilterDatabase {
+	return &FilterDatabase{
+		Database: db,
+		filter:   filter,
+		mem:      make(map[string][]byte),
+	}
+}
+
+// Get retrieves a value from memory or the persistent database.
+func (db *FilterDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	value, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		return value, nil
+	}
+	return db.Database.Get(key)
+}
+
+// Has checks whether key is present in memory or the persistent database.
+func (db *FilterDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	_, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		return true, nil
+	}
+	return db.Database.Has(key)
+}
+
+// Delete removes key from memory and the persistent database.
+func (db *FilterDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	delete(db.mem, string(key))
+	db.lock.Unlock()
+	return db.Database.Delete(key)
+}
+
+// ForRequest implements RequestDatabase.
+func (db *FilterDatabase) ForRequest(req OdrRequest) wtcdb.Database {
+	return &filterView{FilterDatabase: db, req: req}
+}
+
+// put stores a key/value pair written by req according to the filter, which is
+// bypassed if the wrapped database is bound to a configuration in archive mode.
+func (db *FilterDatabase) put(req OdrRequest, key, value []byte) error {
+	if ConfigOf(db.Database).ArchiveMode || db.filter == nil || db.filter(req, key, value) {
+		return db.Database.Put(key, value)
+	}
+	db.lock.Lock()
+	db.mem[string(key)] = append([]byte{}, value...)
+	db.lock.Unlock()
+	return nil
+}
+
+// filterView is a FilterDatabase bound to the request storing its result.
+type filterView struct {
+	*FilterDatabase
+	req OdrRequest
+}
+
+func (v *filterView) Put(key, value []byte) error {
+	return v.put(v.req, key, value)
+}
+
+func (v *filterView) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: v}
+}
+
+// viewBatch collects the writes of a request, applying them to the request's
+// database view on Write.
+type viewBatch struct {
+	db     wtcdb.Putter
+	writes []viewWrite
+	size   int
+}
+
+type viewWrite struct {
+	key, value []byte
+}
+
+func (b *viewBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, viewWrite{append([]byte{}, key...), append([]byte{}, value...)})
+	b.size += len(value)
+	return nil
+}
+
+func (b *viewBatch) ValueSize() int {
+	return b.size
+}
+
+func (b *viewBatch) Write() error {
+	for _, w := range b.writes {
+		if err := b.db.Put(w.key, w.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestFilterDatabase(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	disk, _ := wtcdb.NewMemDatabase()
+
+	secret := []byte("secret contract code")
+	public := []byte("public contract code")
+	secretHash, publicHash := crypto.Keccak256Hash(secret), crypto.Keccak256Hash(public)
+	sdb.Put(secretHash[:], secret)
+	sdb.Put(publicHash[:], public)
+
+	filtered := 0
+	ldb := NewFilterDatabase(disk, func(req OdrRequest, key, value []byte) bool {
+		if r, ok := req.(*CodeRequest); ok && r.Hash == secretHash {
+			filtered++
+			return false
+		}
+		return true
+	})
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	for _, hash := range [][]byte{secretHash[:], publicHash[:]} {
+		req := &CodeRequest{Id: &TrieID{}}
+		copy(req.Hash[:], hash)
+		if err := odr.Retrieve(context.Background(), req); err != nil {
+			t.Fatalf("retrieval failed: %v", err)
+		}
+	}
+	if filtered != 1 {
+		t.Fatalf("filtered write count mismatch: have %d, want 1", filtered)
+	}
+	// Both entries must be served, but only the public one persisted
+	if data, err := ldb.Get(secretHash[:]); err != nil || !bytes.Equal(data, secret) {
+		t.Errorf("filtered entry not served from memory: %x (%v)", data, err)
+	}
+	if data, err := ldb.Get(publicHash[:]); err != nil || !bytes.Equal(data, public) {
+		t.Errorf("persisted entry not served: %x (%v)", data, err)
+	}
+	if ok, _ := disk.Has(secretHash[:]); ok {
+		t.Errorf("filtered entry persisted to disk")
+	}
+	if ok, _ := disk.Has(publicHash[:]); !ok {
+		t.Errorf("unfiltered entry not persisted to disk")
+	}
+}
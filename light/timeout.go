@@ -0,0 +1,71 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"time"
+)
+
+// RequestTimeouts holds the timeouts applied to ODR retrievals of each kind if
+// the caller's context doesn't have a deadline of its own.
+type RequestTimeouts map[RequestKind]time.Duration
+
+// DefaultRequestTimeouts are short for single trie node lookups and longer for
+// requests that may transfer large amounts of data (bodies, code, receipts).
+var DefaultRequestTimeouts = RequestTimeouts{
+	KindTrie:          5 * time.Second,
+	KindAccount:       5 * time.Second,
+	KindStorageRoot:   5 * time.Second,
+	KindCodeHash:      5 * time.Second,
+	KindBatchHeader:   15 * time.Second,
+	KindBatchTrie:     15 * time.Second,
+	KindCode:          15 * time.Second,
+	KindBlock:         15 * time.Second,
+	KindReceipts:      15 * time.Second,
+	KindTxByIndex:     15 * time.Second,
+	KindTxCount:       5 * time.Second,
+	KindBatchBlock:    30 * time.Second,
+	KindHeaderSegment: 30 * time.Second,
+	KindReceiptsMeta:  15 * time.Second,
+	KindTxLogs:        15 * time.Second,
+	KindTxLookup:      15 * time.Second,
+	KindCht:           10 * time.Second,
+	KindStateRoot:     10 * time.Second,
+	KindBlockBloom:    10 * time.Second,
+}
+
+// fallbackRequestTimeout is used for request kinds missing from the table.
+const fallbackRequestTimeout = 10 * time.Second
+
+// Timeout returns the configured timeout for the given request kind.
+func (t RequestTimeouts) Timeout(kind RequestKind) time.Duration {
+	if timeout, ok := t[kind]; ok {
+		return timeout
+	}
+	return fallbackRequestTimeout
+}
+
+// WithTimeout derives a context for retrieving req. If ctx already has a
+// deadline it is left untouched, otherwise the timeout of the request's kind
+// is applied.
+func (t RequestTimeouts) WithTimeout(ctx context.Context, req OdrRequest) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, t.Timeout(KindOf(req)))
+}
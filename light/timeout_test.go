@@ -0,0 +1,59 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeouts(t *testing.T) {
+	timeouts := RequestTimeouts{
+		KindTrie:     1 * time.Second,
+		KindCode:     2 * time.Second,
+		KindBlock:    3 * time.Second,
+		KindReceipts: 4 * time.Second,
+		KindCht:      5 * time.Second,
+	}
+	reqs := []OdrRequest{&TrieRequest{}, &CodeRequest{}, &BlockRequest{}, &ReceiptsRequest{}, &ChtRequest{}}
+	for _, req := range reqs {
+		want := timeouts[KindOf(req)]
+		start := time.Now()
+		ctx, cancel := timeouts.WithTimeout(context.Background(), req)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if !ok {
+			t.Fatalf("%v request: no deadline set", KindOf(req))
+		}
+		if have := deadline.Sub(start); have < want || have > want+time.Second/2 {
+			t.Errorf("%v request: timeout mismatch: have %v, want %v", KindOf(req), have, want)
+		}
+	}
+}
+
+func TestRequestTimeoutsKeepDeadline(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	want, _ := parent.Deadline()
+
+	ctx, cancel := DefaultRequestTimeouts.WithTimeout(parent, &TrieRequest{})
+	defer cancel()
+	if have, _ := ctx.Deadline(); !have.Equal(want) {
+		t.Fatalf("caller deadline overridden: have %v, want %v", have, want)
+	}
+}
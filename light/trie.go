@@ -53,7 +53,7 @@ func (db *odrDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie,
 func (db *odrDatabase) CopyTrie(t state.Trie) state.Trie {
 	switch t := t.(type) {
 	case *odrTrie:
-		cpy := &odrTrie{db: t.db, id: t.id}
+		cpy := &odrTrie{db: t.db, id: t.id, modified: t.modified}
 		if t.trie != nil {
 			cpytrie := *t.trie
 			cpy.trie = &cpytrie
@@ -68,7 +68,7 @@ func (db *odrDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, err
 	if codeHash == sha3_nil {
 		return nil, nil
 	}
-	if code, err := db.backend.Database().Get(codeHash[:]); err == nil {
+	if code, err := ReadContent(localDatabase(db.backend, KindCode), codeHash, ContentCode); err == nil {
 		return code, nil
 	}
 	id := *db.id
@@ -79,18 +79,26 @@ func (db *odrDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, err
 }
 
 func (db *odrDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
-	code, err := db.ContractCode(addrHash, codeHash)
-	return len(code), err
+	id := *db.id
+	id.AccKey = addrHash[:]
+	size, err := GetCodeSize(db.ctx, db.backend, &id, codeHash)
+	return int(size), err
 }
 
 type odrTrie struct {
-	db   *odrDatabase
-	id   *TrieID
-	trie *trie.Trie
+	db       *odrDatabase
+	id       *TrieID
+	trie     *trie.Trie
+	modified bool // the trie no longer matches id.Root, value index unusable
 }
 
 func (t *odrTrie) TryGet(key []byte) ([]byte, error) {
 	key = crypto.Keccak256(key)
+	if BackendConfig(t.db.backend).IndexTrieValues && !t.modified {
+		if value, ok := GetIndexedTrieValue(t.db.backend.Database(), t.id.Root, key); ok {
+			return value, nil
+		}
+	}
 	var res []byte
 	err := t.do(key, func() (err error) {
 		res, err = t.trie.TryGet(key)
@@ -101,6 +109,7 @@ func (t *odrTrie) TryGet(key []byte) ([]byte, error) {
 
 func (t *odrTrie) TryUpdate(key, value []byte) error {
 	key = crypto.Keccak256(key)
+	t.modified = true
 	return t.do(key, func() error {
 		return t.trie.TryDelete(key)
 	})
@@ -108,6 +117,7 @@ func (t *odrTrie) TryUpdate(key, value []byte) error {
 
 func (t *odrTrie) TryDelete(key []byte) error {
 	key = crypto.Keccak256(key)
+	t.modified = true
 	return t.do(key, func() error {
 		return t.trie.TryDelete(key)
 	})
@@ -149,7 +159,7 @@ func (t *odrTrie) do(key []byte, fn func() error) error {
 		if _, ok := err.(*trie.MissingNodeError); !ok {
 			return err
 		}
-		r := &TrieRequest{Id: t.id, Key: key}
+		r := newTrieRequest(t.db.backend.Database(), t.id, key)
 		if err := t.db.backend.Retrieve(t.db.ctx, r); err != nil {
 			return fmt.Errorf("can't fetch trie key %x: %v", key, err)
 		}
@@ -185,6 +195,11 @@ func (it *nodeIterator) Next(descend bool) bool {
 	var ok bool
 	it.do(func() error {
 		ok = it.NodeIterator.Next(descend)
+		if ok && len(it.NodeIterator.Path()) > BackendConfig(it.t.db.backend).maxTrieDepth() {
+			// Each node on the path adds a nibble at most, so it's certainly too deep
+			ok = false
+			return ErrTrieTooDeep
+		}
 		return it.NodeIterator.Error()
 	})
 	return ok
@@ -204,7 +219,7 @@ func (it *nodeIterator) do(fn func() error) {
 			return
 		}
 		lasthash = missing.NodeHash
-		r := &TrieRequest{Id: it.t.id, Key: nibblesToKey(missing.Path)}
+		r := newTrieRequest(it.t.db.backend.Database(), it.t.id, nibblesToKey(missing.Path))
 		if it.err = it.t.db.backend.Retrieve(it.t.db.ctx, r); it.err != nil {
 			return
 		}
@@ -20,12 +20,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/wtc/go-wtc/common"
 	"github.com/wtc/go-wtc/consensus/ethash"
 	"github.com/wtc/go-wtc/core"
 	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/core/types"
 	"github.com/wtc/go-wtc/core/vm"
 	"github.com/wtc/go-wtc/wtcdb"
 	"github.com/wtc/go-wtc/params"
@@ -80,3 +83,31 @@ func diffTries(t1, t2 state.Trie) error {
 	}
 	return nil
 }
+
+var (
+	testStateContract = common.HexToAddress("0x000000000000000000000000000000000000c0de")
+	testStateSlots    = 16
+)
+
+// makeTestState commits a small state into db: two funded accounts and a
+// contract with code and a few storage slots. It returns a header whose state
+// root points to the committed state.
+func makeTestState(db wtcdb.Database) *types.Header {
+	st, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	st.SetBalance(testBankAddress, testBankFunds, new(big.Int), new(big.Int))
+	st.SetNonce(testBankAddress, 3)
+	st.SetBalance(acc1Addr, big.NewInt(1000), new(big.Int), new(big.Int))
+	st.SetCode(testStateContract, testContractCode)
+	for i := 0; i < testStateSlots; i++ {
+		st.SetState(testStateContract, testStateSlot(i), common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	root, err := st.CommitTo(db, true)
+	if err != nil {
+		panic(err)
+	}
+	return &types.Header{Number: new(big.Int), Root: root}
+}
+
+func testStateSlot(i int) common.Hash {
+	return common.BigToHash(big.NewInt(int64(i)))
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+)
+
+// DefaultTrieInflight is the number of retrievals allowed to run concurrently
+// for a single trie if no other limit is configured.
+const DefaultTrieInflight = 4
+
+// trieSlots is the set of retrieval slots of a single trie.
+type trieSlots struct {
+	sem   chan struct{}
+	users int // retrievals holding or waiting for a slot
+}
+
+// TrieLimitOdr wraps an OdrBackend, capping the number of concurrent retrievals
+// referencing the same trie and queuing the rest. This keeps the enumeration of
+// a single large storage trie from starving the reads of other accounts.
+// Requests not referencing a trie are passed through.
+type TrieLimitOdr struct {
+	OdrBackend
+	limit int
+
+	lock  sync.Mutex
+	tries map[common.Hash]*trieSlots
+}
+
+// NewTrieLimitOdr creates a wrapper around backend allowing at most limit
+// concurrent retrievals per trie, or DefaultTrieInflight if limit isn't positive.
+func NewTrieLimitOdr(backend OdrBackend, limit int) *TrieLimitOdr {
+	if limit <= 0 {
+		limit = DefaultTrieInflight
+	}
+	return &TrieLimitOdr{
+		OdrBackend: backend,
+		limit:      limit,
+		tries:      make(map[common.Hash]*trieSlots),
+	}
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *TrieLimitOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve waits for a free slot of the trie referenced by req, then retrieves
+// it through the wrapped backend.
+func (odr *TrieLimitOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	id := requestTrieID(req)
+	if id == nil {
+		return odr.OdrBackend.Retrieve(ctx, req)
+	}
+	odr.lock.Lock()
+	slots := odr.tries[id.Root]
+	if slots == nil {
+		slots = &trieSlots{sem: make(chan struct{}, odr.limit)}
+		odr.tries[id.Root] = slots
+	}
+	slots.users++
+	odr.lock.Unlock()
+
+	defer func() {
+		odr.lock.Lock()
+		if slots.users--; slots.users == 0 {
+			delete(odr.tries, id.Root)
+		}
+		odr.lock.Unlock()
+	}()
+	select {
+	case slots.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-slots.sem }()
+
+	return odr.OdrBackend.Retrieve(ctx, req)
+}
+
+// requestTrieID returns the trie referenced by a request, or nil if it doesn't
+// reference any.
+func requestTrieID(req OdrRequest) *TrieID {
+	switch r := req.(type) {
+	case *TrieRequest:
+		return r.Id
+	case *AccountRequest:
+		return r.Id
+	case *StorageRootRequest:
+		return r.StateId
+	case *CodeHashRequest:
+		return r.StateId
+	case *CodeRequest:
+		return r.Id
+	case *CodeSizeRequest:
+		return r.Id
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+)
+
+// concurrencyOdr is a backend recording the peak number of concurrent
+// retrievals per trie, holding each of them for a while.
+type concurrencyOdr struct {
+	OdrBackend
+	lock    sync.Mutex
+	running map[common.Hash]int
+	peak    map[common.Hash]int
+}
+
+func (odr *concurrencyOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	root := requestTrieID(req).Root
+
+	odr.lock.Lock()
+	odr.running[root]++
+	if odr.running[root] > odr.peak[root] {
+		odr.peak[root] = odr.running[root]
+	}
+	odr.lock.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	odr.lock.Lock()
+	odr.running[root]--
+	odr.lock.Unlock()
+	return nil
+}
+
+func TestTrieLimit(t *testing.T) {
+	backend := &concurrencyOdr{running: make(map[common.Hash]int), peak: make(map[common.Hash]int)}
+	odr := NewTrieLimitOdr(backend, 2)
+
+	hot := &TrieID{Root: common.HexToHash("01")}
+	cold := &TrieID{Root: common.HexToHash("02")}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			odr.Retrieve(NoOdr, &TrieRequest{Id: hot, Key: []byte{byte(i)}})
+		}(i)
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			odr.Retrieve(NoOdr, &TrieRequest{Id: cold, Key: []byte{byte(i)}})
+		}(i)
+	}
+	wg.Wait()
+
+	if peak := backend.peak[hot.Root]; peak != 2 {
+		t.Errorf("hot trie concurrency mismatch: have %d, want %d", peak, 2)
+	}
+	if peak := backend.peak[cold.Root]; peak < 1 || peak > 2 {
+		t.Errorf("cold trie concurrency out of bounds: have %d, want 1-2", peak)
+	}
+	if len(odr.tries) != 0 {
+		t.Errorf("slots leaked for %d tries", len(odr.tries))
+	}
+	// Retrievals waiting in the queue should give up on cancellation
+	blocker := &blockingOdr{release: make(chan struct{})}
+	defer close(blocker.release)
+
+	odr = NewTrieLimitOdr(blocker, 1)
+	go odr.Retrieve(NoOdr, &TrieRequest{Id: hot})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(NoOdr, 10*time.Millisecond)
+	defer cancel()
+	if err := odr.Retrieve(ctx, &TrieRequest{Id: hot}); err != context.DeadlineExceeded {
+		t.Errorf("error mismatch for queued retrieval: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// blockingOdr is a backend whose retrievals block until released.
+type blockingOdr struct {
+	OdrBackend
+	release chan struct{}
+}
+
+func (odr *blockingOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	<-odr.release
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrUnknownTransaction is returned if the block of a transaction can't be
+// resolved from the local transaction lookup entries.
+var ErrUnknownTransaction = errors.New("unknown transaction")
+
+// TxLogsRequest is the ODR request type for retrieving the logs emitted by a
+// single transaction. It's served as the receipts of its block, which are
+// verified against the receipts root and stored, so later queries for the
+// transactions of the same block are answered locally.
+type TxLogsRequest struct {
+	OdrRequest
+	TxHash    common.Hash
+	BlockHash common.Hash
+	Number    uint64
+	Index     uint64 // position of the transaction in the block
+	Receipts  types.Receipts
+	Logs      []*types.Log
+}
+
+// NewTxLogsRequest creates a request for the logs of a transaction, resolving
+// its position from the local transaction lookup entries.
+func NewTxLogsRequest(db wtcdb.Database, txHash common.Hash) (*TxLogsRequest, error) {
+	hash, number, index := canonicalTxLookup(db, txHash)
+	if hash == (common.Hash{}) {
+		return nil, ErrUnknownTransaction
+	}
+	return &TxLogsRequest{TxHash: txHash, BlockHash: hash, Number: number, Index: index}, nil
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *TxLogsRequest) StoreResult(db wtcdb.Database) error {
+	header := getHeader(db, req.BlockHash, req.Number)
+	if header == nil {
+		return ErrNoHeader
+	}
+	if types.DeriveSha(req.Receipts) != header.ReceiptHash {
+		return ErrReceiptHashMismatch
+	}
+	if req.Index >= uint64(len(req.Receipts)) {
+		return ErrIndexOutOfRange
+	}
+	if err := core.WriteBlockReceipts(db, req.BlockHash, req.Number, req.Receipts); err != nil {
+		return err
+	}
+	req.Logs = txLogs(req.Receipts, req.TxHash, req.BlockHash, req.Number, req.Index)
+	return nil
+}
+
+// txLogs returns copies of the logs of the receipt at index with their derived
+// fields filled in, log indices counting from the start of the block. The
+// result is empty but not nil if the transaction emitted no logs.
+func txLogs(receipts types.Receipts, txHash, blockHash common.Hash, number, index uint64) []*types.Log {
+	var offset uint
+	for _, receipt := range receipts[:index] {
+		offset += uint(len(receipt.Logs))
+	}
+	logs := make([]*types.Log, len(receipts[index].Logs))
+	for i, log := range receipts[index].Logs {
+		cpy := *log
+		cpy.BlockNumber, cpy.BlockHash = number, blockHash
+		cpy.TxHash, cpy.TxIndex = txHash, uint(index)
+		cpy.Index = offset + uint(i)
+		logs[i] = &cpy
+	}
+	return logs
+}
+
+// GetTransactionLogs retrieves the logs emitted by a transaction whose lookup
+// entry is known locally, e.g. because its block body was retrieved.
+func GetTransactionLogs(ctx context.Context, odr OdrBackend, txHash common.Hash) ([]*types.Log, error) {
+	r, err := NewTxLogsRequest(odr.Database(), txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipts := core.GetBlockReceipts(localDatabase(odr, KindTxLogs), r.BlockHash, r.Number); receipts != nil {
+		if r.Index >= uint64(len(receipts)) {
+			return nil, ErrIndexOutOfRange
+		}
+		return txLogs(receipts, txHash, r.BlockHash, r.Number, r.Index), nil
+	}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return nil, err
+	}
+	return r.Logs, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestGetTransactionLogs(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	receipts := makeTestReceipts(txs)
+
+	// Let the first transaction emit two logs and the second none
+	extra := *receipts[0].Logs[0]
+	extra.Data = []byte{0xff}
+	receipts[0].Logs = append(receipts[0].Logs, &extra)
+	receipts[1].Logs = nil
+	for _, receipt := range receipts {
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	}
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+	hash, number := block.Hash(), block.NumberU64()
+	core.WriteBlock(sdb, block)
+	core.WriteBlockReceipts(sdb, hash, number, receipts)
+
+	odr := NewMemoryOdrBackend(sdb)
+	core.WriteHeader(odr.Database(), block.Header())
+	core.WriteTxLookupEntries(odr.Database(), block)
+
+	want := [][]uint{{0, 1}, {}, {2}}
+	for i, tx := range txs {
+		logs, err := GetTransactionLogs(context.Background(), odr, tx.Hash())
+		if err != nil {
+			t.Fatalf("tx %d: failed to retrieve logs: %v", i, err)
+		}
+		if logs == nil || len(logs) != len(want[i]) {
+			t.Fatalf("tx %d: log count mismatch: have %d, want %d", i, len(logs), len(want[i]))
+		}
+		for j, log := range logs {
+			if log.Index != want[i][j] {
+				t.Errorf("tx %d log %d: index mismatch: have %d, want %d", i, j, log.Index, want[i][j])
+			}
+			if log.TxIndex != uint(i) || log.TxHash != tx.Hash() || log.BlockHash != hash || log.BlockNumber != number {
+				t.Errorf("tx %d log %d: position mismatch: %+v", i, j, log)
+			}
+		}
+	}
+	// The receipts are stored by the first retrieval, later ones are local
+	if core.GetBlockReceipts(odr.Database(), hash, number) == nil {
+		t.Fatalf("receipts not stored")
+	}
+	logs, err := GetTransactionLogs(context.Background(), offlineOdr{odr.Database()}, txs[2].Hash())
+	if err != nil || len(logs) != 1 || logs[0].Index != 2 {
+		t.Errorf("local logs mismatch: have %v, %v", logs, err)
+	}
+	if _, err := GetTransactionLogs(context.Background(), odr, common.HexToHash("01")); err != ErrUnknownTransaction {
+		t.Errorf("unknown transaction error mismatch: have %v, want %v", err, ErrUnknownTransaction)
+	}
+}
+
+func TestTxLogsRequestReceiptsMismatch(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(2)
+	receipts := makeTestReceipts(txs)
+	block := makeTestBlock(genesis.Header(), txs, nil, receipts)
+
+	db, _ := wtcdb.NewMemDatabase()
+	core.WriteHeader(db, block.Header())
+	req := &TxLogsRequest{TxHash: txs[0].Hash(), BlockHash: block.Hash(), Number: block.NumberU64(), Receipts: receipts[:1]}
+	if err := req.StoreResult(db); err != ErrReceiptHashMismatch {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrReceiptHashMismatch)
+	}
+	if core.GetBlockReceipts(db, block.Hash(), block.NumberU64()) != nil {
+		t.Errorf("mismatching receipts stored")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrTxLookupMismatch is returned if a retrieved transaction lookup entry
+// doesn't point to the transaction in a canonical block.
+var ErrTxLookupMismatch = errors.New("transaction lookup mismatch")
+
+// TxLookupRequest is the ODR request type for retrieving the lookup entry of a
+// transaction, i.e. the block and position it was included at. The entry is
+// served with the body of the block, which is verified against the canonical
+// header known locally and must hold the transaction at the given position.
+// The body and the lookup entries of all its transactions are stored. LES has no
+// message for it, LesOdr fails it with ErrUnsupportedRequest.
+type TxLookupRequest struct {
+	OdrRequest
+	TxHash    common.Hash
+	BlockHash common.Hash
+	Number    uint64
+	Index     uint64 // position of the transaction in the block
+	Rlp       []byte // RLP encoded block body
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *TxLookupRequest) StoreResult(db wtcdb.Database) error {
+	header := getHeader(db, req.BlockHash, req.Number)
+	if header == nil {
+		return ErrNoHeader
+	}
+	if core.GetCanonicalHash(db, req.Number) != req.BlockHash {
+		return ErrTxLookupMismatch
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(req.Rlp, body); err != nil {
+		return ErrMalformedResponse
+	}
+	if req.Index >= uint64(len(body.Transactions)) || body.Transactions[req.Index].Hash() != req.TxHash {
+		return ErrTxLookupMismatch
+	}
+	if err := storeBody(db, req.BlockHash, req.Number, req.Rlp); err != nil {
+		return err
+	}
+	return writeTxLookupEntries(db, types.NewBlockWithHeader(header).WithBody(body.Transactions, body.Uncles))
+}
+
+// writeTxLookupEntries stores the lookup entries of the transactions of a block.
+// A transaction included in several blocks across a reorg may already have an
+// entry pointing to another block: an entry into a block of the canonical chain
+// is kept unless the new block is canonical itself, any other entry is replaced.
+func writeTxLookupEntries(db wtcdb.Database, block *types.Block) error {
+	canonical := core.GetCanonicalHash(db, block.NumberU64()) == block.Hash()
+
+	var keep map[common.Hash]bool
+	for _, tx := range block.Transactions() {
+		hash, number, _ := core.GetTxLookupEntry(db, tx.Hash())
+		if hash == (common.Hash{}) || hash == block.Hash() {
+			continue
+		}
+		if !canonical && core.GetCanonicalHash(db, number) == hash {
+			if keep == nil {
+				keep = make(map[common.Hash]bool)
+			}
+			keep[tx.Hash()] = true
+		}
+	}
+	if keep == nil {
+		return core.WriteTxLookupEntries(db, block)
+	}
+	return core.WriteTxLookupEntries(&lookupFilter{db, keep}, block)
+}
+
+// lookupFilter is a database writer dropping the lookup entries of the given
+// transactions, which are keyed by the transaction hash suffix.
+type lookupFilter struct {
+	wtcdb.Putter
+	keep map[common.Hash]bool
+}
+
+// Put implements wtcdb.Putter, skipping the entries of kept transactions.
+func (f *lookupFilter) Put(key []byte, value []byte) error {
+	if len(key) >= common.HashLength && f.keep[common.BytesToHash(key[len(key)-common.HashLength:])] {
+		return nil
+	}
+	return f.Putter.Put(key, value)
+}
+
+// canonicalTxLookup returns the local lookup entry of a transaction if it points
+// into the canonical chain. Entries into blocks that have been reorged out are
+// stale and are deleted, so that the transaction is looked up anew.
+func canonicalTxLookup(db wtcdb.Database, txHash common.Hash) (common.Hash, uint64, uint64) {
+	hash, number, index := core.GetTxLookupEntry(db, txHash)
+	if hash == (common.Hash{}) {
+		return common.Hash{}, 0, 0
+	}
+	if canon := core.GetCanonicalHash(db, number); canon != (common.Hash{}) && canon != hash {
+		core.DeleteTxLookupEntry(db, txHash)
+		return common.Hash{}, 0, 0
+	}
+	return hash, number, index
+}
+
+// GetTxLookup returns the block hash, number and position of a transaction,
+// retrieving and verifying its lookup entry if it's not known locally.
+func GetTxLookup(ctx context.Context, odr OdrBackend, txHash common.Hash) (common.Hash, uint64, uint64, error) {
+	if hash, number, index := canonicalTxLookup(localDatabase(odr, KindTxLookup), txHash); hash != (common.Hash{}) {
+		return hash, number, index, nil
+	}
+	r := &TxLookupRequest{TxHash: txHash}
+	if err := odr.Retrieve(ctx, r); err != nil {
+		return common.Hash{}, 0, 0, err
+	}
+	return r.BlockHash, r.Number, r.Index, nil
+}
+
+// IsTxIncluded reports whether a transaction is included in the canonical chain,
+// returning the hash and number of the block it was found in either way. The
+// lookup entry is taken from the local database if present, even if it points
+// into an orphaned block, and retrieved otherwise. The transaction is verified to
+// be at the position of the entry in the body of that block, and the block to be
+// canonical per the verified canonical index, so a transaction known only from
+// an orphaned block, or one newer than the verified head, isn't included.
+func IsTxIncluded(ctx context.Context, odr OdrBackend, txHash common.Hash) (bool, common.Hash, uint64, error) {
+	hash, number, index := core.GetTxLookupEntry(localDatabase(odr, KindTxLookup), txHash)
+	if hash == (common.Hash{}) {
+		var err error
+		if hash, number, index, err = GetTxLookup(ctx, odr, txHash); err != nil {
+			return false, common.Hash{}, 0, err
+		}
+	}
+	tx, err := GetTransactionByIndex(ctx, odr, hash, number, index)
+	if err == ErrIndexOutOfRange || (err == nil && tx.Hash() != txHash) {
+		return false, common.Hash{}, 0, ErrTxLookupMismatch
+	}
+	if err != nil {
+		return false, common.Hash{}, 0, err
+	}
+	canon, err := VerifiedHashForNumber(ctx, odr, number)
+	if err == ErrAheadOfHead {
+		return false, hash, number, nil
+	}
+	if err != nil {
+		return false, common.Hash{}, 0, err
+	}
+	return canon == hash, hash, number, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/core/types"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestGetTxLookup(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	block := makeTestBlock(genesis.Header(), txs, nil, nil)
+	hash, number := block.Hash(), block.NumberU64()
+	core.WriteBlock(sdb, block)
+	core.WriteTxLookupEntries(sdb, block)
+
+	odr := NewMemoryOdrBackend(sdb)
+	db := odr.Database()
+	core.WriteHeader(db, block.Header())
+	core.WriteCanonicalHash(db, hash, number)
+
+	blockHash, blockNumber, index, err := GetTxLookup(context.Background(), odr, txs[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve lookup: %v", err)
+	}
+	if blockHash != hash || blockNumber != number || index != 1 {
+		t.Errorf("lookup mismatch: have %x/%d/%d, want %x/%d/1", blockHash, blockNumber, index, hash, number)
+	}
+	// The body and the entries of every transaction of the block are stored
+	if getBodyRLP(db, hash, number) == nil {
+		t.Errorf("body not stored")
+	}
+	for i, tx := range txs {
+		if have, _, idx := core.GetTxLookupEntry(db, tx.Hash()); have != hash || idx != uint64(i) {
+			t.Errorf("tx %d: stored lookup mismatch: have %x/%d", i, have, idx)
+		}
+	}
+}
+
+func TestTxLookupRequestSpoofed(t *testing.T) {
+	gdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(gdb)
+	txs := makeTestTxs(3)
+	block := makeTestBlock(genesis.Header(), txs, nil, nil)
+	fork := makeTestBlock(genesis.Header(), txs, []*types.Header{newTestUncle(genesis.Header(), "fork")}, nil)
+	hash, number := block.Hash(), block.NumberU64()
+	body, _ := rlp.EncodeToBytes(block.Body())
+	forkBody, _ := rlp.EncodeToBytes(fork.Body())
+	other, _ := rlp.EncodeToBytes(&types.Body{Transactions: txs[:2]})
+
+	tests := []*TxLookupRequest{
+		{TxHash: txs[1].Hash(), BlockHash: hash, Number: number, Index: 2, Rlp: body},            // wrong position
+		{TxHash: txs[1].Hash(), BlockHash: hash, Number: number, Index: 5, Rlp: body},            // out of range
+		{TxHash: txs[1].Hash(), BlockHash: fork.Hash(), Number: number, Index: 1, Rlp: forkBody}, // non-canonical block
+		{TxHash: txs[1].Hash(), BlockHash: hash, Number: number, Index: 1, Rlp: other},           // body of another block
+		{TxHash: txs[1].Hash(), BlockHash: hash, Number: number, Index: 1, Rlp: []byte{0xc3}},    // malformed body
+	}
+	for i, req := range tests {
+		db, _ := wtcdb.NewMemDatabase()
+		core.WriteHeader(db, block.Header())
+		core.WriteHeader(db, fork.Header())
+		core.WriteCanonicalHash(db, hash, number)
+		if err := req.StoreResult(db); err == nil {
+			t.Errorf("test %d: spoofed lookup accepted", i)
+		}
+		if have, _, _ := core.GetTxLookupEntry(db, txs[1].Hash()); have != (common.Hash{}) {
+			t.Errorf("test %d: spoofed lookup stored", i)
+		}
+	}
+	// Without the header nothing can be verified
+	req := &TxLookupRequest{TxHash: txs[1].Hash(), BlockHash: hash, Number: number, Index: 1, Rlp: body}
+	db, _ := wtcdb.NewMemDatabase()
+	if err := req.StoreResult(db); err != ErrNoHeader {
+		t.Errorf("error mismatch without header: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+func TestTxLookupReorg(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(3)
+	fork := makeTestBlock(genesis.Header(), txs, []*types.Header{newTestUncle(genesis.Header(), "fork")}, nil)
+	block := makeTestBlock(genesis.Header(), txs, nil, nil)
+	hash, number := block.Hash(), block.NumberU64()
+	core.WriteBlock(sdb, block)
+	core.WriteCanonicalHash(sdb, hash, number)
+	core.WriteTxLookupEntries(sdb, block)
+
+	// The transactions were first seen in the fork block while it was canonical
+	odr := NewMemoryOdrBackend(sdb)
+	db := odr.Database()
+	core.WriteHeader(db, fork.Header())
+	core.WriteHeader(db, block.Header())
+	core.WriteCanonicalHash(db, fork.Hash(), number)
+	if err := writeTxLookupEntries(db, fork); err != nil {
+		t.Fatalf("failed to write fork entries: %v", err)
+	}
+	// After the reorg the stale entry is dropped and the lookup retrieved anew
+	core.WriteCanonicalHash(db, hash, number)
+	blockHash, _, index, err := GetTxLookup(context.Background(), odr, txs[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve lookup: %v", err)
+	}
+	if blockHash != hash || index != 1 {
+		t.Errorf("lookup mismatch: have %x/%d, want %x/1", blockHash, index, hash)
+	}
+	for i, tx := range txs {
+		if have, _, _ := core.GetTxLookupEntry(db, tx.Hash()); have != hash {
+			t.Errorf("tx %d: lookup points to %x, want canonical %x", i, have, hash)
+		}
+	}
+	// Storing the fork block again must not override the canonical entries
+	if err := writeTxLookupEntries(db, fork); err != nil {
+		t.Fatalf("failed to write fork entries: %v", err)
+	}
+	for i, tx := range txs {
+		if have, _, _ := core.GetTxLookupEntry(db, tx.Hash()); have != hash {
+			t.Errorf("tx %d: lookup overridden by fork block %x", i, have)
+		}
+	}
+	// A stale entry without a source to retrieve from is reported unknown
+	core.WriteCanonicalHash(db, fork.Hash(), number)
+	if _, err := NewTxLogsRequest(db, txs[0].Hash()); err != ErrUnknownTransaction {
+		t.Errorf("error mismatch for stale entry: have %v, want %v", err, ErrUnknownTransaction)
+	}
+	if have, _, _ := core.GetTxLookupEntry(db, txs[0].Hash()); have != (common.Hash{}) {
+		t.Errorf("stale entry not deleted: %x", have)
+	}
+}
+
+func TestIsTxIncluded(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	txs := makeTestTxs(4)
+	block := makeTestBlock(genesis.Header(), txs[:2], nil, nil)
+	fork := makeTestBlock(genesis.Header(), txs[2:], []*types.Header{newTestUncle(genesis.Header(), "fork")}, nil)
+	core.WriteBlock(sdb, block)
+	core.WriteBlock(sdb, fork)
+	core.WriteTxLookupEntries(sdb, block)
+
+	odr := NewMemoryOdrBackend(sdb)
+	db := odr.Database()
+	writeCanonicalHeaders(db, []*types.Header{genesis.Header(), block.Header()})
+	core.WriteHeader(db, fork.Header())
+	core.WriteHeadHeaderHash(db, block.Hash())
+
+	// A transaction of the canonical block is included, its lookup retrieved
+	included, hash, number, err := IsTxIncluded(NoOdr, odr, txs[1].Hash())
+	if err != nil || !included || hash != block.Hash() || number != 1 {
+		t.Errorf("canonical tx mismatch: have %v, %x/%d, %v, want true, %x/1", included, hash, number, err, block.Hash())
+	}
+	// A transaction a server placed in an orphaned block isn't
+	core.WriteTxLookupEntries(db, fork)
+	included, hash, number, err = IsTxIncluded(NoOdr, odr, txs[3].Hash())
+	if err != nil || included || hash != fork.Hash() || number != 1 {
+		t.Errorf("orphaned tx mismatch: have %v, %x/%d, %v, want false, %x/1", included, hash, number, err, fork.Hash())
+	}
+	// An entry not pointing to the transaction is rejected
+	core.WriteTxLookupEntries(db, types.NewBlockWithHeader(block.Header()).WithBody(txs[2:3], nil))
+	if _, _, _, err := IsTxIncluded(NoOdr, odr, txs[2].Hash()); err != ErrTxLookupMismatch {
+		t.Errorf("error mismatch for misplaced tx: have %v, want %v", err, ErrTxLookupMismatch)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var trieValueIndexPrefix = []byte("light-tvi-") // trieValueIndexPrefix + root + key -> RLP encoded value
+
+func trieValueIndexKey(root common.Hash, key []byte) []byte {
+	return append(append(append([]byte{}, trieValueIndexPrefix...), root[:]...), key...)
+}
+
+// indexProof verifies a merkle proof for key and stores the proven value (or
+// its absence) in the value index. Proofs not ending in the value of the key
+// (e.g. those retrieved while iterating) are silently skipped.
+func indexProof(db wtcdb.Database, root common.Hash, key []byte, proof []rlp.RawValue) error {
+	value, err := ConfigOf(db).VerifyProof(root, key, proof)
+	if err != nil {
+		return nil
+	}
+	return WriteIndexedTrieValue(db, root, key, value)
+}
+
+// WriteIndexedTrieValue stores the value belonging to key in the trie with the
+// given root in the value index. A nil value records the absence of the key.
+func WriteIndexedTrieValue(db wtcdb.Putter, root common.Hash, key, value []byte) error {
+	data, err := rlp.EncodeToBytes(value)
+	if err != nil {
+		return err
+	}
+	return db.Put(trieValueIndexKey(root, key), data)
+}
+
+// GetIndexedTrieValue looks up the value belonging to key in the trie with the
+// given root in the value index. The returned flag reports whether the entry
+// was found at all, as a nil value means the key is proven absent.
+func GetIndexedTrieValue(db wtcdb.Database, root common.Hash, key []byte) ([]byte, bool) {
+	data, err := db.Get(trieValueIndexKey(root, key))
+	if err != nil || len(data) == 0 {
+		return nil, false
+	}
+	var value []byte
+	if err := rlp.DecodeBytes(data, &value); err != nil {
+		return nil, false
+	}
+	if len(value) == 0 {
+		return nil, true
+	}
+	return value, true
+}
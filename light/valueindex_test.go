@@ -0,0 +1,99 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestTrieValueIndex(t *testing.T) {
+	config := DefaultConfig()
+	config.IndexTrieValues = true
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	head := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb, config: config}
+
+	st := NewState(context.Background(), head, odr)
+	if bal := st.GetBalance(acc1Addr); bal.Cmp(big.NewInt(1000)) != 0 {
+		t.Fatalf("balance mismatch: have %v, want %v", bal, 1000)
+	}
+	want, ok := GetIndexedTrieValue(ldb, head.Root, crypto.Keccak256(acc1Addr[:]))
+	if !ok || len(want) == 0 {
+		t.Fatalf("account not indexed after retrieval")
+	}
+	// Copy only the index into a fresh database and read through it without
+	// any trie nodes or network access.
+	idb, _ := wtcdb.NewMemDatabase()
+	for _, key := range ldb.Keys() {
+		if bytes.HasPrefix(key, trieValueIndexPrefix) {
+			val, _ := ldb.Get(key)
+			idb.Put(key, val)
+		}
+	}
+	odr = &testOdr{sdb: sdb, ldb: idb, disable: true, config: config}
+	tr, _ := NewStateDatabase(context.Background(), head, odr).OpenTrie(head.Root)
+	have, err := tr.TryGet(acc1Addr[:])
+	if err != nil {
+		t.Fatalf("indexed read failed: %v", err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatalf("indexed value mismatch: have %x, want %x", have, want)
+	}
+	// A different root must not hit the index
+	other := *head
+	other.Root[0]++
+	tr, _ = NewStateDatabase(context.Background(), &other, odr).OpenTrie(other.Root)
+	if _, err := tr.TryGet(acc1Addr[:]); err == nil {
+		t.Fatalf("index served value for unrelated root")
+	}
+}
+
+func BenchmarkTrieValueIndex(b *testing.B) {
+	b.Run("trie", func(b *testing.B) { benchmarkTrieValueIndex(b, false) })
+	b.Run("index", func(b *testing.B) { benchmarkTrieValueIndex(b, true) })
+}
+
+func benchmarkTrieValueIndex(b *testing.B, index bool) {
+	config := DefaultConfig()
+	config.IndexTrieValues = index
+
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	head := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb, config: config}
+	db := NewStateDatabase(context.Background(), head, odr)
+
+	tr, _ := db.OpenTrie(head.Root)
+	if _, err := tr.TryGet(acc1Addr[:]); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr, _ := db.OpenTrie(head.Root)
+		if _, err := tr.TryGet(acc1Addr[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
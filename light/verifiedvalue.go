@@ -0,0 +1,98 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/core/state"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+)
+
+// VerifiedValue retrieves the value stored under key in the trie identified by
+// id, whose root must have been verified by the caller. The key is the raw trie
+// key, i.e. the hash of the address or slot for state and storage tries. Nodes
+// missing locally are retrieved, and the value is only read along a path leading
+// from the root to the key, so it's proven either way: found reports whether the
+// key exists.
+func VerifiedValue(ctx context.Context, odr OdrBackend, id *TrieID, key []byte) (value []byte, found bool, err error) {
+	t, err := trie.New(id.Root, odr.Database())
+	if err == nil {
+		value, err = t.TryGet(key)
+	}
+	if _, ok := err.(*trie.MissingNodeError); ok {
+		// The proof is only usable if it leads from the verified root to the key
+		if err := odr.Retrieve(ctx, newTrieRequest(odr.Database(), id, key)); err != nil {
+			return nil, false, err
+		}
+		if t, err = trie.New(id.Root, odr.Database()); err == nil {
+			value, err = t.TryGet(key)
+		}
+		if _, ok := err.(*trie.MissingNodeError); ok {
+			return nil, false, ErrMalformedResponse
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, value != nil, nil
+}
+
+// VerifiedDecode retrieves the value stored under key in the trie identified by
+// id like VerifiedValue, passing it to decode if found. Decoding failures are
+// reported as ErrMalformedResponse, the value being proven by the trie.
+func VerifiedDecode(ctx context.Context, odr OdrBackend, id *TrieID, key []byte, decode func([]byte) error) (bool, error) {
+	value, found, err := VerifiedValue(ctx, odr, id, key)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := decode(value); err != nil {
+		return false, ErrMalformedResponse
+	}
+	return true, nil
+}
+
+// VerifiedAccount retrieves the account with the given address from the state
+// trie identified by id, reporting whether it exists.
+func VerifiedAccount(ctx context.Context, odr OdrBackend, id *TrieID, addr common.Address) (*state.Account, bool, error) {
+	key := addressHash(addr)
+	account := new(state.Account)
+	found, err := VerifiedDecode(ctx, odr, id, key[:], func(value []byte) error {
+		return rlp.DecodeBytes(value, account)
+	})
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return account, true, nil
+}
+
+// VerifiedSlot retrieves the content of a storage slot from the storage trie
+// identified by id, reporting whether the slot is set.
+func VerifiedSlot(ctx context.Context, odr OdrBackend, id *TrieID, slot common.Hash) ([]byte, bool, error) {
+	var content []byte
+	found, err := VerifiedDecode(ctx, odr, id, crypto.Keccak256(slot[:]), func(value []byte) (err error) {
+		_, content, _, err = rlp.Split(value)
+		return err
+	})
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return content, true, nil
+}
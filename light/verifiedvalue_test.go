@@ -0,0 +1,87 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestVerifiedDecode(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	ldb, _ := wtcdb.NewMemDatabase()
+	header := makeTestState(sdb)
+	odr := &testOdr{sdb: sdb, ldb: ldb}
+	id := StateTrieID(header)
+
+	// A custom decoder only interested in the nonce
+	nonce := func(n *uint64) func([]byte) error {
+		return func(value []byte) error {
+			var acc struct {
+				Nonce uint64
+				Rest  []rlp.RawValue `rlp:"tail"`
+			}
+			err := rlp.DecodeBytes(value, &acc)
+			*n = acc.Nonce
+			return err
+		}
+	}
+	var n uint64
+	key := crypto.Keccak256(testBankAddress[:])
+	if found, err := VerifiedDecode(context.Background(), odr, id, key, nonce(&n)); err != nil || !found || n != 3 {
+		t.Errorf("nonce mismatch: have %d, %v, %v, want 3", n, found, err)
+	}
+	n = 0
+	key = crypto.Keccak256(acc2Addr[:])
+	if found, err := VerifiedDecode(context.Background(), odr, id, key, nonce(&n)); err != nil || found || n != 0 {
+		t.Errorf("missing account mismatch: have %d, %v, %v, want not found", n, found, err)
+	}
+	// Values the decoder rejects are malformed, the decoder's error isn't leaked
+	reject := func([]byte) error { return errors.New("rejected") }
+	if _, err := VerifiedDecode(context.Background(), odr, id, crypto.Keccak256(acc1Addr[:]), reject); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for rejected value: have %v, want %v", err, ErrMalformedResponse)
+	}
+	// The specializations for accounts and storage slots
+	account, found, err := VerifiedAccount(context.Background(), odr, id, acc1Addr)
+	if err != nil || !found || account.Balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("account mismatch: have %v, %v, %v", account, found, err)
+	}
+	if account, found, err := VerifiedAccount(context.Background(), odr, id, acc2Addr); err != nil || found || account != nil {
+		t.Errorf("missing account mismatch: have %v, %v, %v", account, found, err)
+	}
+	contract, _, _ := VerifiedAccount(context.Background(), odr, id, testStateContract)
+	storage := StorageTrieID(id, crypto.Keccak256Hash(testStateContract[:]), contract.Root)
+	if value, found, err := VerifiedSlot(context.Background(), odr, storage, testStateSlot(2)); err != nil || !found || !bytes.Equal(value, []byte{3}) {
+		t.Errorf("slot mismatch: have %x, %v, %v, want %x", value, found, err, []byte{3})
+	}
+	if value, found, err := VerifiedSlot(context.Background(), odr, storage, testStateSlot(testStateSlots)); err != nil || found || value != nil {
+		t.Errorf("missing slot mismatch: have %x, %v, %v", value, found, err)
+	}
+	// Failing retrievals are not mistaken for absence
+	ddb, _ := wtcdb.NewMemDatabase()
+	disabled := &testOdr{sdb: sdb, ldb: ddb, disable: true}
+	if _, found, err := VerifiedValue(context.Background(), disabled, id, crypto.Keccak256(acc2Addr[:])); err != ErrOdrDisabled || found {
+		t.Errorf("error mismatch for failing retrieval: have %v, %v, want %v", found, err, ErrOdrDisabled)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/metrics"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+var (
+	verifiedProofPrefix = []byte("light-verified-") // verifiedProofPrefix + hash(root, key, proof) -> RLP encoded value
+
+	// incrementalProofCounter counts the proofs verified from a cached prefix.
+	incrementalProofCounter = metrics.NewCounter("light/odr/incrementalproofs")
+)
+
+// verifiedProofKey returns the database key of the verification marker of a
+// proof of key against root.
+func verifiedProofKey(root common.Hash, key []byte, proof []rlp.RawValue) []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{root, key, proof})
+	return append(append([]byte{}, verifiedProofPrefix...), crypto.Keccak256(enc)...)
+}
+
+// verifyProofCached verifies a merkle proof of key against root like VerifyProof,
+// unless the very same proof was verified before and the CacheVerifiedProofs
+// option of the configuration bound to db is set. With markers enabled, proofs
+// starting with nodes already cached locally are verified incrementally.
+func verifyProofCached(db wtcdb.Database, root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	config := ConfigOf(db)
+	if !config.CacheVerifiedProofs {
+		return config.VerifyProof(root, key, proof)
+	}
+	mkey := verifiedProofKey(root, key, proof)
+	if data, err := db.Get(mkey); err == nil && len(data) > 0 {
+		var value []byte
+		if err := rlp.DecodeBytes(data, &value); err == nil {
+			if len(value) == 0 {
+				return nil, nil
+			}
+			return value, nil
+		}
+	}
+	value, err := verifyIncremental(db, root, key, proof)
+	if err != nil {
+		return nil, err
+	}
+	// Failing to record the marker only means verifying again next time
+	if data, err := rlp.EncodeToBytes(value); err == nil {
+		db.Put(mkey, data)
+	}
+	return value, nil
+}
+
+// verifyIncremental verifies a merkle proof of key against root, trusting the
+// leading proof nodes that are cached locally: those were verified when stored
+// and are content-addressed, so only the nodes below the first one missing from
+// the cache are hashed and checked. Proofs not starting with the cached nodes
+// are verified in full by the configured verifier.
+func verifyIncremental(db wtcdb.Database, root common.Hash, key []byte, proof []rlp.RawValue) ([]byte, error) {
+	config := ConfigOf(db)
+	if !config.standardTrie() {
+		return config.VerifyProof(root, key, proof)
+	}
+	local := localProofPrefix(db, root, key)
+	if len(local) == 0 || len(local) > len(proof) {
+		return config.VerifyProof(root, key, proof)
+	}
+	for i, node := range local {
+		if !bytes.Equal(node, proof[i]) {
+			return config.VerifyProof(root, key, proof)
+		}
+	}
+	// Resolve the path through the cache, falling back to the rest of the proof
+	stage := newStagingDatabase(db)
+	for _, node := range proof[len(local):] {
+		stage.Put(crypto.Keccak256(node), node)
+	}
+	guard := &depthGuard{Database: stage, limit: config.maxTrieDepth()}
+	t, err := trie.New(root, guard)
+	if err != nil {
+		return nil, err
+	}
+	incrementalProofCounter.Inc(1)
+	return t.TryGet(key)
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestCacheVerifiedProofs(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	st, _ := trie.New(id.Root, sdb)
+	key := addressHash(acc1Addr)
+	proof := st.Prove(key[:])
+
+	verifier := new(stubVerifier)
+	mdb, _ := wtcdb.NewMemDatabase()
+	ldb := BindConfig(mdb, &Config{ProofVerifier: verifier, CacheVerifiedProofs: true})
+	if err := (&AccountRequest{Id: id, Address: acc1Addr, Proof: proof}).StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store account: %v", err)
+	}
+	if verifier.calls != 1 {
+		t.Fatalf("verification count mismatch: have %d, want 1", verifier.calls)
+	}
+	// The same proof is accepted from the marker, even in a later session
+	req := &AccountRequest{Id: id, Address: acc1Addr, Proof: proof}
+	if err := req.StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store account again: %v", err)
+	}
+	if verifier.calls != 1 {
+		t.Errorf("previously verified proof verified again")
+	}
+	if req.Account == nil || req.Account.Balance.Int64() != 1000 {
+		t.Errorf("account mismatch from marker: %v", req.Account)
+	}
+	// A proof differing in any node is verified
+	verifier.reject = true
+	if err := (&AccountRequest{Id: id, Address: acc1Addr, Proof: proof[:len(proof)-1]}).StoreResult(ldb); err != ErrMalformedResponse {
+		t.Errorf("error mismatch for different proof: have %v, want %v", err, ErrMalformedResponse)
+	}
+	if verifier.calls != 2 {
+		t.Errorf("different proof not verified")
+	}
+	// Backends without the option verify every proof, even sharing the markers
+	ldb = BindConfig(mdb, &Config{ProofVerifier: verifier})
+	if err := (&AccountRequest{Id: id, Address: acc1Addr, Proof: proof}).StoreResult(ldb); err != ErrMalformedResponse {
+		t.Errorf("error mismatch with markers disabled: have %v, want %v", err, ErrMalformedResponse)
+	}
+}
+
+func TestVerifyIncremental(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	id := StateTrieID(makeTestState(sdb))
+	st, _ := trie.New(id.Root, sdb)
+
+	// Cache the path of one account, sharing its upper nodes with the others
+	ldb, _ := wtcdb.NewMemDatabase()
+	key := addressHash(acc1Addr)
+	if err := (&AccountRequest{Id: id, Address: acc1Addr, Proof: st.Prove(key[:])}).StoreResult(ldb); err != nil {
+		t.Fatalf("failed to store account: %v", err)
+	}
+	key = addressHash(testBankAddress)
+	proof := st.Prove(key[:])
+	if len(localProofPrefix(ldb, id.Root, key[:])) == 0 {
+		t.Fatalf("no cached proof prefix")
+	}
+	want, err := DefaultConfig().VerifyProof(id.Root, key[:], proof)
+	if err != nil {
+		t.Fatalf("failed to verify full proof: %v", err)
+	}
+	have, err := verifyIncremental(ldb, id.Root, key[:], proof)
+	if err != nil {
+		t.Fatalf("failed to verify incrementally: %v", err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("value mismatch: have %x, want %x", have, want)
+	}
+	// Nodes below the cached prefix are still checked
+	tampered := make([]rlp.RawValue, len(proof))
+	copy(tampered, proof)
+	leaf := common.CopyBytes(tampered[len(tampered)-1])
+	leaf[len(leaf)-1] ^= 0x01
+	tampered[len(tampered)-1] = leaf
+	if _, err := verifyIncremental(ldb, id.Root, key[:], tampered); err == nil {
+		t.Errorf("tampered proof accepted")
+	}
+	// Nodes missing from both the cache and the proof fail the verification
+	if _, err := verifyIncremental(ldb, id.Root, key[:], proof[:len(proof)-1]); err == nil {
+		t.Errorf("truncated proof accepted")
+	}
+}
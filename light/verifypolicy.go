@@ -0,0 +1,73 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// VerificationFailurePolicy tells a backend what to do with a response failing
+// verification.
+type VerificationFailurePolicy int
+
+const (
+	// RejectAndRetry discards the response and retries the retrieval from
+	// another source, if the backend has any. This is the default.
+	RejectAndRetry VerificationFailurePolicy = iota
+
+	// RejectAndDiscard discards the response and fails the retrieval.
+	RejectAndDiscard
+
+	// StoreAndFlag fails the retrieval, but keeps the raw response for
+	// debugging. It's stored apart from the verified data, so it's never
+	// served as trusted; see GetUnverified.
+	StoreAndFlag
+)
+
+func (p VerificationFailurePolicy) String() string {
+	switch p {
+	case RejectAndRetry:
+		return "reject-and-retry"
+	case RejectAndDiscard:
+		return "reject-and-discard"
+	case StoreAndFlag:
+		return "store-and-flag"
+	}
+	return "unknown"
+}
+
+var unverifiedPrefix = []byte("light-unverified-") // unverifiedPrefix + request encoding -> raw response
+
+// WriteUnverified stores the raw response to req that failed verification.
+func WriteUnverified(db wtcdb.Putter, req OdrRequest, response []byte) error {
+	key, err := MarshalRequest(req)
+	if err != nil {
+		return err
+	}
+	return db.Put(append(append([]byte{}, unverifiedPrefix...), key...), response)
+}
+
+// GetUnverified returns the raw response to req that failed verification and
+// was flagged by the StoreAndFlag policy, or nil if there is none.
+func GetUnverified(db wtcdb.Database, req OdrRequest) []byte {
+	key, err := MarshalRequest(req)
+	if err != nil {
+		return nil
+	}
+	data, _ := db.Get(append(append([]byte{}, unverifiedPrefix...), key...))
+	return data
+}
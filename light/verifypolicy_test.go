@@ -0,0 +1,53 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// Tests that the responses flagged by WriteUnverified are returned by
+// GetUnverified for the same request only, and are never served as trusted.
+func TestUnverifiedRoundTrip(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+
+	req := &CodeRequest{Id: &TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}, Hash: common.Hash{3}}
+	other := &CodeRequest{Id: &TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}, Hash: common.Hash{4}}
+
+	if data := GetUnverified(db, req); data != nil {
+		t.Fatalf("unflagged response returned: %x", data)
+	}
+	response := []byte("forged code")
+	if err := WriteUnverified(db, req, response); err != nil {
+		t.Fatalf("failed to flag response: %v", err)
+	}
+	// Any request for the same data must find the response
+	same := &CodeRequest{Id: &TrieID{BlockHash: common.Hash{1}, Root: common.Hash{2}}, Hash: common.Hash{3}}
+	if data := GetUnverified(db, same); !bytes.Equal(data, response) {
+		t.Errorf("flagged response mismatch: have %x, want %x", data, response)
+	}
+	if data := GetUnverified(db, other); data != nil {
+		t.Errorf("flagged response returned for another request: %x", data)
+	}
+	if ResolveLocally(db, same) {
+		t.Errorf("flagged response served as trusted")
+	}
+}
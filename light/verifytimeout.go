@@ -0,0 +1,157 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/metrics"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// ErrVerificationTimeout is returned if the verification of a response didn't
+// finish within the VerificationTimeout of the backend configuration.
+var ErrVerificationTimeout = errors.New("response verification timed out")
+
+// verificationTimeoutCounter counts the verifications abandoned for taking too long.
+var verificationTimeoutCounter = metrics.NewCounter("light/odr/verifytimeout")
+
+// VerifyWithTimeout runs verify on a staging view of db, applying the database
+// writes it made only if it succeeded within the VerificationTimeout of the
+// configuration bound to db. A verification that times out is abandoned: it keeps running in the background, but none of
+// its writes ever reach db. Any other state it modifies, like the fields of the
+// request being verified, should not be relied upon after a timeout.
+func VerifyWithTimeout(db wtcdb.Database, verify func(db wtcdb.Database) error) error {
+	timeout := ConfigOf(db).VerificationTimeout
+	if timeout <= 0 {
+		return verify(db)
+	}
+	stage := newStagingDatabase(db)
+	done := make(chan error, 1)
+	go func() { done <- verify(stage) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		return stage.commit()
+	case <-clock.After(timeout):
+		verificationTimeoutCounter.Inc(1)
+		return ErrVerificationTimeout
+	}
+}
+
+// stagingOp is a database write recorded by a staging database.
+type stagingOp struct {
+	key, value []byte
+	del        bool
+}
+
+// stagingDatabase records the writes done to it in memory, serving reads from
+// the recorded writes first and the wrapped database second.
+type stagingDatabase struct {
+	wtcdb.Database
+
+	lock sync.RWMutex
+	ops  []stagingOp
+	mem  map[string][]byte // recorded values, nil for deleted keys
+}
+
+func newStagingDatabase(db wtcdb.Database) *stagingDatabase {
+	return &stagingDatabase{Database: db, mem: make(map[string][]byte)}
+}
+
+// Put records a write of a key.
+func (db *stagingDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	key, value = common.CopyBytes(key), common.CopyBytes(value)
+	if value == nil {
+		value = []byte{}
+	}
+	db.ops = append(db.ops, stagingOp{key: key, value: value})
+	db.mem[string(key)] = value
+	return nil
+}
+
+// Delete records the removal of a key.
+func (db *stagingDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	key = common.CopyBytes(key)
+	db.ops = append(db.ops, stagingOp{key: key, del: true})
+	db.mem[string(key)] = nil
+	return nil
+}
+
+// Get retrieves a recorded value or one from the wrapped database.
+func (db *stagingDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	value, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		if value == nil {
+			return nil, errors.New("not found")
+		}
+		return value, nil
+	}
+	return db.Database.Get(key)
+}
+
+// Has checks whether a key was recorded or is present in the wrapped database.
+func (db *stagingDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	value, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		return value != nil, nil
+	}
+	return db.Database.Has(key)
+}
+
+// Close doesn't close the wrapped database, which is still in use.
+func (db *stagingDatabase) Close() {}
+
+// NewBatch creates a batch recording its entries on Write.
+func (db *stagingDatabase) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: db}
+}
+
+// commit applies the recorded writes to the wrapped database in order.
+func (db *stagingDatabase) commit() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, op := range db.ops {
+		var err error
+		if op.del {
+			err = db.Database.Delete(op.key)
+		} else {
+			err = db.Database.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	db.ops, db.mem = nil, make(map[string][]byte)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// slowRequest is an ODR request taking a while to verify before storing a value.
+type slowRequest struct {
+	OdrRequest
+	delay time.Duration
+}
+
+func (req *slowRequest) StoreResult(db wtcdb.Database) error {
+	time.Sleep(req.delay)
+	return db.Put([]byte("slow"), []byte{1})
+}
+
+func TestVerificationTimeout(t *testing.T) {
+	mdb, _ := wtcdb.NewMemDatabase()
+	db := BindConfig(mdb, &Config{VerificationTimeout: 20 * time.Millisecond})
+	if err := VerifyWithTimeout(db, (&slowRequest{delay: time.Second}).StoreResult); err != ErrVerificationTimeout {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrVerificationTimeout)
+	}
+	if ok, _ := db.Has([]byte("slow")); ok {
+		t.Errorf("write of abandoned verification stored")
+	}
+	// Verifications finishing in time have their writes applied
+	if err := VerifyWithTimeout(db, (&slowRequest{}).StoreResult); err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if ok, _ := db.Has([]byte("slow")); !ok {
+		t.Errorf("write of finished verification not stored")
+	}
+}
+
+func TestVerificationTimeoutStaging(t *testing.T) {
+	db, _ := wtcdb.NewMemDatabase()
+	db.Put([]byte("old"), []byte{1})
+
+	// Writes are visible to the verifier, but only applied once it succeeded
+	err := VerifyWithTimeout(db, func(stage wtcdb.Database) error {
+		stage.Delete([]byte("old"))
+		batch := stage.NewBatch()
+		batch.Put([]byte("new"), []byte{2})
+		batch.Write()
+		if ok, _ := stage.Has([]byte("old")); ok {
+			t.Errorf("deleted key visible")
+		}
+		if v, _ := stage.Get([]byte("new")); len(v) != 1 || v[0] != 2 {
+			t.Errorf("batch write not visible: %x", v)
+		}
+		if ok, _ := db.Has([]byte("new")); ok {
+			t.Errorf("write applied before verification finished")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if ok, _ := db.Has([]byte("old")); ok {
+		t.Errorf("delete not applied")
+	}
+	if ok, _ := db.Has([]byte("new")); !ok {
+		t.Errorf("write not applied")
+	}
+	// Failed verifications have no effect
+	VerifyWithTimeout(db, func(stage wtcdb.Database) error {
+		stage.Put([]byte("bad"), []byte{3})
+		return ErrMalformedResponse
+	})
+	if ok, _ := db.Has([]byte("bad")); ok {
+		t.Errorf("write of failed verification applied")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/log"
+	"github.com/wtc/go-wtc/metrics"
+)
+
+// ErrRetrievalStuck is returned by a retrieval force-cancelled by the watchdog.
+var ErrRetrievalStuck = errors.New("retrieval stuck")
+
+var stuckRetrievalCounter = metrics.NewCounter("light/odr/stuck")
+
+// WatchdogConfig contains the settings of a retrieval watchdog.
+type WatchdogConfig struct {
+	Interval    time.Duration // Time between two checks of the running retrievals
+	MaxLifetime time.Duration // Time after which a running retrieval is considered stuck
+	Cancel      bool          // Whether to force-cancel stuck retrievals
+}
+
+// DefaultWatchdogConfig only reports stuck retrievals, leaving their handling
+// to the timeouts of the callers.
+var DefaultWatchdogConfig = WatchdogConfig{
+	Interval:    10 * time.Second,
+	MaxLifetime: time.Minute,
+}
+
+// watchedRetrieval is a retrieval in flight through a watchdog.
+type watchedRetrieval struct {
+	req      OdrRequest
+	start    time.Time
+	cancel   context.CancelFunc
+	reported bool
+	stuck    bool
+}
+
+// WatchdogOdr wraps an OdrBackend, periodically checking for retrievals that
+// neither completed nor failed within a sane time. Such retrievals are logged,
+// counted and optionally force-cancelled, acting as a safety net for bugs in the
+// network layer beyond the timeouts of individual requests.
+type WatchdogOdr struct {
+	OdrBackend
+	config WatchdogConfig
+
+	lock   sync.Mutex
+	active map[*watchedRetrieval]struct{}
+	stuck  uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewWatchdogOdr creates a watchdog around backend and starts monitoring.
+func NewWatchdogOdr(backend OdrBackend, config WatchdogConfig) *WatchdogOdr {
+	odr := &WatchdogOdr{
+		OdrBackend: backend,
+		config:     config,
+		active:     make(map[*watchedRetrieval]struct{}),
+		quit:       make(chan struct{}),
+	}
+	odr.wg.Add(1)
+	go odr.loop()
+	return odr
+}
+
+// Stop terminates the monitoring loop. Running retrievals are not affected.
+func (odr *WatchdogOdr) Stop() {
+	close(odr.quit)
+	odr.wg.Wait()
+}
+
+// Stuck returns the number of stuck retrievals detected so far.
+func (odr *WatchdogOdr) Stuck() uint64 {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	return odr.stuck
+}
+
+// Config returns the configuration of the wrapped backend.
+func (odr *WatchdogOdr) Config() *Config {
+	return BackendConfig(odr.OdrBackend)
+}
+
+// Retrieve retrieves req through the wrapped backend under monitoring.
+func (odr *WatchdogOdr) Retrieve(ctx context.Context, req OdrRequest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &watchedRetrieval{req: req, start: clock.Now(), cancel: cancel}
+	odr.lock.Lock()
+	odr.active[r] = struct{}{}
+	odr.lock.Unlock()
+
+	err := odr.OdrBackend.Retrieve(ctx, req)
+
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+	delete(odr.active, r)
+	if r.stuck {
+		return ErrRetrievalStuck
+	}
+	return err
+}
+
+func (odr *WatchdogOdr) loop() {
+	defer odr.wg.Done()
+
+	for {
+		select {
+		case <-clock.After(odr.config.Interval):
+			odr.check()
+		case <-odr.quit:
+			return
+		}
+	}
+}
+
+// check reports (and if configured cancels) the retrievals running for longer
+// than the maximum lifetime.
+func (odr *WatchdogOdr) check() {
+	odr.lock.Lock()
+	defer odr.lock.Unlock()
+
+	for r := range odr.active {
+		elapsed := since(r.start)
+		if r.reported || elapsed < odr.config.MaxLifetime {
+			continue
+		}
+		r.reported = true
+		odr.stuck++
+		stuckRetrievalCounter.Inc(1)
+		log.Warn("Stuck ODR retrieval detected", "kind", KindOf(r.req), "elapsed", common.PrettyDuration(elapsed), "cancel", odr.config.Cancel)
+
+		if odr.config.Cancel {
+			r.stuck = true
+			r.cancel()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchdogCancel(t *testing.T) {
+	odr := NewWatchdogOdr(newHangingOdr(), WatchdogConfig{
+		Interval:    10 * time.Millisecond,
+		MaxLifetime: 50 * time.Millisecond,
+		Cancel:      true,
+	})
+	defer odr.Stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- odr.Retrieve(context.Background(), &TrieRequest{}) }()
+	select {
+	case err := <-errc:
+		if err != ErrRetrievalStuck {
+			t.Fatalf("error mismatch: have %v, want %v", err, ErrRetrievalStuck)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("stuck retrieval not cancelled")
+	}
+	if n := odr.Stuck(); n != 1 {
+		t.Fatalf("stuck count mismatch: have %d, want 1", n)
+	}
+}
+
+func TestWatchdogReportOnly(t *testing.T) {
+	odr := NewWatchdogOdr(newHangingOdr(), WatchdogConfig{
+		Interval:    10 * time.Millisecond,
+		MaxLifetime: 20 * time.Millisecond,
+	})
+	defer odr.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- odr.Retrieve(ctx, &TrieRequest{}) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := odr.Stuck(); n != 1 {
+		t.Fatalf("stuck count mismatch: have %d, want 1", n)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("retrieval cancelled in report only mode: %v", err)
+	default:
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("error mismatch: have %v, want %v", err, context.Canceled)
+	}
+}
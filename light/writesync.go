@@ -0,0 +1,206 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync"
+
+	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+// WriteSync tells for each request kind whether the results of its requests
+// are written to disk synchronously. Kinds missing from the map are written
+// through a memory buffer.
+type WriteSync map[RequestKind]bool
+
+// DefaultWriteSync writes headers, canonical hashes and the header fields proven
+// through the CHT synchronously, everything else is buffered.
+//
+// Buffered writes are lost if the process crashes before they are flushed. This
+// is harmless for trie nodes, code, bodies and receipts: they are verified
+// against a header before being stored and are simply retrieved again when
+// needed. Canonical hashes on the other hand are assumed to always have their
+// header present, so all results storing headers or canonical hashes should be
+// kept in the same class.
+var DefaultWriteSync = WriteSync{
+	KindCht:           true,
+	KindHeader:        true,
+	KindBatchHeader:   true,
+	KindHeaderSegment: true,
+	KindStateRoot:     true,
+	KindBlockBloom:    true,
+}
+
+// syncPutter is implemented by databases able to do durable writes.
+type syncPutter interface {
+	PutSync(key []byte, value []byte) error
+}
+
+// BufferedDatabase wraps a database, storing the results of ODR requests either
+// synchronously or through a write buffer, depending on the request kind. Reads
+// see the buffered entries. Writes not belonging to a request go directly to
+// the wrapped database.
+type BufferedDatabase struct {
+	wtcdb.Database
+	sync WriteSync
+
+	lock  sync.RWMutex
+	mem   map[string][]byte
+	batch wtcdb.Batch
+}
+
+// NewBufferedDatabase creates a buffering wrapper around db.
+func NewBufferedDatabase(db wtcdb.Database, sync WriteSync) *BufferedDatabase {
+	return &BufferedDatabase{
+		Database: db,
+		sync:     sync,
+		mem:      make(map[string][]byte),
+		batch:    db.NewBatch(),
+	}
+}
+
+// Put writes a value to the wrapped database, updating the buffer too if the
+// key has a pending write.
+func (db *BufferedDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	if _, ok := db.mem[string(key)]; ok {
+		db.mem[string(key)] = common.CopyBytes(value)
+		db.batch.Put(key, value)
+	}
+	db.lock.Unlock()
+	return db.Database.Put(key, value)
+}
+
+// Get retrieves a value from the buffer or the wrapped database.
+func (db *BufferedDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	value, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		return value, nil
+	}
+	return db.Database.Get(key)
+}
+
+// Has checks whether a key is present in the buffer or the wrapped database.
+func (db *BufferedDatabase) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	_, ok := db.mem[string(key)]
+	db.lock.RUnlock()
+	if ok {
+		return true, nil
+	}
+	return db.Database.Has(key)
+}
+
+// Delete flushes pending writes and removes a key from the wrapped database.
+func (db *BufferedDatabase) Delete(key []byte) error {
+	if err := db.Flush(); err != nil {
+		return err
+	}
+	return db.Database.Delete(key)
+}
+
+// Close flushes pending writes and closes the wrapped database.
+func (db *BufferedDatabase) Close() {
+	db.Flush()
+	db.Database.Close()
+}
+
+// Flush writes the buffered entries to the wrapped database.
+func (db *BufferedDatabase) Flush() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.flush()
+}
+
+// flush writes the buffered entries, assuming the write lock is held.
+func (db *BufferedDatabase) flush() error {
+	if len(db.mem) == 0 {
+		return nil
+	}
+	if err := db.batch.Write(); err != nil {
+		return err
+	}
+	db.mem = make(map[string][]byte)
+	db.batch = db.Database.NewBatch()
+	return nil
+}
+
+// ForRequest implements RequestDatabase, returning a synchronous or buffered
+// view depending on the kind of req.
+func (db *BufferedDatabase) ForRequest(req OdrRequest) wtcdb.Database {
+	if db.sync[KindOf(req)] {
+		return &syncView{db}
+	}
+	return &bufferedView{db}
+}
+
+// syncView stores the results of a request durably.
+type syncView struct {
+	*BufferedDatabase
+}
+
+// Put writes a value to the wrapped database, waiting for it to reach stable
+// storage if the database supports it.
+func (v *syncView) Put(key []byte, value []byte) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if _, ok := v.mem[string(key)]; ok {
+		// Drop the older pending write so a later flush can't override this one
+		delete(v.mem, string(key))
+		v.batch = v.Database.NewBatch()
+		for k, pending := range v.mem {
+			v.batch.Put([]byte(k), pending)
+		}
+	}
+	if db, ok := v.Database.(syncPutter); ok {
+		return db.PutSync(key, value)
+	}
+	return v.Database.Put(key, value)
+}
+
+// NewBatch creates a batch storing its entries durably on Write.
+func (v *syncView) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: v}
+}
+
+// bufferedView stores the results of a request in the write buffer.
+type bufferedView struct {
+	*BufferedDatabase
+}
+
+// Put adds a value to the write buffer, flushing it if it grew too large.
+func (v *bufferedView) Put(key []byte, value []byte) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.mem[string(key)] = common.CopyBytes(value)
+	v.batch.Put(key, value)
+	if v.batch.ValueSize() >= wtcdb.IdealBatchSize {
+		return v.flush()
+	}
+	return nil
+}
+
+// NewBatch creates a batch adding its entries to the write buffer on Write.
+func (v *bufferedView) NewBatch() wtcdb.Batch {
+	return &viewBatch{db: v}
+}
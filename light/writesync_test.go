@@ -0,0 +1,92 @@
+// Copyright 2015 The go-wtc Authors
+// This file is part of the go-wtc library.
+//
+// The go-wtc library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-wtc library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-wtc library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/wtc/go-wtc/core"
+	"github.com/wtc/go-wtc/crypto"
+	"github.com/wtc/go-wtc/trie"
+	"github.com/wtc/go-wtc/wtcdb"
+)
+
+func TestBufferedDatabaseCrash(t *testing.T) {
+	sdb, _ := wtcdb.NewMemDatabase()
+	genesis := new(core.Genesis).MustCommit(sdb)
+	headers := makeTestHeaders(genesis.Header(), 4)
+	root := makeTestCht(sdb, headers)
+	cht, _ := trie.New(root, sdb)
+
+	disk, _ := wtcdb.NewMemDatabase()
+	db := NewBufferedDatabase(disk, DefaultWriteSync)
+
+	chtReq := &ChtRequest{ChtRoot: root, BlockNum: 2, Header: headers[1], Td: headers[1].Number, Proof: cht.Prove(chtKey(2))}
+	if err := chtReq.StoreResult(StoreDatabase(db, chtReq)); err != nil {
+		t.Fatalf("failed to store cht result: %v", err)
+	}
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	codeReq := &CodeRequest{Hash: crypto.Keccak256Hash(code), Data: code}
+	if err := codeReq.StoreResult(StoreDatabase(db, codeReq)); err != nil {
+		t.Fatalf("failed to store code result: %v", err)
+	}
+	if data, _ := db.Get(codeReq.Hash[:]); !bytes.Equal(data, code) {
+		t.Errorf("buffered code not readable: have %x, want %x", data, code)
+	}
+	// Simulate a crash by dropping the buffer, only sync writes should be on disk
+	if hash := core.GetCanonicalHash(disk, 2); hash != headers[1].Hash() {
+		t.Errorf("canonical hash lost: have %x, want %x", hash, headers[1].Hash())
+	}
+	if header := core.GetHeader(disk, headers[1].Hash(), 2); header == nil {
+		t.Errorf("header lost")
+	}
+	if ok, _ := disk.Has(codeReq.Hash[:]); ok {
+		t.Errorf("buffered code written before flush")
+	}
+	// Flushing should persist the buffered writes
+	if err := db.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if data, _ := disk.Get(codeReq.Hash[:]); !bytes.Equal(data, code) {
+		t.Errorf("flushed code mismatch: have %x, want %x", data, code)
+	}
+}
+
+func TestBufferedDatabaseSyncOverride(t *testing.T) {
+	disk, _ := wtcdb.NewMemDatabase()
+	db := NewBufferedDatabase(disk, DefaultWriteSync)
+
+	buffered := StoreDatabase(db, &CodeRequest{})
+	buffered.Put([]byte("key"), []byte("old"))
+
+	// A synchronous write must not be overridden by the older buffered one, even
+	// if it emptied the buffer and later writes are flushed along with it
+	if err := StoreDatabase(db, &ChtRequest{}).Put([]byte("key"), []byte("new")); err != nil {
+		t.Fatalf("failed to write synchronously: %v", err)
+	}
+	buffered.Put([]byte("other"), []byte("pending"))
+	if err := db.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if data, _ := disk.Get([]byte("key")); !bytes.Equal(data, []byte("new")) {
+		t.Errorf("synchronous write overridden: have %q, want %q", data, "new")
+	}
+	if data, _ := disk.Get([]byte("other")); !bytes.Equal(data, []byte("pending")) {
+		t.Errorf("unrelated buffered write lost: have %q, want %q", data, "pending")
+	}
+}
@@ -74,6 +74,34 @@ func NewTimer(name string) metrics.Timer {
 	return metrics.GetOrRegisterTimer(name, metrics.DefaultRegistry)
 }
 
+// NewHistogram create a new metrics Histogram, either a real one of a NOP stub
+// depending on the metrics flag. Samples are kept in an exponentially decaying
+// reservoir biased towards the last five minutes.
+func NewHistogram(name string) metrics.Histogram {
+	if !Enabled {
+		return new(metrics.NilHistogram)
+	}
+	return metrics.GetOrRegisterHistogram(name, metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015))
+}
+
+// NewGauge create a new metrics Gauge, either a real one of a NOP stub depending
+// on the metrics flag.
+func NewGauge(name string) metrics.Gauge {
+	if !Enabled {
+		return new(metrics.NilGauge)
+	}
+	return metrics.GetOrRegisterGauge(name, metrics.DefaultRegistry)
+}
+
+// NewGaugeFloat64 create a new metrics GaugeFloat64, either a real one of a NOP
+// stub depending on the metrics flag.
+func NewGaugeFloat64(name string) metrics.GaugeFloat64 {
+	if !Enabled {
+		return new(metrics.NilGaugeFloat64)
+	}
+	return metrics.GetOrRegisterGaugeFloat64(name, metrics.DefaultRegistry)
+}
+
 // CollectProcessMetrics periodically collects various metrics about the running
 // process.
 func CollectProcessMetrics(refresh time.Duration) {
@@ -36,7 +36,31 @@ import (
 // contains all nodes of the longest existing prefix of the key
 // (at least the root node), ending with the node that proves the
 // absence of the key.
+//
+// The proof is minimal: siblings of the path are only represented by
+// their hashes in the path nodes, and nodes embedded in their parents
+// aren't repeated, so no smaller set of nodes proves the key.
 func (t *Trie) Prove(key []byte) []rlp.RawValue {
+	proof, err := t.prove(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
+		return nil
+	}
+	return proof
+}
+
+// ProvePrefix is like Prove, but tolerates nodes missing from the database. If
+// a node on the path to key can't be resolved, the proof nodes leading up to it
+// are returned along with complete set to false.
+func (t *Trie) ProvePrefix(key []byte) (proof []rlp.RawValue, complete bool) {
+	proof, err := t.prove(key)
+	if _, ok := err.(*MissingNodeError); ok {
+		return proof, false
+	}
+	return proof, err == nil
+}
+
+func (t *Trie) prove(key []byte) ([]rlp.RawValue, error) {
 	// Collect all nodes on the path to key.
 	key = keybytesToHex(key)
 	nodes := []node{}
@@ -60,13 +84,17 @@ func (t *Trie) Prove(key []byte) []rlp.RawValue {
 			var err error
 			tn, err = t.resolveHash(n, nil)
 			if err != nil {
-				log.Error(fmt.Sprintf("Unhandled trie error: %v", err))
-				return nil
+				return encodeProof(nodes), err
 			}
 		default:
 			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
 		}
 	}
+	return encodeProof(nodes), nil
+}
+
+// encodeProof converts the nodes on a path into their proof encoding.
+func encodeProof(nodes []node) []rlp.RawValue {
 	hasher := newHasher(0, 0)
 	proof := make([]rlp.RawValue, 0, len(nodes))
 	for i, n := range nodes {
@@ -24,7 +24,9 @@ import (
 	"time"
 
 	"github.com/wtc/go-wtc/common"
+	"github.com/wtc/go-wtc/crypto"
 	"github.com/wtc/go-wtc/rlp"
+	"github.com/wtc/go-wtc/wtcdb"
 )
 
 func init() {
@@ -49,6 +51,43 @@ func TestProof(t *testing.T) {
 	}
 }
 
+func TestProvePrefix(t *testing.T) {
+	trie, vals := randomTrie(500)
+	db, _ := wtcdb.NewMemDatabase()
+	root, _ := trie.CommitTo(db)
+
+	for _, kv := range vals {
+		full := trie.Prove(kv.k)
+		if len(full) < 2 {
+			continue
+		}
+		// Remove the last node of the path and ensure the rest is returned
+		last := crypto.Keccak256(full[len(full)-1])
+		blob, _ := db.Get(last)
+		db.Delete(last)
+
+		partial, _ := New(root, db)
+		proof, complete := partial.ProvePrefix(kv.k)
+		if complete {
+			t.Fatalf("key %x: proof reported complete with missing node", kv.k)
+		}
+		if len(proof) != len(full)-1 {
+			t.Fatalf("key %x: prefix length mismatch: have %d, want %d", kv.k, len(proof), len(full)-1)
+		}
+		for i := range proof {
+			if !bytes.Equal(proof[i], full[i]) {
+				t.Fatalf("key %x: prefix node %d mismatch", kv.k, i)
+			}
+		}
+		db.Put(last, blob)
+		if proof, complete := partial.ProvePrefix(kv.k); !complete || len(proof) != len(full) {
+			t.Fatalf("key %x: restored proof incomplete", kv.k)
+		}
+		return
+	}
+	t.Fatalf("no key with a multi node proof")
+}
+
 func TestOneElementProof(t *testing.T) {
 	trie := new(Trie)
 	updateString(trie, "k", "v")
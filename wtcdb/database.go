@@ -29,6 +29,7 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -109,6 +110,18 @@ func (db *LDBDatabase) Put(key []byte, value []byte) error {
 	return db.db.Put(key, value, nil)
 }
 
+// PutSync puts the given key / value to the queue and waits for the write to be
+// flushed to stable storage before returning
+func (db *LDBDatabase) PutSync(key []byte, value []byte) error {
+	if db.putTimer != nil {
+		defer db.putTimer.UpdateSince(time.Now())
+	}
+	if db.writeMeter != nil {
+		db.writeMeter.Mark(int64(len(value)))
+	}
+	return db.db.Put(key, value, &opt.WriteOptions{Sync: true})
+}
+
 func (db *LDBDatabase) Has(key []byte) (bool, error) {
 	return db.db.Has(key, nil)
 }
@@ -169,6 +182,13 @@ func (db *LDBDatabase) Close() {
 	}
 }
 
+// Compact flattens the underlying data store for the given key range. A nil
+// start is treated as a key before all keys and a nil limit as a key after all
+// keys.
+func (db *LDBDatabase) Compact(start []byte, limit []byte) error {
+	return db.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
 func (db *LDBDatabase) LDB() *leveldb.DB {
 	return db.db
 }